@@ -0,0 +1,636 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/attribution"
+	"github.com/rekuberate-io/power/pkg/carbon"
+	"github.com/rekuberate-io/power/pkg/estimation"
+	_ "github.com/rekuberate-io/power/pkg/influx"
+	"github.com/rekuberate-io/power/pkg/ledger"
+	"github.com/rekuberate-io/power/pkg/metrics"
+	"github.com/rekuberate-io/power/pkg/otlp"
+	_ "github.com/rekuberate-io/power/pkg/output"
+	"github.com/rekuberate-io/power/pkg/plaintext"
+	"github.com/rekuberate-io/power/pkg/readers"
+	"github.com/rekuberate-io/power/pkg/sink"
+
+	"k8s.io/klog/v2"
+)
+
+// sinkSpecs are the sinks of the -sink flags, or of POWER_SINKS separated by semicolons
+var sinkSpecs = stringList{values: envList("POWER_SINKS", ";")}
+
+func init() {
+	flag.Var(&sinkSpecs, "sink", fmt.Sprintf("sink to feed, name[:target][,key=value...], e.g. influx:/var/log/power.lp,policy=drop-newest, can be repeated; registered: %s [POWER_SINKS]", strings.Join(sink.Registered(), ", ")))
+}
+
+// Every flag can also be set through its environment variable, flags take precedence
+var (
+	listenAddress   = flag.String("listen-address", env("POWER_LISTEN_ADDRESS", ":9102"), "address to serve the http endpoints on [POWER_LISTEN_ADDRESS]")
+	interval        = flag.Duration("interval", envDuration("POWER_INTERVAL", 5*time.Second), "sampling interval [POWER_INTERVAL]")
+	strategy        = flag.String("strategy", env("POWER_STRATEGY", readers.StrategyAuto.String()), "comma separated, ordered list of rapl reader strategies to try: auto, sysfs, perf, msr, model [POWER_STRATEGY]")
+	nodeName        = flag.String("node-name", env("NODE_NAME", ""), "name of the node the agent runs on, defaults to the hostname [NODE_NAME]")
+	sysfsRoot       = flag.String("sysfs-root", env("POWER_SYSFS_ROOT", ""), "read the powercap zones from a sysfs tree mounted elsewhere, implies the sysfs strategy [POWER_SYSFS_ROOT]")
+	record          = flag.String("record", env("POWER_RECORD", ""), "record every raw read of the counters to this file, for a later replay [POWER_RECORD]")
+	replay          = flag.String("replay", env("POWER_REPLAY", ""), "play back a recording instead of reading the counters [POWER_REPLAY]")
+	replaySpeed     = flag.Float64("replay-speed", envFloat("POWER_REPLAY_SPEED", 1), "speed of the playback, 1 is the recorded pace [POWER_REPLAY_SPEED]")
+	attributePods   = flag.Bool("pod-attribution", envBool("POWER_POD_ATTRIBUTION", false), "attribute the node energy to kubernetes pods and containers by their cgroup cpu usage [POWER_POD_ATTRIBUTION]")
+	cgroupRoot      = flag.String("cgroup-root", env("POWER_CGROUP_ROOT", "/sys/fs/cgroup"), "mount point of the cgroup hierarchies [POWER_CGROUP_ROOT]")
+	podGrace        = flag.Duration("pod-eviction-grace", envDuration("POWER_POD_EVICTION_GRACE", attribution.DefaultEvictionGrace), "how long the totals of a pod or container are kept after its cgroup is gone [POWER_POD_EVICTION_GRACE]")
+	procRoot        = flag.String("proc-root", env("POWER_PROC_ROOT", "/proc"), "mount point of procfs [POWER_PROC_ROOT]")
+	estimationModel = flag.String("estimation-model", env("POWER_ESTIMATION_MODEL", ""), "json file with the component and psu models to estimate the wall power [POWER_ESTIMATION_MODEL]")
+	idleModel       = flag.String("idle-model", env("POWER_IDLE_MODEL", ""), "idle power model persisted by the calibrate command [POWER_IDLE_MODEL]")
+	idleMode        = flag.String("idle-mode", env("POWER_IDLE_MODE", attribution.IdleToSystem.String()), "how pod attribution charges the idle power of the model: system, even [POWER_IDLE_MODE]")
+	carbonIntensity = flag.Float64("carbon-intensity", envFloat("POWER_CARBON_INTENSITY", 0), "static carbon intensity of the grid in gCO2e/kWh [POWER_CARBON_INTENSITY]")
+	carbonSeries    = flag.String("carbon-series", env("POWER_CARBON_SERIES", ""), "csv file of 'timestamp,intensity' rows with the carbon intensity of the grid [POWER_CARBON_SERIES]")
+	carbonUrl       = flag.String("carbon-url", env("POWER_CARBON_URL", ""), "json http endpoint reporting the carbon intensity of the grid [POWER_CARBON_URL]")
+	ledgerPath      = flag.String("ledger", env("POWER_LEDGER", ""), "file to checkpoint the energy totals to, so that they survive restarts of the agent [POWER_LEDGER]")
+	ledgerInterval  = flag.Duration("ledger-interval", envDuration("POWER_LEDGER_INTERVAL", 1*time.Minute), "interval between two checkpoints of the ledger [POWER_LEDGER_INTERVAL]")
+	ledgerRetention = flag.Duration("ledger-retention", envDuration("POWER_LEDGER_RETENTION", ledger.DefaultRetention), "how long the ledger keeps the hourly totals the report command reads [POWER_LEDGER_RETENTION]")
+	otlpEndpoint    = flag.String("otlp-endpoint", env("POWER_OTLP_ENDPOINT", ""), "push the energy and power as OpenTelemetry metrics to this OTLP/HTTP collector, e.g. http://localhost:4318 [POWER_OTLP_ENDPOINT]")
+	otlpEncoding    = flag.String("otlp-encoding", env("POWER_OTLP_ENCODING", otlp.Protobuf.String()), "encoding of the OTLP requests: protobuf, json [POWER_OTLP_ENCODING]")
+	otlpInterval    = flag.Duration("otlp-interval", envDuration("POWER_OTLP_INTERVAL", 30*time.Second), "interval between two OTLP exports [POWER_OTLP_INTERVAL]")
+	otlpHeaders     = flag.String("otlp-headers", env("POWER_OTLP_HEADERS", ""), "comma separated key=value headers added to the OTLP requests [POWER_OTLP_HEADERS]")
+	statsdAddress   = flag.String("statsd-address", env("POWER_STATSD_ADDRESS", ""), "write the power and energy to this statsd daemon, e.g. udp://localhost:8125 [POWER_STATSD_ADDRESS]")
+	graphiteAddress = flag.String("graphite-address", env("POWER_GRAPHITE_ADDRESS", ""), "write the power and energy to this graphite plaintext listener, e.g. tcp://localhost:2003 [POWER_GRAPHITE_ADDRESS]")
+	metricTemplate  = flag.String("metric-template", env("POWER_METRIC_TEMPLATE", plaintext.DefaultTemplate), "name of the statsd and graphite metrics, <host>, <package>, <die>, <domain> and <metric> are replaced [POWER_METRIC_TEMPLATE]")
+	plainInterval   = flag.Duration("plaintext-interval", envDuration("POWER_PLAINTEXT_INTERVAL", 10*time.Second), "interval between two writes to statsd and graphite [POWER_PLAINTEXT_INTERVAL]")
+	influxOutput    = flag.String("influx-destination", env("POWER_INFLUX_DESTINATION", ""), "write InfluxDB line protocol to - (stdout), a file, or an http write endpoint, e.g. http://localhost:8086/api/v2/write?org=o&bucket=power [POWER_INFLUX_DESTINATION]")
+	influxToken     = flag.String("influx-token", env("POWER_INFLUX_TOKEN", ""), "token sent as the Authorization header of the influx writes [POWER_INFLUX_TOKEN]")
+	sinkBuffer      = flag.Int("sink-buffer", envInt("POWER_SINK_BUFFER", 16), "samples buffered for the sink dispatcher, the sampler waits for it once they are full instead of dropping samples before the buffers of the sinks [POWER_SINK_BUFFER]")
+	influxInterval  = flag.Duration("influx-interval", envDuration("POWER_INFLUX_INTERVAL", 10*time.Second), "interval between two influx writes [POWER_INFLUX_INTERVAL]")
+	pue             = flag.Float64("pue", envFloat("POWER_PUE", 1), "power usage effectiveness of the facility, multiplies the energy for the carbon estimation [POWER_PUE]")
+)
+
+func main() {
+	klog.InitFlags(nil)
+	flag.Parse()
+
+	if *nodeName == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			klog.Fatalln(err)
+		}
+
+		*nodeName = hostname
+	}
+
+	raplReader, err := newRaplReader()
+	if err != nil {
+		klog.Fatalln(err)
+	}
+
+	// the ledger compares the counters of the reader, not of the recorder wrapping it
+	measuredReader := raplReader
+
+	if *record != "" {
+		recorder, err := readers.CreateRecording(*record, raplReader)
+		if err != nil {
+			klog.Fatalln(err)
+		}
+		defer func(recorder *readers.Recorder) {
+			err := recorder.Close()
+			if err != nil {
+				klog.Errorln(err)
+			}
+		}(recorder)
+
+		raplReader = recorder
+	}
+
+	sampler := readers.NewSampler(raplReader, *interval)
+	// a replay describes the recorded machine
+	agent := &agent{node: *nodeName, sampler: sampler, cpus: readers.TopologyOf(measuredReader)}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if *attributePods {
+		agent.cgroupAttributor = attribution.NewCgroupAttributor(attribution.CgroupFS{Root: *cgroupRoot}, attribution.ProcFS{Root: *procRoot})
+		agent.cgroupAttributor.EvictionGrace = *podGrace
+
+		if *idleModel != "" {
+			agent.cgroupAttributor.Idle, err = newIdlePolicy()
+			if err != nil {
+				klog.Fatalln(err)
+			}
+		}
+
+		// a dropped sample would be missing from the totals of the pods, the attribution holds up the sampler instead
+		go agent.attribute(sampler.SubscribeBlocking(1))
+	}
+
+	carbonConfig := carbon.Config{Intensity: *carbonIntensity, SeriesPath: *carbonSeries, URL: *carbonUrl, PUE: *pue}
+	if carbonConfig.Enabled() {
+		estimator, err := carbon.NewEstimator(carbonConfig)
+		if err != nil {
+			klog.Fatalln(err)
+		}
+
+		agent.carbonAccumulator = carbon.NewAccumulator(estimator)
+		// the samples taken during a slow fetch of the intensity are buffered, the sampler only waits once the buffer is
+		// full, so that no energy is missing from the emissions
+		go agent.estimateCarbon(ctx, sampler.SubscribeBlocking(64))
+	}
+
+	if *estimationModel != "" {
+		model, err := estimation.LoadModel(*estimationModel)
+		if err != nil {
+			klog.Fatalln(err)
+		}
+
+		agent.estimator = estimation.NewEstimator(model)
+		agent.estimator.Probe = &estimation.Probe{ProcRoot: *procRoot}
+
+		// the utilization of the first sample is relative to the priming, and no sample may be skipped for the
+		// utilization to cover the interval of the next one
+		err = agent.estimator.Prime()
+		if err != nil {
+			klog.Fatalln(err)
+		}
+		go agent.estimate(sampler.SubscribeBlocking(1))
+	}
+
+	ledgerDone := make(chan struct{})
+	if *ledgerPath != "" {
+		agent.ledger, err = ledger.Open(*ledgerPath, measuredReader)
+		if err != nil {
+			klog.Fatalln(err)
+		}
+		agent.ledger.Retention = *ledgerRetention
+
+		go func(samples <-chan readers.Sample) {
+			defer close(ledgerDone)
+
+			err := agent.ledger.Run(ctx, samples, *ledgerInterval)
+			if err != nil {
+				klog.Errorln(err)
+			}
+		}(sampler.Subscribe(1))
+	} else {
+		close(ledgerDone)
+	}
+
+	topology := sink.NewTopology(*nodeName, measuredReader, agent.cpus)
+	agent.dispatcher, err = newDispatcher(topology)
+	if err != nil {
+		klog.Fatalln(err)
+	}
+	if *sinkBuffer < 0 {
+		klog.Fatalf("invalid sink buffer %d, expected zero or more samples", *sinkBuffer)
+	}
+
+	sinksDone := make(chan struct{})
+	if agent.dispatcher.Len() > 0 {
+		go func(samples <-chan readers.Sample) {
+			defer close(sinksDone)
+
+			err := agent.dispatcher.Run(ctx, samples, topology)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				klog.Errorln(err)
+			}
+		}(sampler.SubscribeBlocking(*sinkBuffer))
+	} else {
+		close(sinksDone)
+	}
+
+	server := &http.Server{
+		Addr:    *listenAddress,
+		Handler: agent.routes(),
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err := server.Shutdown(shutdownCtx)
+		if err != nil {
+			klog.Errorln(err)
+		}
+	}()
+
+	go func() {
+		err := sampler.Run(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			klog.Errorln(err)
+		}
+	}()
+
+	klog.Infof("starting rapl agent on %s { reader: %s, interval: %s, address: %s }", *nodeName, readers.StrategyName(raplReader), *interval, *listenAddress)
+
+	err = server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		klog.Fatalln(err)
+	}
+
+	// the ledger checkpoints and the sinks flush a last time on the way out
+	<-ledgerDone
+	<-sinksDone
+
+	klog.Infoln("stopped rapl agent")
+}
+
+func newRaplReader() (readers.RaplReader, error) {
+	if *replay != "" {
+		raplReader, err := readers.NewReplayReader(*replay, *replaySpeed)
+		if err != nil {
+			return nil, err
+		}
+
+		return raplReader, nil
+	}
+
+	if *sysfsRoot != "" {
+		raplReader := &readers.Sysfs{Root: *sysfsRoot}
+		if diagnosis := raplReader.Diagnose(); !diagnosis.Usable() {
+			return nil, fmt.Errorf("sysfs tree at %s is not usable: %s", *sysfsRoot, diagnosis)
+		}
+
+		return raplReader, nil
+	}
+
+	raplReaderStrategies, err := readers.ParseRaplReaderStrategies(*strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	return readers.NewRaplReader(raplReaderStrategies...)
+}
+
+func newIdlePolicy() (attribution.IdlePolicy, error) {
+	mode, err := attribution.ParseIdleMode(*idleMode)
+	if err != nil {
+		return attribution.IdlePolicy{}, err
+	}
+
+	model, err := attribution.LoadIdleModel(*idleModel)
+	if err != nil {
+		return attribution.IdlePolicy{}, err
+	}
+
+	return attribution.IdlePolicy{Model: &model, Mode: mode}, nil
+}
+
+// newDispatcher creates the sinks of the -sink flags and of the flags of the built-in exporters
+func newDispatcher(topology sink.Topology) (*sink.Dispatcher, error) {
+	var specs []sink.Spec
+	for _, s := range sinkSpecs.values {
+		spec, err := sink.ParseSpec(s)
+		if err != nil {
+			return nil, err
+		}
+
+		specs = append(specs, spec)
+	}
+
+	if *otlpEndpoint != "" {
+		params := map[string]string{"encoding": *otlpEncoding}
+		for _, header := range strings.Split(*otlpHeaders, ",") {
+			if strings.TrimSpace(header) == "" {
+				continue
+			}
+
+			key, value, found := strings.Cut(header, "=")
+			if !found {
+				return nil, fmt.Errorf("invalid otlp header %q, expected key=value", header)
+			}
+			params["header."+strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+
+		specs = append(specs, sink.Spec{
+			Name:    "otlp",
+			Config:  sink.Config{Target: *otlpEndpoint, Params: params},
+			Options: sink.Options{FlushInterval: *otlpInterval},
+		})
+	}
+
+	for name, address := range map[string]string{"statsd": *statsdAddress, "graphite": *graphiteAddress} {
+		if address != "" {
+			specs = append(specs, sink.Spec{
+				Name:    name,
+				Config:  sink.Config{Target: address, Params: map[string]string{"template": *metricTemplate}},
+				Options: sink.Options{FlushInterval: *plainInterval},
+			})
+		}
+	}
+
+	if *influxOutput != "" {
+		specs = append(specs, sink.Spec{
+			Name:    "influx",
+			Config:  sink.Config{Target: *influxOutput, Params: map[string]string{"token": *influxToken}},
+			Options: sink.Options{FlushInterval: *influxInterval},
+		})
+	}
+
+	dispatcher := sink.NewDispatcher()
+	for i, spec := range specs {
+		spec.Config.Topology = topology
+		s, err := sink.New(spec.Name, spec.Config)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s sink: %w", spec.Name, err)
+		}
+
+		// the same kind of sink may be added more than once
+		name := spec.Name
+		for _, stats := range dispatcher.Stats() {
+			if stats.Name == name {
+				name = fmt.Sprintf("%s-%d", spec.Name, i)
+			}
+		}
+
+		err = dispatcher.Add(name, s, spec.Options)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return dispatcher, nil
+}
+
+func env(key string, fallback string) string {
+	if value, exists := os.LookupEnv(key); exists {
+		return value
+	}
+
+	return fallback
+}
+
+func envList(key string, separator string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), separator) {
+		if strings.TrimSpace(value) != "" {
+			values = append(values, strings.TrimSpace(value))
+		}
+	}
+
+	return values
+}
+
+// stringList is a flag that can be repeated, the values of the environment are replaced by the first flag
+type stringList struct {
+	values []string
+	set    bool
+}
+
+func (l *stringList) String() string {
+	return strings.Join(l.values, ";")
+}
+
+func (l *stringList) Set(value string) error {
+	if !l.set {
+		l.values = nil
+		l.set = true
+	}
+
+	l.values = append(l.values, value)
+
+	return nil
+}
+
+func envBool(key string, fallback bool) bool {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		klog.Fatalf("invalid boolean in %s: %s", key, err)
+	}
+
+	return b
+}
+
+func envFloat(key string, fallback float64) float64 {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		klog.Fatalf("invalid number in %s: %s", key, err)
+	}
+
+	return f
+}
+
+func envInt(key string, fallback int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		klog.Fatalf("invalid integer in %s: %s", key, err)
+	}
+
+	return i
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		klog.Fatalf("invalid duration in %s: %s", key, err)
+	}
+
+	return duration
+}
+
+type agent struct {
+	node              string
+	sampler           *readers.Sampler
+	cpus              map[int]*readers.Cpu
+	cgroupAttributor  *attribution.CgroupAttributor
+	carbonAccumulator *carbon.Accumulator
+	estimator         *estimation.Estimator
+	ledger            *ledger.Ledger
+	dispatcher        *sink.Dispatcher
+}
+
+// estimate estimates the wall power of every sample until the sampler stops
+func (a *agent) estimate(samples <-chan readers.Sample) {
+	for sample := range samples {
+		_, err := a.estimator.Estimate(sample)
+		if err != nil {
+			klog.Errorln(err)
+		}
+	}
+}
+
+// estimateCarbon converts every sample to emissions until the sampler stops
+func (a *agent) estimateCarbon(ctx context.Context, samples <-chan readers.Sample) {
+	for sample := range samples {
+		err := a.carbonAccumulator.Add(ctx, sample)
+		if err != nil {
+			klog.Errorln(err)
+		}
+	}
+}
+
+// attribute splits every sample across the kubernetes containers until the sampler stops
+func (a *agent) attribute(samples <-chan readers.Sample) {
+	for sample := range samples {
+		_, err := a.cgroupAttributor.Attribute(sample)
+		if err != nil {
+			klog.Errorln(err)
+		}
+	}
+}
+
+func (a *agent) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", a.metrics)
+	mux.HandleFunc("/energy", a.energy)
+	mux.HandleFunc("/healthz", a.healthz)
+	mux.HandleFunc("/readyz", a.readyz)
+
+	return mux
+}
+
+// metrics serves the energy counters, power gauges and cpu info in the OpenMetrics text format
+func (a *agent) metrics(w http.ResponseWriter, _ *http.Request) {
+	snapshot := metrics.FromSample(a.node, a.sampler.Last(), a.cpus)
+	snapshot.Estimated = readers.IsEstimated(a.sampler.Reader())
+
+	families := snapshot.Families()
+	if a.cgroupAttributor != nil {
+		families = append(families, metrics.CgroupFamilies(a.node, a.cgroupAttributor.Totals())...)
+	}
+	if a.estimator != nil {
+		estimate, wallEnergy := a.estimator.Last()
+		families = append(families, metrics.EstimationFamilies(a.node, estimate, wallEnergy)...)
+	}
+	if a.carbonAccumulator != nil {
+		emissions, intensity := a.carbonAccumulator.Totals()
+		families = append(families, metrics.CarbonFamilies(a.node, emissions, intensity)...)
+	}
+	if a.ledger != nil {
+		families = append(families, metrics.LedgerFamilies(a.node, a.ledger.State())...)
+	}
+	if a.dispatcher != nil && a.dispatcher.Len() > 0 {
+		families = append(families, metrics.SinkFamilies(a.node, a.dispatcher.Stats())...)
+	}
+
+	w.Header().Set("Content-Type", metrics.ContentType)
+	err := metrics.Write(w, families...)
+	if err != nil {
+		klog.Errorln(err)
+	}
+}
+
+type domainValues map[string]float64
+
+type packageReport struct {
+	Package      int64        `json:"package"`
+	EnergyJoules domainValues `json:"energy_joules_total"`
+	PowerWatts   domainValues `json:"power_watts"`
+	// LedgerJoules is the energy since the ledger was created, across restarts, if the agent keeps a ledger
+	LedgerJoules domainValues `json:"ledger_energy_joules_total,omitempty"`
+}
+
+type energyReport struct {
+	Node      string          `json:"node"`
+	Time      time.Time       `json:"time"`
+	Interval  float64         `json:"interval_seconds"`
+	Estimated bool            `json:"estimated"`
+	Error     string          `json:"error,omitempty"`
+	Packages  []packageReport `json:"packages"`
+}
+
+// energy serves the running energy counters and the power gauges of the last interval, per package and domain
+func (a *agent) energy(w http.ResponseWriter, _ *http.Request) {
+	sample := a.sampler.Last()
+	power := sample.Power()
+
+	report := energyReport{
+		Node:      a.node,
+		Time:      sample.Time,
+		Interval:  sample.Interval.Seconds(),
+		Estimated: readers.IsEstimated(a.sampler.Reader()),
+		Packages:  []packageReport{},
+	}
+
+	var ledgerTotals map[int64]readers.Energy
+	if a.ledger != nil {
+		ledgerTotals = a.ledger.Totals()
+	}
+
+	if sample.Err != nil {
+		report.Error = sample.Err.Error()
+	}
+
+	for _, pkgId := range sample.PackageIds() {
+		pkgReport := packageReport{
+			Package:      pkgId,
+			EnergyJoules: domainValues{},
+			PowerWatts:   domainValues{},
+		}
+
+		for _, domain := range readers.Domains {
+			pkgReport.EnergyJoules[domain.String()] = sample.Totals[pkgId].Get(domain)
+			if watts, exists := power[pkgId]; exists {
+				pkgReport.PowerWatts[domain.String()] = readers.Energy(watts).Get(domain)
+			}
+			if totals, exists := ledgerTotals[pkgId]; exists {
+				if pkgReport.LedgerJoules == nil {
+					pkgReport.LedgerJoules = domainValues{}
+				}
+				pkgReport.LedgerJoules[domain.String()] = totals.Get(domain)
+			}
+		}
+
+		report.Packages = append(report.Packages, pkgReport)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(report)
+	if err != nil {
+		klog.Errorln(err)
+	}
+}
+
+// healthz reports whether the sampling loop is alive, i.e. it attempted a read within the last three intervals
+func (a *agent) healthz(w http.ResponseWriter, _ *http.Request) {
+	lastAttempt := a.sampler.LastAttempt()
+	if lastAttempt.IsZero() || time.Since(lastAttempt) > 3*a.sampler.Interval() {
+		http.Error(w, fmt.Sprintf("sampler stalled, last read attempt at %s", lastAttempt.Format(time.RFC3339)), http.StatusServiceUnavailable)
+		return
+	}
+
+	_, _ = fmt.Fprintln(w, "ok")
+}
+
+// readyz reports whether the agent serves fresh measurements, i.e. the last read succeeded
+func (a *agent) readyz(w http.ResponseWriter, _ *http.Request) {
+	sample := a.sampler.Last()
+
+	switch {
+	case sample.Time.IsZero():
+		http.Error(w, "no measurement taken yet", http.StatusServiceUnavailable)
+	case sample.Err != nil:
+		http.Error(w, fmt.Sprintf("reading the rapl counters failed: %s", sample.Err), http.StatusServiceUnavailable)
+	default:
+		_, _ = fmt.Fprintln(w, "ok")
+	}
+}
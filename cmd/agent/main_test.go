@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+func TestHealthzGoesStale(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"class/powercap/intel-rapl/intel-rapl:0/name":      "package-0",
+		"class/powercap/intel-rapl/intel-rapl:0/energy_uj": "1000000",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	interval := 20 * time.Millisecond
+	a := &agent{node: "test", sampler: readers.NewSampler(&readers.Sysfs{Root: root}, interval)}
+
+	healthz := func() int {
+		recorder := httptest.NewRecorder()
+		a.healthz(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		return recorder.Code
+	}
+
+	if code := healthz(); code != http.StatusServiceUnavailable {
+		t.Errorf("healthz before the first read: got %d, want %d", code, http.StatusServiceUnavailable)
+	}
+
+	if _, err := a.sampler.Sample(); err != nil {
+		t.Fatal(err)
+	}
+	if code := healthz(); code != http.StatusOK {
+		t.Errorf("healthz after a read: got %d, want %d", code, http.StatusOK)
+	}
+
+	time.Sleep(4 * interval)
+	if code := healthz(); code != http.StatusServiceUnavailable {
+		t.Errorf("healthz after three intervals without a read: got %d, want %d", code, http.StatusServiceUnavailable)
+	}
+}
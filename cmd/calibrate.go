@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/attribution"
+	"github.com/rekuberate-io/power/pkg/readers"
+
+	"k8s.io/klog/v2"
+)
+
+// calibrate samples the rapl counters while the host is quiet and persists the fitted idle power model, which the
+// agent uses to charge the idle floor of the packages separately from the dynamic energy of the workloads
+func calibrate(args []string) error {
+	flags, common := newReaderFlagSet("calibrate", "calibrate [flags]", 1*time.Second)
+	duration := flags.Duration("duration", 1*time.Minute, "how long to calibrate for, the host should stay quiet meanwhile")
+	interval := common.interval
+	maxUtilization := flags.Float64("max-utilization", attribution.DefaultMaxUtilization, "busy ratio above which the samples of a package are rejected")
+	procRoot := flags.String("proc-root", "/proc", "mount point of procfs")
+	output := flags.String("file", "idle-model.json", "file to persist the idle model to")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	raplReader, err := common.raplReader()
+	if err != nil {
+		return err
+	}
+
+	sampler := readers.NewSampler(raplReader, *interval)
+	calibrator := attribution.NewCalibrator(attribution.ProcFS{Root: *procRoot}, readers.TopologyOf(raplReader))
+	calibrator.MaxUtilization = *maxUtilization
+
+	_, err = sampler.Sample()
+	if err != nil {
+		return err
+	}
+
+	err = calibrator.Prime()
+	if err != nil {
+		return err
+	}
+
+	klog.V(5).Infof("calibrating idle power for %s every %s", *duration, *interval)
+
+	deadline := time.Now().Add(*duration)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	accepted, rejected := 0, 0
+	for now := range ticker.C {
+		sample, err := sampler.Sample()
+		if err != nil {
+			return err
+		}
+
+		packages, err := calibrator.Add(sample)
+		if err != nil {
+			return err
+		}
+
+		accepted += packages
+		rejected += len(sample.Energy) - packages
+
+		if now.After(deadline) {
+			break
+		}
+	}
+
+	fmt.Printf("accepted %d, rejected %d package samples\n", accepted, rejected)
+
+	model, err := calibrator.Fit()
+	if err != nil {
+		return err
+	}
+
+	for _, pkgId := range sortedPackageIds(model.Packages) {
+		idle := readers.Energy(model.Packages[pkgId])
+		fmt.Printf("Package: %d\n", pkgId)
+		for _, domain := range readers.Domains {
+			fmt.Printf("\t%-21s: %12.3f W\n", domain, idle.Get(domain))
+		}
+	}
+
+	err = model.Save(*output)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nidle model saved to %s\n", *output)
+
+	return nil
+}
+
+func sortedPackageIds(power map[int64]readers.Power) []int64 {
+	var pkgIds []int64
+	for pkgId := range power {
+		pkgIds = append(pkgIds, pkgId)
+	}
+
+	sort.Slice(pkgIds, func(i, j int) bool { return pkgIds[i] < pkgIds[j] })
+
+	return pkgIds
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+// errDiscrepancies is returned by compare once it printed the discrepancies, main exits with status 1 then
+var errDiscrepancies = errors.New("discrepancies above tolerance")
+
+// compare samples every usable rapl reader strategy over the same interval and prints how much they disagree. It
+// exits with a non-zero status when a discrepancy above the tolerance is found, so it can gate a hardware rollout
+func compare(args []string) error {
+	flags := flag.NewFlagSet("compare", flag.ExitOnError)
+	interval := flags.Duration("interval", 1*time.Second, "sampling interval, shared by all strategies")
+	tolerance := flags.Float64("tolerance", 0.05, "relative difference above which a domain is flagged, e.g. 0.05 for 5%")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	comparison, err := readers.Compare(*interval, *tolerance)
+	for strategy, reason := range comparison.Skipped {
+		fmt.Printf("skipped %s: %s\n", strategy, reason)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("compared against %s over %s (tolerance: %.2f%%)\n\n", comparison.Reference, comparison.Interval, *tolerance*100)
+
+	for _, difference := range comparison.Differences {
+		status := "ok"
+		switch {
+		case difference.Missing:
+			status = "MISSING"
+		case difference.Discrepancy:
+			status = "DISCREPANCY"
+		}
+
+		fmt.Printf("%-12s %s\n", status, difference)
+	}
+
+	if discrepancies := comparison.Discrepancies(); len(discrepancies) > 0 {
+		fmt.Println()
+		fmt.Printf("%d discrepancies above tolerance\n", len(discrepancies))
+		return errDiscrepancies
+	}
+
+	return nil
+}
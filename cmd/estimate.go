@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/estimation"
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+// estimate prints the estimated wall power of the host and its breakdown per component, to be calibrated against a pdu
+func estimate(args []string) error {
+	flags, common := newReaderFlagSet("estimate", "estimate -model model.json [flags]", 1*time.Second)
+	modelPath := flags.String("model", "", "json file with the component and psu models")
+	interval := common.interval
+	count := flags.Int("count", 1, "number of intervals to estimate, 0 to run until interrupted")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *modelPath == "" {
+		return fmt.Errorf("estimate needs a -model file")
+	}
+
+	model, err := estimation.LoadModel(*modelPath)
+	if err != nil {
+		return err
+	}
+
+	raplReader, err := common.raplReader()
+	if err != nil {
+		return err
+	}
+
+	sampler := readers.NewSampler(raplReader, *interval)
+	estimator := estimation.NewEstimator(model)
+
+	_, err = sampler.Sample()
+	if err != nil {
+		return err
+	}
+
+	err = estimator.Prime()
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	for i := 0; *count == 0 || i < *count; i++ {
+		<-ticker.C
+
+		sample, err := sampler.Sample()
+		if err != nil {
+			return err
+		}
+
+		estimate, err := estimator.Estimate(sample)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s\n", estimate.Time.Format(time.RFC3339))
+		fmt.Printf("\t%-21s: %12.3f W\n", "rapl (package+dram)", estimate.RaplWatts)
+		for _, component := range estimate.Components {
+			fmt.Printf("\t%-21s: %12.3f W\n", fmt.Sprintf("%s (%s)", component.Name, component.Type), component.Watts)
+		}
+		fmt.Printf("\t%-21s: %12.3f W\n", "dc", estimate.DCWatts)
+		fmt.Printf("\t%-21s: %12.3f W\n", "psu loss", estimate.PSULossWatts)
+		fmt.Printf("\t%-21s: %12.3f W\n", "wall", estimate.WallWatts)
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/metrics"
+	"github.com/rekuberate-io/power/pkg/readers"
+
+	"k8s.io/klog/v2"
+)
+
+// export writes the energy counters, power gauges and cpu info in the OpenMetrics text format, to stdout or to a file
+// that is replaced atomically, as the textfile collector of the node exporter expects
+func export(args []string) error {
+	flags, common := newFlagSet("export", "export [flags]", 1*time.Second, "openmetrics")
+	file := flags.String("file", "", "file to write the exposition to, replaced atomically on every sample, stdout if empty")
+	count := flags.Int("count", 1, "number of samples to export, 0 to export every interval until interrupted")
+	node := flags.String("node", "", "value of the node label, defaults to the hostname")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	err = common.validate()
+	if err != nil {
+		return err
+	}
+
+	if *node == "" {
+		*node, err = os.Hostname()
+		if err != nil {
+			return err
+		}
+	}
+
+	raplReader, err := common.raplReader()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	sampler := readers.NewSampler(raplReader, *common.interval)
+	_, err = sampler.Sample()
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(*common.interval)
+	defer ticker.Stop()
+
+	for exported := 0; *count == 0 || exported < *count; {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		sample, err := sampler.Sample()
+		if err != nil {
+			klog.Errorln(err)
+			continue
+		}
+
+		// the sampler primes again after a failed read, the first sample after it has no energy
+		if sample.Time.IsZero() {
+			continue
+		}
+
+		snapshot := metrics.FromSample(*node, sample, readers.TopologyOf(raplReader))
+		snapshot.Estimated = readers.IsEstimated(raplReader)
+
+		var exposition bytes.Buffer
+		err = snapshot.Write(&exposition)
+		if err != nil {
+			return err
+		}
+
+		err = writeExposition(*file, exposition.Bytes())
+		if err != nil {
+			return err
+		}
+
+		exported++
+	}
+
+	return nil
+}
+
+// writeExposition writes data to stdout, or replaces the file at path with it through a rename
+func writeExposition(path string, data []byte) error {
+	if path == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+
+	return metrics.WriteFile(path, data)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/carbon"
+	"github.com/rekuberate-io/power/pkg/output"
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+// commonFlags are the flags every subcommand measuring energy shares, so that they read the same everywhere
+type commonFlags struct {
+	strategy *string
+	interval *time.Duration
+	units    *string
+	format   *string
+
+	formats []string
+	unit    output.Unit
+}
+
+// newFlagSet creates the flag set of a subcommand with the common -strategy, -interval, -units and -o flags. The
+// first of formats is the default output format
+func newFlagSet(name string, usage string, interval time.Duration, formats ...string) (*flag.FlagSet, *commonFlags) {
+	flags, common := newReaderFlagSet(name, usage, interval)
+
+	common.formats = formats
+	common.addUnits(flags)
+	common.format = flags.String("o", formats[0], fmt.Sprintf("output format: %s", strings.Join(formats, ", ")))
+
+	return flags, common
+}
+
+// newReaderFlagSet creates the flag set of a subcommand with only the common -strategy and -interval flags, for the
+// subcommands that print neither energy nor reports
+func newReaderFlagSet(name string, usage string, interval time.Duration) (*flag.FlagSet, *commonFlags) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: power %s\n\n", usage)
+		flags.PrintDefaults()
+	}
+
+	common := &commonFlags{}
+	common.strategy = flags.String("strategy", readers.StrategyAuto.String(), "comma separated, ordered list of rapl reader strategies to try: auto, sysfs, perf, msr, model")
+	common.interval = flags.Duration("interval", interval, "sampling interval")
+
+	return flags, common
+}
+
+// addUnits adds the -units flag, for the subcommands printing energy without an output format
+func (c *commonFlags) addUnits(flags *flag.FlagSet) {
+	c.units = flags.String("units", "J", "unit to print the energy in: J, Wh, kWh")
+}
+
+// validate checks the values of the common flags, it has to be called after parsing
+func (c *commonFlags) validate() error {
+	if c.units == nil {
+		return nil
+	}
+
+	unit, err := output.ParseUnit(*c.units)
+	if err != nil {
+		return err
+	}
+	c.unit = unit
+
+	if c.format == nil {
+		return nil
+	}
+
+	for _, format := range c.formats {
+		if *c.format == format {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown output format %q, expected one of: %s", *c.format, strings.Join(c.formats, ", "))
+}
+
+// raplReader returns a reader of the first usable strategy of -strategy
+func (c *commonFlags) raplReader() (readers.RaplReader, error) {
+	strategies, err := readers.ParseRaplReaderStrategies(*c.strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	raplReader, err := readers.NewRaplReader(strategies...)
+	if err != nil {
+		return nil, err
+	}
+
+	if readers.IsEstimated(raplReader) {
+		fmt.Fprintln(os.Stderr, "no rapl interface is usable, the package energy is ESTIMATED from the cpu utilization")
+	}
+
+	return raplReader, nil
+}
+
+// carbonFlags configure the estimation of the emissions of the measured energy
+type carbonFlags struct {
+	intensity *float64
+	series    *string
+	url       *string
+	pue       *float64
+}
+
+func addCarbonFlags(flags *flag.FlagSet) *carbonFlags {
+	return &carbonFlags{
+		intensity: flags.Float64("carbon-intensity", 0, "static carbon intensity of the grid in gCO2e/kWh"),
+		series:    flags.String("carbon-series", "", "csv file of 'timestamp,intensity' rows with the carbon intensity of the grid in gCO2e/kWh"),
+		url:       flags.String("carbon-url", "", "json http endpoint reporting the carbon intensity of the grid in gCO2e/kWh"),
+		pue:       flags.Float64("pue", 1, "power usage effectiveness of the facility, multiplies the energy for the carbon estimation"),
+	}
+}
+
+// estimator returns the carbon estimator configured by the flags, nil if no carbon intensity source is configured
+func (c *carbonFlags) estimator() (*carbon.Estimator, error) {
+	config := carbon.Config{Intensity: *c.intensity, SeriesPath: *c.series, URL: *c.url, PUE: *c.pue}
+	if !config.Enabled() {
+		return nil, nil
+	}
+
+	return carbon.NewEstimator(config)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/output"
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+type strategyInfo struct {
+	Strategy          string `json:"strategy"`
+	Usable            bool   `json:"usable"`
+	Present           bool   `json:"present"`
+	Readable          bool   `json:"readable"`
+	MissingCapability string `json:"missing_capability,omitempty"`
+	Reason            string `json:"reason,omitempty"`
+}
+
+type hostInfo struct {
+	Schema            int             `json:"schema_version"`
+	Hostname          string          `json:"hostname"`
+	Cpus              []output.Cpu    `json:"cpus"`
+	Capabilities      map[string]bool `json:"capabilities"`
+	PerfEventParanoid *int            `json:"perf_event_paranoid"`
+	Lockdown          string          `json:"lockdown"`
+	MsrModuleLoaded   bool            `json:"msr_module_loaded"`
+	Strategies        []strategyInfo  `json:"strategies"`
+	Selected          string          `json:"selected,omitempty"`
+	Estimated         bool            `json:"estimated"`
+}
+
+var capabilities = []struct {
+	name string
+	bit  uint
+}{
+	{"CAP_DAC_READ_SEARCH", readers.CAP_DAC_READ_SEARCH},
+	{"CAP_SYS_RAWIO", readers.CAP_SYS_RAWIO},
+	{"CAP_SYS_ADMIN", readers.CAP_SYS_ADMIN},
+	{"CAP_PERFMON", readers.CAP_PERFMON},
+}
+
+// info prints the detected topology, the capabilities of the process and the diagnosis of every strategy
+func info(args []string) error {
+	flags, common := newFlagSet("info", "info [flags]", 1*time.Second, "table", "json")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	err = common.validate()
+	if err != nil {
+		return err
+	}
+
+	host := hostInfo{Schema: output.SchemaVersion, Capabilities: make(map[string]bool), MsrModuleLoaded: readers.MsrModuleLoaded(), Lockdown: readers.KernelLockdown()}
+
+	host.Hostname, err = os.Hostname()
+	if err != nil {
+		return err
+	}
+
+	host.Cpus = output.Topology(readers.Cpus)
+
+	for _, capability := range capabilities {
+		host.Capabilities[capability.name] = readers.HasCapability(capability.bit)
+	}
+
+	if paranoid, err := readers.PerfEventParanoid(); err == nil {
+		host.PerfEventParanoid = &paranoid
+	}
+
+	for _, strategy := range readers.RaplReaderStrategies {
+		diagnosis, err := readers.DiagnoseRaplReaderStrategy(strategy)
+		if err != nil {
+			return err
+		}
+
+		host.Strategies = append(host.Strategies, strategyInfo{
+			Strategy:          strategy.String(),
+			Usable:            diagnosis.Usable(),
+			Present:           diagnosis.Present,
+			Readable:          diagnosis.Readable,
+			MissingCapability: diagnosis.MissingCapability,
+			Reason:            diagnosis.Reason,
+		})
+	}
+
+	strategies, err := readers.ParseRaplReaderStrategies(*common.strategy)
+	if err != nil {
+		return err
+	}
+
+	raplReader, err := readers.NewRaplReader(strategies...)
+	if err == nil {
+		host.Selected = readers.StrategyName(raplReader)
+		host.Estimated = readers.IsEstimated(raplReader)
+	}
+
+	if *common.format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(host)
+	}
+
+	fmt.Printf("Host: %s\n\n", host.Hostname)
+	for _, cpu := range host.Cpus {
+		fmt.Printf("Socket %d: %s '%s/%s/Fam:%d' (packages: %v, cores: %d)\n", cpu.Socket, cpu.Vendor, cpu.ModelName, cpu.InternalName, cpu.Family, cpu.Packages, len(cpu.Cores))
+	}
+
+	paranoid := "n/a"
+	if host.PerfEventParanoid != nil {
+		paranoid = fmt.Sprint(*host.PerfEventParanoid)
+	}
+
+	fmt.Println()
+	for _, capability := range capabilities {
+		fmt.Printf("%-21s: %t\n", capability.name, host.Capabilities[capability.name])
+	}
+	fmt.Printf("%-21s: %s\n", "perf_event_paranoid", paranoid)
+	lockdown := host.Lockdown
+	if lockdown == "" {
+		lockdown = "n/a"
+	}
+	fmt.Printf("%-21s: %s\n", "lockdown", lockdown)
+	fmt.Printf("%-21s: %t\n", "msr module", host.MsrModuleLoaded)
+
+	fmt.Println()
+	for _, strategy := range host.Strategies {
+		fmt.Printf("%-6s usable: %-5t missing capability: %-20s %s\n", strategy.Strategy, strategy.Usable, strategy.MissingCapability, strategy.Reason)
+	}
+
+	fmt.Println()
+	if host.Selected == "" {
+		fmt.Printf("no usable rapl reader for -strategy %s\n", *common.strategy)
+	} else {
+		fmt.Printf("selected: %s (estimated: %t)\n", host.Selected, host.Estimated)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+type limitReport struct {
+	Package    int64   `json:"package"`
+	Domain     string  `json:"domain"`
+	Name       string  `json:"name"`
+	Watts      float64 `json:"watts"`
+	TimeWindow float64 `json:"time_window_seconds"`
+	MaxWatts   float64 `json:"max_watts,omitempty"`
+	Enabled    bool    `json:"enabled"`
+	Locked     bool    `json:"locked"`
+	Source     string  `json:"source"`
+}
+
+// limits prints the power limits of the rapl domains, read from the powercap constraints or the power limit msrs
+func limits(args []string) error {
+	flags, common := newFlagSet("limits", "limits [flags]", 1*time.Second, "table", "json")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	err = common.validate()
+	if err != nil {
+		return err
+	}
+
+	limiter, err := powerLimiter(common)
+	if err != nil {
+		return err
+	}
+
+	powerLimits, err := limiter.PowerLimits()
+	if err != nil {
+		return err
+	}
+
+	if *common.format == "json" {
+		var reports []limitReport
+		for _, limit := range powerLimits {
+			reports = append(reports, limitReport{
+				Package:    limit.Package,
+				Domain:     limit.Domain.String(),
+				Name:       limit.Name,
+				Watts:      limit.Watts,
+				TimeWindow: limit.TimeWindow.Seconds(),
+				MaxWatts:   limit.MaxWatts,
+				Enabled:    limit.Enabled,
+				Locked:     limit.Locked,
+				Source:     limit.Source,
+			})
+		}
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(reports)
+	}
+
+	fmt.Printf("%-8s %-8s %-12s %12s %14s %12s %-8s %-7s %s\n", "package", "domain", "name", "limit (W)", "window", "max (W)", "enabled", "locked", "source")
+	for _, limit := range powerLimits {
+		fmt.Printf("%-8d %-8s %-12s %12.3f %14s %12.3f %-8t %-7t %s\n", limit.Package, limit.Domain, limit.Name, limit.Watts, limit.TimeWindow, limit.MaxWatts, limit.Enabled, limit.Locked, limit.Source)
+	}
+
+	return nil
+}
+
+// powerLimiter returns the selected reader when it can read the power limits, otherwise the first usable of the
+// sysfs and msr readers
+func powerLimiter(common *commonFlags) (readers.PowerLimiter, error) {
+	raplReader, err := common.raplReader()
+	if err == nil {
+		if limiter, ok := raplReader.(readers.PowerLimiter); ok {
+			return limiter, nil
+		}
+	}
+
+	for _, raplReader := range []readers.RaplReader{&readers.Sysfs{}, &readers.MsrReader{}} {
+		if raplReader.Available() {
+			return raplReader.(readers.PowerLimiter), nil
+		}
+	}
+
+	return nil, errors.New("reading the power limits needs the sysfs or the msr interface")
+}
@@ -1,76 +1,88 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"github.com/rekuberate-io/power/pkg/readers"
 	"os"
-	"strings"
 
 	"k8s.io/klog/v2"
 )
 
-var (
-	strategy = flag.Int("strategy", 1, "rapl reader strategy")
-)
+// command is a subcommand of the cli
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{name: "info", summary: "print the cpu topology and which rapl interfaces are usable, and why not", run: info},
+	{name: "read", summary: "measure the energy consumed over one interval", run: read},
+	{name: "watch", summary: "measure the power continuously", run: watch},
+	{name: "top", summary: "live dashboard of the power, its history, the throttling and the top processes", run: top},
+	{name: "limits", summary: "print the power limits of the rapl domains", run: limits},
+	{name: "run", summary: "measure the energy a command consumes", run: run},
+	{name: "export", summary: "write the counters in the OpenMetrics text format, e.g. for a textfile collector", run: export},
+	{name: "compare", summary: "compare the readings of every usable rapl interface", run: compare},
+	{name: "calibrate", summary: "fit the idle power model used by the pod attribution", run: calibrate},
+	{name: "estimate", summary: "estimate the wall power of the host from a component model", run: estimate},
+	{name: "record", summary: "record the raw counters for a later replay", run: record},
+	{name: "replay", summary: "play back a recording", run: replay},
+	{name: "report", summary: "energy, cost and emissions of a recording or a ledger over a time range, per day", run: energyReport},
+}
 
 func main() {
 	defer exit()
 
-	raplReader, err := readers.NewRaplReader(readers.RaplReaderStrategy(*strategy))
-	if err != nil {
-		klog.Fatalln(err)
+	// a bare invocation keeps measuring one interval, like it did before the subcommands
+	name, args := "read", []string{}
+	if flag.NArg() > 0 {
+		name, args = flag.Arg(0), flag.Args()[1:]
 	}
 
-	hostname, err := os.Hostname()
-	if err != nil {
-		klog.Fatalln(err)
+	if name == "help" {
+		usage()
+		return
 	}
 
-	klog.V(5).Infoln(fmt.Sprintf(
-		"starting rapl measuring session on %s { reader: %T, duration: %dsec, interval: %dsec }",
-		hostname,
-		raplReader,
-	))
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
 
-	for _, cpu := range readers.Cpus {
-		fmt.Printf(
-			"%s '%s/%s/Fam:%d' on socket %d (packages: %d, cores: %d)",
-			cpu.Vendor.String(),
-			strings.TrimSpace(cpu.Model.Name),
-			cpu.Model.InternalName,
-			cpu.Family,
-			cpu.PhysicalId,
-			len(cpu.Packages),
-			len(cpu.Cores),
-		)
-	}
+		klog.V(5).Infof("starting rapl measuring session { command: %s }", name)
 
-	fmt.Println()
-	fmt.Println()
+		err := c.run(args)
+		if errors.Is(err, errDiscrepancies) {
+			// the discrepancies are printed already, only the exit status is left
+			exit()
+			os.Exit(1)
+		}
+		if err != nil {
+			klog.Fatalln(err)
+		}
 
-	measurement, err := raplReader.Read()
-	if err != nil {
-		klog.Errorln(err)
+		return
 	}
 
-	for pkgId, cores := range measurement {
-		fmt.Printf("Package: %d\n", pkgId)
-		for _, core := range cores {
-
-			power := core.ToKiloWattHour()
+	fmt.Fprintf(os.Stderr, "unknown command: %s\n\n", name)
+	usage()
+	os.Exit(2)
+}
 
-			fmt.Printf("\t%-21s: %18.6f J %27.15f kWh\n", "Package", core.Pkg, power.Pkg)
-			fmt.Printf("\t%-21s: %18.6f J %27.15f kWh\n", "PowerPlane0 (cores)", core.PP0, power.PP0)
-			fmt.Printf("\t%-21s: %18.6f J %27.15f kWh\n", "PowerPlane1 (L3/gpu)", core.PP1, power.PP1)
-			fmt.Printf("\t%-21s: %18.6f J %27.15f kWh\n", "DRAM", core.DRAM, power.DRAM)
-			fmt.Printf("\t%-21s: %18.6f J %27.15f kWh\n", "PSYS", core.PSys, power.PSys)
-		}
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "usage: power [-v level] <command> [flags]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-10s %s\n", c.name, c.summary)
 	}
+	fmt.Fprintf(out, "\nrun 'power <command> -h' for the flags of a command\n")
 }
 
 func init() {
 	klog.InitFlags(nil)
+	flag.Usage = usage
 	flag.Parse()
 }
 
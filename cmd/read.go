@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/carbon"
+	"github.com/rekuberate-io/power/pkg/output"
+	"github.com/rekuberate-io/power/pkg/readers"
+
+	"k8s.io/klog/v2"
+)
+
+// read measures the energy consumed over one interval
+func read(args []string) error {
+	flags, common := newFlagSet("read", "read [flags]", 1*time.Second, output.Formats...)
+	carbonConfig := addCarbonFlags(flags)
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	err = common.validate()
+	if err != nil {
+		return err
+	}
+
+	raplReader, err := common.raplReader()
+	if err != nil {
+		return err
+	}
+
+	estimator, err := carbonConfig.estimator()
+	if err != nil {
+		return err
+	}
+
+	sampler := readers.NewSampler(raplReader, *common.interval)
+	_, err = sampler.Sample()
+	if err != nil {
+		return err
+	}
+
+	time.Sleep(*common.interval)
+
+	sample, err := sampler.Sample()
+	if err != nil {
+		return err
+	}
+
+	writer, err := newOutputWriter(common, raplReader)
+	if err != nil {
+		return err
+	}
+
+	err = writer.WriteSample(newOutputSample(sampler, sample, estimator))
+	if err != nil {
+		return err
+	}
+
+	return writer.Close()
+}
+
+// watch samples the counters every interval until interrupted, or until -count samples were taken
+func watch(args []string) error {
+	flags, common := newFlagSet("watch", "watch [flags]", 1*time.Second, output.Formats...)
+	count := flags.Int("count", 0, "number of samples to take, 0 to watch until interrupted")
+	carbonConfig := addCarbonFlags(flags)
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	err = common.validate()
+	if err != nil {
+		return err
+	}
+
+	raplReader, err := common.raplReader()
+	if err != nil {
+		return err
+	}
+
+	estimator, err := carbonConfig.estimator()
+	if err != nil {
+		return err
+	}
+
+	writer, err := newOutputWriter(common, raplReader)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	sampler := readers.NewSampler(raplReader, *common.interval)
+	samples := sampler.Subscribe(1)
+
+	go func() {
+		err := sampler.Run(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			klog.Errorln(err)
+		}
+	}()
+
+	taken := 0
+	var last readers.Sample
+	for sample := range samples {
+		if sample.Err != nil {
+			klog.Errorln(sample.Err)
+			continue
+		}
+
+		err := writer.WriteSample(newOutputSample(sampler, sample, estimator))
+		if err != nil {
+			return err
+		}
+
+		taken++
+		last = sample
+		if *count > 0 && taken >= *count {
+			// a sample taken meanwhile is not written
+			stop()
+			break
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+
+	if *common.format == "table" {
+		fmt.Println("Totals since start:")
+		// the totals of the last sample written, the sampler may have taken another one before it stopped
+		for _, pkgId := range last.PackageIds() {
+			totals := last.Totals[pkgId]
+			fmt.Printf("\tPackage %d: %.6f %s package, %.6f %s dram\n", pkgId, common.unit.Convert(totals.Pkg), common.unit.Name, common.unit.Convert(totals.DRAM), common.unit.Name)
+		}
+	}
+
+	return nil
+}
+
+// newOutputWriter creates the writer of -o to stdout and writes the header of the host
+func newOutputWriter(common *commonFlags, raplReader readers.RaplReader) (output.Writer, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	writer, err := output.NewWriter(*common.format, os.Stdout, common.unit)
+	if err != nil {
+		return nil, err
+	}
+
+	return writer, writer.WriteHeader(output.NewHeader(hostname, raplReader, readers.TopologyOf(raplReader)))
+}
+
+// newOutputSample converts a sample of sampler, adding the emissions of every domain when estimator is not nil
+func newOutputSample(sampler *readers.Sampler, sample readers.Sample, estimator *carbon.Estimator) output.Sample {
+	s := output.FromSample(sample, sampler.Supported(), readers.TopologyOf(sampler.Reader()))
+	if estimator == nil {
+		return s
+	}
+
+	for i, pkg := range s.Packages {
+		emissions, intensity, err := estimator.Emissions(context.Background(), sample.Energy[pkg.Package], sample.Time)
+		if err != nil {
+			klog.Errorln(err)
+			continue
+		}
+		s.Intensity = &intensity
+
+		for j, domain := range pkg.Domains {
+			grams := readers.Energy(emissions).Get(readers.Domains[j])
+			domain.Emissions = &grams
+			s.Packages[i].Domains[j] = domain
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+
+	"k8s.io/klog/v2"
+)
+
+// record writes every raw read of the rapl counters, together with the topology, units and wrap limits, to a
+// recording that replay, or the agent with -replay, plays back on any machine
+func record(args []string) error {
+	flags, common := newReaderFlagSet("record", "record [flags]", 1*time.Second)
+	duration := flags.Duration("duration", 1*time.Minute, "how long to record for")
+	interval := common.interval
+	output := flags.String("file", "power.rec", "file to write the recording to")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	raplReader, err := common.raplReader()
+	if err != nil {
+		return err
+	}
+
+	recorder, err := readers.CreateRecording(*output, raplReader)
+	if err != nil {
+		return err
+	}
+	defer func(recorder *readers.Recorder) {
+		err := recorder.Close()
+		if err != nil {
+			klog.Errorln(err)
+		}
+	}(recorder)
+
+	sampler := readers.NewSampler(recorder, *interval)
+
+	_, err = sampler.Sample()
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(*duration)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	reads := 1
+	for now := range ticker.C {
+		_, err := sampler.Sample()
+		if err != nil {
+			klog.Errorln(err)
+		}
+		reads++
+
+		if now.After(deadline) {
+			break
+		}
+	}
+
+	fmt.Printf("recorded %d reads to %s\n", reads, *output)
+
+	return nil
+}
+
+// replay plays a recording back through the sampler and prints the power of every interval
+func replay(args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: power replay [flags] recording\n\n")
+		flags.PrintDefaults()
+	}
+	speed := flags.Float64("speed", 0, "speed of the playback, 1 is the recorded pace, 0 steps through every read without waiting")
+	interval := flags.Duration("interval", 1*time.Second, "interval between two samples at the recorded pace, ignored when stepping")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return errors.New("replay needs the recording to play back")
+	}
+
+	raplReader, err := readers.NewReplayReader(flags.Arg(0), *speed)
+	if err != nil {
+		return err
+	}
+
+	header := raplReader.Recording.Header
+	fmt.Printf("recording of %s taken %s with %s (estimated: %t), %d reads\n\n", header.Hostname, header.Created.Format(time.RFC3339), header.Strategy, header.Estimated, len(raplReader.Recording.Snapshots))
+
+	sampler := readers.NewSampler(raplReader, *interval)
+
+	pace := time.Duration(0)
+	if *speed > 0 {
+		pace = time.Duration(float64(*interval) / *speed)
+	}
+
+	for {
+		sample, err := sampler.Sample()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			fmt.Printf("%s\terror: %s\n", sample.Time.Format(time.RFC3339Nano), err)
+		} else if !sample.Time.IsZero() {
+			for pkgId, power := range sample.Power() {
+				fmt.Printf("%s\tpackage %d\t%10.3f W package\t%10.3f W core\t%10.3f W dram\n", sample.Time.Format(time.RFC3339Nano), pkgId, power.Pkg, power.PP0, power.DRAM)
+			}
+		}
+
+		time.Sleep(pace)
+	}
+
+	fmt.Println()
+	for _, pkgId := range sampler.Last().PackageIds() {
+		totals := sampler.Totals()[pkgId]
+		fmt.Printf("Package: %d total %.6f J package, %.6f J dram\n", pkgId, totals.Pkg, totals.DRAM)
+	}
+
+	return nil
+}
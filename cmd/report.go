@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/aggregation"
+	"github.com/rekuberate-io/power/pkg/ledger"
+	"github.com/rekuberate-io/power/pkg/readers"
+	"github.com/rekuberate-io/power/pkg/report"
+
+	"k8s.io/klog/v2"
+)
+
+// energyReport sums the energy of a recording, or of the hourly totals of a ledger, over a time range, with its cost and
+// emissions and a breakdown per day
+func energyReport(args []string) error {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: power report [flags] recording|ledger\n\n")
+		flags.PrintDefaults()
+	}
+	format := flags.String("o", "markdown", fmt.Sprintf("output format: %s", strings.Join(report.Formats, ", ")))
+	from := flags.String("from", "", "start of the time range, RFC 3339 or 2006-01-02 in -timezone, the start of the input if empty")
+	to := flags.String("to", "", "end of the time range, exclusive, RFC 3339 or 2006-01-02 in -timezone, the end of the input if empty")
+	timezone := flags.String("timezone", "Local", "time zone of the days and of the tariff periods, e.g. Europe/Berlin")
+	price := flags.Float64("tariff", 0, "flat price of a kWh")
+	tariffPath := flags.String("tariff-file", "", "json file with a time of use tariff, overrides -tariff")
+	currency := flags.String("currency", "EUR", "currency of the flat -tariff")
+	carbonConfig := addCarbonFlags(flags)
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return errors.New("report needs the recording or the ledger to report on")
+	}
+	path := flags.Arg(0)
+
+	location, err := time.LoadLocation(*timezone)
+	if err != nil {
+		return err
+	}
+
+	options := report.Options{Source: path, Location: location}
+
+	options.From, err = parseReportTime(*from, location)
+	if err != nil {
+		return err
+	}
+
+	options.To, err = parseReportTime(*to, location)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *tariffPath != "":
+		options.Tariff, err = report.LoadTariff(*tariffPath)
+		if err != nil {
+			return err
+		}
+	case *price > 0:
+		options.Tariff = report.FlatTariff(*price, *currency)
+	}
+
+	options.Carbon, err = carbonConfig.estimator()
+	if err != nil {
+		return err
+	}
+
+	buckets, err := loadBuckets(path, location)
+	if err != nil {
+		return err
+	}
+
+	r, err := report.Build(context.Background(), buckets, options)
+	if err != nil {
+		return err
+	}
+
+	return report.Write(os.Stdout, r, *format)
+}
+
+// loadBuckets reads the minute rollups of a recording, told apart by its gzip header, or the hourly totals of a ledger
+func loadBuckets(path string, location *time.Location) ([]report.Bucket, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			klog.Errorln(err)
+		}
+	}(file)
+
+	magic, err := bufio.NewReader(file).Peek(2)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		return recordingBuckets(path, location)
+	}
+
+	state, err := ledger.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return report.FromLedger(state), nil
+}
+
+// recordingBuckets steps through every read of a recording and rolls the samples up per minute
+func recordingBuckets(path string, location *time.Location) ([]report.Bucket, error) {
+	raplReader, err := readers.NewReplayReader(path, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregator := aggregation.New(aggregation.Config{Resolutions: []aggregation.Resolution{aggregation.Minute}, Location: location})
+	sampler := readers.NewSampler(raplReader, time.Second)
+
+	for {
+		sample, err := sampler.Sample()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			klog.Errorf("recorded read failed: %s", err)
+			continue
+		}
+
+		err = aggregator.AddSample(sample)
+		if err != nil {
+			klog.Errorln(err)
+		}
+	}
+
+	return report.FromRollups(aggregator.Close()), nil
+}
+
+func parseReportTime(s string, location *time.Location) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", s, location); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected RFC 3339 or 2006-01-02", s)
+	}
+
+	return t, nil
+}
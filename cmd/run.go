@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/output"
+	"github.com/rekuberate-io/power/pkg/readers"
+
+	"k8s.io/klog/v2"
+)
+
+type domainValues map[string]float64
+
+type runResult struct {
+	Run          int          `json:"run"`
+	Duration     float64      `json:"duration_seconds"`
+	ExitCode     int          `json:"exit_code"`
+	Energy       domainValues `json:"energy"`
+	AverageWatts domainValues `json:"average_watts"`
+	PeakWatts    domainValues `json:"peak_watts"`
+}
+
+type statistic struct {
+	Mean   float64 `json:"mean"`
+	Stddev float64 `json:"stddev"`
+}
+
+type runSummary struct {
+	Duration     statistic            `json:"duration_seconds"`
+	Energy       map[string]statistic `json:"energy"`
+	AverageWatts map[string]statistic `json:"average_watts"`
+	PeakWatts    map[string]statistic `json:"peak_watts"`
+}
+
+type runReport struct {
+	Command []string    `json:"command"`
+	Unit    string      `json:"unit"`
+	Runs    []runResult `json:"runs"`
+	Summary runSummary  `json:"summary"`
+}
+
+// run measures the energy the packages of the host consume while a command runs. The counters are sampled
+// periodically during the run, so runs longer than the wrap time of the counters are measured correctly
+func run(args []string) error {
+	flags, common := newFlagSet("run", "run [flags] -- command [args...]", 1*time.Second, "table", "json", "csv")
+	repeat := flags.Int("repeat", 1, "number of times to run the command")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	err = common.validate()
+	if err != nil {
+		return err
+	}
+
+	command := flags.Args()
+	if len(command) == 0 {
+		return errors.New("run needs a command, e.g. power run -- sleep 1")
+	}
+
+	if *repeat < 1 {
+		return fmt.Errorf("invalid repeat count: %d", *repeat)
+	}
+
+	raplReader, err := common.raplReader()
+	if err != nil {
+		return err
+	}
+
+	report := runReport{Command: command, Unit: common.unit.Name}
+	for i := 1; i <= *repeat; i++ {
+		result, err := runOnce(raplReader, *common.interval, common.unit, command)
+		if err != nil {
+			return err
+		}
+
+		result.Run = i
+		if result.ExitCode != 0 {
+			klog.Warningf("run %d of %s exited with status %d", i, command[0], result.ExitCode)
+		}
+
+		report.Runs = append(report.Runs, result)
+	}
+
+	report.Summary = summarize(report.Runs)
+
+	switch *common.format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case "csv":
+		return writeRunCsv(os.Stdout, report)
+	default:
+		return writeRunTable(os.Stdout, report)
+	}
+}
+
+// runOnce runs the command once, sampling the counters from right before its start until right after its exit
+func runOnce(raplReader readers.RaplReader, interval time.Duration, unit output.Unit, command []string) (runResult, error) {
+	result := runResult{
+		Energy:       domainValues{},
+		AverageWatts: domainValues{},
+		PeakWatts:    domainValues{},
+	}
+
+	// the output of the command goes to stderr, which keeps the report on stdout machine readable
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	measured, err := readers.MeasureFuncEvery(context.Background(), raplReader, interval, cmd.Run)
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitCode()
+	} else if err != nil {
+		return result, err
+	}
+
+	energy := measured.Total()
+	average := readers.Energy(energy.ToWatts(measured.Duration))
+	peak := readers.Energy(measured.Peak)
+
+	result.Duration = measured.Duration.Seconds()
+	for _, domain := range readers.Domains {
+		result.Energy[domain.String()] = unit.Convert(energy.Get(domain))
+		result.AverageWatts[domain.String()] = average.Get(domain)
+		result.PeakWatts[domain.String()] = peak.Get(domain)
+	}
+
+	return result, nil
+}
+
+func summarize(results []runResult) runSummary {
+	summary := runSummary{
+		Energy:       make(map[string]statistic),
+		AverageWatts: make(map[string]statistic),
+		PeakWatts:    make(map[string]statistic),
+	}
+
+	summary.Duration = newStatistic(results, func(r runResult) float64 { return r.Duration })
+	for _, domain := range readers.Domains {
+		name := domain.String()
+		summary.Energy[name] = newStatistic(results, func(r runResult) float64 { return r.Energy[name] })
+		summary.AverageWatts[name] = newStatistic(results, func(r runResult) float64 { return r.AverageWatts[name] })
+		summary.PeakWatts[name] = newStatistic(results, func(r runResult) float64 { return r.PeakWatts[name] })
+	}
+
+	return summary
+}
+
+// newStatistic computes the mean and the sample standard deviation of a value of the runs
+func newStatistic(results []runResult, value func(runResult) float64) statistic {
+	if len(results) == 0 {
+		return statistic{}
+	}
+
+	sum := 0.0
+	for _, result := range results {
+		sum += value(result)
+	}
+	mean := sum / float64(len(results))
+
+	if len(results) < 2 {
+		return statistic{Mean: mean}
+	}
+
+	squares := 0.0
+	for _, result := range results {
+		squares += math.Pow(value(result)-mean, 2)
+	}
+
+	return statistic{Mean: mean, Stddev: math.Sqrt(squares / float64(len(results)-1))}
+}
+
+func writeRunTable(w io.Writer, report runReport) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	header := []string{"run", "duration (s)", "exit"}
+	for _, domain := range readers.Domains {
+		header = append(header, fmt.Sprintf("%s (%s)", domain, report.Unit))
+	}
+	header = append(header, "package avg (W)", "package peak (W)")
+	fmt.Fprintln(table, strings.Join(header, "\t")+"\t")
+
+	for _, result := range report.Runs {
+		row := []string{strconv.Itoa(result.Run), fmt.Sprintf("%.3f", result.Duration), strconv.Itoa(result.ExitCode)}
+		for _, domain := range readers.Domains {
+			row = append(row, fmt.Sprintf("%.3f", result.Energy[domain.String()]))
+		}
+		row = append(row, fmt.Sprintf("%.3f", result.AverageWatts[readers.DomainPkg.String()]), fmt.Sprintf("%.3f", result.PeakWatts[readers.DomainPkg.String()]))
+		fmt.Fprintln(table, strings.Join(row, "\t")+"\t")
+	}
+
+	if len(report.Runs) > 1 {
+		summary := report.Summary
+		for _, name := range []string{"mean", "stddev"} {
+			pick := func(s statistic) float64 {
+				if name == "mean" {
+					return s.Mean
+				}
+				return s.Stddev
+			}
+
+			row := []string{name, fmt.Sprintf("%.3f", pick(summary.Duration)), ""}
+			for _, domain := range readers.Domains {
+				row = append(row, fmt.Sprintf("%.3f", pick(summary.Energy[domain.String()])))
+			}
+			row = append(row, fmt.Sprintf("%.3f", pick(summary.AverageWatts[readers.DomainPkg.String()])), fmt.Sprintf("%.3f", pick(summary.PeakWatts[readers.DomainPkg.String()])))
+			fmt.Fprintln(table, strings.Join(row, "\t")+"\t")
+		}
+	}
+
+	return table.Flush()
+}
+
+func writeRunCsv(w io.Writer, report runReport) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{"run", "duration_seconds", "exit_code"}
+	for _, domain := range readers.Domains {
+		header = append(header, domain.String()+"_"+strings.ToLower(report.Unit), domain.String()+"_average_watts", domain.String()+"_peak_watts")
+	}
+
+	err := writer.Write(header)
+	if err != nil {
+		return err
+	}
+
+	format := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+
+	for _, result := range report.Runs {
+		row := []string{strconv.Itoa(result.Run), format(result.Duration), strconv.Itoa(result.ExitCode)}
+		for _, domain := range readers.Domains {
+			name := domain.String()
+			row = append(row, format(result.Energy[name]), format(result.AverageWatts[name]), format(result.PeakWatts[name]))
+		}
+
+		err := writer.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+
+	summary := report.Summary
+	for _, name := range []string{"mean", "stddev"} {
+		pick := func(s statistic) string {
+			if name == "mean" {
+				return format(s.Mean)
+			}
+			return format(s.Stddev)
+		}
+
+		row := []string{name, pick(summary.Duration), ""}
+		for _, domain := range readers.Domains {
+			name := domain.String()
+			row = append(row, pick(summary.Energy[name]), pick(summary.AverageWatts[name]), pick(summary.PeakWatts[name]))
+		}
+
+		err := writer.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
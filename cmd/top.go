@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/attribution"
+	"github.com/rekuberate-io/power/pkg/output"
+	"github.com/rekuberate-io/power/pkg/readers"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	ansiAlternateScreen = "\033[?1049h"
+	ansiMainScreen      = "\033[?1049l"
+	ansiHideCursor      = "\033[?25l"
+	ansiShowCursor      = "\033[?25h"
+	ansiHome            = "\033[H"
+	ansiClearToEnd      = "\033[J"
+	ansiClearLine       = "\033[K"
+	ansiBold            = "\033[1m"
+	ansiReverse         = "\033[7m"
+	ansiReset           = "\033[0m"
+)
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// history keeps the last values of a series, oldest first
+type history struct {
+	values []float64
+	size   int
+}
+
+func (h *history) add(value float64) {
+	h.values = append(h.values, value)
+	if len(h.values) > h.size {
+		h.values = h.values[len(h.values)-h.size:]
+	}
+}
+
+// sparkline draws the series scaled between zero and its maximum
+func (h *history) sparkline() string {
+	max := 0.0
+	for _, value := range h.values {
+		if value > max {
+			max = value
+		}
+	}
+
+	line := make([]rune, 0, h.size)
+	for _, value := range h.values {
+		level := 0
+		if max > 0 {
+			level = int(value / max * float64(len(sparks)-1))
+		}
+		line = append(line, sparks[level])
+	}
+
+	for len(line) < h.size {
+		line = append(line, ' ')
+	}
+
+	return string(line)
+}
+
+// processTotal is the energy a process was attributed since the dashboard started
+type processTotal struct {
+	pid    int
+	comm   string
+	joules float64
+	last   attribution.ProcessEnergy
+}
+
+// dashboard holds the state top renders from
+type dashboard struct {
+	header   output.Header
+	unit     output.Unit
+	size     int
+	top      int
+	started  time.Time
+	power    map[int64]map[readers.Domain]*history
+	throttle map[int64]*history
+	// throttleErr explains why no throttling is shown, nil when it is
+	throttleErr error
+	processes   map[int]*processTotal
+	attribution attribution.ProcessAttribution
+}
+
+// top shows the power of every package and domain, their recent history, the throttling and the processes consuming
+// the most energy, refreshed every interval until interrupted
+func top(args []string) error {
+	flags, common := newReaderFlagSet("top", "top [flags]", 1*time.Second)
+	common.addUnits(flags)
+	size := flags.Int("history", 60, "number of samples in the sparklines")
+	processes := flags.Int("processes", 10, "number of processes to show")
+	count := flags.Int("count", 0, "number of refreshes, 0 to refresh until interrupted")
+	procRoot := flags.String("proc-root", "", "mount point of procfs, /proc if empty")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	err = common.validate()
+	if err != nil {
+		return err
+	}
+
+	if *size < 1 {
+		return errors.New("-history has to be at least 1")
+	}
+
+	raplReader, err := common.raplReader()
+	if err != nil {
+		return err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+
+	d := &dashboard{
+		header:    output.NewHeader(hostname, raplReader, readers.TopologyOf(raplReader)),
+		unit:      common.unit,
+		size:      *size,
+		top:       *processes,
+		started:   time.Now(),
+		power:     make(map[int64]map[readers.Domain]*history),
+		throttle:  make(map[int64]*history),
+		processes: make(map[int]*processTotal),
+	}
+
+	var throttling *readers.Throttling
+	msrReader := &readers.MsrReader{}
+	if msrReader.Available() {
+		throttling = readers.NewThrottling(msrReader)
+		_, d.throttleErr = throttling.Sample()
+	} else {
+		d.throttleErr = errors.New(msrReader.Diagnose().Reason)
+	}
+
+	attributor := attribution.NewProcessAttributor(attribution.ProcFS{Root: *procRoot}, readers.TopologyOf(raplReader))
+	err = attributor.Prime()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	sampler := readers.NewSampler(raplReader, *common.interval)
+	samples := sampler.Subscribe(1)
+
+	go func() {
+		err := sampler.Run(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			klog.Errorln(err)
+		}
+	}()
+
+	fmt.Print(ansiAlternateScreen + ansiHideCursor)
+	defer fmt.Print(ansiShowCursor + ansiMainScreen)
+
+	d.render(sampler)
+
+	refreshed := 0
+	for sample := range samples {
+		// a failed read keeps the previous attribution, the dashboard still shows the failure
+		attributed, err := attributor.Attribute(sample)
+		if err != nil {
+			klog.Errorln(err)
+		} else {
+			d.attribute(attributed)
+		}
+
+		if throttling != nil && d.throttleErr == nil {
+			throttled, err := throttling.Sample()
+			if err != nil {
+				d.throttleErr = err
+			}
+
+			for pkgId, fraction := range throttled {
+				d.historyOf(d.throttle, pkgId).add(fraction * 100)
+			}
+		}
+
+		power := sample.Power()
+		for pkgId := range sample.Energy {
+			if _, exists := d.power[pkgId]; !exists {
+				d.power[pkgId] = make(map[readers.Domain]*history)
+			}
+
+			for _, domain := range readers.Domains {
+				h, exists := d.power[pkgId][domain]
+				if !exists {
+					h = &history{size: d.size}
+					d.power[pkgId][domain] = h
+				}
+				h.add(readers.Energy(power[pkgId]).Get(domain))
+			}
+		}
+
+		d.render(sampler)
+
+		refreshed++
+		if *count > 0 && refreshed >= *count {
+			stop()
+		}
+	}
+
+	return nil
+}
+
+// attribute adds the energy of the processes to their totals, and drops the totals of the processes that exited, the
+// pids would pile up otherwise. A process that was not scheduled during the interval keeps its total
+func (d *dashboard) attribute(attributed attribution.ProcessAttribution) {
+	d.attribution = attributed
+
+	for _, process := range attributed.Processes {
+		total, exists := d.processes[process.Pid]
+		if !exists || total.comm != process.Comm {
+			total = &processTotal{pid: process.Pid, comm: process.Comm}
+			d.processes[process.Pid] = total
+		}
+
+		total.joules += process.Energy.Pkg
+		total.last = process
+	}
+
+	// a reused pid runs another command
+	for pid, total := range d.processes {
+		if comm, alive := attributed.Alive[pid]; !alive || comm != total.comm {
+			delete(d.processes, pid)
+		}
+	}
+}
+
+func (d *dashboard) historyOf(histories map[int64]*history, pkgId int64) *history {
+	h, exists := histories[pkgId]
+	if !exists {
+		h = &history{size: d.size}
+		histories[pkgId] = h
+	}
+
+	return h
+}
+
+// render draws the whole screen into a buffer first, so that it is written to the terminal at once without flicker
+func (d *dashboard) render(sampler *readers.Sampler) {
+	var screen bytes.Buffer
+	line := func(format string, a ...interface{}) {
+		fmt.Fprintf(&screen, format, a...)
+		screen.WriteString(ansiClearLine + "\n")
+	}
+
+	last := sampler.Last()
+	totals := sampler.Totals()
+	supported := sampler.Supported()
+
+	screen.WriteString(ansiHome)
+
+	estimated := ""
+	if d.header.Estimated {
+		estimated = " ESTIMATED"
+	}
+	line("%spower top%s - %s - %s%s - %s - up %s", ansiBold, ansiReset, d.header.Hostname, d.header.Reader, estimated, time.Now().Format("15:04:05"), time.Since(d.started).Round(time.Second))
+	for _, cpu := range d.header.Topology {
+		line("Socket %d: %s '%s/%s/Fam:%d' (packages: %v, cores: %d)", cpu.Socket, cpu.Vendor, cpu.ModelName, cpu.InternalName, cpu.Family, cpu.Packages, len(cpu.Cores))
+	}
+	line("")
+
+	line("%s%-8s %-10s %12s  %-*s %18s%s", ansiReverse, "PACKAGE", "DOMAIN", "WATTS", d.size, "HISTORY", "TOTAL ("+d.unit.Name+")", ansiReset)
+
+	var pkgIds []int64
+	for pkgId := range d.power {
+		pkgIds = append(pkgIds, pkgId)
+	}
+	sort.Slice(pkgIds, func(i, j int) bool { return pkgIds[i] < pkgIds[j] })
+
+	if len(pkgIds) == 0 {
+		line("waiting for the first sample...")
+	}
+
+	power := last.Power()
+	for _, pkgId := range pkgIds {
+		pkgLabel := fmt.Sprint(pkgId)
+		for _, domain := range readers.Domains {
+			if !output.HasDomain(supported[pkgId], domain) {
+				continue
+			}
+
+			line("%-8s %-10s %12.3f  %s %18.6f", pkgLabel, domain, readers.Energy(power[pkgId]).Get(domain), d.power[pkgId][domain].sparkline(), d.unit.Convert(totals[pkgId].Get(domain)))
+			pkgLabel = ""
+		}
+
+		if h, exists := d.throttle[pkgId]; exists && len(h.values) > 0 {
+			line("%-8s %-10s %11.1f%%  %s", pkgLabel, "throttled", h.values[len(h.values)-1], h.sparkline())
+		} else {
+			line("%-8s %-10s %12s", pkgLabel, "throttled", "n/a")
+		}
+	}
+
+	if d.throttleErr != nil {
+		line("throttling: n/a, %s", d.throttleErr)
+	}
+	if last.Err != nil {
+		line("last read failed: %s", last.Err)
+	}
+	line("")
+
+	line("%s%-8s %-16s %8s %8s %12s %18s%s", ansiReverse, "PID", "COMMAND", "PACKAGE", "SHARE", "WATTS", "TOTAL ("+d.unit.Name+")", ansiReset)
+	interval := d.attribution.Interval.Seconds()
+	for _, process := range d.attribution.Top(d.top) {
+		watts := 0.0
+		if interval > 0 {
+			watts = process.Energy.Pkg / interval
+		}
+
+		line("%-8d %-16.16s %8d %7.1f%% %12.3f %18.6f", process.Pid, process.Comm, process.Package, process.Share*100, watts, d.unit.Convert(d.processes[process.Pid].joules))
+	}
+
+	screen.WriteString(ansiClearToEnd)
+
+	_, err := os.Stdout.Write(screen.Bytes())
+	if err != nil {
+		klog.Errorln(err)
+	}
+}
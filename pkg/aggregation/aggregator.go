@@ -0,0 +1,430 @@
+package aggregation
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+// NodeTotal is the package id of the rollups summing every package of the node
+const NodeTotal int64 = -1
+
+// ErrTooLate is returned for a sample whose windows were closed already, it is dropped
+var ErrTooLate = errors.New("sample is older than the allowed lateness, its windows are closed")
+
+// Config configures an Aggregator
+type Config struct {
+	// Resolutions are the rollups to produce, every one of Resolutions if empty
+	Resolutions []Resolution
+	// Lateness is how long a window stays open after its end, measured by the end of the latest sample, to accept
+	// samples arriving out of order
+	Lateness time.Duration
+	// GapTolerance is the longest stretch without samples that is not reported as a gap
+	GapTolerance time.Duration
+	// Location aligns the windows, UTC if nil
+	Location *time.Location
+}
+
+// Gap is a stretch of a window no sample covers
+type Gap struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Rollup summarizes the samples of a package, or of the whole node, during a window
+type Rollup struct {
+	Resolution Resolution
+	// Package is the id of the package, NodeTotal for the sum of every package
+	Package int64
+	Start   time.Time
+	End     time.Time
+	// Energy is the joules consumed during the window. A sample crossing the boundary of the window is split in
+	// proportion to its overlap
+	Energy readers.Energy
+	// Mean is the average power over the time covered by samples, Min, Max and P95 are taken over the average power of
+	// every sample overlapping the window
+	Mean readers.Power
+	Min  readers.Power
+	Max  readers.Power
+	P95  readers.Power
+	// Samples is the number of samples overlapping the window
+	Samples int
+	// Covered is the time of the window covered by samples
+	Covered time.Duration
+	// Gaps are the stretches of the window, up to the latest sample, longer than the gap tolerance without samples
+	Gaps []Gap
+	// Late is the number of samples merged into the window after a later sample was seen
+	Late int
+	// Complete is set once the window is closed, an open window may still change
+	Complete bool
+}
+
+// Coverage returns the fraction of the window covered by samples
+func (r Rollup) Coverage() float64 {
+	return r.Covered.Seconds() / r.End.Sub(r.Start).Seconds()
+}
+
+type span struct {
+	start, end time.Time
+}
+
+// series is the state of a package, or the node, during a window
+type series struct {
+	energy readers.Energy
+	watts  []readers.Power
+}
+
+type windowKey struct {
+	resolution Resolution
+	start      int64
+}
+
+type window struct {
+	resolution Resolution
+	start, end time.Time
+	series     map[int64]*series
+	covered    []span
+	samples    int
+	late       int
+}
+
+// Aggregator rolls timestamped energy measurements up into windows of a minute, an hour and a day. Windows are
+// emitted by Flush once they are closed, i.e. once a sample ending Lateness after them was added. Samples are expected
+// not to overlap, like the ones of a readers.Sampler, overlapping samples are both accounted
+type Aggregator struct {
+	config Config
+
+	mu        sync.Mutex
+	windows   map[windowKey]*window
+	watermark time.Time
+	dropped   int
+}
+
+// New creates an aggregator
+func New(config Config) *Aggregator {
+	if len(config.Resolutions) == 0 {
+		config.Resolutions = Resolutions
+	}
+	if config.Location == nil {
+		config.Location = time.UTC
+	}
+
+	return &Aggregator{
+		config:  config,
+		windows: make(map[windowKey]*window),
+	}
+}
+
+// AddSample adds a sample of a readers.Sampler. Failed samples add nothing, the time they missed shows as a gap
+func (a *Aggregator) AddSample(sample readers.Sample) error {
+	if sample.Err != nil || sample.Time.IsZero() {
+		return nil
+	}
+
+	return a.add(sample.Time.Add(-sample.Interval), sample.Time, sample.Energy)
+}
+
+// AddMeasurement adds the energy deltas of a measurement taken over the interval ending at end, e.g. by
+// RaplReader.Read
+func (a *Aggregator) AddMeasurement(end time.Time, interval time.Duration, measurement readers.Measurement) error {
+	return a.add(end.Add(-interval), end, measurement.Packages())
+}
+
+func (a *Aggregator) add(start time.Time, end time.Time, energy map[int64]readers.Energy) error {
+	if !end.After(start) {
+		return errors.New("the interval of the sample is empty")
+	}
+
+	// the node total of the sample is accounted like a package
+	packages := make(map[int64]readers.Energy, len(energy)+1)
+	node := readers.Energy{}
+	for pkgId, pkgEnergy := range energy {
+		packages[pkgId] = pkgEnergy
+		node = node.Add(pkgEnergy)
+	}
+	packages[NodeTotal] = node
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// the finest window a sample starts in closes first, once it is closed the sample can not be accounted completely
+	if a.closed(a.finest(), start, a.watermark) {
+		a.dropped++
+		return ErrTooLate
+	}
+	late := end.Before(a.watermark)
+
+	interval := end.Sub(start)
+	for _, resolution := range a.config.Resolutions {
+		for windowStart := resolution.Start(start, a.config.Location); windowStart.Before(end); windowStart = resolution.End(windowStart) {
+			w := a.window(resolution, windowStart)
+
+			overlap := span{start: maxTime(start, w.start), end: minTime(end, w.end)}
+			fraction := overlap.end.Sub(overlap.start).Seconds() / interval.Seconds()
+
+			for pkgId, pkgEnergy := range packages {
+				s, exists := w.series[pkgId]
+				if !exists {
+					s = &series{}
+					w.series[pkgId] = s
+				}
+
+				s.energy = s.energy.Add(pkgEnergy.Scale(fraction))
+				s.watts = append(s.watts, pkgEnergy.ToWatts(interval))
+			}
+
+			w.covered = append(w.covered, overlap)
+			w.samples++
+			if late {
+				w.late++
+			}
+		}
+	}
+
+	if end.After(a.watermark) {
+		a.watermark = end
+	}
+
+	return nil
+}
+
+func (a *Aggregator) window(resolution Resolution, start time.Time) *window {
+	key := windowKey{resolution: resolution, start: start.UnixNano()}
+
+	w, exists := a.windows[key]
+	if !exists {
+		w = &window{
+			resolution: resolution,
+			start:      start,
+			end:        resolution.End(start),
+			series:     make(map[int64]*series),
+		}
+		a.windows[key] = w
+	}
+
+	return w
+}
+
+func (a *Aggregator) finest() Resolution {
+	finest := a.config.Resolutions[0]
+	for _, resolution := range a.config.Resolutions {
+		if resolution < finest {
+			finest = resolution
+		}
+	}
+
+	return finest
+}
+
+// closed reports whether the window of resolution containing t is closed at the watermark
+func (a *Aggregator) closed(resolution Resolution, t time.Time, watermark time.Time) bool {
+	end := resolution.End(resolution.Start(t, a.config.Location))
+	return !watermark.Before(end.Add(a.config.Lateness))
+}
+
+// Dropped returns the number of samples dropped because they arrived after their windows closed
+func (a *Aggregator) Dropped() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.dropped
+}
+
+// Flush removes the windows closed by now and returns their rollups
+func (a *Aggregator) Flush() []Rollup {
+	return a.flush(false)
+}
+
+// Close removes every window, closed or not, and returns their rollups. Windows still open are not Complete
+func (a *Aggregator) Close() []Rollup {
+	return a.flush(true)
+}
+
+// Open returns the rollups of the windows still open, without removing them, e.g. to export the current hour
+func (a *Aggregator) Open() []Rollup {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var rollups []Rollup
+	for _, w := range a.windows {
+		rollups = append(rollups, a.rollups(w, false)...)
+	}
+	sortRollups(rollups)
+
+	return rollups
+}
+
+func (a *Aggregator) flush(all bool) []Rollup {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var rollups []Rollup
+	for key, w := range a.windows {
+		complete := !a.watermark.Before(w.end.Add(a.config.Lateness))
+		if !complete && !all {
+			continue
+		}
+
+		rollups = append(rollups, a.rollups(w, complete)...)
+		delete(a.windows, key)
+	}
+	sortRollups(rollups)
+
+	return rollups
+}
+
+// Run adds every sample and emits the rollups of the windows as they close, until samples is closed or ctx is done.
+// The windows still open are emitted then, not Complete
+func (a *Aggregator) Run(ctx context.Context, samples <-chan readers.Sample, emit func(Rollup)) error {
+	defer func() {
+		for _, rollup := range a.Close() {
+			emit(rollup)
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case sample, ok := <-samples:
+			if !ok {
+				return nil
+			}
+
+			err := a.AddSample(sample)
+			if err != nil && !errors.Is(err, ErrTooLate) {
+				return err
+			}
+
+			for _, rollup := range a.Flush() {
+				emit(rollup)
+			}
+		}
+	}
+}
+
+func (a *Aggregator) rollups(w *window, complete bool) []Rollup {
+	covered := merge(w.covered)
+
+	var duration time.Duration
+	for _, s := range covered {
+		duration += s.end.Sub(s.start)
+	}
+
+	// only the part of the window up to the latest sample can have gaps yet
+	gaps := []Gap{}
+	cursor := w.start
+	until := minTime(w.end, a.watermark)
+	for _, s := range append(covered, span{start: until, end: until}) {
+		if s.start.Sub(cursor) > a.config.GapTolerance {
+			gaps = append(gaps, Gap{Start: cursor, End: minTime(s.start, until)})
+		}
+		cursor = maxTime(cursor, s.end)
+		if !cursor.Before(until) {
+			break
+		}
+	}
+
+	var rollups []Rollup
+	for pkgId, s := range w.series {
+		rollup := Rollup{
+			Resolution: w.resolution,
+			Package:    pkgId,
+			Start:      w.start,
+			End:        w.end,
+			Energy:     s.energy,
+			Mean:       s.energy.ToWatts(duration),
+			Samples:    w.samples,
+			Covered:    duration,
+			Gaps:       gaps,
+			Late:       w.late,
+			Complete:   complete,
+		}
+
+		for _, domain := range readers.Domains {
+			values := make([]float64, 0, len(s.watts))
+			for _, watts := range s.watts {
+				values = append(values, readers.Energy(watts).Get(domain))
+			}
+			sort.Float64s(values)
+
+			setPower(&rollup.Min, domain, values[0])
+			setPower(&rollup.Max, domain, values[len(values)-1])
+			setPower(&rollup.P95, domain, percentile(values, 0.95))
+		}
+
+		rollups = append(rollups, rollup)
+	}
+
+	return rollups
+}
+
+// merge sorts the spans and merges the overlapping ones
+func merge(spans []span) []span {
+	sorted := make([]span, len(spans))
+	copy(sorted, spans)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].start.Before(sorted[j].start) })
+
+	var merged []span
+	for _, s := range sorted {
+		if len(merged) > 0 && !s.start.After(merged[len(merged)-1].end) {
+			last := &merged[len(merged)-1]
+			last.end = maxTime(last.end, s.end)
+			continue
+		}
+
+		merged = append(merged, s)
+	}
+
+	return merged
+}
+
+// percentile returns the nearest rank percentile of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+
+	return sorted[rank]
+}
+
+func setPower(power *readers.Power, domain readers.Domain, value float64) {
+	energy := readers.Energy(*power)
+	energy.Set(domain, value)
+	*power = readers.Power(energy)
+}
+
+func sortRollups(rollups []Rollup) {
+	sort.Slice(rollups, func(i, j int) bool {
+		if rollups[i].Resolution != rollups[j].Resolution {
+			return rollups[i].Resolution < rollups[j].Resolution
+		}
+		if !rollups[i].Start.Equal(rollups[j].Start) {
+			return rollups[i].Start.Before(rollups[j].Start)
+		}
+
+		return rollups[i].Package < rollups[j].Package
+	})
+}
+
+func minTime(a time.Time, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+
+	return b
+}
+
+func maxTime(a time.Time, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,261 @@
+package aggregation
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+var minute = time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+// at returns the time seconds after the start of the minute
+func at(seconds int) time.Time {
+	return minute.Add(time.Duration(seconds) * time.Second)
+}
+
+// sampleSpan is a sample from the second from to the second to of the minute, of the joules of every package
+type sampleSpan struct {
+	from, to int
+	energy   map[int64]readers.Energy
+}
+
+func (s sampleSpan) sample() readers.Sample {
+	energy := s.energy
+	if energy == nil {
+		energy = map[int64]readers.Energy{0: {Pkg: float64(s.to - s.from)}}
+	}
+
+	return readers.Sample{Time: at(s.to), Interval: at(s.to).Sub(at(s.from)), Energy: energy}
+}
+
+// rollupOf returns the rollup of the package in the window of resolution starting at start
+func rollupOf(t *testing.T, rollups []Rollup, resolution Resolution, pkgId int64, start time.Time) Rollup {
+	t.Helper()
+
+	for _, rollup := range rollups {
+		if rollup.Resolution == resolution && rollup.Package == pkgId && rollup.Start.Equal(start) {
+			return rollup
+		}
+	}
+
+	t.Fatalf("no %s rollup of package %d starting at %s in %+v", resolution, pkgId, start, rollups)
+	return Rollup{}
+}
+
+func addSamples(t *testing.T, aggregator *Aggregator, spans ...sampleSpan) {
+	t.Helper()
+
+	for _, s := range spans {
+		if err := aggregator.AddSample(s.sample()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAggregatorGaps(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		tolerance time.Duration
+		froms     []int
+		gaps      []Gap
+		covered   time.Duration
+	}{
+		{name: "contiguous", froms: []int{0, 10, 20, 30, 40, 50}, gaps: []Gap{}, covered: time.Minute},
+		{name: "missing sample", tolerance: 5 * time.Second, froms: []int{0, 10, 30, 40, 50}, gaps: []Gap{{Start: at(20), End: at(30)}}, covered: 50 * time.Second},
+		{name: "within tolerance", tolerance: 10 * time.Second, froms: []int{0, 10, 30, 40, 50}, gaps: []Gap{}, covered: 50 * time.Second},
+		{name: "late start", tolerance: 5 * time.Second, froms: []int{10, 20, 30, 40, 50}, gaps: []Gap{{Start: at(0), End: at(10)}}, covered: 50 * time.Second},
+		{name: "two gaps", froms: []int{0, 20, 40}, gaps: []Gap{{Start: at(10), End: at(20)}, {Start: at(30), End: at(40)}, {Start: at(50), End: at(60)}}, covered: 30 * time.Second},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			aggregator := New(Config{Resolutions: []Resolution{Minute}, GapTolerance: test.tolerance})
+			for _, from := range test.froms {
+				addSamples(t, aggregator, sampleSpan{from: from, to: from + 10})
+			}
+			// the next minute closes the window up to its end
+			addSamples(t, aggregator, sampleSpan{from: 60, to: 70})
+
+			rollup := rollupOf(t, aggregator.Flush(), Minute, NodeTotal, minute)
+			if len(rollup.Gaps) != len(test.gaps) {
+				t.Fatalf("got gaps %+v, want %+v", rollup.Gaps, test.gaps)
+			}
+			for i, gap := range test.gaps {
+				if !rollup.Gaps[i].Start.Equal(gap.Start) || !rollup.Gaps[i].End.Equal(gap.End) {
+					t.Errorf("got gaps %+v, want %+v", rollup.Gaps, test.gaps)
+				}
+			}
+			if rollup.Covered != test.covered || !rollup.Complete {
+				t.Errorf("got %s covered of a complete window %v, want %s of a complete one", rollup.Covered, rollup.Complete, test.covered)
+			}
+		})
+	}
+}
+
+func TestAggregatorLateness(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		lateness time.Duration
+		late     sampleSpan
+		err      error
+		lates    int
+		dropped  int
+	}{
+		{name: "closed window", late: sampleSpan{from: 20, to: 30}, err: ErrTooLate, dropped: 1},
+		{name: "within lateness", lateness: 30 * time.Second, late: sampleSpan{from: 20, to: 30}, lates: 1},
+		{name: "lateness exceeded", lateness: 5 * time.Second, late: sampleSpan{from: 20, to: 30}, err: ErrTooLate, dropped: 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			aggregator := New(Config{Resolutions: []Resolution{Minute}, Lateness: test.lateness})
+			addSamples(t, aggregator, sampleSpan{from: 0, to: 10}, sampleSpan{from: 10, to: 20}, sampleSpan{from: 60, to: 70})
+
+			err := aggregator.AddSample(test.late.sample())
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+			if dropped := aggregator.Dropped(); dropped != test.dropped {
+				t.Errorf("got %d dropped, want %d", dropped, test.dropped)
+			}
+
+			rollup := rollupOf(t, aggregator.Close(), Minute, NodeTotal, minute)
+			if rollup.Late != test.lates {
+				t.Errorf("got %d late samples, want %d", rollup.Late, test.lates)
+			}
+			if want := float64(20 + 10*test.lates); rollup.Energy.Pkg != want {
+				t.Errorf("got %v J, want %v J", rollup.Energy.Pkg, want)
+			}
+		})
+	}
+}
+
+func TestAggregatorSplitsAcrossBoundary(t *testing.T) {
+	for _, test := range []struct {
+		name          string
+		sample        sampleSpan
+		first, second float64
+	}{
+		{name: "halves", sample: sampleSpan{from: 50, to: 70, energy: map[int64]readers.Energy{0: {Pkg: 20}}}, first: 10, second: 10},
+		{name: "quarter", sample: sampleSpan{from: 45, to: 65, energy: map[int64]readers.Energy{0: {Pkg: 100}}}, first: 75, second: 25},
+		{name: "ends on the boundary", sample: sampleSpan{from: 40, to: 60, energy: map[int64]readers.Energy{0: {Pkg: 20}}}, first: 20},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			aggregator := New(Config{Resolutions: []Resolution{Minute, Hour}})
+			addSamples(t, aggregator, test.sample)
+			rollups := aggregator.Close()
+
+			if got := rollupOf(t, rollups, Minute, 0, minute).Energy.Pkg; math.Abs(got-test.first) > 1e-9 {
+				t.Errorf("got %v J in the first minute, want %v J", got, test.first)
+			}
+			if test.second > 0 {
+				if got := rollupOf(t, rollups, Minute, 0, at(60)).Energy.Pkg; math.Abs(got-test.second) > 1e-9 {
+					t.Errorf("got %v J in the second minute, want %v J", got, test.second)
+				}
+			}
+
+			// the hour holds the whole sample
+			if got := rollupOf(t, rollups, Hour, 0, minute).Energy.Pkg; math.Abs(got-test.first-test.second) > 1e-9 {
+				t.Errorf("got %v J in the hour, want %v J", got, test.first+test.second)
+			}
+		})
+	}
+}
+
+func TestAggregatorPowerStatistics(t *testing.T) {
+	aggregator := New(Config{Resolutions: []Resolution{Minute}})
+	// 1 s samples drawing 1 W to 20 W
+	for watts := 1; watts <= 20; watts++ {
+		addSamples(t, aggregator, sampleSpan{from: watts - 1, to: watts, energy: map[int64]readers.Energy{0: {Pkg: float64(watts), DRAM: 1}}})
+	}
+
+	rollup := rollupOf(t, aggregator.Close(), Minute, 0, minute)
+	for _, test := range []struct {
+		name      string
+		got, want float64
+	}{
+		{name: "min", got: rollup.Min.Pkg, want: 1},
+		{name: "max", got: rollup.Max.Pkg, want: 20},
+		{name: "p95", got: rollup.P95.Pkg, want: 19},
+		{name: "mean over the covered time", got: rollup.Mean.Pkg, want: 10.5},
+		{name: "dram min", got: rollup.Min.DRAM, want: 1},
+		{name: "dram p95", got: rollup.P95.DRAM, want: 1},
+	} {
+		if math.Abs(test.got-test.want) > 1e-9 {
+			t.Errorf("%s: got %v W, want %v W", test.name, test.got, test.want)
+		}
+	}
+	if rollup.Samples != 20 {
+		t.Errorf("got %d samples, want 20", rollup.Samples)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	ramp := make([]float64, 20)
+	for i := range ramp {
+		ramp[i] = float64(i + 1)
+	}
+
+	for _, test := range []struct {
+		sorted []float64
+		p      float64
+		want   float64
+	}{
+		{sorted: ramp, p: 0.95, want: 19},
+		{sorted: ramp, p: 0.5, want: 10},
+		{sorted: ramp, p: 1, want: 20},
+		{sorted: ramp, p: 0, want: 1},
+		{sorted: []float64{5}, p: 0.95, want: 5},
+		{sorted: []float64{1, 2}, p: 0.95, want: 2},
+	} {
+		if got := percentile(test.sorted, test.p); got != test.want {
+			t.Errorf("got p%v %v of %v, want %v", test.p*100, got, test.sorted, test.want)
+		}
+	}
+}
+
+func TestAggregatorNodeTotal(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		samples []sampleSpan
+		energy  readers.Energy
+		max     float64
+	}{
+		{
+			name:    "one package",
+			samples: []sampleSpan{{from: 0, to: 10, energy: map[int64]readers.Energy{0: {Pkg: 10, DRAM: 1}}}},
+			energy:  readers.Energy{Pkg: 10, DRAM: 1},
+			max:     1,
+		},
+		{
+			name:    "two packages",
+			samples: []sampleSpan{{from: 0, to: 10, energy: map[int64]readers.Energy{0: {Pkg: 10, DRAM: 1}, 1: {Pkg: 20}}}},
+			energy:  readers.Energy{Pkg: 30, DRAM: 1},
+			max:     3,
+		},
+		{
+			name: "package missing from a sample",
+			samples: []sampleSpan{
+				{from: 0, to: 10, energy: map[int64]readers.Energy{0: {Pkg: 10}, 1: {Pkg: 20}}},
+				{from: 10, to: 20, energy: map[int64]readers.Energy{0: {Pkg: 10}}},
+			},
+			energy: readers.Energy{Pkg: 40},
+			max:    3,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			aggregator := New(Config{Resolutions: []Resolution{Minute}})
+			addSamples(t, aggregator, test.samples...)
+
+			rollup := rollupOf(t, aggregator.Close(), Minute, NodeTotal, minute)
+			for _, domain := range readers.Domains {
+				if math.Abs(rollup.Energy.Get(domain)-test.energy.Get(domain)) > 1e-9 {
+					t.Errorf("got node energy %+v, want %+v", rollup.Energy, test.energy)
+					break
+				}
+			}
+			if rollup.Max.Pkg != test.max {
+				t.Errorf("got the node drawing at most %v W, want %v W", rollup.Max.Pkg, test.max)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package aggregation
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Resolution is the length of the windows of a rollup
+type Resolution int
+
+const (
+	Minute Resolution = iota
+	Hour
+	Day
+)
+
+// Resolutions lists every resolution from the finest to the coarsest
+var Resolutions = []Resolution{Minute, Hour, Day}
+
+func (r Resolution) String() string {
+	var values []string = []string{"minute", "hour", "day"}
+	if int(r) < 0 || int(r) >= len(values) {
+		return "unknown"
+	}
+
+	return values[r]
+}
+
+// ParseResolution parses the name of a resolution, see Resolution.String
+func ParseResolution(s string) (Resolution, error) {
+	for _, resolution := range Resolutions {
+		if strings.EqualFold(resolution.String(), strings.TrimSpace(s)) {
+			return resolution, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown resolution %q, expected one of: minute, hour, day", s)
+}
+
+// Start returns the start of the window of t, in location. Minutes and hours start at the full minute or hour of the
+// wall clock of location, also in zones offset by a fraction of an hour. They are subtracted from the absolute time,
+// so that the repeated hour when the clocks are set back is a window of its own. Days are aligned to the wall clock of
+// location, so that a day is a calendar day there, even across daylight saving changes
+func (r Resolution) Start(t time.Time, location *time.Location) time.Time {
+	t = t.In(location)
+	seconds := time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+
+	switch r {
+	case Minute:
+		return t.Add(-seconds)
+	case Hour:
+		return t.Add(-time.Duration(t.Minute())*time.Minute - seconds)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, location)
+	}
+}
+
+// End returns the end of the window starting at start
+func (r Resolution) End(start time.Time) time.Time {
+	switch r {
+	case Minute:
+		return start.Add(time.Minute)
+	case Hour:
+		return start.Add(time.Hour)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
@@ -0,0 +1,84 @@
+package aggregation
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+func TestWindowsAcrossDaylightSavingEnd(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	// on 2026-10-25 the clocks go back from 03:00 CEST to 02:00 CET at 01:00 UTC, 02:xx happens twice
+	second := time.Date(2026, time.October, 25, 1, 30, 0, 0, time.UTC)
+	if start := Hour.Start(second, berlin); !start.Equal(time.Date(2026, time.October, 25, 1, 0, 0, 0, time.UTC)) {
+		t.Errorf("the hour of the repeated 02:30 starts at %s, want 02:00 CET", start)
+	}
+	if start := Minute.Start(second.Add(90*time.Second), berlin); !start.Equal(second.Add(time.Minute)) {
+		t.Errorf("the minute of 02:31:30 CET starts at %s, want 02:31 CET", start)
+	}
+
+	aggregator := New(Config{Resolutions: []Resolution{Hour, Day}, Location: berlin})
+
+	// one watt from 02:00 CEST until 03:00 CET, two hours
+	from := time.Date(2026, time.October, 25, 0, 0, 0, 0, time.UTC)
+	for end := from.Add(time.Minute); !end.After(from.Add(2 * time.Hour)); end = end.Add(time.Minute) {
+		err := aggregator.AddSample(readers.Sample{Time: end, Interval: time.Minute, Energy: map[int64]readers.Energy{0: {Pkg: 60}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hours := 0
+	for _, rollup := range aggregator.Close() {
+		if rollup.Package != NodeTotal {
+			continue
+		}
+
+		switch rollup.Resolution {
+		case Hour:
+			hours++
+			if math.Abs(rollup.Energy.Pkg-3600) > 1e-6 || rollup.End.Sub(rollup.Start) != time.Hour || rollup.Coverage() != 1 {
+				t.Errorf("got hour %s-%s with %v J and coverage %v, want a complete hour of 3600 J", rollup.Start, rollup.End, rollup.Energy.Pkg, rollup.Coverage())
+			}
+		case Day:
+			if !rollup.Start.Equal(time.Date(2026, time.October, 25, 0, 0, 0, 0, berlin)) || rollup.End.Sub(rollup.Start) != 25*time.Hour {
+				t.Errorf("got day %s-%s, want the 25 hours of 2026-10-25", rollup.Start, rollup.End)
+			}
+			if math.Abs(rollup.Energy.Pkg-7200) > 1e-6 {
+				t.Errorf("got %v J for the day, want 7200 J", rollup.Energy.Pkg)
+			}
+		}
+	}
+
+	if hours != 2 {
+		t.Errorf("got %d hours, want 02:00 CEST and 02:00 CET", hours)
+	}
+}
+
+func TestWindowsInHalfHourOffsetZone(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	// 10:45:30 IST is 05:15:30 UTC
+	at := time.Date(2026, time.March, 1, 10, 45, 30, 0, kolkata)
+	for _, test := range []struct {
+		resolution Resolution
+		start      time.Time
+	}{
+		{resolution: Minute, start: time.Date(2026, time.March, 1, 10, 45, 0, 0, kolkata)},
+		{resolution: Hour, start: time.Date(2026, time.March, 1, 10, 0, 0, 0, kolkata)},
+		{resolution: Day, start: time.Date(2026, time.March, 1, 0, 0, 0, 0, kolkata)},
+	} {
+		if start := test.resolution.Start(at, kolkata); !start.Equal(test.start) {
+			t.Errorf("the %s of %s starts at %s, want %s", test.resolution, at, start.In(kolkata), test.start)
+		}
+	}
+}
@@ -0,0 +1,473 @@
+package attribution
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+	"k8s.io/klog/v2"
+)
+
+const (
+	cgroupRoot             = "/sys/fs/cgroup"
+	cgroupV2Controllers    = "cgroup.controllers"
+	cgroupV2CpuStat        = "cpu.stat"
+	cgroupV1CpuAcctUsage   = "cpuacct.usage"
+	cgroupV2UsageUsecField = "usage_usec"
+
+	// userHz is the frequency of the ticks in /proc/stat, which is fixed to 100 on every architecture rapl exists on
+	userHz = 100
+
+	// DefaultEvictionGrace is how long the totals of a container or pod are kept after its cgroup disappeared
+	DefaultEvictionGrace = 10 * time.Minute
+)
+
+// the cpuacct hierarchy of cgroup v1 is mounted on its own or co-mounted with the cpu controller
+var cgroupV1CpuAcctHierarchies = []string{"cpuacct", "cpu,cpuacct", "cpuacct,cpu"}
+
+var (
+	podUIDPattern      = regexp.MustCompile(`pod([0-9a-fA-F]{8}[-_][0-9a-fA-F]{4}[-_][0-9a-fA-F]{4}[-_][0-9a-fA-F]{4}[-_][0-9a-fA-F]{12})`)
+	containerIdPattern = regexp.MustCompile(`^(?:[a-z-]+-)?([0-9a-f]{64})(?:\.scope)?$`)
+)
+
+type QoSClass string
+
+const (
+	Guaranteed QoSClass = "guaranteed"
+	Burstable  QoSClass = "burstable"
+	BestEffort QoSClass = "besteffort"
+)
+
+// ContainerUsage is the cpu usage of the cgroup of a kubernetes container
+type ContainerUsage struct {
+	PodUID      string
+	ContainerID string
+	QoS         QoSClass
+	Path        string
+	// UsageUsec is the cpu time the container spent since its cgroup was created, in microseconds
+	UsageUsec uint64
+}
+
+// CgroupSnapshot is the cpu usage of every kubernetes container, and of every cpu, at one point in time
+type CgroupSnapshot struct {
+	Time time.Time
+	// Containers is keyed by container id
+	Containers map[string]ContainerUsage
+	Cpus       map[int]readers.CpuTime
+}
+
+// CgroupFS reads the cpu usage of kubernetes containers from a cgroup v2 (unified) or v1 (cpuacct) hierarchy, for
+// both the systemd (kubepods.slice/...) and the cgroupfs (kubepods/...) cgroup drivers
+type CgroupFS struct {
+	// Root is the mount point of the cgroup hierarchies, /sys/fs/cgroup if empty
+	Root string
+}
+
+func (c CgroupFS) root() string {
+	if c.Root == "" {
+		return cgroupRoot
+	}
+
+	return c.Root
+}
+
+// Version returns 2 when the unified hierarchy is mounted on Root, 1 otherwise
+func (c CgroupFS) Version() int {
+	if readers.FileExists(filepath.Join(c.root(), cgroupV2Controllers)) {
+		return 2
+	}
+
+	return 1
+}
+
+// Containers reads the cpu usage of every kubernetes container cgroup
+func (c CgroupFS) Containers() (map[string]ContainerUsage, error) {
+	hierarchy, usageFile := c.root(), cgroupV2CpuStat
+	if c.Version() == 1 {
+		usageFile = cgroupV1CpuAcctUsage
+
+		found := false
+		for _, name := range cgroupV1CpuAcctHierarchies {
+			if readers.FileExists(filepath.Join(c.root(), name, cgroupV1CpuAcctUsage)) {
+				hierarchy, found = filepath.Join(c.root(), name), true
+				break
+			}
+		}
+
+		if !found {
+			return nil, errors.New("cpuacct cgroup hierarchy not found")
+		}
+	}
+
+	containers := make(map[string]ContainerUsage)
+
+	err := filepath.WalkDir(hierarchy, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// cgroups of exiting containers disappear while walking
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+
+			return err
+		}
+
+		if !entry.IsDir() || !strings.Contains(path, "kubepods") {
+			return nil
+		}
+
+		container, ok := parseContainerPath(strings.TrimPrefix(path, hierarchy))
+		if !ok {
+			return nil
+		}
+
+		usage, err := readUsage(filepath.Join(path, usageFile))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+
+			return err
+		}
+
+		container.UsageUsec = usage
+		containers[container.ContainerID] = container
+
+		// container cgroups are leaves as far as attribution is concerned
+		return fs.SkipDir
+	})
+
+	return containers, err
+}
+
+// parseContainerPath extracts the pod uid, container id and qos class from the path of a container cgroup
+func parseContainerPath(path string) (ContainerUsage, bool) {
+	container := ContainerUsage{Path: path}
+
+	match := containerIdPattern.FindStringSubmatch(filepath.Base(path))
+	if match == nil {
+		return container, false
+	}
+	container.ContainerID = match[1]
+
+	pod := podUIDPattern.FindStringSubmatch(path)
+	if pod == nil {
+		return container, false
+	}
+	// the systemd driver escapes the dashes of the uid to underscores
+	container.PodUID = strings.ReplaceAll(pod[1], "_", "-")
+
+	switch {
+	case strings.Contains(path, "besteffort"):
+		container.QoS = BestEffort
+	case strings.Contains(path, "burstable"):
+		container.QoS = Burstable
+	default:
+		container.QoS = Guaranteed
+	}
+
+	return container, true
+}
+
+// readUsage reads the cpu usage of a cgroup in microseconds, from cpu.stat (v2) or cpuacct.usage (v1, nanoseconds)
+func readUsage(path string) (uint64, error) {
+	if filepath.Base(path) == cgroupV1CpuAcctUsage {
+		usage, err := readers.ReadUintFromFile(path)
+		if err != nil {
+			return 0, err
+		}
+
+		return usage / 1000, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			klog.Errorln(err)
+		}
+	}(file)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == cgroupV2UsageUsecField {
+			return strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, errors.New("usage_usec not found in " + path)
+}
+
+// ContainerEnergy is the energy attributed to a kubernetes container
+type ContainerEnergy struct {
+	PodUID      string
+	ContainerID string
+	QoS         QoSClass
+	// UsageUsec is the cpu time the container spent during the interval, in microseconds
+	UsageUsec uint64
+	// Share is the fraction of the cpu time of the node the container spent
+	Share  float64
+	Energy readers.Energy
+}
+
+// CgroupAttribution splits the energy of the node during an interval across the kubernetes containers
+type CgroupAttribution struct {
+	Time       time.Time
+	Interval   time.Duration
+	Containers []ContainerEnergy
+	// Pods holds the sum of the energy of the containers of every pod, keyed by pod uid
+	Pods map[string]readers.Energy
+	// System holds the energy not attributed to any container (idle, system services, kernel), so that the
+	// containers and System add up to the energy measured across all packages
+	System readers.Energy
+}
+
+// AttributeCgroups splits the energy consumed by all packages between two snapshots across the kubernetes
+// containers, in proportion to the cpu time each one spent relative to the cpu time available on the node. With a
+// modeled idle policy only the dynamic energy is split, relative to the busy time of the node, and the idle energy is
+// charged as the policy says. Every domain is split with the same share
+func AttributeCgroups(before, after CgroupSnapshot, energy map[int64]readers.Energy, idle IdlePolicy) CgroupAttribution {
+	attribution := CgroupAttribution{
+		Time:     after.Time,
+		Interval: after.Time.Sub(before.Time),
+		Pods:     make(map[string]readers.Energy),
+	}
+
+	nodeEnergy := readers.Energy{}
+	nodeIdle := readers.Energy{}
+	nodeDynamic := readers.Energy{}
+	for pkgId, pkgEnergy := range energy {
+		pkgIdle, pkgDynamic := idle.split(pkgId, pkgEnergy, attribution.Interval)
+
+		nodeEnergy = nodeEnergy.Add(pkgEnergy)
+		nodeIdle = nodeIdle.Add(pkgIdle)
+		nodeDynamic = nodeDynamic.Add(pkgDynamic)
+	}
+
+	var capacityTicks uint64
+	for cpuId, cpuTime := range after.Cpus {
+		delta := cpuTime.Sub(before.Cpus[cpuId])
+
+		if idle.modeled() {
+			capacityTicks += delta.Busy()
+		} else {
+			capacityTicks += delta.Total()
+		}
+	}
+	capacityUsec := float64(capacityTicks) * 1000000 / userHz
+
+	total := 0.0
+	for containerId, container := range after.Containers {
+		usage := container.UsageUsec
+		if previous, exists := before.Containers[containerId]; exists {
+			usage = sub(usage, previous.UsageUsec)
+		}
+
+		if usage == 0 || capacityUsec == 0 {
+			continue
+		}
+
+		share := float64(usage) / capacityUsec
+		total += share
+
+		attribution.Containers = append(attribution.Containers, ContainerEnergy{
+			PodUID:      container.PodUID,
+			ContainerID: containerId,
+			QoS:         container.QoS,
+			UsageUsec:   usage,
+			Share:       share,
+		})
+	}
+
+	attributed := readers.Energy{}
+	for i, container := range attribution.Containers {
+		// cgroup usage and cpu times are not read at the same instant, never attribute more than was measured
+		if total > 1 {
+			attribution.Containers[i].Share = container.Share / total
+		}
+
+		containerEnergy := nodeDynamic.Scale(attribution.Containers[i].Share)
+		if idle.Mode == IdleEvenly {
+			containerEnergy = containerEnergy.Add(nodeIdle.Scale(1 / float64(len(attribution.Containers))))
+		}
+
+		attribution.Containers[i].Energy = containerEnergy
+		attribution.Pods[container.PodUID] = attribution.Pods[container.PodUID].Add(containerEnergy)
+		attributed = attributed.Add(containerEnergy)
+	}
+
+	attribution.System = nodeEnergy.Sub(attributed)
+
+	sort.Slice(attribution.Containers, func(i, j int) bool {
+		return attribution.Containers[i].ContainerID < attribution.Containers[j].ContainerID
+	})
+
+	return attribution
+}
+
+// CgroupTotals holds the energy attributed since the attributor started
+type CgroupTotals struct {
+	// Containers is keyed by container id, Share and UsageUsec are those of the last interval
+	Containers map[string]ContainerEnergy
+	// Pods is keyed by pod uid
+	Pods   map[string]readers.Energy
+	System readers.Energy
+}
+
+// CgroupAttributor attributes the samples of a readers.Sampler to kubernetes containers and pods, and keeps
+// monotonic per container and per pod totals. The totals of containers and pods whose cgroups are gone are evicted
+// after EvictionGrace, so that pod churn does not grow them without bound
+type CgroupAttributor struct {
+	// Idle decides how the idle floor of the packages is charged, the zero value leaves it unmodeled
+	Idle IdlePolicy
+	// EvictionGrace is how long the totals of a container or pod are kept after its cgroup was last seen,
+	// DefaultEvictionGrace if zero
+	EvictionGrace time.Duration
+
+	cgroupfs CgroupFS
+	procfs   ProcFS
+
+	mu       sync.Mutex
+	previous *CgroupSnapshot
+	totals   CgroupTotals
+	// containersSeen and podsSeen hold when the cgroup of every container and pod was last seen
+	containersSeen map[string]time.Time
+	podsSeen       map[string]time.Time
+}
+
+// NewCgroupAttributor creates an attributor reading the container usage from cgroupfs and the cpu times from procfs
+func NewCgroupAttributor(cgroupfs CgroupFS, procfs ProcFS) *CgroupAttributor {
+	return &CgroupAttributor{
+		cgroupfs: cgroupfs,
+		procfs:   procfs,
+		totals: CgroupTotals{
+			Containers: make(map[string]ContainerEnergy),
+			Pods:       make(map[string]readers.Energy),
+		},
+		containersSeen: make(map[string]time.Time),
+		podsSeen:       make(map[string]time.Time),
+	}
+}
+
+// Snapshot reads the usage of every container and the cpu times of the node
+func (a *CgroupAttributor) Snapshot() (CgroupSnapshot, error) {
+	snapshot := CgroupSnapshot{Time: time.Now()}
+
+	containers, err := a.cgroupfs.Containers()
+	if err != nil {
+		return snapshot, err
+	}
+	snapshot.Containers = containers
+
+	cpus, err := a.procfs.CpuTimes()
+	if err != nil {
+		return snapshot, err
+	}
+	snapshot.Cpus = cpus
+
+	return snapshot, nil
+}
+
+// Attribute splits the energy of sample across the containers that ran since the previous call and adds it to the
+// totals. The first call only takes a snapshot and returns an empty attribution
+func (a *CgroupAttributor) Attribute(sample readers.Sample) (CgroupAttribution, error) {
+	snapshot, err := a.Snapshot()
+	if err != nil {
+		return CgroupAttribution{}, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	previous := a.previous
+	a.previous = &snapshot
+
+	a.evict(snapshot)
+
+	if previous == nil || sample.Err != nil {
+		return CgroupAttribution{Time: snapshot.Time, Pods: map[string]readers.Energy{}}, sample.Err
+	}
+
+	attribution := AttributeCgroups(*previous, snapshot, sample.Energy, a.Idle)
+
+	for _, container := range attribution.Containers {
+		total := a.totals.Containers[container.ContainerID]
+		container.Energy = total.Energy.Add(container.Energy)
+		a.totals.Containers[container.ContainerID] = container
+	}
+
+	for podUID, energy := range attribution.Pods {
+		a.totals.Pods[podUID] = a.totals.Pods[podUID].Add(energy)
+	}
+
+	a.totals.System = a.totals.System.Add(attribution.System)
+
+	return attribution, nil
+}
+
+// evict drops the totals of the containers and pods whose cgroups were not seen for longer than EvictionGrace
+func (a *CgroupAttributor) evict(snapshot CgroupSnapshot) {
+	for containerId, container := range snapshot.Containers {
+		a.containersSeen[containerId] = snapshot.Time
+		a.podsSeen[container.PodUID] = snapshot.Time
+	}
+
+	grace := a.EvictionGrace
+	if grace <= 0 {
+		grace = DefaultEvictionGrace
+	}
+
+	for containerId, seen := range a.containersSeen {
+		if snapshot.Time.Sub(seen) > grace {
+			delete(a.containersSeen, containerId)
+			delete(a.totals.Containers, containerId)
+			klog.V(5).Infof("evicted the energy totals of container %s, gone since %s", containerId, seen.Format(time.RFC3339))
+		}
+	}
+
+	for podUID, seen := range a.podsSeen {
+		if snapshot.Time.Sub(seen) > grace {
+			delete(a.podsSeen, podUID)
+			delete(a.totals.Pods, podUID)
+			klog.V(5).Infof("evicted the energy totals of pod %s, gone since %s", podUID, seen.Format(time.RFC3339))
+		}
+	}
+}
+
+// Totals returns a copy of the energy attributed since the attributor started
+func (a *CgroupAttributor) Totals() CgroupTotals {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	totals := CgroupTotals{
+		Containers: make(map[string]ContainerEnergy, len(a.totals.Containers)),
+		Pods:       make(map[string]readers.Energy, len(a.totals.Pods)),
+		System:     a.totals.System,
+	}
+
+	for containerId, container := range a.totals.Containers {
+		totals.Containers[containerId] = container
+	}
+
+	for podUID, energy := range a.totals.Pods {
+		totals.Pods[podUID] = energy
+	}
+
+	return totals
+}
@@ -0,0 +1,164 @@
+package attribution
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+const (
+	podA       = "1b4e28ba-2fa1-11d2-883f-0016d3cca427"
+	podB       = "6fa459ea-ee8a-3ca4-894e-db77e160355e"
+	containerA = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	containerB = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+)
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// v2Container is the cgroup of a container of the systemd driver, which escapes the dashes of the pod uid
+func v2Container(root string, qos QoSClass, podUID string, containerId string) string {
+	pod := "kubepods-" + string(qos) + "-pod" + strings.ReplaceAll(podUID, "-", "_") + ".slice"
+	return filepath.Join(root, "kubepods.slice", "kubepods-"+string(qos)+".slice", pod, "cri-containerd-"+containerId+".scope")
+}
+
+func writeV2Usage(t *testing.T, root string, qos QoSClass, podUID string, containerId string, usageUsec uint64) {
+	writeFile(t, filepath.Join(v2Container(root, qos, podUID, containerId), cgroupV2CpuStat),
+		fmt.Sprintf("usage_usec %d\nuser_usec 0\nsystem_usec 0\n", usageUsec))
+}
+
+func writeCpuTimes(t *testing.T, root string, busy uint64, idle uint64) {
+	writeFile(t, filepath.Join(root, procStatPath), fmt.Sprintf(
+		"cpu  %[1]d 0 0 %[2]d 0 0 0 0 0 0\ncpu0 %[1]d 0 0 %[2]d 0 0 0 0 0 0\nintr 0\n", busy, idle))
+}
+
+func TestContainersV2(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, cgroupV2Controllers), "cpu memory")
+	writeV2Usage(t, root, Burstable, podA, containerA, 1500)
+	// a pod cgroup without containers, and a system slice, are not containers
+	writeFile(t, filepath.Join(root, "kubepods.slice", "kubepods-besteffort.slice", "kubepods-besteffort-pod"+strings.ReplaceAll(podB, "-", "_")+".slice", cgroupV2CpuStat), "usage_usec 7\n")
+	writeFile(t, filepath.Join(root, "system.slice", "containerd.service", cgroupV2CpuStat), "usage_usec 9\n")
+
+	cgroupfs := CgroupFS{Root: root}
+	if version := cgroupfs.Version(); version != 2 {
+		t.Fatalf("got cgroup version %d, want 2", version)
+	}
+
+	containers, err := cgroupfs.Containers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(containers) != 1 {
+		t.Fatalf("got containers %+v, want only %s", containers, containerA)
+	}
+
+	container := containers[containerA]
+	if container.PodUID != podA || container.QoS != Burstable || container.UsageUsec != 1500 {
+		t.Errorf("got %+v, want pod %s, burstable, 1500us", container, podA)
+	}
+}
+
+func TestContainersV1(t *testing.T) {
+	root := t.TempDir()
+	hierarchy := filepath.Join(root, "cpu,cpuacct")
+	writeFile(t, filepath.Join(hierarchy, cgroupV1CpuAcctUsage), "123456789000")
+	writeFile(t, filepath.Join(hierarchy, "kubepods", "besteffort", "pod"+podB, containerB, cgroupV1CpuAcctUsage), "2500000")
+	writeFile(t, filepath.Join(hierarchy, "kubepods", "pod"+podA, containerA, cgroupV1CpuAcctUsage), "1000")
+
+	cgroupfs := CgroupFS{Root: root}
+	if version := cgroupfs.Version(); version != 1 {
+		t.Fatalf("got cgroup version %d, want 1", version)
+	}
+
+	containers, err := cgroupfs.Containers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(containers) != 2 {
+		t.Fatalf("got containers %+v, want %s and %s", containers, containerA, containerB)
+	}
+
+	// cpuacct.usage is in nanoseconds
+	if container := containers[containerB]; container.PodUID != podB || container.QoS != BestEffort || container.UsageUsec != 2500 {
+		t.Errorf("got %+v, want pod %s, besteffort, 2500us", container, podB)
+	}
+	if container := containers[containerA]; container.QoS != Guaranteed || container.UsageUsec != 1 {
+		t.Errorf("got %+v, want guaranteed, 1us", container)
+	}
+}
+
+func TestCgroupAttributorEvictsGoneContainers(t *testing.T) {
+	cgroupRoot, procRoot := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(cgroupRoot, cgroupV2Controllers), "cpu")
+	writeV2Usage(t, cgroupRoot, Guaranteed, podA, containerA, 0)
+	writeV2Usage(t, cgroupRoot, BestEffort, podB, containerB, 0)
+	writeCpuTimes(t, procRoot, 0, 0)
+
+	attributor := NewCgroupAttributor(CgroupFS{Root: cgroupRoot}, ProcFS{Root: procRoot})
+	attributor.EvictionGrace = time.Hour
+
+	sample := readers.Sample{Interval: time.Second, Energy: map[int64]readers.Energy{0: {Pkg: 10}}}
+	if _, err := attributor.Attribute(sample); err != nil {
+		t.Fatal(err)
+	}
+
+	// 100 ticks of 10ms are 1s of cpu time, a quarter of it spent by each container
+	writeV2Usage(t, cgroupRoot, Guaranteed, podA, containerA, 250000)
+	writeV2Usage(t, cgroupRoot, BestEffort, podB, containerB, 250000)
+	writeCpuTimes(t, procRoot, 50, 50)
+
+	attribution, err := attributor.Attribute(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(attribution.Pods[podA].Pkg-2.5) > 1e-9 || math.Abs(attribution.System.Pkg-5) > 1e-9 {
+		t.Errorf("got pods %+v and system %+v, want 2.5 J per pod and 5 J of system", attribution.Pods, attribution.System)
+	}
+
+	if err := os.RemoveAll(filepath.Dir(v2Container(cgroupRoot, BestEffort, podB, containerB))); err != nil {
+		t.Fatal(err)
+	}
+
+	// within the grace the totals of the gone container are kept
+	if _, err := attributor.Attribute(sample); err != nil {
+		t.Fatal(err)
+	}
+	if totals := attributor.Totals(); len(totals.Containers) != 2 || len(totals.Pods) != 2 {
+		t.Fatalf("evicted within the grace, got %+v", totals)
+	}
+
+	attributor.EvictionGrace = time.Millisecond
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := attributor.Attribute(sample); err != nil {
+		t.Fatal(err)
+	}
+
+	totals := attributor.Totals()
+	if _, exists := totals.Containers[containerB]; exists || len(totals.Containers) != 1 {
+		t.Errorf("container %s was not evicted, got %+v", containerB, totals.Containers)
+	}
+	if _, exists := totals.Pods[podB]; exists || len(totals.Pods) != 1 {
+		t.Errorf("pod %s was not evicted, got %+v", podB, totals.Pods)
+	}
+	if math.Abs(totals.Pods[podA].Pkg-2.5) > 1e-9 {
+		t.Errorf("got %v J for pod %s, want 2.5 J", totals.Pods[podA].Pkg, podA)
+	}
+}
@@ -0,0 +1,281 @@
+package attribution
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+const (
+	// DefaultMaxUtilization is the busy ratio below which a package is considered quiet during calibration
+	DefaultMaxUtilization = 0.1
+	// minCalibrationSamples is the number of quiet samples per package needed to fit an idle model
+	minCalibrationSamples = 3
+)
+
+// IdleModel holds the static power of every package and domain, i.e. the power drawn at zero utilization
+type IdleModel struct {
+	Created time.Time `json:"created"`
+	Samples int       `json:"samples"`
+	// Packages holds the idle power in watts, per package
+	Packages map[int64]readers.Power `json:"packages"`
+}
+
+// Energy returns the idle energy of package pkgId during interval, in joules
+func (m IdleModel) Energy(pkgId int64, interval time.Duration) readers.Energy {
+	return readers.Energy(m.Packages[pkgId]).Scale(interval.Seconds())
+}
+
+// LoadIdleModel reads an idle model persisted by IdleModel.Save
+func LoadIdleModel(path string) (IdleModel, error) {
+	model := IdleModel{}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return model, err
+	}
+
+	err = json.Unmarshal(data, &model)
+	if err != nil {
+		return model, fmt.Errorf("failed to parse idle model %s: %w", path, err)
+	}
+
+	return model, nil
+}
+
+// Save persists the model as json, replacing path atomically
+func (m IdleModel) Save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+type IdleMode int
+
+const (
+	// IdleUnmodeled splits the whole energy by cpu time relative to the capacity of the cpus, the unused capacity is
+	// what is left unattributed
+	IdleUnmodeled IdleMode = iota
+	// IdleToSystem charges the idle energy of the model to the idle/system bucket, and splits the dynamic energy by
+	// cpu time relative to the busy time of the cpus
+	IdleToSystem
+	// IdleEvenly charges the idle energy of the model evenly to every process or container that ran during the
+	// interval, and splits the dynamic energy like IdleToSystem
+	IdleEvenly
+)
+
+func (m IdleMode) String() string {
+	var values []string = []string{"unmodeled", "system", "even"}
+	if int(m) < 0 || int(m) >= len(values) {
+		return "unknown"
+	}
+
+	return values[m]
+}
+
+// ParseIdleMode parses one of "unmodeled", "system" or "even"
+func ParseIdleMode(s string) (IdleMode, error) {
+	for _, mode := range []IdleMode{IdleUnmodeled, IdleToSystem, IdleEvenly} {
+		if strings.EqualFold(strings.TrimSpace(s), mode.String()) {
+			return mode, nil
+		}
+	}
+
+	return IdleUnmodeled, fmt.Errorf("unknown idle mode %q, expected one of: unmodeled, system, even", s)
+}
+
+// IdlePolicy decides how the idle floor of the packages is charged during attribution, the zero value is IdleUnmodeled
+type IdlePolicy struct {
+	Model *IdleModel
+	Mode  IdleMode
+}
+
+func (p IdlePolicy) modeled() bool {
+	return p.Model != nil && p.Mode != IdleUnmodeled
+}
+
+// split separates the energy of a package during interval into its idle and dynamic part, the idle part never
+// exceeds what was measured
+func (p IdlePolicy) split(pkgId int64, energy readers.Energy, interval time.Duration) (readers.Energy, readers.Energy) {
+	if !p.modeled() {
+		return readers.Energy{}, energy
+	}
+
+	modeled := p.Model.Energy(pkgId, interval)
+
+	idle := readers.Energy{}
+	for _, domain := range readers.Domains {
+		idle.Set(domain, math.Max(0, math.Min(modeled.Get(domain), energy.Get(domain))))
+	}
+
+	return idle, energy.Sub(idle)
+}
+
+type calibrationPoint struct {
+	utilization float64
+	power       readers.Power
+}
+
+// Calibrator fits an IdleModel from samples taken while the host is quiet. For every sample the busy ratio of each
+// package is derived from /proc/stat, samples of packages busier than MaxUtilization are rejected, and the power of
+// the remaining ones is regressed linearly against the busy ratio, the intercept being the idle power
+type Calibrator struct {
+	MaxUtilization float64
+
+	procfs       ProcFS
+	corePackages map[int]int64
+
+	mu       sync.Mutex
+	previous map[int]readers.CpuTime
+	points   map[int64][]calibrationPoint
+}
+
+// NewCalibrator creates a calibrator reading the cpu times from procfs, with the cores mapped to packages by cpus
+func NewCalibrator(procfs ProcFS, cpus map[int]*readers.Cpu) *Calibrator {
+	return &Calibrator{
+		MaxUtilization: DefaultMaxUtilization,
+		procfs:         procfs,
+		corePackages:   readers.CorePackages(cpus),
+		points:         make(map[int64][]calibrationPoint),
+	}
+}
+
+// Prime reads the cpu times the next call of Add is relative to, it should be called right after the sampler is primed
+func (c *Calibrator) Prime() error {
+	cpus, err := c.procfs.CpuTimes()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.previous = cpus
+
+	return nil
+}
+
+// Add records the power of every quiet package of sample, and returns the number of packages accepted
+func (c *Calibrator) Add(sample readers.Sample) (int, error) {
+	cpus, err := c.procfs.CpuTimes()
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	previous := c.previous
+	c.previous = cpus
+
+	if previous == nil || sample.Err != nil {
+		return 0, sample.Err
+	}
+
+	ticks := make(map[int64]readers.CpuTime)
+	for cpuId, cpuTime := range cpus {
+		pkgId := c.corePackages[cpuId]
+		ticks[pkgId] = ticks[pkgId].Add(cpuTime.Sub(previous[cpuId]))
+	}
+
+	accepted := 0
+	for pkgId, power := range sample.Power() {
+		if ticks[pkgId].Total() == 0 {
+			continue
+		}
+
+		utilization := ticks[pkgId].Utilization()
+		if utilization > c.MaxUtilization {
+			continue
+		}
+
+		c.points[pkgId] = append(c.points[pkgId], calibrationPoint{utilization: utilization, power: power})
+		accepted++
+	}
+
+	return accepted, nil
+}
+
+// Fit regresses the power of every package and domain against its busy ratio and returns the intercepts as the model
+func (c *Calibrator) Fit() (IdleModel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	model := IdleModel{
+		Created:  time.Now(),
+		Packages: make(map[int64]readers.Power),
+	}
+
+	for pkgId, points := range c.points {
+		if len(points) < minCalibrationSamples {
+			continue
+		}
+
+		idle := readers.Energy{}
+		for _, domain := range readers.Domains {
+			idle.Set(domain, intercept(points, domain))
+		}
+
+		model.Packages[pkgId] = readers.Power(idle)
+		model.Samples += len(points)
+	}
+
+	if len(model.Packages) == 0 {
+		return model, errors.New(fmt.Sprintf("not enough quiet samples to fit an idle model, at least %d per package with a utilization below %.0f%% are needed", minCalibrationSamples, c.MaxUtilization*100))
+	}
+
+	return model, nil
+}
+
+// intercept fits power = idle + slope * utilization by least squares and returns idle, falling back to the mean power
+// when the utilization did not vary enough to fit a slope
+func intercept(points []calibrationPoint, domain readers.Domain) float64 {
+	n := float64(len(points))
+
+	var sumX, sumY, sumXX, sumXY float64
+	for _, point := range points {
+		x := point.utilization
+		y := readers.Energy(point.power).Get(domain)
+
+		sumX += x
+		sumY += y
+		sumXX += x * x
+		sumXY += x * y
+	}
+
+	meanX, meanY := sumX/n, sumY/n
+	variance := sumXX/n - meanX*meanX
+	if variance < 1e-9 {
+		return math.Max(0, meanY)
+	}
+
+	slope := (sumXY/n - meanX*meanY) / variance
+
+	return math.Max(0, meanY-slope*meanX)
+}
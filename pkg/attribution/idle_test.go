@@ -0,0 +1,160 @@
+package attribution
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+// oneCpu is the topology of a single cpu on package 0
+var oneCpu = map[int]*readers.Cpu{0: {Packages: map[int64]bool{0: true}, Cores: []readers.Core{{Id: 0, Package: 0}}}}
+
+func TestCalibratorFitsIdlePower(t *testing.T) {
+	root := t.TempDir()
+	calibrator := NewCalibrator(ProcFS{Root: root}, oneCpu)
+
+	writeProcStat(t, root, [2]uint64{0, 0})
+	if err := calibrator.Prime(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the package draws 10 W idle and 20 W more per unit of utilization, the dram a constant 2 W
+	var busy, idle uint64
+	for _, step := range []struct {
+		busy, idle uint64
+		accepted   int
+	}{
+		{busy: 5, idle: 95, accepted: 1},
+		{busy: 2, idle: 98, accepted: 1},
+		{busy: 50, idle: 50, accepted: 0},
+		{busy: 8, idle: 92, accepted: 1},
+	} {
+		busy += step.busy
+		idle += step.idle
+		writeProcStat(t, root, [2]uint64{busy, idle})
+
+		utilization := float64(step.busy) / float64(step.busy+step.idle)
+		accepted, err := calibrator.Add(readers.Sample{
+			Interval: 2 * time.Second,
+			Energy:   map[int64]readers.Energy{0: {Pkg: 2 * (10 + 20*utilization), DRAM: 4}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if accepted != step.accepted {
+			t.Errorf("at %.0f%% utilization got %d packages accepted, want %d", utilization*100, accepted, step.accepted)
+		}
+	}
+
+	model, err := calibrator.Fit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model.Samples != 3 {
+		t.Errorf("got %d samples, want the 3 quiet ones", model.Samples)
+	}
+	assertEnergy(t, "idle power", readers.Energy(model.Packages[0]), readers.Energy{Pkg: 10, DRAM: 2})
+}
+
+func TestCalibratorNeedsQuietSamples(t *testing.T) {
+	root := t.TempDir()
+	calibrator := NewCalibrator(ProcFS{Root: root}, oneCpu)
+
+	writeProcStat(t, root, [2]uint64{0, 0})
+	if err := calibrator.Prime(); err != nil {
+		t.Fatal(err)
+	}
+	writeProcStat(t, root, [2]uint64{1, 99})
+	if _, err := calibrator.Add(readers.Sample{Interval: time.Second, Energy: map[int64]readers.Energy{0: {Pkg: 10}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := calibrator.Fit(); err == nil {
+		t.Error("fitted a model from a single sample")
+	}
+}
+
+func TestIdleModelSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "idle.json")
+	model := IdleModel{
+		Created:  time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC),
+		Samples:  12,
+		Packages: map[int64]readers.Power{0: {Pkg: 10.5, DRAM: 2}, 1: {Pkg: 11}},
+	}
+
+	if err := model.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadIdleModel(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !loaded.Created.Equal(model.Created) || loaded.Samples != model.Samples || len(loaded.Packages) != 2 {
+		t.Fatalf("got model %+v, want %+v", loaded, model)
+	}
+	for pkgId, power := range model.Packages {
+		assertEnergy(t, fmt.Sprintf("idle power of package %d", pkgId), readers.Energy(loaded.Packages[pkgId]), readers.Energy(power))
+	}
+}
+
+func TestIdlePolicySplit(t *testing.T) {
+	model := &IdleModel{Packages: map[int64]readers.Power{0: {Pkg: 10, PP0: 4}}}
+
+	// the modeled core idle energy exceeds the measured one, it is capped
+	idle, dynamic := IdlePolicy{Model: model, Mode: IdleToSystem}.split(0, readers.Energy{Pkg: 50, PP0: 6}, 2*time.Second)
+	assertEnergy(t, "idle", idle, readers.Energy{Pkg: 20, PP0: 6})
+	assertEnergy(t, "dynamic", dynamic, readers.Energy{Pkg: 30})
+
+	idle, dynamic = IdlePolicy{Model: model}.split(0, readers.Energy{Pkg: 50, PP0: 6}, 2*time.Second)
+	assertEnergy(t, "unmodeled idle", idle, readers.Energy{})
+	assertEnergy(t, "unmodeled dynamic", dynamic, readers.Energy{Pkg: 50, PP0: 6})
+}
+
+func TestAttributeProcessesIdleModes(t *testing.T) {
+	root := t.TempDir()
+	procfs := ProcFS{Root: root}
+	at := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	writeProcStat(t, root, [2]uint64{0, 0})
+	before := snapshot(t, procfs)
+	before.Time = at
+
+	// the cpu is half busy, 60 ticks for pid 1 and 40 for pid 2
+	writeProcStat(t, root, [2]uint64{100, 100})
+	writePidStat(t, root, 1, "server", 60, 0)
+	writePidStat(t, root, 2, "cron", 40, 0)
+	after := snapshot(t, procfs)
+	after.Time = at.Add(2 * time.Second)
+
+	// 10 W idle over 2 s are 20 J of the 50 J measured
+	model := &IdleModel{Packages: map[int64]readers.Power{0: {Pkg: 10}}}
+	energy := map[int64]readers.Energy{0: {Pkg: 50}}
+
+	for _, test := range []struct {
+		policy     IdlePolicy
+		pid1, pid2 float64
+		idle       float64
+	}{
+		// the whole energy by the share of the capacity of the cpu
+		{policy: IdlePolicy{}, pid1: 15, pid2: 10, idle: 25},
+		// the dynamic energy by the share of the busy time, the idle energy to the system bucket
+		{policy: IdlePolicy{Model: model, Mode: IdleToSystem}, pid1: 18, pid2: 12, idle: 20},
+		// the idle energy evenly across the processes on top
+		{policy: IdlePolicy{Model: model, Mode: IdleEvenly}, pid1: 28, pid2: 22, idle: 0},
+	} {
+		t.Run(test.policy.Mode.String(), func(t *testing.T) {
+			attribution := AttributeProcesses(before, after, energy, map[int]int64{0: 0}, test.policy)
+
+			if len(attribution.Processes) != 2 {
+				t.Fatalf("got processes %+v, want pids 1 and 2", attribution.Processes)
+			}
+			assertEnergy(t, "pid 1", attribution.Processes[0].Energy, readers.Energy{Pkg: test.pid1})
+			assertEnergy(t, "pid 2", attribution.Processes[1].Energy, readers.Energy{Pkg: test.pid2})
+			assertEnergy(t, "idle", attribution.Idle[0], readers.Energy{Pkg: test.idle})
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package attribution
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+// ProcessEnergy is the energy attributed to a process during an interval. Only the package and core (PP0) domains are
+// attributed, uncore, dram and psys can not be related to the cpu time of a process
+type ProcessEnergy struct {
+	Pid     int
+	Comm    string
+	Package int64
+	// Ticks is the cpu time the process spent during the interval, in USER_HZ ticks
+	Ticks uint64
+	// Share is the fraction of the cpu time of its package the process spent
+	Share  float64
+	Energy readers.Energy
+}
+
+// ProcessAttribution splits the energy of every package of an interval across the processes that ran on it
+type ProcessAttribution struct {
+	Time      time.Time
+	Interval  time.Duration
+	Processes []ProcessEnergy
+	// Idle holds the energy not attributed to any process (idle, interrupts, exited processes), per package
+	Idle map[int64]readers.Energy
+	// Alive holds the command of every process alive at the end of the interval, whether it ran during it or not
+	Alive map[int]string
+}
+
+// Top returns the n processes that were attributed the most package energy
+func (a ProcessAttribution) Top(n int) []ProcessEnergy {
+	processes := make([]ProcessEnergy, len(a.Processes))
+	copy(processes, a.Processes)
+
+	sort.Slice(processes, func(i, j int) bool { return processes[i].Energy.Pkg > processes[j].Energy.Pkg })
+	if n >= 0 && n < len(processes) {
+		processes = processes[:n]
+	}
+
+	return processes
+}
+
+// AttributeProcesses splits the package and core energy consumed between two procfs snapshots across the processes,
+// in proportion to the cpu time each one spent on its package. A process is accounted to the package of the cpu it
+// last ran on. With a modeled idle policy only the dynamic energy is split, relative to the busy time of the package,
+// and the idle energy is charged as the policy says. Whatever is not attributed to a process is reported as
+// idle/system energy, so per package the attributed and idle energy add up to the measured one
+func AttributeProcesses(before, after ProcSnapshot, energy map[int64]readers.Energy, corePackages map[int]int64, idle IdlePolicy) ProcessAttribution {
+	attribution := ProcessAttribution{
+		Time:     after.Time,
+		Interval: after.Time.Sub(before.Time),
+		Idle:     make(map[int64]readers.Energy),
+		Alive:    make(map[int]string, len(after.Processes)),
+	}
+
+	for pid, process := range after.Processes {
+		attribution.Alive[pid] = process.Comm
+	}
+
+	packageTicks := make(map[int64]uint64)
+	for cpuId, cpuTime := range after.Cpus {
+		delta := cpuTime.Sub(before.Cpus[cpuId])
+
+		ticks := delta.Total()
+		if idle.modeled() {
+			ticks = delta.Busy()
+		}
+
+		packageTicks[corePackages[cpuId]] += ticks
+	}
+
+	for pid, process := range after.Processes {
+		// processes started during the interval spent all of their cpu time in it
+		ticks := process.Total()
+		if previous, exists := before.Processes[pid]; exists {
+			ticks = sub(ticks, previous.Total())
+		}
+
+		pkgId := corePackages[process.Processor]
+		if ticks == 0 || packageTicks[pkgId] == 0 {
+			continue
+		}
+
+		attribution.Processes = append(attribution.Processes, ProcessEnergy{
+			Pid:     pid,
+			Comm:    process.Comm,
+			Package: pkgId,
+			Ticks:   ticks,
+			Share:   float64(ticks) / float64(packageTicks[pkgId]),
+		})
+	}
+
+	// the per process and per cpu counters are not read at the same instant, so the shares of a package may add up to
+	// slightly more than one, in which case they are scaled down
+	shares := make(map[int64]float64)
+	processes := make(map[int64]int)
+	for _, process := range attribution.Processes {
+		shares[process.Package] += process.Share
+		processes[process.Package]++
+	}
+
+	idleEnergy := make(map[int64]readers.Energy)
+	dynamicEnergy := make(map[int64]readers.Energy)
+	for pkgId, pkgEnergy := range energy {
+		idleEnergy[pkgId], dynamicEnergy[pkgId] = idle.split(pkgId, pkgEnergy, attribution.Interval)
+	}
+
+	attributed := make(map[int64]readers.Energy)
+	for i, process := range attribution.Processes {
+		share := process.Share
+		if shares[process.Package] > 1 {
+			share /= shares[process.Package]
+			attribution.Processes[i].Share = share
+		}
+
+		pkgEnergy := dynamicEnergy[process.Package]
+		processEnergy := readers.Energy{
+			Pkg: pkgEnergy.Pkg * share,
+			PP0: pkgEnergy.PP0 * share,
+		}
+
+		if idle.Mode == IdleEvenly {
+			pkgIdle := idleEnergy[process.Package]
+			processEnergy.Pkg += pkgIdle.Pkg / float64(processes[process.Package])
+			processEnergy.PP0 += pkgIdle.PP0 / float64(processes[process.Package])
+		}
+
+		attribution.Processes[i].Energy = processEnergy
+		attributed[process.Package] = attributed[process.Package].Add(processEnergy)
+	}
+
+	for pkgId, pkgEnergy := range energy {
+		attribution.Idle[pkgId] = pkgEnergy.Sub(attributed[pkgId])
+	}
+
+	sort.Slice(attribution.Processes, func(i, j int) bool { return attribution.Processes[i].Pid < attribution.Processes[j].Pid })
+
+	return attribution
+}
+
+// ProcessAttributor attributes the samples of a readers.Sampler to processes, taking a procfs snapshot per sample
+type ProcessAttributor struct {
+	// Idle decides how the idle floor of the packages is charged, the zero value leaves it unmodeled
+	Idle IdlePolicy
+
+	procfs       ProcFS
+	corePackages map[int]int64
+
+	mu       sync.Mutex
+	previous *ProcSnapshot
+}
+
+// NewProcessAttributor creates an attributor reading procfs, with the cores mapped to packages by the given topology
+func NewProcessAttributor(procfs ProcFS, cpus map[int]*readers.Cpu) *ProcessAttributor {
+	return &ProcessAttributor{
+		procfs:       procfs,
+		corePackages: readers.CorePackages(cpus),
+	}
+}
+
+// Prime takes the procfs snapshot the next call of Attribute is relative to, it should be called right after the
+// sampler is primed
+func (a *ProcessAttributor) Prime() error {
+	snapshot, err := a.procfs.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.previous = &snapshot
+
+	return nil
+}
+
+// Attribute splits the energy of sample across the processes that ran since the previous call. The first call, if
+// Prime was not called, only takes a snapshot and returns an empty attribution
+func (a *ProcessAttributor) Attribute(sample readers.Sample) (ProcessAttribution, error) {
+	snapshot, err := a.procfs.Snapshot()
+	if err != nil {
+		return ProcessAttribution{}, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	previous := a.previous
+	a.previous = &snapshot
+
+	if previous == nil || sample.Err != nil {
+		return ProcessAttribution{Time: snapshot.Time, Idle: map[int64]readers.Energy{}}, sample.Err
+	}
+
+	return AttributeProcesses(*previous, snapshot, sample.Energy, a.corePackages, a.Idle), nil
+}
@@ -0,0 +1,142 @@
+package attribution
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+// writeProcStat writes /proc/stat with a busy (user) and an idle tick count per cpu
+func writeProcStat(t *testing.T, root string, cpus ...[2]uint64) {
+	var busy, idle uint64
+	var lines []string
+	for id, ticks := range cpus {
+		busy += ticks[0]
+		idle += ticks[1]
+		lines = append(lines, fmt.Sprintf("cpu%d %d 0 0 %d 0 0 0 0 0 0", id, ticks[0], ticks[1]))
+	}
+
+	writeFile(t, filepath.Join(root, procStatPath), fmt.Sprintf("cpu  %d 0 0 %d 0 0 0 0 0 0\n%s\nintr 0\n", busy, idle, strings.Join(lines, "\n")))
+}
+
+// writePidStat writes /proc/<pid>/stat of a process that spent ticks in user mode and last ran on processor
+func writePidStat(t *testing.T, root string, pid int, comm string, ticks uint64, processor int) {
+	// the fields after comm, starting with the state (field 3 of proc(5))
+	fields := make([]string, 50)
+	for i := range fields {
+		fields[i] = "0"
+	}
+	fields[0] = "S"
+	fields[11] = fmt.Sprint(ticks)
+	fields[36] = fmt.Sprint(processor)
+
+	writeFile(t, filepath.Join(root, fmt.Sprintf(pidStatPath, pid)), fmt.Sprintf("%d (%s) %s\n", pid, comm, strings.Join(fields, " ")))
+}
+
+func snapshot(t *testing.T, procfs ProcFS) ProcSnapshot {
+	t.Helper()
+
+	s, err := procfs.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func assertEnergy(t *testing.T, what string, got readers.Energy, want readers.Energy) {
+	t.Helper()
+
+	for _, domain := range readers.Domains {
+		if diff := got.Get(domain) - want.Get(domain); diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("%s: got %+v, want %+v", what, got, want)
+			return
+		}
+	}
+}
+
+func TestAttributeProcesses(t *testing.T) {
+	root := t.TempDir()
+	procfs := ProcFS{Root: root}
+	corePackages := map[int]int64{0: 0, 1: 1}
+
+	writeProcStat(t, root, [2]uint64{0, 0}, [2]uint64{0, 0})
+	writePidStat(t, root, 1, "my (weird) proc", 0, 0)
+	writePidStat(t, root, 4, "exited", 10, 0)
+	before := snapshot(t, procfs)
+
+	// package 0 is half busy over 200 ticks, package 1 fully busy over 100
+	writeProcStat(t, root, [2]uint64{100, 100}, [2]uint64{100, 0})
+	writePidStat(t, root, 1, "my (weird) proc", 50, 0)
+	// pid 2 started during the interval, all of its cpu time is in it
+	writePidStat(t, root, 2, "worker", 30, 0)
+	writePidStat(t, root, 3, "batch job", 100, 1)
+	if err := os.Remove(filepath.Join(root, fmt.Sprintf(pidStatPath, 4))); err != nil {
+		t.Fatal(err)
+	}
+	after := snapshot(t, procfs)
+
+	energy := map[int64]readers.Energy{0: {Pkg: 100, PP0: 50, DRAM: 10}, 1: {Pkg: 40, PP0: 20}}
+	attribution := AttributeProcesses(before, after, energy, corePackages, IdlePolicy{})
+
+	if len(attribution.Processes) != 3 {
+		t.Fatalf("got processes %+v, want pids 1 to 3", attribution.Processes)
+	}
+
+	want := []ProcessEnergy{
+		{Pid: 1, Comm: "my (weird) proc", Package: 0, Ticks: 50, Share: 0.25, Energy: readers.Energy{Pkg: 25, PP0: 12.5}},
+		{Pid: 2, Comm: "worker", Package: 0, Ticks: 30, Share: 0.15, Energy: readers.Energy{Pkg: 15, PP0: 7.5}},
+		{Pid: 3, Comm: "batch job", Package: 1, Ticks: 100, Share: 1, Energy: readers.Energy{Pkg: 40, PP0: 20}},
+	}
+	for i, process := range attribution.Processes {
+		w := want[i]
+		if process.Pid != w.Pid || process.Comm != w.Comm || process.Package != w.Package || process.Ticks != w.Ticks || process.Share != w.Share {
+			t.Errorf("got process %+v, want %+v", process, w)
+		}
+		assertEnergy(t, fmt.Sprintf("energy of pid %d", process.Pid), process.Energy, w.Energy)
+	}
+
+	// the exited pid 4 is not alive anymore
+	if len(attribution.Alive) != 3 || attribution.Alive[1] != "my (weird) proc" || attribution.Alive[3] != "batch job" {
+		t.Errorf("got alive processes %v, want pids 1 to 3", attribution.Alive)
+	}
+
+	// the idle remainder holds what no process was charged, dram included
+	assertEnergy(t, "idle of package 0", attribution.Idle[0], readers.Energy{Pkg: 60, PP0: 30, DRAM: 10})
+	assertEnergy(t, "idle of package 1", attribution.Idle[1], readers.Energy{})
+}
+
+func TestProcessTimesSkipsVanishedProcesses(t *testing.T) {
+	root := t.TempDir()
+	writePidStat(t, root, 1, "init", 10, 0)
+	// pid 2 exited between the listing of /proc and the read of its stat
+	if err := os.MkdirAll(filepath.Join(root, "2"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	processes, err := ProcFS{Root: root}.ProcessTimes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(processes) != 1 || processes[1].Comm != "init" {
+		t.Errorf("got processes %+v, want only pid 1", processes)
+	}
+
+	// a process reaped while its stat is read fails with ESRCH instead
+	for _, err := range []error{
+		&os.PathError{Op: "read", Path: "/proc/2/stat", Err: syscall.ESRCH},
+		&os.PathError{Op: "open", Path: "/proc/2/stat", Err: syscall.ENOENT},
+	} {
+		if !vanished(err) {
+			t.Errorf("%s is not taken for a vanished process", err)
+		}
+	}
+	if vanished(&os.PathError{Op: "open", Path: "/proc/2/stat", Err: syscall.EACCES}) {
+		t.Error("a permission error is taken for a vanished process")
+	}
+}
@@ -0,0 +1,165 @@
+package attribution
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+const (
+	procRoot     = "/proc"
+	procStatPath = "stat"
+	pidStatPath  = "%d/stat"
+)
+
+// ProcessTime holds the cpu time a process spent, in USER_HZ ticks as reported by /proc/<pid>/stat
+type ProcessTime struct {
+	Pid   int
+	Comm  string
+	UTime uint64
+	STime uint64
+	// Processor is the cpu the process last ran on
+	Processor int
+}
+
+// Total returns the ticks the process spent in user and kernel mode
+func (p ProcessTime) Total() uint64 {
+	return p.UTime + p.STime
+}
+
+// ProcSnapshot is the cpu time of every cpu and every process at one point in time
+type ProcSnapshot struct {
+	Time      time.Time
+	Cpus      map[int]readers.CpuTime
+	Processes map[int]ProcessTime
+}
+
+// ProcFS reads cpu times from a procfs tree
+type ProcFS struct {
+	// Root is the mount point of procfs, /proc if empty. Pointing it to a fixture tree allows deterministic runs
+	Root string
+}
+
+func (p ProcFS) path(format string, a ...interface{}) string {
+	root := p.Root
+	if root == "" {
+		root = procRoot
+	}
+
+	return filepath.Join(root, fmt.Sprintf(format, a...))
+}
+
+// Snapshot reads the cpu time of every cpu and every process
+func (p ProcFS) Snapshot() (ProcSnapshot, error) {
+	snapshot := ProcSnapshot{Time: time.Now()}
+
+	cpus, err := p.CpuTimes()
+	if err != nil {
+		return snapshot, err
+	}
+	snapshot.Cpus = cpus
+
+	processes, err := p.ProcessTimes()
+	if err != nil {
+		return snapshot, err
+	}
+	snapshot.Processes = processes
+
+	return snapshot, nil
+}
+
+// CpuTimes parses the per cpu lines of /proc/stat
+func (p ProcFS) CpuTimes() (map[int]readers.CpuTime, error) {
+	return readers.ReadCpuTimes(p.path(procStatPath))
+}
+
+// ProcessTimes reads /proc/<pid>/stat of every process, processes exiting while being read are skipped
+func (p ProcFS) ProcessTimes() (map[int]ProcessTime, error) {
+	entries, err := os.ReadDir(p.path(""))
+	if err != nil {
+		return nil, err
+	}
+
+	processes := make(map[int]ProcessTime)
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+
+		process, err := p.ProcessTime(pid)
+		if err != nil {
+			if vanished(err) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		processes[pid] = process
+	}
+
+	return processes, nil
+}
+
+// ProcessTime parses /proc/<pid>/stat, see proc(5)
+func (p ProcFS) ProcessTime(pid int) (ProcessTime, error) {
+	process := ProcessTime{Pid: pid}
+
+	stat, err := readers.ReadStringFromFile(p.path(pidStatPath, pid))
+	if err != nil {
+		return process, err
+	}
+
+	// comm is enclosed in parentheses and may contain spaces and parentheses itself
+	open := strings.Index(stat, "(")
+	closing := strings.LastIndex(stat, ")")
+	if open < 0 || closing < open {
+		return process, fmt.Errorf("failed to parse %s", p.path(pidStatPath, pid))
+	}
+
+	process.Comm = stat[open+1 : closing]
+
+	// fields start with the state, which is field 3 in proc(5)
+	fields := strings.Fields(stat[closing+1:])
+	if len(fields) < 37 {
+		return process, fmt.Errorf("failed to parse %s: %d fields", p.path(pidStatPath, pid), len(fields))
+	}
+
+	values, err := readers.ParseUint64s([]string{fields[11], fields[12]})
+	if err != nil {
+		return process, err
+	}
+
+	process.UTime = values[0]
+	process.STime = values[1]
+
+	process.Processor, err = strconv.Atoi(fields[36])
+	if err != nil {
+		return process, err
+	}
+
+	return process, nil
+}
+
+// vanished reports whether err comes from reading a process that exited meanwhile, its files are gone once it is
+// reaped, or fail with ESRCH when it is reaped while they are opened
+func vanished(err error) bool {
+	return errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ESRCH)
+}
+
+func sub(a, b uint64) uint64 {
+	if a < b {
+		return 0
+	}
+
+	return a - b
+}
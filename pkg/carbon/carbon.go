@@ -0,0 +1,160 @@
+package carbon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+// Emissions holds grams of CO2 equivalent per rapl domain
+type Emissions readers.Energy
+
+// Add sums two emissions
+func (e Emissions) Add(e2 Emissions) Emissions {
+	return Emissions(readers.Energy(e).Add(readers.Energy(e2)))
+}
+
+// Config selects the carbon intensity source, the first one set of URL, SeriesPath and Intensity is used
+type Config struct {
+	// Intensity is a static carbon intensity in gCO2e/kWh
+	Intensity float64
+	// SeriesPath is a csv file of "timestamp,intensity" rows
+	SeriesPath string
+	// URL is a json http endpoint reporting the intensity
+	URL string
+	// PUE is the power usage effectiveness of the facility, the energy measured is multiplied by it. Defaults to 1
+	PUE float64
+}
+
+// Enabled reports whether any carbon intensity source is configured
+func (c Config) Enabled() bool {
+	return c.URL != "" || c.SeriesPath != "" || c.Intensity > 0
+}
+
+// NewEstimator creates an estimator from the configured source
+func NewEstimator(config Config) (*Estimator, error) {
+	var provider Provider
+
+	switch {
+	case config.URL != "":
+		provider = NewHTTPProvider(config.URL)
+	case config.SeriesPath != "":
+		series, err := LoadSeries(config.SeriesPath)
+		if err != nil {
+			return nil, err
+		}
+		provider = series
+	case config.Intensity > 0:
+		provider = Static(config.Intensity)
+	default:
+		return nil, errors.New("no carbon intensity source configured")
+	}
+
+	// a pue of 0 is unset, every facility consumes at least the energy of its it equipment
+	if config.PUE != 0 && config.PUE < 1 {
+		return nil, fmt.Errorf("pue can not be below 1, got %g", config.PUE)
+	}
+
+	return &Estimator{Provider: provider, PUE: config.PUE}, nil
+}
+
+// Estimator converts measured energy to emissions by applying a grid carbon intensity and a PUE multiplier
+type Estimator struct {
+	Provider Provider
+	// PUE is the power usage effectiveness of the facility, a value of 0 is treated as 1
+	PUE float64
+}
+
+func (e *Estimator) pue() float64 {
+	if e.PUE == 0 {
+		return 1
+	}
+
+	return e.PUE
+}
+
+// Emissions converts energy consumed at the given time to grams of CO2 equivalent, alongside the intensity applied
+func (e *Estimator) Emissions(ctx context.Context, energy readers.Energy, at time.Time) (Emissions, float64, error) {
+	intensity, err := e.Provider.Intensity(ctx, at)
+	if err != nil {
+		return Emissions{}, 0, err
+	}
+
+	kWh := readers.Energy(energy.ToKiloWattHour())
+
+	return Emissions(kWh.Scale(intensity * e.pue())), intensity, nil
+}
+
+// Measurement converts every package of a measurement taken at the given time, see RaplReader.Read
+func (e *Estimator) Measurement(ctx context.Context, measurement readers.Measurement, at time.Time) (map[int64]Emissions, float64, error) {
+	emissions := make(map[int64]Emissions)
+
+	var intensity float64
+	for pkgId, energy := range measurement.Packages() {
+		pkgEmissions, pkgIntensity, err := e.Emissions(ctx, energy, at)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		emissions[pkgId] = pkgEmissions
+		intensity = pkgIntensity
+	}
+
+	return emissions, intensity, nil
+}
+
+// Accumulator keeps running emission totals of the samples of a readers.Sampler, applying the intensity in effect at
+// the time of each sample
+type Accumulator struct {
+	estimator *Estimator
+
+	mu        sync.Mutex
+	totals    map[int64]Emissions
+	intensity float64
+}
+
+// NewAccumulator creates an accumulator converting samples with estimator
+func NewAccumulator(estimator *Estimator) *Accumulator {
+	return &Accumulator{
+		estimator: estimator,
+		totals:    make(map[int64]Emissions),
+	}
+}
+
+// Add converts the energy of the sample and adds it to the totals
+func (a *Accumulator) Add(ctx context.Context, sample readers.Sample) error {
+	if sample.Err != nil {
+		return nil
+	}
+
+	for pkgId, energy := range sample.Energy {
+		emissions, intensity, err := a.estimator.Emissions(ctx, energy, sample.Time)
+		if err != nil {
+			return err
+		}
+
+		a.mu.Lock()
+		a.totals[pkgId] = a.totals[pkgId].Add(emissions)
+		a.intensity = intensity
+		a.mu.Unlock()
+	}
+
+	return nil
+}
+
+// Totals returns the emissions since the accumulator started, per package, and the last intensity applied
+func (a *Accumulator) Totals() (map[int64]Emissions, float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	totals := make(map[int64]Emissions, len(a.totals))
+	for pkgId, emissions := range a.totals {
+		totals[pkgId] = emissions
+	}
+
+	return totals, a.intensity
+}
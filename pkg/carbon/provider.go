@@ -0,0 +1,230 @@
+package carbon
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Provider reports the carbon intensity of the grid, in grams of CO2 equivalent per kWh, at a point in time
+type Provider interface {
+	Intensity(ctx context.Context, at time.Time) (float64, error)
+}
+
+// Static is a constant carbon intensity in gCO2e/kWh
+type Static float64
+
+// Intensity returns the constant intensity regardless of the time
+func (s Static) Intensity(_ context.Context, _ time.Time) (float64, error) {
+	return float64(s), nil
+}
+
+type seriesPoint struct {
+	time      time.Time
+	intensity float64
+}
+
+// Series is a carbon intensity time-series, each intensity holds from its timestamp until the next one
+type Series struct {
+	points []seriesPoint
+}
+
+// LoadSeries reads a csv file of "timestamp,intensity" rows, with RFC 3339 timestamps and intensities in gCO2e/kWh.
+// A header row is skipped
+func LoadSeries(path string) (*Series, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			klog.Errorln(err)
+		}
+	}(file)
+
+	return ParseSeries(file)
+}
+
+// ParseSeries reads "timestamp,intensity" csv rows, see LoadSeries
+func ParseSeries(r io.Reader) (*Series, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	series := &Series{}
+
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		at, err := time.Parse(time.RFC3339, record[0])
+		if err != nil {
+			if line == 1 {
+				continue
+			}
+
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		intensity, err := strconv.ParseFloat(record[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		series.points = append(series.points, seriesPoint{time: at, intensity: intensity})
+	}
+
+	if len(series.points) == 0 {
+		return nil, errors.New("carbon intensity series is empty")
+	}
+
+	sort.Slice(series.points, func(i, j int) bool { return series.points[i].time.Before(series.points[j].time) })
+
+	return series, nil
+}
+
+// Intensity returns the intensity of the last point at or before at, times before the first point take its intensity
+func (s *Series) Intensity(_ context.Context, at time.Time) (float64, error) {
+	i := sort.Search(len(s.points), func(i int) bool { return s.points[i].time.After(at) })
+	if i == 0 {
+		return s.points[0].intensity, nil
+	}
+
+	return s.points[i-1].intensity, nil
+}
+
+// HTTPProvider fetches the carbon intensity from a json http endpoint, e.g. a grid operator api or a local stand-in.
+// The time is passed as an RFC 3339 "time" query parameter, and the intensity is read from the top level Field of the
+// response. The intensity of every window of Resolution is cached for TTL, so that lookups of the past, e.g. the
+// buckets of a report, get the intensity of their own time
+type HTTPProvider struct {
+	URL   string
+	Field string
+	// Resolution is the granularity of the intensities of the endpoint, the times within a window share the intensity
+	// fetched for its start
+	Resolution time.Duration
+	TTL        time.Duration
+	Client     *http.Client
+
+	mu    sync.Mutex
+	cache map[time.Time]cachedIntensity
+}
+
+type cachedIntensity struct {
+	intensity float64
+	fetchedAt time.Time
+}
+
+// NewHTTPProvider creates a provider reading the "intensity" field of endpoint, in windows of five minutes cached for
+// five minutes
+func NewHTTPProvider(endpoint string) *HTTPProvider {
+	return &HTTPProvider{
+		URL:        endpoint,
+		Field:      "intensity",
+		Resolution: 5 * time.Minute,
+		TTL:        5 * time.Minute,
+		Client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Intensity returns the cached intensity of the window of at while it is fresh, and fetches it otherwise
+func (p *HTTPProvider) Intensity(ctx context.Context, at time.Time) (float64, error) {
+	window := at
+	if p.Resolution > 0 {
+		window = at.Truncate(p.Resolution)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if cached, exists := p.cache[window]; exists && time.Since(cached.fetchedAt) < p.TTL {
+		return cached.intensity, nil
+	}
+
+	intensity, err := p.fetch(ctx, window)
+	if err != nil {
+		return 0, err
+	}
+
+	if p.cache == nil {
+		p.cache = make(map[time.Time]cachedIntensity)
+	}
+
+	// the expired windows are dropped, so that the cache does not grow with every window looked up
+	now := time.Now()
+	for cachedWindow, cached := range p.cache {
+		if now.Sub(cached.fetchedAt) >= p.TTL {
+			delete(p.cache, cachedWindow)
+		}
+	}
+	p.cache[window] = cachedIntensity{intensity: intensity, fetchedAt: now}
+
+	return intensity, nil
+}
+
+func (p *HTTPProvider) fetch(ctx context.Context, at time.Time) (float64, error) {
+	endpoint, err := url.Parse(p.URL)
+	if err != nil {
+		return 0, err
+	}
+
+	query := endpoint.Query()
+	query.Set("time", at.UTC().Format(time.RFC3339))
+	endpoint.RawQuery = query.Encode()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Accept", "application/json")
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("carbon intensity endpoint returned %s", response.Status)
+	}
+
+	var body map[string]interface{}
+	err = json.NewDecoder(response.Body).Decode(&body)
+	if err != nil {
+		return 0, err
+	}
+
+	switch value := body[p.Field].(type) {
+	case float64:
+		return value, nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(value), 64)
+	default:
+		return 0, fmt.Errorf("carbon intensity endpoint response has no numeric %q field", p.Field)
+	}
+}
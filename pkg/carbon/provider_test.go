@@ -0,0 +1,65 @@
+package carbon
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPProviderCachesPerWindow(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		at, err := time.Parse(time.RFC3339, r.URL.Query().Get("time"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// the intensity of the endpoint is the hour of the day
+		_, _ = fmt.Fprintf(w, `{"intensity": %d}`, at.Hour())
+	}))
+	defer server.Close()
+
+	provider := NewHTTPProvider(server.URL)
+	provider.Resolution = time.Hour
+
+	day := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	lookups := []struct {
+		at   time.Time
+		want float64
+	}{
+		{day.Add(3*time.Hour + 10*time.Minute), 3},
+		{day.Add(3*time.Hour + 50*time.Minute), 3},
+		{day.Add(17 * time.Hour), 17},
+		{day.Add(3 * time.Hour), 3},
+	}
+
+	for _, lookup := range lookups {
+		intensity, err := provider.Intensity(context.Background(), lookup.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if intensity != lookup.want {
+			t.Errorf("intensity at %s: got %v, want %v", lookup.at, intensity, lookup.want)
+		}
+	}
+
+	if requests != 2 {
+		t.Errorf("got %d requests, want one per window", requests)
+	}
+}
+
+func TestNewEstimatorRejectsPUEBelowOne(t *testing.T) {
+	if _, err := NewEstimator(Config{Intensity: 100, PUE: 0.8}); err == nil {
+		t.Error("a pue of 0.8 was accepted")
+	}
+
+	if _, err := NewEstimator(Config{Intensity: 100}); err != nil {
+		t.Errorf("an unset pue was rejected: %s", err)
+	}
+}
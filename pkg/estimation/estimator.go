@@ -0,0 +1,67 @@
+package estimation
+
+import (
+	"sync"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+// Estimator estimates the wall power of every sample of a readers.Sampler and keeps the estimated wall energy total
+type Estimator struct {
+	Model Model
+	Probe *Probe
+
+	mu          sync.Mutex
+	last        Estimate
+	wallEnergy  float64
+	disks, nics []string
+}
+
+// NewEstimator creates an estimator for model, probing the utilization from the default procfs and sysfs mounts
+func NewEstimator(model Model) *Estimator {
+	disks, nics := model.Devices()
+
+	return &Estimator{
+		Model: model,
+		Probe: &Probe{},
+		disks: disks,
+		nics:  nics,
+	}
+}
+
+// Prime reads the utilization counters the next call of Estimate is relative to
+func (e *Estimator) Prime() error {
+	_, err := e.Probe.Utilization(e.disks, e.nics)
+	return err
+}
+
+// Estimate estimates the wall power during the interval of sample and adds its energy to the total
+func (e *Estimator) Estimate(sample readers.Sample) (Estimate, error) {
+	utilization, err := e.Probe.Utilization(e.disks, e.nics)
+	if err != nil {
+		return Estimate{}, err
+	}
+
+	if sample.Err != nil {
+		return Estimate{}, sample.Err
+	}
+
+	estimate := e.Model.Estimate(sample.Energy, sample.Interval, utilization)
+	estimate.Time = sample.Time
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.last = estimate
+	e.wallEnergy += estimate.WallEnergy()
+
+	return estimate, nil
+}
+
+// Last returns the most recent estimate and the estimated wall energy since the estimator started, in joules
+func (e *Estimator) Last() (Estimate, float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.last, e.wallEnergy
+}
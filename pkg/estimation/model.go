@@ -0,0 +1,221 @@
+package estimation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+type ComponentType string
+
+const (
+	// Static components draw a constant power, e.g. fans, motherboard, bmc
+	Static ComponentType = "static"
+	// Cpu components scale linearly with the cpu utilization of the host, e.g. voltage regulators, chipset
+	Cpu ComponentType = "cpu"
+	// Disk components scale linearly with the i/o utilization of each of their devices
+	Disk ComponentType = "disk"
+	// Nic components scale linearly with the bandwidth utilization of each of their devices
+	Nic ComponentType = "nic"
+)
+
+// Component is a part of the system rapl does not measure, modeled as idle + (active - idle) * utilization watts per
+// device
+type Component struct {
+	Name string        `json:"name"`
+	Type ComponentType `json:"type"`
+	// Devices lists the block devices (disk) or network interfaces (nic) the component consists of
+	Devices []string `json:"devices,omitempty"`
+	// Count is the number of identical units of a static or cpu component, or behind every device of a disk or nic
+	// component (e.g. the disks of a raid array), defaults to 1
+	Count       int     `json:"count,omitempty"`
+	IdleWatts   float64 `json:"idle_watts"`
+	ActiveWatts float64 `json:"active_watts,omitempty"`
+}
+
+// EfficiencyPoint is the efficiency of the power supply at a load, as a fraction of its rated power
+type EfficiencyPoint struct {
+	Load       float64 `json:"load"`
+	Efficiency float64 `json:"efficiency"`
+}
+
+// PSU models the losses of the power supply, the efficiency between the points of the curve is interpolated linearly
+type PSU struct {
+	RatedWatts float64           `json:"rated_watts"`
+	Curve      []EfficiencyPoint `json:"curve"`
+}
+
+// Efficiency returns the efficiency of the power supply when delivering dcWatts, 1 if no curve is configured
+func (p PSU) Efficiency(dcWatts float64) float64 {
+	if len(p.Curve) == 0 || p.RatedWatts <= 0 {
+		return 1
+	}
+
+	curve := make([]EfficiencyPoint, len(p.Curve))
+	copy(curve, p.Curve)
+	sort.Slice(curve, func(i, j int) bool { return curve[i].Load < curve[j].Load })
+
+	load := dcWatts / p.RatedWatts
+	switch {
+	case load <= curve[0].Load:
+		return curve[0].Efficiency
+	case load >= curve[len(curve)-1].Load:
+		return curve[len(curve)-1].Efficiency
+	}
+
+	for i := 1; i < len(curve); i++ {
+		if load <= curve[i].Load {
+			low, high := curve[i-1], curve[i]
+			return low.Efficiency + (high.Efficiency-low.Efficiency)*(load-low.Load)/(high.Load-low.Load)
+		}
+	}
+
+	return curve[len(curve)-1].Efficiency
+}
+
+// Model estimates the wall power of the host from the rapl measurements and the models of the other components
+type Model struct {
+	Components []Component `json:"components"`
+	PSU        PSU         `json:"psu"`
+}
+
+// LoadModel reads a json model file
+func LoadModel(path string) (Model, error) {
+	model := Model{}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return model, err
+	}
+
+	err = json.Unmarshal(data, &model)
+	if err != nil {
+		return model, fmt.Errorf("failed to parse estimation model %s: %w", path, err)
+	}
+
+	return model, model.Validate()
+}
+
+// Validate checks the model for components and efficiency points that can not be estimated
+func (m Model) Validate() error {
+	for _, component := range m.Components {
+		switch component.Type {
+		case Static, Cpu, Disk, Nic:
+		default:
+			return fmt.Errorf("component %s has unknown type %q", component.Name, component.Type)
+		}
+
+		if component.IdleWatts < 0 || component.ActiveWatts < 0 {
+			return fmt.Errorf("component %s has negative watts", component.Name)
+		}
+	}
+
+	for _, point := range m.PSU.Curve {
+		if point.Efficiency <= 0 || point.Efficiency > 1 {
+			return errors.New(fmt.Sprintf("psu efficiency has to be within (0, 1], got %f", point.Efficiency))
+		}
+	}
+
+	return nil
+}
+
+// ComponentPower is the estimated power of one component
+type ComponentPower struct {
+	Name  string
+	Type  ComponentType
+	Watts float64
+}
+
+// Estimate is the breakdown of the estimated wall power of the host during an interval
+type Estimate struct {
+	Time     time.Time
+	Interval time.Duration
+	// RaplWatts is the measured power of the packages and dram across all packages
+	RaplWatts float64
+	// Components holds the modeled power of every component, in the order of the model
+	Components []ComponentPower
+	// DCWatts is the power delivered by the power supply, rapl and components
+	DCWatts float64
+	// PSULossWatts is the power lost in the power supply
+	PSULossWatts float64
+	// WallWatts is the power drawn from the wall
+	WallWatts float64
+}
+
+// WallEnergy returns the estimated energy drawn from the wall during the interval, in joules
+func (e Estimate) WallEnergy() float64 {
+	return e.WallWatts * e.Interval.Seconds()
+}
+
+// Estimate derives the wall power from the energy measured across all packages during interval and the utilization
+// of the host during the same interval. The rapl figure is the package plus the dram domain of every package
+func (m Model) Estimate(energy map[int64]readers.Energy, interval time.Duration, utilization Utilization) Estimate {
+	estimate := Estimate{
+		Time:     time.Now(),
+		Interval: interval,
+	}
+
+	for _, pkgEnergy := range energy {
+		power := pkgEnergy.ToWatts(interval)
+		estimate.RaplWatts += power.Pkg + power.DRAM
+	}
+
+	estimate.DCWatts = estimate.RaplWatts
+
+	for _, component := range m.Components {
+		watts := component.power(utilization)
+		estimate.Components = append(estimate.Components, ComponentPower{Name: component.Name, Type: component.Type, Watts: watts})
+		estimate.DCWatts += watts
+	}
+
+	estimate.WallWatts = estimate.DCWatts / m.PSU.Efficiency(estimate.DCWatts)
+	estimate.PSULossWatts = estimate.WallWatts - estimate.DCWatts
+
+	return estimate
+}
+
+func (c Component) power(utilization Utilization) float64 {
+	count := c.Count
+	if count == 0 {
+		count = 1
+	}
+
+	linear := func(load float64) float64 {
+		return c.IdleWatts + (c.ActiveWatts-c.IdleWatts)*clamp(load)
+	}
+
+	switch c.Type {
+	case Cpu:
+		return float64(count) * linear(utilization.Cpu)
+	case Disk, Nic:
+		loads := utilization.Disks
+		if c.Type == Nic {
+			loads = utilization.Nics
+		}
+
+		watts := 0.0
+		for _, device := range c.Devices {
+			watts += float64(count) * linear(loads[device])
+		}
+
+		return watts
+	default:
+		return float64(count) * c.IdleWatts
+	}
+}
+
+func clamp(load float64) float64 {
+	if load < 0 {
+		return 0
+	}
+	if load > 1 {
+		return 1
+	}
+
+	return load
+}
@@ -0,0 +1,206 @@
+package estimation
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/attribution"
+	"github.com/rekuberate-io/power/pkg/readers"
+	"k8s.io/klog/v2"
+)
+
+const (
+	procRoot       = "/proc"
+	sysfsRoot      = "/sys"
+	diskStatsPath  = "diskstats"
+	nicRxBytesPath = "class/net/%s/statistics/rx_bytes"
+	nicTxBytesPath = "class/net/%s/statistics/tx_bytes"
+	nicSpeedPath   = "class/net/%s/speed"
+)
+
+// Utilization holds the busy ratios (0..1) of the host during an interval
+type Utilization struct {
+	Cpu float64
+	// Disks holds the fraction of the interval each block device had i/o in flight
+	Disks map[string]float64
+	// Nics holds the fraction of the link speed each network interface used, receive and transmit combined
+	Nics map[string]float64
+}
+
+type utilizationCounters struct {
+	time    time.Time
+	cpus    map[int]readers.CpuTime
+	ioTicks map[string]uint64
+	bytes   map[string]uint64
+}
+
+// Probe derives the utilization of the cpus, disks and network interfaces between two calls of Utilization
+type Probe struct {
+	// ProcRoot is the mount point of procfs, /proc if empty
+	ProcRoot string
+	// SysfsRoot is the mount point of sysfs, /sys if empty
+	SysfsRoot string
+
+	mu       sync.Mutex
+	previous *utilizationCounters
+}
+
+// Utilization returns the utilization since the previous call, the first call returns a zero utilization
+func (p *Probe) Utilization(disks []string, nics []string) (Utilization, error) {
+	counters, err := p.read(nics)
+	if err != nil {
+		return Utilization{}, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	previous := p.previous
+	p.previous = &counters
+
+	utilization := Utilization{Disks: make(map[string]float64), Nics: make(map[string]float64)}
+	if previous == nil {
+		return utilization, nil
+	}
+
+	interval := counters.time.Sub(previous.time)
+	if interval <= 0 {
+		return utilization, nil
+	}
+
+	var ticks readers.CpuTime
+	for cpuId, cpuTime := range counters.cpus {
+		ticks = ticks.Add(cpuTime.Sub(previous.cpus[cpuId]))
+	}
+	utilization.Cpu = ticks.Utilization()
+
+	for _, disk := range disks {
+		ticks := counterDelta(counters.ioTicks, previous.ioTicks, disk)
+		utilization.Disks[disk] = clamp(float64(ticks) / (interval.Seconds() * 1000))
+	}
+
+	for _, nic := range nics {
+		speed, err := readers.ReadIntFromFile(p.sysfsPath(nicSpeedPath, nic))
+		// virtual interfaces report no speed, they are considered idle
+		if err != nil || speed <= 0 {
+			continue
+		}
+
+		bits := float64(counterDelta(counters.bytes, previous.bytes, nic)) * 8
+		utilization.Nics[nic] = clamp(bits / (float64(speed) * 1000000 * interval.Seconds()))
+	}
+
+	return utilization, nil
+}
+
+// counterDelta returns the increase of the counter of a device. A counter seen for the first time, or one that went
+// backwards because it was reset (e.g. a nic re-plugged), primes again and counts as zero
+func counterDelta(current map[string]uint64, previous map[string]uint64, device string) uint64 {
+	before, exists := previous[device]
+	if !exists || current[device] < before {
+		return 0
+	}
+
+	return current[device] - before
+}
+
+func (p *Probe) read(nics []string) (utilizationCounters, error) {
+	counters := utilizationCounters{
+		time:  time.Now(),
+		bytes: make(map[string]uint64),
+	}
+
+	cpus, err := attribution.ProcFS{Root: p.ProcRoot}.CpuTimes()
+	if err != nil {
+		return counters, err
+	}
+	counters.cpus = cpus
+
+	counters.ioTicks, err = p.readDiskStats()
+	if err != nil {
+		return counters, err
+	}
+
+	for _, nic := range nics {
+		rx, err := readers.ReadUintFromFile(p.sysfsPath(nicRxBytesPath, nic))
+		if err != nil {
+			return counters, err
+		}
+
+		tx, err := readers.ReadUintFromFile(p.sysfsPath(nicTxBytesPath, nic))
+		if err != nil {
+			return counters, err
+		}
+
+		counters.bytes[nic] = rx + tx
+	}
+
+	return counters, nil
+}
+
+// readDiskStats reads the milliseconds every block device spent doing i/o, the 13th field of /proc/diskstats
+func (p *Probe) readDiskStats() (map[string]uint64, error) {
+	root := p.ProcRoot
+	if root == "" {
+		root = procRoot
+	}
+
+	file, err := os.Open(filepath.Join(root, diskStatsPath))
+	if err != nil {
+		return nil, err
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			klog.Errorln(err)
+		}
+	}(file)
+
+	ioTicks := make(map[string]uint64)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 13 {
+			continue
+		}
+
+		values, err := readers.ParseUint64s(fields[12:13])
+		if err != nil {
+			return nil, err
+		}
+
+		ioTicks[fields[2]] = values[0]
+	}
+
+	return ioTicks, scanner.Err()
+}
+
+func (p *Probe) sysfsPath(format string, a ...interface{}) string {
+	root := p.SysfsRoot
+	if root == "" {
+		root = sysfsRoot
+	}
+
+	return filepath.Join(root, fmt.Sprintf(format, a...))
+}
+
+// Devices returns the block devices and network interfaces the components of the model consist of
+func (m Model) Devices() ([]string, []string) {
+	var disks, nics []string
+	for _, component := range m.Components {
+		switch component.Type {
+		case Disk:
+			disks = append(disks, component.Devices...)
+		case Nic:
+			nics = append(nics, component.Devices...)
+		}
+	}
+
+	return disks, nics
+}
@@ -0,0 +1,60 @@
+package estimation
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeCounters(t *testing.T, procRoot string, sysfsRoot string, ioTicks uint64, rx uint64) {
+	t.Helper()
+
+	files := map[string]string{
+		filepath.Join(procRoot, "stat"):                               "cpu0 10 0 0 10 0 0 0 0 0 0\n",
+		filepath.Join(procRoot, diskStatsPath):                        fmt.Sprintf(" 259 0 nvme0n1 1 0 0 0 1 0 0 0 0 %d 0\n", ioTicks),
+		filepath.Join(sysfsRoot, fmt.Sprintf(nicRxBytesPath, "eth0")): fmt.Sprint(rx),
+		filepath.Join(sysfsRoot, fmt.Sprintf(nicTxBytesPath, "eth0")): "0",
+		filepath.Join(sysfsRoot, fmt.Sprintf(nicSpeedPath, "eth0")):   "1000",
+	}
+
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestUtilizationOfResetCounters(t *testing.T) {
+	procRoot, sysfsRoot := t.TempDir(), t.TempDir()
+	probe := &Probe{ProcRoot: procRoot, SysfsRoot: sysfsRoot}
+	disks, nics := []string{"nvme0n1"}, []string{"eth0"}
+
+	writeCounters(t, procRoot, sysfsRoot, 5000, 1<<30)
+	if _, err := probe.Utilization(disks, nics); err != nil {
+		t.Fatal(err)
+	}
+
+	// the nic was re-plugged and the disk counters reset, both start over from a lower value
+	writeCounters(t, procRoot, sysfsRoot, 10, 100)
+	utilization, err := probe.Utilization(disks, nics)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if utilization.Disks["nvme0n1"] != 0 || utilization.Nics["eth0"] != 0 {
+		t.Errorf("reset counters count as busy, got disks %v and nics %v", utilization.Disks, utilization.Nics)
+	}
+}
+
+func TestComponentCountOfDevices(t *testing.T) {
+	component := Component{Name: "raid", Type: Disk, Devices: []string{"md0"}, Count: 4, IdleWatts: 2, ActiveWatts: 8}
+
+	watts := component.power(Utilization{Disks: map[string]float64{"md0": 0.5}})
+	if watts != 20 {
+		t.Errorf("got %v W for 4 disks at half load, want 20 W", watts)
+	}
+}
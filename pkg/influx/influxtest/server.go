@@ -0,0 +1,120 @@
+// Package influxtest provides a stub InfluxDB write endpoint, for testing the influx.Writer, or code writing through
+// it, without a database
+package influxtest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// Request is a write request the server received
+type Request struct {
+	Path   string
+	Query  string
+	Header http.Header
+	// Lines are the lines of the body, without the empty ones
+	Lines []string
+	// Status is the status code the server answered with
+	Status int
+}
+
+// Server is a stub of the v1 (/write) and v2 (/api/v2/write) write endpoints of InfluxDB. It answers the n-th
+// (counting from 0) request with the status of Statuses, and 204 for every other one
+type Server struct {
+	// Statuses holds the status code to answer the n-th request with
+	Statuses map[int]int
+	// RetryAfter is sent as the Retry-After header of the failed responses, if set
+	RetryAfter string
+
+	server   *httptest.Server
+	mu       sync.Mutex
+	requests []Request
+}
+
+// NewServer starts a server on a local port, stop it with Close
+func NewServer() *Server {
+	server := &Server{Statuses: make(map[int]int)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/write", server.write)
+	mux.HandleFunc("/api/v2/write", server.write)
+	server.server = httptest.NewServer(mux)
+
+	return server
+}
+
+// URL returns the base url of the server, the write endpoints are /write and /api/v2/write
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// Close stops the server
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Requests returns every request received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requests := make([]Request, len(s.requests))
+	copy(requests, s.requests)
+
+	return requests
+}
+
+// Lines returns the lines of every accepted request, in the order received
+func (s *Server) Lines() []string {
+	var lines []string
+	for _, request := range s.Requests() {
+		if request.Status == http.StatusNoContent {
+			lines = append(lines, request.Lines...)
+		}
+	}
+
+	return lines
+}
+
+func (s *Server) write(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	request := Request{Path: r.URL.Path, Query: r.URL.RawQuery, Header: r.Header.Clone()}
+	for _, line := range strings.Split(string(body), "\n") {
+		if line != "" {
+			request.Lines = append(request.Lines, line)
+		}
+	}
+
+	s.mu.Lock()
+	status, scripted := s.Statuses[len(s.requests)]
+	if !scripted {
+		status = http.StatusNoContent
+	}
+	request.Status = status
+	s.requests = append(s.requests, request)
+	s.mu.Unlock()
+
+	if status != http.StatusNoContent {
+		if s.RetryAfter != "" {
+			w.Header().Set("Retry-After", s.RetryAfter)
+		}
+
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
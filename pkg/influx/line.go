@@ -0,0 +1,114 @@
+// Package influx writes the rapl energy and power as InfluxDB line protocol, to stdout, a file or the http write
+// endpoint of InfluxDB
+package influx
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+// Measurement is the measurement of every line
+const Measurement = "rapl"
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+)
+
+// Topology holds the tags describing the packages of the host
+type Topology struct {
+	Host string
+	// Dies, Vendors and Models hold the die, the cpu vendor and the cpu model name, per package
+	Dies    map[int64]int64
+	Vendors map[int64]string
+	Models  map[int64]string
+}
+
+// NewTopology collects the tags of the packages of the cpus
+func NewTopology(host string, cpus map[int]*readers.Cpu) Topology {
+	topology := Topology{
+		Host:    host,
+		Dies:    make(map[int64]int64),
+		Vendors: make(map[int64]string),
+		Models:  make(map[int64]string),
+	}
+
+	for _, cpu := range cpus {
+		for pkgId, die := range cpu.Dies() {
+			topology.Dies[pkgId] = die
+		}
+		for pkgId := range cpu.Packages {
+			topology.Vendors[pkgId] = cpu.Vendor.String()
+			topology.Models[pkgId] = strings.TrimSpace(cpu.Model.Name)
+		}
+	}
+
+	return topology
+}
+
+// Lines renders a sample as one line per package and domain, tagged with the host, package, die, domain, vendor and
+// model, with the joules, watts and kWh of the interval and the joules since the sampler started as fields, and the
+// end of the interval as the timestamp in nanoseconds
+func (t Topology) Lines(sample readers.Sample) []string {
+	timestamp := strconv.FormatInt(sample.Time.UnixNano(), 10)
+
+	var pkgIds []int64
+	for pkgId := range sample.Totals {
+		pkgIds = append(pkgIds, pkgId)
+	}
+	sort.Slice(pkgIds, func(i, j int) bool { return pkgIds[i] < pkgIds[j] })
+
+	var lines []string
+	for _, pkgId := range pkgIds {
+		energy := sample.Energy[pkgId]
+		watts := readers.Energy(energy.ToWatts(sample.Interval))
+		kWh := readers.Energy(energy.ToKiloWattHour())
+
+		for _, domain := range readers.Domains {
+			var line strings.Builder
+			line.WriteString(measurementEscaper.Replace(Measurement))
+			t.writeTag(&line, "host", t.Host)
+			t.writeTag(&line, "package", strconv.FormatInt(pkgId, 10))
+			t.writeTag(&line, "die", strconv.FormatInt(t.Dies[pkgId], 10))
+			t.writeTag(&line, "domain", domain.String())
+			t.writeTag(&line, "vendor", t.Vendors[pkgId])
+			t.writeTag(&line, "model", t.Models[pkgId])
+
+			line.WriteString(" joules=")
+			line.WriteString(formatFloat(energy.Get(domain)))
+			line.WriteString(",joules_total=")
+			line.WriteString(formatFloat(sample.Totals[pkgId].Get(domain)))
+			line.WriteString(",watts=")
+			line.WriteString(formatFloat(watts.Get(domain)))
+			line.WriteString(",kwh=")
+			line.WriteString(formatFloat(kWh.Get(domain)))
+
+			line.WriteString(" ")
+			line.WriteString(timestamp)
+
+			lines = append(lines, line.String())
+		}
+	}
+
+	return lines
+}
+
+// writeTag appends a tag, tags with an empty value are left out as the line protocol requires
+func (t Topology) writeTag(line *strings.Builder, key string, value string) {
+	if value == "" {
+		return
+	}
+
+	line.WriteString(",")
+	line.WriteString(tagEscaper.Replace(key))
+	line.WriteString("=")
+	line.WriteString(tagEscaper.Replace(value))
+}
+
+// formatFloat formats a float field, which the line protocol reads as a float even without a decimal point
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,33 @@
+package influx
+
+import (
+	"context"
+
+	"github.com/rekuberate-io/power/pkg/sink"
+)
+
+func init() {
+	sink.Register("influx", newSink)
+}
+
+// newSink creates a writer to the destination of the target, Stdout if empty. The token param is sent as the
+// authorization of the http writes
+func newSink(config sink.Config) (sink.Sink, error) {
+	destination := config.Target
+	if destination == "" {
+		destination = Stdout
+	}
+
+	writerConfig := Config{Destination: destination}
+	if token := config.Param("token", ""); token != "" {
+		writerConfig.Headers = map[string]string{"Authorization": "Token " + token}
+	}
+
+	return New(writerConfig, NewTopology(config.Topology.Node, config.Topology.Cpus))
+}
+
+// Write queues the lines of a measurement, they are written on the next Flush
+func (w *Writer) Write(_ context.Context, measurement sink.Measurement) error {
+	w.Add(measurement.Sample)
+	return nil
+}
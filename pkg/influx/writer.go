@@ -0,0 +1,293 @@
+package influx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/internal/batch"
+	"github.com/rekuberate-io/power/pkg/readers"
+
+	"k8s.io/klog/v2"
+)
+
+// Stdout is the destination writing to the standard output
+const Stdout = "-"
+
+// Config configures a Writer, the zero values of the durations and sizes fall back to the defaults
+type Config struct {
+	// Destination is Stdout, the http(s) url of a write endpoint, e.g. http://localhost:8086/api/v2/write?org=o&bucket=b
+	// or http://localhost:8086/write?db=power, or else the path of a file the lines are appended to
+	Destination string
+	// Headers are added to every http request, e.g. "Authorization: Token ..."
+	Headers map[string]string
+	// Interval is the time between two writes, 10s by default
+	Interval time.Duration
+	// BatchSize is the most lines written at once, a full batch is written right away, 5000 by default
+	BatchSize int
+	// MaxQueue is the most lines kept while the destination fails, the oldest are dropped first, 100000 by default
+	MaxQueue int
+	// Timeout limits every http request, 10s by default
+	Timeout time.Duration
+	// MaxElapsed limits the retries of a batch, 1m by default, the batch is kept for the next write then
+	MaxElapsed time.Duration
+	Client     *http.Client
+}
+
+func (c *Config) defaults() {
+	if c.Interval <= 0 {
+		c.Interval = 10 * time.Second
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 5000
+	}
+	if c.MaxQueue <= 0 {
+		c.MaxQueue = 100000
+	}
+	if c.MaxQueue < c.BatchSize {
+		c.MaxQueue = c.BatchSize
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	if c.MaxElapsed <= 0 {
+		c.MaxElapsed = time.Minute
+	}
+	if c.Client == nil {
+		c.Client = &http.Client{}
+	}
+}
+
+// Writer writes the samples of a readers.Sampler as line protocol in batches. Writes to an http endpoint failing with
+// a server error, 429 or without an answer are retried with exponential backoff
+type Writer struct {
+	config   Config
+	topology Topology
+	endpoint string
+	out      io.Writer
+	file     *os.File
+
+	queue *batch.Queue
+	// closeMu keeps the file from being closed while a batch is written to it
+	closeMu sync.Mutex
+}
+
+// New creates a writer, opening the file destination for appending
+func New(config Config, topology Topology) (*Writer, error) {
+	config.defaults()
+
+	writer := &Writer{config: config, topology: topology, queue: batch.NewQueue(config.BatchSize, config.MaxQueue)}
+
+	switch {
+	case config.Destination == Stdout:
+		writer.out = os.Stdout
+	case strings.HasPrefix(config.Destination, "http://"), strings.HasPrefix(config.Destination, "https://"):
+		endpoint, err := url.Parse(config.Destination)
+		if err != nil {
+			return nil, fmt.Errorf("invalid influx write endpoint: %w", err)
+		}
+
+		// the timestamps are in nanoseconds, the default precision of both write apis
+		query := endpoint.Query()
+		if query.Get("precision") == "" {
+			query.Set("precision", "ns")
+			endpoint.RawQuery = query.Encode()
+		}
+		writer.endpoint = endpoint.String()
+	case config.Destination == "":
+		return nil, errors.New("influx destination is empty")
+	default:
+		file, err := os.OpenFile(config.Destination, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+
+		writer.out = file
+		writer.file = file
+	}
+
+	return writer, nil
+}
+
+// Add queues the lines of a sample for the next write, failed samples are skipped
+func (w *Writer) Add(sample readers.Sample) {
+	if sample.Err != nil || sample.Time.IsZero() || sample.Interval <= 0 {
+		return
+	}
+
+	lines := w.topology.Lines(sample)
+
+	values := make([]interface{}, len(lines))
+	for i, text := range lines {
+		values[i] = text
+	}
+
+	w.queue.Add(values...)
+}
+
+// Stats returns the number of lines written and dropped so far
+func (w *Writer) Stats() (written int, dropped int) {
+	return w.queue.Stats()
+}
+
+// Flush writes the queued lines in batches. A batch failing with a retryable error is kept for the next write, one the
+// endpoint rejects is dropped
+func (w *Writer) Flush(ctx context.Context) error {
+	return w.flush(ctx, w.config.MaxElapsed)
+}
+
+func (w *Writer) flush(ctx context.Context, maxElapsed time.Duration) error {
+	return w.queue.Flush(ctx, func(ctx context.Context, lines []interface{}) error {
+		var body bytes.Buffer
+		for _, text := range lines {
+			body.WriteString(text.(string))
+			body.WriteByte('\n')
+		}
+
+		return w.write(ctx, body.Bytes(), maxElapsed)
+	})
+}
+
+// Run adds every sample and writes the lines every interval, or as soon as a batch is full, until samples is closed or
+// ctx is done. The writes run apart from the samples, which keep being queued while a batch is retried. The queue is
+// flushed a last time, without retries, and the file closed on the way out
+func (w *Writer) Run(ctx context.Context, samples <-chan readers.Sample) error {
+	writeCtx, cancel := context.WithCancel(ctx)
+	written := make(chan struct{})
+
+	go func() {
+		defer close(written)
+
+		ticker := time.NewTicker(w.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-writeCtx.Done():
+				return
+			case <-w.queue.Full():
+				w.flushAndLog(writeCtx)
+			case <-ticker.C:
+				w.flushAndLog(writeCtx)
+			}
+		}
+	}()
+
+	defer func() {
+		cancel()
+		<-written
+
+		// ctx may be done already, the last write gets its own deadline
+		flushCtx, cancel := context.WithTimeout(context.Background(), w.config.Timeout)
+		defer cancel()
+
+		err := w.flush(flushCtx, 0)
+		if err != nil {
+			klog.Errorf("last influx write failed: %s", err)
+		}
+
+		err = w.Close()
+		if err != nil {
+			klog.Errorln(err)
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case sample, ok := <-samples:
+			if !ok {
+				return nil
+			}
+
+			w.Add(sample)
+		}
+	}
+}
+
+func (w *Writer) flushAndLog(ctx context.Context) {
+	err := w.Flush(ctx)
+	if err != nil && ctx.Err() == nil {
+		klog.Errorf("influx write failed: %s", err)
+	}
+}
+
+// Close closes the file destination
+func (w *Writer) Close() error {
+	w.closeMu.Lock()
+	defer w.closeMu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+
+	err := w.file.Close()
+	w.file = nil
+	w.out = nil
+
+	return err
+}
+
+// write writes a batch to the destination, retrying retryable http failures with exponential backoff and jitter for
+// up to maxElapsed
+func (w *Writer) write(ctx context.Context, body []byte, maxElapsed time.Duration) error {
+	if w.endpoint == "" {
+		w.closeMu.Lock()
+		defer w.closeMu.Unlock()
+
+		if w.out == nil {
+			return &batch.PermanentError{Err: errors.New("influx writer is closed")}
+		}
+
+		_, err := w.out.Write(body)
+		return err
+	}
+
+	return batch.Retry(ctx, "influx write", maxElapsed, func() error {
+		return w.post(ctx, body)
+	})
+}
+
+func (w *Writer) post(ctx context.Context, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, w.config.Timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, w.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return &batch.PermanentError{Err: err}
+	}
+	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	for key, value := range w.config.Headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := w.config.Client.Do(request)
+	if err != nil {
+		// the endpoint is unreachable, or did not answer in time
+		return &batch.RetryableError{Err: err}
+	}
+	defer response.Body.Close()
+
+	responseBody, _ := io.ReadAll(io.LimitReader(response.Body, 64*1024))
+
+	switch {
+	case response.StatusCode >= 200 && response.StatusCode < 300:
+		return nil
+	case response.StatusCode == http.StatusTooManyRequests, response.StatusCode >= 500:
+		return &batch.RetryableError{
+			Err:        fmt.Errorf("influx write endpoint returned %s", response.Status),
+			RetryAfter: batch.RetryAfter(response.Header.Get("Retry-After")),
+		}
+	}
+
+	return &batch.PermanentError{Err: fmt.Errorf("influx write endpoint rejected the lines with %s: %s", response.Status, strings.TrimSpace(string(responseBody)))}
+}
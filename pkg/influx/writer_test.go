@@ -0,0 +1,181 @@
+package influx_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/influx"
+	"github.com/rekuberate-io/power/pkg/influx/influxtest"
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+var (
+	start    = time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+	topology = influx.NewTopology("node", nil)
+)
+
+// sample is the n-th sample of a package drawing 1 W, the total is n joules
+func sample(n int) readers.Sample {
+	return readers.Sample{
+		Time:     start.Add(time.Duration(n) * time.Second),
+		Interval: time.Second,
+		Energy:   map[int64]readers.Energy{0: {Pkg: 1}},
+		Totals:   map[int64]readers.Energy{0: {Pkg: float64(n)}},
+	}
+}
+
+// lines returns the lines of the samples
+func lines(samples ...int) []string {
+	var all []string
+	for _, n := range samples {
+		all = append(all, topology.Lines(sample(n))...)
+	}
+
+	return all
+}
+
+func assertLines(t *testing.T, got []string, want []string) {
+	t.Helper()
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got lines\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func newWriter(t *testing.T, config influx.Config) *influx.Writer {
+	t.Helper()
+
+	writer, err := influx.New(config, topology)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return writer
+}
+
+func TestWriterWritesToEndpoints(t *testing.T) {
+	for _, path := range []string{"/write?db=power", "/api/v2/write?org=o&bucket=power"} {
+		t.Run(path, func(t *testing.T) {
+			server := influxtest.NewServer()
+			defer server.Close()
+
+			writer := newWriter(t, influx.Config{
+				Destination: server.URL() + path,
+				Headers:     map[string]string{"Authorization": "Token secret"},
+			})
+			writer.Add(sample(1))
+			writer.Add(sample(2))
+
+			if err := writer.Flush(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			requests := server.Requests()
+			if len(requests) != 1 || requests[0].Header.Get("Authorization") != "Token secret" {
+				t.Fatalf("got requests %+v, want one with the authorization", requests)
+			}
+			if !strings.Contains(requests[0].Query, "precision=ns") {
+				t.Errorf("got query %q, want the precision in nanoseconds", requests[0].Query)
+			}
+
+			assertLines(t, server.Lines(), lines(1, 2))
+			if written, dropped := writer.Stats(); written != len(lines(1, 2)) || dropped != 0 {
+				t.Errorf("got %d written and %d dropped, want every line written", written, dropped)
+			}
+		})
+	}
+}
+
+func TestWriterRetriesWithRetryAfter(t *testing.T) {
+	server := influxtest.NewServer()
+	defer server.Close()
+	server.Statuses[0] = http.StatusServiceUnavailable
+	server.RetryAfter = "1"
+
+	writer := newWriter(t, influx.Config{Destination: server.URL() + "/write?db=power"})
+	writer.Add(sample(1))
+
+	began := time.Now()
+	if err := writer.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(began); elapsed < time.Second {
+		t.Errorf("retried after %s, want the Retry-After of 1s", elapsed)
+	}
+	if requests := server.Requests(); len(requests) != 2 {
+		t.Errorf("got %d requests, want a retry", len(requests))
+	}
+	assertLines(t, server.Lines(), lines(1))
+}
+
+func TestWriterDropsRejectedBatch(t *testing.T) {
+	server := influxtest.NewServer()
+	defer server.Close()
+	server.Statuses[0] = http.StatusBadRequest
+
+	perSample := len(lines(1))
+	writer := newWriter(t, influx.Config{Destination: server.URL() + "/write?db=power", BatchSize: perSample})
+	writer.Add(sample(1))
+	writer.Add(sample(2))
+
+	if err := writer.Flush(context.Background()); err == nil {
+		t.Fatal("the rejected batch did not fail the flush")
+	}
+	if err := writer.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	assertLines(t, server.Lines(), lines(2))
+	if written, dropped := writer.Stats(); written != perSample || dropped != perSample {
+		t.Errorf("got %d written and %d dropped, want %d of each", written, dropped, perSample)
+	}
+}
+
+func TestWriterQueueOverflow(t *testing.T) {
+	server := influxtest.NewServer()
+	defer server.Close()
+
+	perSample := len(lines(1))
+	writer := newWriter(t, influx.Config{Destination: server.URL() + "/write?db=power", BatchSize: perSample, MaxQueue: 2 * perSample})
+	for n := 1; n <= 3; n++ {
+		writer.Add(sample(n))
+	}
+
+	if err := writer.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the oldest lines are dropped first
+	assertLines(t, server.Lines(), lines(2, 3))
+	if written, dropped := writer.Stats(); written != 2*perSample || dropped != perSample {
+		t.Errorf("got %d written and %d dropped, want %d written and %d dropped", written, dropped, 2*perSample, perSample)
+	}
+}
+
+func TestWriterAppendsToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "power.lp")
+
+	for n := 1; n <= 2; n++ {
+		writer := newWriter(t, influx.Config{Destination: path})
+		writer.Add(sample(n))
+
+		if err := writer.Flush(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertLines(t, strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"), lines(1, 2))
+}
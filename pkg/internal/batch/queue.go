@@ -0,0 +1,127 @@
+// Package batch queues items for a remote destination and sends them in batches, retrying the failed sends with
+// exponential backoff. It is the common part of the otlp exporter and the influx writer
+package batch
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+type item struct {
+	seq   uint64
+	value interface{}
+}
+
+// Queue keeps the items to send, at most MaxQueue of them, the oldest are dropped first. The zero value is not usable,
+// create one with NewQueue
+type Queue struct {
+	batchSize int
+	maxQueue  int
+
+	mu      sync.Mutex
+	seq     uint64
+	items   []item
+	sent    int
+	dropped int
+	full    chan struct{}
+	// flushMu lets a flush at a time send, so that no batch is sent twice
+	flushMu sync.Mutex
+}
+
+// NewQueue creates a queue sending batches of up to batchSize items and keeping up to maxQueue items, at least a batch
+func NewQueue(batchSize int, maxQueue int) *Queue {
+	if maxQueue < batchSize {
+		maxQueue = batchSize
+	}
+
+	return &Queue{batchSize: batchSize, maxQueue: maxQueue, full: make(chan struct{}, 1)}
+}
+
+// Add queues values, dropping the oldest items if the queue overflows, and signals Full once a batch is complete
+func (q *Queue) Add(values ...interface{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, value := range values {
+		q.seq++
+		q.items = append(q.items, item{seq: q.seq, value: value})
+	}
+
+	if overflow := len(q.items) - q.maxQueue; overflow > 0 {
+		q.items = q.items[overflow:]
+		q.dropped += overflow
+	}
+
+	if len(q.items) >= q.batchSize {
+		select {
+		case q.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Full receives when a batch is complete, to send it right away instead of waiting for the next interval
+func (q *Queue) Full() <-chan struct{} {
+	return q.full
+}
+
+// Stats returns the number of items sent and dropped so far
+func (q *Queue) Stats() (sent int, dropped int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.sent, q.dropped
+}
+
+// Flush sends the queued items in batches until the queue is empty. A batch failing with a PermanentError is dropped,
+// one failing otherwise is kept for the next flush and its error returned. Items are added meanwhile, the queue is
+// not locked while a batch is sent
+func (q *Queue) Flush(ctx context.Context, send func(ctx context.Context, batch []interface{}) error) error {
+	q.flushMu.Lock()
+	defer q.flushMu.Unlock()
+
+	for {
+		q.mu.Lock()
+		n := len(q.items)
+		if n > q.batchSize {
+			n = q.batchSize
+		}
+		if n == 0 {
+			q.mu.Unlock()
+			return nil
+		}
+
+		batch := make([]interface{}, n)
+		for i, it := range q.items[:n] {
+			batch[i] = it.value
+		}
+		last := q.items[n-1].seq
+		q.mu.Unlock()
+
+		err := send(ctx, batch)
+
+		var permanent *PermanentError
+		if err != nil && !errors.As(err, &permanent) {
+			return err
+		}
+
+		// items added meanwhile may have pushed some of the batch out of the queue already
+		q.mu.Lock()
+		sent := 0
+		for sent < len(q.items) && q.items[sent].seq <= last {
+			sent++
+		}
+		q.items = q.items[sent:]
+		if err != nil {
+			q.dropped += sent
+		} else {
+			q.sent += sent
+		}
+		q.mu.Unlock()
+
+		if err != nil {
+			return err
+		}
+	}
+}
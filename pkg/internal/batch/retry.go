@@ -0,0 +1,91 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	initialBackoff = 500 * time.Millisecond
+	maxBackoff     = 30 * time.Second
+)
+
+// PermanentError is a failure retrying does not fix, the batch is dropped
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+// RetryableError is a failure worth retrying, after RetryAfter if the destination sent one
+type RetryableError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RetryableError) Error() string {
+	return e.Err.Error()
+}
+
+// Retry calls send until it succeeds, fails with another error than a RetryableError, or maxElapsed would be exceeded
+// by the next wait. The waits grow exponentially, with jitter, unless the destination asks for a longer one. what
+// names the send in the logs, e.g. "otlp export"
+func Retry(ctx context.Context, what string, maxElapsed time.Duration, send func() error) error {
+	deadline := time.Now().Add(maxElapsed)
+	backoff := initialBackoff
+
+	for {
+		err := send()
+
+		var retryable *RetryableError
+		if err == nil || !errors.As(err, &retryable) {
+			return err
+		}
+
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff)))
+		if retryable.RetryAfter > wait {
+			wait = retryable.RetryAfter
+		}
+		if time.Now().Add(wait).After(deadline) {
+			return err
+		}
+
+		klog.V(2).Infof("%s failed, retrying in %s: %s", what, wait, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// RetryAfter parses the seconds or the http date of a Retry-After header, zero if absent or invalid
+func RetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if at, err := http.ParseTime(header); err == nil {
+		return time.Until(at)
+	}
+
+	return 0
+}
@@ -0,0 +1,454 @@
+package ledger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+
+	"k8s.io/klog/v2"
+)
+
+// Version is the version of the checkpoint file format
+const Version = 1
+
+// DefaultRetention is how long the hourly totals are kept, a bit more than a year to report on a whole year
+const DefaultRetention = 400 * 24 * time.Hour
+
+// BootIdPath is the file the kernel exposes a random id of the current boot in
+var BootIdPath = "/proc/sys/kernel/random/boot_id"
+
+// State is what a checkpoint persists
+type State struct {
+	Version int `json:"version"`
+	// BootId is the boot the counters were read in, a different one means the host rebooted and the counters restarted
+	BootId string `json:"boot_id"`
+	// Reader is the strategy of the reader the counters were read with, see readers.StrategyName. Counters of
+	// different readers do not line up
+	Reader string `json:"reader"`
+	// Created is when the ledger was first opened
+	Created time.Time `json:"created"`
+	// Updated is the time of the last sample recorded
+	Updated time.Time `json:"updated"`
+	// Totals holds the joules consumed since the ledger was created, per package
+	Totals map[int64]readers.Energy `json:"totals"`
+	// Counters holds the raw counters of the last sample recorded, per package, to account for the energy consumed
+	// while nobody was sampling
+	Counters map[int64]readers.Energy `json:"counters"`
+	// Reboots counts the reboots of the host detected on open
+	Reboots int `json:"reboots"`
+	// Resets counts the packages whose counters were found lower than the last recorded ones, without a reboot, and
+	// without a known range they could have wrapped around at
+	Resets int `json:"resets"`
+	// Hours holds the joules consumed during every hour, oldest first, for the hours within the retention
+	Hours []Hour `json:"hours,omitempty"`
+}
+
+// Hour is the energy consumed during an hour of the wall clock, in UTC
+type Hour struct {
+	Start time.Time `json:"start"`
+	// Energy holds the joules, per package. The energy consumed while the process was down is accounted to the hour
+	// it was found in
+	Energy map[int64]readers.Energy `json:"energy"`
+	// Covered is the time of the hour covered by samples, in seconds
+	Covered float64 `json:"covered_seconds"`
+}
+
+// Ledger accumulates energy deltas into totals per package and domain that survive restarts of the process. It is
+// checkpointed to a file, replaced atomically so that a crash leaves either the previous or the new checkpoint. With a
+// reader whose counters are kept by the hardware, the energy consumed while the process was down is added on the first
+// sample after a restart, as long as the host did not reboot and the counters did not reset meanwhile. Otherwise it is
+// lost and the totals continue from where they were. The energy is accounted from the raw counters of the samples,
+// which are cumulative, so that samples missed by a slow subscriber are not lost
+type Ledger struct {
+	// Retention is how long the hourly totals are kept, DefaultRetention unless changed after opening
+	Retention time.Duration
+
+	path   string
+	reader string
+	bootId string
+	// ranges holds the values the counters wrap around at per package, if the reader reports them
+	ranges map[int64]readers.Energy
+	// hardwareCounters is set when the counters outlive the process, otherwise the energy consumed while the process
+	// was down can not be accounted, see readers.HasHardwareCounters
+	hardwareCounters bool
+
+	mu    sync.Mutex
+	state State
+	// recorded is the time of the last sample recorded since opening
+	recorded time.Time
+	dirty    bool
+}
+
+// Open loads the ledger checkpointed at path, or creates an empty one if the file does not exist. reader identifies
+// the reader the samples are taken with, see readers.RaplReader
+func Open(path string, reader readers.RaplReader) (*Ledger, error) {
+	bootId, err := BootId()
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Ledger{
+		Retention:        DefaultRetention,
+		path:             path,
+		reader:           readers.StrategyName(reader),
+		bootId:           bootId,
+		hardwareCounters: readers.HasHardwareCounters(reader),
+	}
+
+	if ranger, ok := reader.(readers.EnergyRanger); ok {
+		l.ranges, err = ranger.EnergyRanges()
+		if err != nil {
+			klog.Errorf("reading the ranges of the counters failed, a wrap will be counted as a reset: %s", err)
+		}
+	}
+
+	l.state, err = Load(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		now := time.Now()
+		l.state = State{Version: Version, BootId: bootId, Reader: l.reader, Created: now, Updated: now}
+	case err != nil:
+		return nil, err
+	}
+
+	if l.state.Totals == nil {
+		l.state.Totals = make(map[int64]readers.Energy)
+	}
+
+	switch {
+	case l.state.BootId != bootId:
+		klog.Infof("host rebooted since the ledger was checkpointed at %s, the energy consumed meanwhile is lost", l.state.Updated.Format(time.RFC3339))
+		l.state.Reboots++
+		l.state.Counters = nil
+	case readers.CanonicalStrategyName(l.state.Reader) != l.reader:
+		klog.Infof("ledger was recorded with %s, counters of %s can not be compared with its counters", l.state.Reader, l.reader)
+		l.state.Counters = nil
+	case !l.hardwareCounters:
+		// the counters restart with the process, the totals simply continue
+		l.state.Counters = nil
+	}
+
+	l.state.BootId = bootId
+	l.state.Reader = l.reader
+
+	return l, nil
+}
+
+// Load reads the state checkpointed at path, without opening the ledger for recording, e.g. to report on it
+func Load(path string) (State, error) {
+	var state State
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return state, err
+	}
+
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return state, fmt.Errorf("parsing the ledger %s failed: %w", path, err)
+	}
+
+	if state.Version != Version {
+		return state, fmt.Errorf("unsupported ledger version %d in %s, expected %d", state.Version, path, Version)
+	}
+
+	return state, nil
+}
+
+// BootId returns the id of the current boot of the host
+func BootId() (string, error) {
+	bootId, err := readers.ReadStringFromFile(BootIdPath)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(bootId), nil
+}
+
+// Add adds energy deltas, e.g. of RaplReader.Read, to the totals
+func (l *Ledger) Add(delta readers.Measurement) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for pkgId, energy := range delta.Packages() {
+		l.state.Totals[pkgId] = l.state.Totals[pkgId].Add(energy)
+		l.addHourly(now, pkgId, energy)
+	}
+	l.state.Updated = now
+	l.dirty = true
+}
+
+// Record adds the energy consumed since the last recorded sample of a readers.Sampler to the totals, from the
+// difference of their counters. Samples that were missed, or failed, in between are thereby accounted for too. On the
+// first sample after opening the energy consumed since the checkpointed counters is added, if they can be compared
+func (l *Ledger) Record(sample readers.Sample) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if sample.Err != nil || sample.Time.IsZero() {
+		return
+	}
+
+	// the energy is accounted to the hour of the middle of the time since the last recorded sample, which is short
+	// compared to an hour
+	start := sample.Time.Add(-sample.Interval)
+	if !l.recorded.IsZero() && l.recorded.Before(start) {
+		start = l.recorded
+	}
+	middle := start.Add(sample.Time.Sub(start) / 2)
+
+	for pkgId, energy := range sample.Energy {
+		if counters, exists := sample.Counters[pkgId]; exists {
+			energy = l.since(pkgId, counters, energy)
+		}
+
+		l.state.Totals[pkgId] = l.state.Totals[pkgId].Add(energy)
+		l.addHourly(middle, pkgId, energy)
+	}
+	l.hour(middle).Covered += sample.Time.Sub(start).Seconds()
+
+	l.state.Counters = make(map[int64]readers.Energy, len(sample.Counters))
+	for pkgId, counters := range sample.Counters {
+		l.state.Counters[pkgId] = counters
+	}
+
+	l.state.Updated = sample.Time
+	l.recorded = sample.Time
+	l.dirty = true
+}
+
+// hour returns the hourly totals of the hour of t, creating them if needed. The hours past the retention, relative to
+// the latest one, are dropped
+func (l *Ledger) hour(t time.Time) *Hour {
+	start := t.UTC().Truncate(time.Hour)
+
+	if hour := l.findHour(start); hour != nil {
+		return hour
+	}
+
+	l.state.Hours = append(l.state.Hours, Hour{Start: start, Energy: make(map[int64]readers.Energy)})
+	// a no-op unless the hour is older than the latest one, e.g. after the clock was set back
+	sort.Slice(l.state.Hours, func(i, j int) bool { return l.state.Hours[i].Start.Before(l.state.Hours[j].Start) })
+
+	cutoff := l.state.Hours[len(l.state.Hours)-1].Start.Add(-l.Retention)
+	expired := 0
+	for expired < len(l.state.Hours) && l.state.Hours[expired].Start.Before(cutoff) {
+		expired++
+	}
+	l.state.Hours = l.state.Hours[expired:]
+
+	if hour := l.findHour(start); hour != nil {
+		return hour
+	}
+
+	// the hour itself is past the retention, it is accounted in the totals only
+	return &Hour{Start: start, Energy: make(map[int64]readers.Energy)}
+}
+
+func (l *Ledger) findHour(start time.Time) *Hour {
+	for i := len(l.state.Hours) - 1; i >= 0 && !l.state.Hours[i].Start.Before(start); i-- {
+		if l.state.Hours[i].Start.Equal(start) {
+			return &l.state.Hours[i]
+		}
+	}
+
+	return nil
+}
+
+func (l *Ledger) addHourly(t time.Time, pkgId int64, energy readers.Energy) {
+	hour := l.hour(t)
+	hour.Energy[pkgId] = hour.Energy[pkgId].Add(energy)
+}
+
+// since returns the energy consumed between the last recorded counters of a package and counters, correcting the
+// counters that wrapped around at the ranges of the reader. Without recorded counters, e.g. on the first sample after
+// a reboot, the energy of the sample is returned. For a counter found lower than the recorded one without a known
+// range, which was reset, the energy of the sample is taken
+func (l *Ledger) since(pkgId int64, counters readers.Energy, energy readers.Energy) readers.Energy {
+	last, exists := l.state.Counters[pkgId]
+	if !exists {
+		return energy
+	}
+
+	delta, reset := readers.Unwrap(counters, last, l.ranges[pkgId])
+	if len(reset) > 0 {
+		klog.Infof("counters %v of package %d were reset since %s, the energy consumed meanwhile is lost", reset, pkgId, l.state.Updated.Format(time.RFC3339))
+		l.state.Resets++
+
+		for _, domain := range reset {
+			delta.Set(domain, energy.Get(domain))
+		}
+	}
+
+	return delta
+}
+
+// Totals returns the joules consumed since the ledger was created, per package
+func (l *Ledger) Totals() map[int64]readers.Energy {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	totals := make(map[int64]readers.Energy, len(l.state.Totals))
+	for pkgId, energy := range l.state.Totals {
+		totals[pkgId] = energy
+	}
+
+	return totals
+}
+
+// State returns a copy of the state a checkpoint persists
+func (l *Ledger) State() State {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state := l.state
+	state.Totals = make(map[int64]readers.Energy, len(l.state.Totals))
+	for pkgId, energy := range l.state.Totals {
+		state.Totals[pkgId] = energy
+	}
+	state.Counters = make(map[int64]readers.Energy, len(l.state.Counters))
+	for pkgId, energy := range l.state.Counters {
+		state.Counters[pkgId] = energy
+	}
+	state.Hours = make([]Hour, len(l.state.Hours))
+	for i, hour := range l.state.Hours {
+		state.Hours[i] = Hour{Start: hour.Start, Energy: make(map[int64]readers.Energy, len(hour.Energy)), Covered: hour.Covered}
+		for pkgId, energy := range hour.Energy {
+			state.Hours[i].Energy[pkgId] = energy
+		}
+	}
+
+	return state
+}
+
+// Checkpoint writes the ledger to its file if anything changed since the last checkpoint. The file is written to a
+// temporary file in the same directory, synced and renamed over the previous checkpoint
+func (l *Ledger) Checkpoint() error {
+	l.mu.Lock()
+	if !l.dirty {
+		l.mu.Unlock()
+		return nil
+	}
+
+	data, err := json.MarshalIndent(l.state, "", "  ")
+	l.dirty = false
+	l.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	err = writeAtomically(l.path, data)
+	if err != nil {
+		l.mu.Lock()
+		l.dirty = true
+		l.mu.Unlock()
+	}
+
+	return err
+}
+
+// Run records every sample and checkpoints the ledger every interval until samples is closed, then checkpoints it a
+// last time. The checkpoints are written in the background, a slow disk does not hold up the samples
+func (l *Ledger) Run(ctx context.Context, samples <-chan readers.Sample, interval time.Duration) error {
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				err := l.Checkpoint()
+				if err != nil {
+					klog.Errorln(err)
+				}
+			}
+		}
+	}()
+
+	// the last checkpoint is written after the background ones stopped, so that it is not overwritten by an older one
+	last := func() error {
+		close(stop)
+		<-stopped
+
+		return l.Checkpoint()
+	}
+
+	for {
+		select {
+		case sample, ok := <-samples:
+			if !ok {
+				return last()
+			}
+
+			l.Record(sample)
+		case <-ctx.Done():
+			return last()
+		}
+	}
+}
+
+func writeAtomically(path string, data []byte) error {
+	dir := filepath.Dir(path)
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	// the temporary file is created private, the ledger is read by the report command too
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return err
+	}
+
+	// persist the rename itself
+	directory, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			klog.Errorln(err)
+		}
+	}(directory)
+
+	return directory.Sync()
+}
@@ -0,0 +1,132 @@
+package ledger
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+var start = time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+// fixtureReader returns a sysfs reader of a tree with package 0, wrapping around at maxRange micro joules unless it is
+// zero
+func fixtureReader(t *testing.T, maxRange uint64) readers.RaplReader {
+	t.Helper()
+
+	root := t.TempDir()
+	files := map[string]string{
+		"boot_id": "6a9e4d1c-0000-4000-8000-000000000000\n",
+		"class/powercap/intel-rapl/intel-rapl:0/name":      "package-0",
+		"class/powercap/intel-rapl/intel-rapl:0/energy_uj": "0",
+	}
+	if maxRange > 0 {
+		files["class/powercap/intel-rapl/intel-rapl:0/max_energy_range_uj"] = fmt.Sprint(maxRange)
+	}
+
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bootIdPath := BootIdPath
+	BootIdPath = filepath.Join(root, "boot_id")
+	t.Cleanup(func() { BootIdPath = bootIdPath })
+
+	return &readers.Sysfs{Root: root}
+}
+
+// sample is a sample of package 0 at the given second after start, over a second
+func sample(second int, energy float64, counter float64) readers.Sample {
+	return readers.Sample{
+		Time:     start.Add(time.Duration(second) * time.Second),
+		Interval: time.Second,
+		Energy:   map[int64]readers.Energy{0: {Pkg: energy}},
+		Counters: map[int64]readers.Energy{0: {Pkg: counter}},
+	}
+}
+
+func assertTotal(t *testing.T, l *Ledger, want float64) {
+	t.Helper()
+
+	if got := l.Totals()[0].Pkg; math.Abs(got-want) > 1e-9 {
+		t.Errorf("got a total of %v J, want %v J", got, want)
+	}
+}
+
+func TestLedgerAccountsMissedSamples(t *testing.T) {
+	l, err := Open(filepath.Join(t.TempDir(), "ledger.json"), fixtureReader(t, 100_000_000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l.Record(sample(1, 1, 10))
+	// the samples at 2s and 3s were dropped by the subscription, the one at 4s covers them
+	l.Record(sample(4, 1, 15))
+	assertTotal(t, l, 6)
+
+	if covered := l.State().Hours[0].Covered; covered != 4 {
+		t.Errorf("got %v s covered, want 4 s", covered)
+	}
+}
+
+func TestLedgerCorrectsWrapAcrossRestart(t *testing.T) {
+	reader := fixtureReader(t, 100_000_000)
+	path := filepath.Join(t.TempDir(), "ledger.json")
+
+	l, err := Open(path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Record(sample(1, 2, 90))
+	if err := l.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the counter wrapped around at 100 J while the process was down
+	l, err = Open(path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Record(sample(60, 1, 5))
+
+	assertTotal(t, l, 2+15)
+	if resets := l.State().Resets; resets != 0 {
+		t.Errorf("got %d resets, want the wrap corrected", resets)
+	}
+}
+
+func TestLedgerCountsResetWithoutRange(t *testing.T) {
+	reader := fixtureReader(t, 0)
+	path := filepath.Join(t.TempDir(), "ledger.json")
+
+	l, err := Open(path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Record(sample(1, 2, 90))
+	if err := l.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err = Open(path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Record(sample(60, 1, 5))
+
+	// the energy consumed while the process was down is lost, the sample itself is kept
+	assertTotal(t, l, 2+1)
+	if resets := l.State().Resets; resets != 1 {
+		t.Errorf("got %d resets, want 1", resets)
+	}
+}
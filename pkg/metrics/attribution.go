@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"sort"
+
+	"github.com/rekuberate-io/power/pkg/attribution"
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+const (
+	podEnergyFamilyName       = "rapl_pod_energy_joules"
+	containerEnergyFamilyName = "rapl_container_energy_joules"
+	systemEnergyFamilyName    = "rapl_system_energy_joules"
+)
+
+// CgroupFamilies converts the totals of a attribution.CgroupAttributor to per pod, per container and system energy
+// counters. Per domain, pods and system add up to the node energy across all packages
+func CgroupFamilies(node string, totals attribution.CgroupTotals) []Family {
+	pods := Family{
+		Name: podEnergyFamilyName,
+		Type: Counter,
+		Unit: "joules",
+		Help: "Energy attributed to the pod by the cpu time of its containers.",
+	}
+
+	containers := Family{
+		Name: containerEnergyFamilyName,
+		Type: Counter,
+		Unit: "joules",
+		Help: "Energy attributed to the container by its cpu time.",
+	}
+
+	system := Family{
+		Name: systemEnergyFamilyName,
+		Type: Counter,
+		Unit: "joules",
+		Help: "Energy not attributed to any pod, i.e. idle, system services and the kernel.",
+	}
+
+	var podUIDs []string
+	for podUID := range totals.Pods {
+		podUIDs = append(podUIDs, podUID)
+	}
+	sort.Strings(podUIDs)
+
+	var containerIds []string
+	for containerId := range totals.Containers {
+		containerIds = append(containerIds, containerId)
+	}
+	sort.Strings(containerIds)
+
+	for _, domain := range readers.Domains {
+		for _, podUID := range podUIDs {
+			pods.Points = append(pods.Points, Point{
+				Labels: []Label{
+					{Name: "node", Value: node},
+					{Name: "pod_uid", Value: podUID},
+					{Name: "domain", Value: domain.String()},
+				},
+				Value: totals.Pods[podUID].Get(domain),
+			})
+		}
+
+		for _, containerId := range containerIds {
+			container := totals.Containers[containerId]
+			containers.Points = append(containers.Points, Point{
+				Labels: []Label{
+					{Name: "node", Value: node},
+					{Name: "pod_uid", Value: container.PodUID},
+					{Name: "container_id", Value: containerId},
+					{Name: "qos", Value: string(container.QoS)},
+					{Name: "domain", Value: domain.String()},
+				},
+				Value: container.Energy.Get(domain),
+			})
+		}
+
+		system.Points = append(system.Points, Point{
+			Labels: []Label{
+				{Name: "node", Value: node},
+				{Name: "domain", Value: domain.String()},
+			},
+			Value: totals.System.Get(domain),
+		})
+	}
+
+	return []Family{pods, containers, system}
+}
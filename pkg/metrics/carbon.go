@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"strconv"
+
+	"github.com/rekuberate-io/power/pkg/carbon"
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+const (
+	emissionsFamilyName = "rapl_carbon_emissions_grams"
+	intensityFamilyName = "rapl_carbon_intensity_grams_per_kwh"
+)
+
+// CarbonFamilies converts the totals of a carbon.Accumulator to per package and domain emission counters, and the
+// last carbon intensity applied to a gauge
+func CarbonFamilies(node string, totals map[int64]carbon.Emissions, intensity float64) []Family {
+	emissions := Family{
+		Name: emissionsFamilyName,
+		Type: Counter,
+		Unit: "grams",
+		Help: "Estimated CO2 equivalent emitted by the energy of the rapl domain, including the pue multiplier.",
+	}
+
+	energies := make(map[int64]readers.Energy, len(totals))
+	for pkgId, pkgEmissions := range totals {
+		energies[pkgId] = readers.Energy(pkgEmissions)
+	}
+
+	for _, pkgId := range packageIds(energies) {
+		for _, domain := range readers.Domains {
+			emissions.Points = append(emissions.Points, Point{
+				Labels: []Label{
+					{Name: "node", Value: node},
+					{Name: "package", Value: strconv.FormatInt(pkgId, 10)},
+					{Name: "domain", Value: domain.String()},
+				},
+				Value: energies[pkgId].Get(domain),
+			})
+		}
+	}
+
+	gauge := Family{
+		Name: intensityFamilyName,
+		Type: Gauge,
+		Help: "Carbon intensity of the grid applied to the last sample.",
+		Points: []Point{
+			{Labels: []Label{{Name: "node", Value: node}}, Value: intensity},
+		},
+	}
+
+	return []Family{emissions, gauge}
+}
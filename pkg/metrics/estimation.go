@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"github.com/rekuberate-io/power/pkg/estimation"
+)
+
+const (
+	estimatedPowerFamilyName      = "system_estimated_power_watts"
+	estimatedWallEnergyFamilyName = "system_estimated_wall_energy_joules"
+)
+
+// EstimationFamilies converts the last estimate of a estimation.Estimator to power gauges per component, including
+// rapl, the power supply losses and the wall power, and the estimated wall energy to a counter
+func EstimationFamilies(node string, estimate estimation.Estimate, wallEnergy float64) []Family {
+	if estimate.Time.IsZero() {
+		return nil
+	}
+
+	power := Family{
+		Name: estimatedPowerFamilyName,
+		Type: Gauge,
+		Unit: "watts",
+		Help: "Estimated power of the components of the system during the last sampling interval.",
+	}
+
+	point := func(component string, kind string, watts float64) {
+		power.Points = append(power.Points, Point{
+			Labels: []Label{
+				{Name: "node", Value: node},
+				{Name: "component", Value: component},
+				{Name: "type", Value: kind},
+			},
+			Value: watts,
+		})
+	}
+
+	point("rapl", "measured", estimate.RaplWatts)
+	for _, component := range estimate.Components {
+		point(component.Name, string(component.Type), component.Watts)
+	}
+	point("psu_loss", "psu", estimate.PSULossWatts)
+	point("wall", "total", estimate.WallWatts)
+
+	energy := Family{
+		Name: estimatedWallEnergyFamilyName,
+		Type: Counter,
+		Unit: "joules",
+		Help: "Estimated energy drawn from the wall since the agent started.",
+		Points: []Point{
+			{Labels: []Label{{Name: "node", Value: node}}, Value: wallEnergy},
+		},
+	}
+
+	return []Family{power, energy}
+}
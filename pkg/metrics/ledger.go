@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"strconv"
+
+	"github.com/rekuberate-io/power/pkg/ledger"
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+const (
+	ledgerEnergyFamilyName  = "rapl_ledger_energy_joules"
+	ledgerRebootsFamilyName = "rapl_ledger_reboots"
+	ledgerResetsFamilyName  = "rapl_ledger_counter_resets"
+)
+
+// LedgerFamilies converts the state of a ledger.Ledger to per package and domain energy counters that survive restarts
+// of the agent, and the reboots and counter resets the ledger detected
+func LedgerFamilies(node string, state ledger.State) []Family {
+	energy := Family{
+		Name: ledgerEnergyFamilyName,
+		Type: Counter,
+		Unit: "joules",
+		Help: "Energy consumed by the rapl domain since the ledger was created, across restarts of the agent.",
+	}
+
+	for _, pkgId := range packageIds(state.Totals) {
+		for _, domain := range readers.Domains {
+			energy.Points = append(energy.Points, Point{
+				Labels: []Label{
+					{Name: "node", Value: node},
+					{Name: "package", Value: strconv.FormatInt(pkgId, 10)},
+					{Name: "domain", Value: domain.String()},
+				},
+				Value: state.Totals[pkgId].Get(domain),
+			})
+		}
+	}
+
+	reboots := Family{
+		Name:   ledgerRebootsFamilyName,
+		Type:   Counter,
+		Help:   "Reboots of the host the ledger detected, the energy consumed while the agent was down is lost on a reboot.",
+		Points: []Point{{Labels: []Label{{Name: "node", Value: node}}, Value: float64(state.Reboots)}},
+	}
+
+	resets := Family{
+		Name:   ledgerResetsFamilyName,
+		Type:   Counter,
+		Help:   "Counter resets without a reboot the ledger detected.",
+		Points: []Point{{Labels: []Label{{Name: "node", Value: node}}, Value: float64(state.Resets)}},
+	}
+
+	return []Family{energy, reboots, resets}
+}
@@ -0,0 +1,145 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the content type of the OpenMetrics text exposition format
+const ContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+type MetricType string
+
+const (
+	Counter MetricType = "counter"
+	Gauge   MetricType = "gauge"
+	Info    MetricType = "info"
+)
+
+// Label is a name/value pair identifying a metric point, labels are written in the order they are given
+type Label struct {
+	Name, Value string
+}
+
+// Point is a single value of a metric family
+type Point struct {
+	Labels []Label
+	Value  float64
+}
+
+// Family is a set of points sharing a name, type, unit and help text
+type Family struct {
+	// Name is the name of the family without the _total or _info suffix, which is appended according to Type
+	Name   string
+	Type   MetricType
+	Unit   string
+	Help   string
+	Points []Point
+}
+
+// Encoder writes metric families in the OpenMetrics text exposition format
+type Encoder struct {
+	w   *bufio.Writer
+	err error
+}
+
+// NewEncoder creates an encoder writing to w
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: bufio.NewWriter(w)}
+}
+
+// Encode writes a metric family, families without points are skipped
+func (e *Encoder) Encode(family Family) error {
+	if e.err != nil {
+		return e.err
+	}
+
+	if len(family.Points) == 0 {
+		return nil
+	}
+
+	e.printf("# TYPE %s %s\n", family.Name, family.Type)
+	if family.Unit != "" {
+		e.printf("# UNIT %s %s\n", family.Name, family.Unit)
+	}
+	if family.Help != "" {
+		e.printf("# HELP %s %s\n", family.Name, escape(family.Help, false))
+	}
+
+	name := family.Name
+	switch family.Type {
+	case Counter:
+		name += "_total"
+	case Info:
+		name += "_info"
+	}
+
+	for _, point := range family.Points {
+		e.printf("%s%s %s\n", name, formatLabels(point.Labels), formatValue(point.Value))
+	}
+
+	return e.err
+}
+
+// Close terminates the exposition with the mandatory EOF marker and flushes it
+func (e *Encoder) Close() error {
+	if e.err != nil {
+		return e.err
+	}
+
+	e.printf("# EOF\n")
+	if e.err != nil {
+		return e.err
+	}
+
+	return e.w.Flush()
+}
+
+func (e *Encoder) printf(format string, a ...interface{}) {
+	if e.err != nil {
+		return
+	}
+
+	_, e.err = fmt.Fprintf(e.w, format, a...)
+}
+
+func formatLabels(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(labels))
+	for _, label := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", label.Name, escape(label.Value, true)))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// escape escapes backslashes and newlines, and double quotes within label values
+func escape(s string, quotes bool) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	if quotes {
+		s = strings.ReplaceAll(s, `"`, `\"`)
+	}
+
+	return s
+}
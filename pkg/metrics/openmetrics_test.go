@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+func assertExposition(t *testing.T, families []Family, want string) {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	if err := Write(&buffer, families...); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := buffer.String(); got != want {
+		t.Errorf("got exposition\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestEncoderEscapesLabelsAndHelp(t *testing.T) {
+	families := []Family{{
+		Name: "test_value",
+		Type: Gauge,
+		Help: "A help with a \\ backslash, \"quotes\"\nand a newline.",
+		Points: []Point{
+			{Labels: []Label{{Name: "path", Value: `C:\power`}, {Name: "quoted", Value: `say "hi"`}, {Name: "lines", Value: "a\nb"}}, Value: 1.5},
+		},
+	}}
+
+	assertExposition(t, families, `# TYPE test_value gauge
+# HELP test_value A help with a \\ backslash, "quotes"\nand a newline.
+test_value{path="C:\\power",quoted="say \"hi\"",lines="a\nb"} 1.5
+# EOF
+`)
+}
+
+func TestEncoderSuffixesAndOrder(t *testing.T) {
+	families := []Family{
+		{Name: "b_joules", Type: Counter, Unit: "joules", Help: "Counted.", Points: []Point{{Value: 2}, {Labels: []Label{{Name: "n", Value: "1"}}, Value: 3e-7}}},
+		{Name: "a_empty", Type: Gauge, Help: "Skipped without points."},
+		{Name: "a_build", Type: Info, Points: []Point{{Labels: []Label{{Name: "version", Value: "1"}}, Value: 1}}},
+		{Name: "a_special", Type: Gauge, Points: []Point{{Value: math.Inf(1)}, {Value: math.Inf(-1)}}},
+	}
+
+	// the families are written in the order given, counters end in _total and info metrics in _info
+	assertExposition(t, families, `# TYPE b_joules counter
+# UNIT b_joules joules
+# HELP b_joules Counted.
+b_joules_total 2
+b_joules_total{n="1"} 3e-07
+# TYPE a_build info
+a_build_info{version="1"} 1
+# TYPE a_special gauge
+a_special +Inf
+a_special -Inf
+# EOF
+`)
+}
+
+func TestEncoderWritesEOFWithoutFamilies(t *testing.T) {
+	assertExposition(t, nil, "# EOF\n")
+}
+
+func TestSnapshotFamilies(t *testing.T) {
+	cpu := &readers.Cpu{
+		PhysicalId: 0,
+		Vendor:     readers.Intel,
+		Model:      readers.Model{Id: 85, Name: " Intel(R) Xeon(R) \"Gold\" ", InternalName: "CPU_SKYLAKE_X"},
+		Family:     6,
+		Cores:      []readers.Core{{Id: 0, Package: 0, Die: 0}, {Id: 1, Package: 1, Die: 1}},
+	}
+
+	snapshot := Snapshot{
+		Node: "node-1",
+		Time: time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC),
+		Cpus: map[int]*readers.Cpu{0: cpu},
+		// the packages are written in the order of their ids
+		Totals: map[int64]readers.Energy{1: {Pkg: 20}, 0: {Pkg: 10, DRAM: 1}},
+		Power:  map[int64]readers.Power{0: {Pkg: 5}},
+	}
+
+	assertExposition(t, snapshot.Families(), `# TYPE rapl_energy_joules counter
+# UNIT rapl_energy_joules joules
+# HELP rapl_energy_joules Energy consumed by the rapl domain since the agent started.
+rapl_energy_joules_total{node="node-1",package="0",die="0",domain="package"} 10
+rapl_energy_joules_total{node="node-1",package="0",die="0",domain="core"} 0
+rapl_energy_joules_total{node="node-1",package="0",die="0",domain="uncore"} 0
+rapl_energy_joules_total{node="node-1",package="0",die="0",domain="dram"} 1
+rapl_energy_joules_total{node="node-1",package="0",die="0",domain="psys"} 0
+rapl_energy_joules_total{node="node-1",package="1",die="1",domain="package"} 20
+rapl_energy_joules_total{node="node-1",package="1",die="1",domain="core"} 0
+rapl_energy_joules_total{node="node-1",package="1",die="1",domain="uncore"} 0
+rapl_energy_joules_total{node="node-1",package="1",die="1",domain="dram"} 0
+rapl_energy_joules_total{node="node-1",package="1",die="1",domain="psys"} 0
+# TYPE rapl_power_watts gauge
+# UNIT rapl_power_watts watts
+# HELP rapl_power_watts Average power drawn by the rapl domain during the last sampling interval.
+rapl_power_watts{node="node-1",package="0",die="0",domain="package"} 5
+rapl_power_watts{node="node-1",package="0",die="0",domain="core"} 0
+rapl_power_watts{node="node-1",package="0",die="0",domain="uncore"} 0
+rapl_power_watts{node="node-1",package="0",die="0",domain="dram"} 0
+rapl_power_watts{node="node-1",package="0",die="0",domain="psys"} 0
+# TYPE rapl_cpu info
+# HELP rapl_cpu Processor detected on the socket.
+rapl_cpu_info{node="node-1",socket="0",vendor="Intel",model_name="Intel(R) Xeon(R) \"Gold\"",internal_model_name="CPU_SKYLAKE_X",family="6"} 1
+# TYPE rapl_estimated gauge
+# HELP rapl_estimated Whether the rapl energy is estimated by a model (1) instead of read from the rapl counters (0).
+rapl_estimated{node="node-1"} 0
+# EOF
+`)
+}
@@ -0,0 +1,181 @@
+package metrics
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+const (
+	energyFamilyName    = "rapl_energy_joules"
+	powerFamilyName     = "rapl_power_watts"
+	cpuFamilyName       = "rapl_cpu"
+	estimatedFamilyName = "rapl_estimated"
+)
+
+// Snapshot is the state of the rapl counters of a node at one point in time
+type Snapshot struct {
+	Node string
+	Time time.Time
+	// Cpus is the detected topology, used for the die labels and the info metrics
+	Cpus map[int]*readers.Cpu
+	// Totals holds the monotonic energy totals in joules, per package
+	Totals map[int64]readers.Energy
+	// Power holds the average power in watts of the last interval, per package
+	Power map[int64]readers.Power
+	// Estimated is set when the energy is modeled instead of read from the rapl counters, see readers.IsEstimated
+	Estimated bool
+}
+
+// FromSample creates a snapshot from the last sample of a readers.Sampler
+func FromSample(node string, sample readers.Sample, cpus map[int]*readers.Cpu) Snapshot {
+	return Snapshot{
+		Node:   node,
+		Time:   sample.Time,
+		Cpus:   cpus,
+		Totals: sample.Totals,
+		Power:  sample.Power(),
+	}
+}
+
+// FromMeasurement creates a snapshot from a measurement taken over interval, e.g. by RaplReader.Read, adding it to
+// the running totals given
+func FromMeasurement(node string, measurement readers.Measurement, interval time.Duration, totals map[int64]readers.Energy, cpus map[int]*readers.Cpu) Snapshot {
+	snapshot := Snapshot{
+		Node:   node,
+		Time:   time.Now(),
+		Cpus:   cpus,
+		Totals: make(map[int64]readers.Energy),
+		Power:  make(map[int64]readers.Power),
+	}
+
+	for pkgId, energy := range totals {
+		snapshot.Totals[pkgId] = energy
+	}
+
+	for pkgId, energy := range measurement.Packages() {
+		snapshot.Totals[pkgId] = snapshot.Totals[pkgId].Add(energy)
+		snapshot.Power[pkgId] = energy.ToWatts(interval)
+	}
+
+	return snapshot
+}
+
+// Families converts the snapshot to the rapl energy counters, power gauges and cpu info metric families
+func (s Snapshot) Families() []Family {
+	dies := make(map[int64]int64)
+	for _, cpu := range s.Cpus {
+		for pkgId, die := range cpu.Dies() {
+			dies[pkgId] = die
+		}
+	}
+
+	energy := Family{
+		Name: energyFamilyName,
+		Type: Counter,
+		Unit: "joules",
+		Help: "Energy consumed by the rapl domain since the agent started.",
+	}
+
+	power := Family{
+		Name: powerFamilyName,
+		Type: Gauge,
+		Unit: "watts",
+		Help: "Average power drawn by the rapl domain during the last sampling interval.",
+	}
+
+	for _, pkgId := range packageIds(s.Totals) {
+		for _, domain := range readers.Domains {
+			labels := s.labels(pkgId, dies[pkgId], domain)
+			energy.Points = append(energy.Points, Point{Labels: labels, Value: s.Totals[pkgId].Get(domain)})
+
+			if watts, exists := s.Power[pkgId]; exists {
+				power.Points = append(power.Points, Point{Labels: labels, Value: readers.Energy(watts).Get(domain)})
+			}
+		}
+	}
+
+	estimated := Family{
+		Name:   estimatedFamilyName,
+		Type:   Gauge,
+		Help:   "Whether the rapl energy is estimated by a model (1) instead of read from the rapl counters (0).",
+		Points: []Point{{Labels: []Label{{Name: "node", Value: s.Node}}}},
+	}
+	if s.Estimated {
+		estimated.Points[0].Value = 1
+	}
+
+	return []Family{energy, power, s.cpuInfo(), estimated}
+}
+
+// Write renders the snapshot as an OpenMetrics exposition to w
+func (s Snapshot) Write(w io.Writer) error {
+	return Write(w, s.Families()...)
+}
+
+// Write renders the given families as an OpenMetrics exposition to w
+func Write(w io.Writer, families ...Family) error {
+	encoder := NewEncoder(w)
+	for _, family := range families {
+		err := encoder.Encode(family)
+		if err != nil {
+			return err
+		}
+	}
+
+	return encoder.Close()
+}
+
+func (s Snapshot) labels(pkgId int64, die int64, domain readers.Domain) []Label {
+	return []Label{
+		{Name: "node", Value: s.Node},
+		{Name: "package", Value: strconv.FormatInt(pkgId, 10)},
+		{Name: "die", Value: strconv.FormatInt(die, 10)},
+		{Name: "domain", Value: domain.String()},
+	}
+}
+
+func (s Snapshot) cpuInfo() Family {
+	info := Family{
+		Name: cpuFamilyName,
+		Type: Info,
+		Help: "Processor detected on the socket.",
+	}
+
+	var sockets []int
+	for socket := range s.Cpus {
+		sockets = append(sockets, socket)
+	}
+	sort.Ints(sockets)
+
+	for _, socket := range sockets {
+		cpu := s.Cpus[socket]
+		info.Points = append(info.Points, Point{
+			Labels: []Label{
+				{Name: "node", Value: s.Node},
+				{Name: "socket", Value: strconv.Itoa(cpu.PhysicalId)},
+				{Name: "vendor", Value: cpu.Vendor.String()},
+				{Name: "model_name", Value: strings.TrimSpace(cpu.Model.Name)},
+				{Name: "internal_model_name", Value: cpu.Model.InternalName},
+				{Name: "family", Value: strconv.Itoa(cpu.Family)},
+			},
+			Value: 1,
+		})
+	}
+
+	return info
+}
+
+func packageIds(energies map[int64]readers.Energy) []int64 {
+	var pkgIds []int64
+	for pkgId := range energies {
+		pkgIds = append(pkgIds, pkgId)
+	}
+	sort.Slice(pkgIds, func(i, j int) bool { return pkgIds[i] < pkgIds[j] })
+
+	return pkgIds
+}
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/rekuberate-io/power/pkg/sink"
+)
+
+const (
+	sinkWrittenFamilyName = "rapl_sink_measurements_written"
+	sinkDroppedFamilyName = "rapl_sink_measurements_dropped"
+	sinkErrorsFamilyName  = "rapl_sink_errors"
+)
+
+func init() {
+	sink.Register("openmetrics", newTextfileSink)
+}
+
+// textfileSink writes every measurement as an OpenMetrics exposition to stdout, or to a file replaced atomically, as
+// the textfile collector of the node exporter expects
+type textfileSink struct {
+	path string
+}
+
+// newTextfileSink creates a sink writing to the file of the target, stdout if empty or "-"
+func newTextfileSink(config sink.Config) (sink.Sink, error) {
+	path := config.Target
+	if path == "-" {
+		path = ""
+	}
+
+	return &textfileSink{path: path}, nil
+}
+
+func (t *textfileSink) Write(_ context.Context, measurement sink.Measurement) error {
+	if measurement.Err != nil {
+		return nil
+	}
+
+	snapshot := FromSample(measurement.Topology.Node, measurement.Sample, measurement.Topology.Cpus)
+	snapshot.Estimated = measurement.Topology.Estimated
+
+	var exposition bytes.Buffer
+	err := snapshot.Write(&exposition)
+	if err != nil {
+		return err
+	}
+
+	if t.path == "" {
+		_, err := os.Stdout.Write(exposition.Bytes())
+		return err
+	}
+
+	return WriteFile(t.path, exposition.Bytes())
+}
+
+func (t *textfileSink) Close() error {
+	return nil
+}
+
+// WriteFile replaces the file at path with data through a rename, so that a collector never reads a partial exposition
+func WriteFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	// the temporary file is created private, the collector may run as another user
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// SinkFamilies converts the stats of the sinks of a sink.Dispatcher to counters of the measurements written and dropped,
+// and of the errors, per sink
+func SinkFamilies(node string, stats []sink.Stats) []Family {
+	written := Family{
+		Name: sinkWrittenFamilyName,
+		Type: Counter,
+		Help: "Measurements written to the sink.",
+	}
+
+	dropped := Family{
+		Name: sinkDroppedFamilyName,
+		Type: Counter,
+		Help: "Measurements dropped because the buffer of the sink was full.",
+	}
+
+	failures := Family{
+		Name: sinkErrorsFamilyName,
+		Type: Counter,
+		Help: "Failed writes, flushes and closes of the sink.",
+	}
+
+	for _, s := range stats {
+		labels := []Label{{Name: "node", Value: node}, {Name: "sink", Value: s.Name}}
+		written.Points = append(written.Points, Point{Labels: labels, Value: float64(s.Written)})
+		dropped.Points = append(dropped.Points, Point{Labels: labels, Value: float64(s.Dropped)})
+		failures.Points = append(failures.Points, Point{Labels: labels, Value: float64(s.Errors)})
+	}
+
+	return []Family{written, dropped, failures}
+}
@@ -0,0 +1,433 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/internal/batch"
+	"github.com/rekuberate-io/power/pkg/readers"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// MetricsPath is the path of the OTLP/HTTP metrics endpoint, appended to endpoints without a path
+	MetricsPath = "/v1/metrics"
+
+	scopeName       = "github.com/rekuberate-io/power"
+	energyName      = "rapl.energy"
+	powerName       = "rapl.power"
+	protobufContent = "application/x-protobuf"
+	jsonContent     = "application/json"
+)
+
+type Encoding int
+
+const (
+	Protobuf Encoding = iota
+	JSON
+)
+
+func (e Encoding) String() string {
+	var values []string = []string{"protobuf", "json"}
+	if int(e) < 0 || int(e) >= len(values) {
+		return "unknown"
+	}
+
+	return values[e]
+}
+
+// ParseEncoding parses one of "protobuf" or "json"
+func ParseEncoding(s string) (Encoding, error) {
+	for _, encoding := range []Encoding{Protobuf, JSON} {
+		if strings.EqualFold(strings.TrimSpace(s), encoding.String()) {
+			return encoding, nil
+		}
+	}
+
+	return Protobuf, fmt.Errorf("unknown otlp encoding %q, expected one of: protobuf, json", s)
+}
+
+// Config configures an Exporter, the zero values of the durations and sizes fall back to the defaults
+type Config struct {
+	// Endpoint is the url of the collector, e.g. http://localhost:4318, MetricsPath is appended if it has no path
+	Endpoint string
+	Encoding Encoding
+	// Headers are added to every request, e.g. for authentication
+	Headers map[string]string
+	// Attributes are added to the resource, next to the ones of the topology
+	Attributes []KeyValue
+	// Interval is the time between two exports, 30s by default
+	Interval time.Duration
+	// BatchSize is the most samples exported by a request, a full batch is exported right away, 60 by default
+	BatchSize int
+	// MaxQueue is the most samples kept while the collector is unreachable, the oldest are dropped first, 1000 by
+	// default. The energy is cumulative, so dropped samples only lose resolution
+	MaxQueue int
+	// Timeout limits every request, 10s by default
+	Timeout time.Duration
+	// MaxElapsed limits the retries of a batch, 1m by default, the batch is kept for the next export then
+	MaxElapsed time.Duration
+	Client     *http.Client
+}
+
+func (c *Config) defaults() {
+	if c.Interval <= 0 {
+		c.Interval = 30 * time.Second
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 60
+	}
+	if c.MaxQueue <= 0 {
+		c.MaxQueue = 1000
+	}
+	if c.MaxQueue < c.BatchSize {
+		c.MaxQueue = c.BatchSize
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	if c.MaxElapsed <= 0 {
+		c.MaxElapsed = time.Minute
+	}
+	if c.Client == nil {
+		c.Client = &http.Client{}
+	}
+}
+
+// point is what the exporter keeps of a sample
+type point struct {
+	time   time.Time
+	totals map[int64]readers.Energy
+	power  map[int64]readers.Power
+}
+
+// Exporter pushes the energy totals of a readers.Sampler as a cumulative, monotonic Sum (rapl.energy, J) and the power
+// of the last interval as a Gauge (rapl.power, W), per package, die and domain, to an OTLP/HTTP collector. Samples are
+// batched, failed requests are retried with exponential backoff on the status codes the OTLP specification marks as
+// retryable
+type Exporter struct {
+	config   Config
+	endpoint string
+	resource Resource
+	dies     map[int64]int64
+
+	queue *batch.Queue
+
+	mu    sync.Mutex
+	start time.Time
+}
+
+// New creates an exporter for the node with the given topology
+func New(config Config, node string, cpus map[int]*readers.Cpu) (*Exporter, error) {
+	config.defaults()
+
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid otlp endpoint: %w", err)
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("invalid otlp endpoint %q, expected an http or https url", config.Endpoint)
+	}
+	if endpoint.Path == "" || endpoint.Path == "/" {
+		endpoint.Path = MetricsPath
+	}
+
+	dies := make(map[int64]int64)
+	for _, cpu := range cpus {
+		for pkgId, die := range cpu.Dies() {
+			dies[pkgId] = die
+		}
+	}
+
+	resource := NewResource(node, cpus)
+	resource.Attributes = append(resource.Attributes, config.Attributes...)
+
+	return &Exporter{
+		config:   config,
+		endpoint: endpoint.String(),
+		resource: resource,
+		dies:     dies,
+		queue:    batch.NewQueue(config.BatchSize, config.MaxQueue),
+	}, nil
+}
+
+// NewResource describes the node by the resource semantic conventions of a host: its name, architecture and the
+// vendor, family and model of its processors, taken from the lowest socket
+func NewResource(node string, cpus map[int]*readers.Cpu) Resource {
+	resource := Resource{Attributes: []KeyValue{
+		String("host.name", node),
+		String("host.arch", runtime.GOARCH),
+	}}
+
+	var sockets []int
+	for socket := range cpus {
+		sockets = append(sockets, socket)
+	}
+	sort.Ints(sockets)
+
+	if len(sockets) > 0 {
+		cpu := cpus[sockets[0]]
+		resource.Attributes = append(resource.Attributes,
+			String("host.cpu.vendor.id", cpu.Vendor.String()),
+			String("host.cpu.family", strconv.Itoa(cpu.Family)),
+			String("host.cpu.model.id", strconv.Itoa(cpu.Model.Id)),
+			String("host.cpu.model.name", strings.TrimSpace(cpu.Model.Name)),
+			Int("host.cpu.sockets", int64(len(sockets))),
+		)
+	}
+
+	return resource
+}
+
+// Add queues a sample for the next export, failed samples are skipped
+func (e *Exporter) Add(sample readers.Sample) {
+	if sample.Err != nil || sample.Time.IsZero() {
+		return
+	}
+
+	// the totals of the sampler count from the start of its first interval
+	e.mu.Lock()
+	if e.start.IsZero() {
+		e.start = sample.Time.Add(-sample.Interval)
+	}
+	e.mu.Unlock()
+
+	e.queue.Add(point{time: sample.Time, totals: sample.Totals, power: sample.Power()})
+}
+
+// Stats returns the number of samples exported and dropped so far
+func (e *Exporter) Stats() (exported int, dropped int) {
+	return e.queue.Stats()
+}
+
+// Flush exports the queued samples in batches. A batch failing with a retryable error is kept for the next export,
+// one the collector rejects is dropped
+func (e *Exporter) Flush(ctx context.Context) error {
+	return e.flush(ctx, e.config.MaxElapsed)
+}
+
+func (e *Exporter) flush(ctx context.Context, maxElapsed time.Duration) error {
+	return e.queue.Flush(ctx, func(ctx context.Context, values []interface{}) error {
+		points := make([]point, len(values))
+		for i, value := range values {
+			points[i] = value.(point)
+		}
+
+		return e.send(ctx, e.request(points), maxElapsed)
+	})
+}
+
+// Run adds every sample and exports them every interval, or as soon as a batch is full, until samples is closed or
+// ctx is done. The exports run apart from the samples, which keep being queued while a batch is retried. The queue is
+// flushed a last time, without retries, on the way out
+func (e *Exporter) Run(ctx context.Context, samples <-chan readers.Sample) error {
+	exportCtx, cancel := context.WithCancel(ctx)
+	exported := make(chan struct{})
+
+	go func() {
+		defer close(exported)
+
+		ticker := time.NewTicker(e.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-exportCtx.Done():
+				return
+			case <-e.queue.Full():
+				e.export(exportCtx)
+			case <-ticker.C:
+				e.export(exportCtx)
+			}
+		}
+	}()
+
+	defer func() {
+		cancel()
+		<-exported
+
+		// ctx may be done already, the last export gets its own deadline
+		flushCtx, cancel := context.WithTimeout(context.Background(), e.config.Timeout)
+		defer cancel()
+
+		err := e.flush(flushCtx, 0)
+		if err != nil {
+			klog.Errorf("last otlp export failed: %s", err)
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case sample, ok := <-samples:
+			if !ok {
+				return nil
+			}
+
+			e.Add(sample)
+		}
+	}
+}
+
+func (e *Exporter) export(ctx context.Context) {
+	err := e.Flush(ctx)
+	if err != nil && ctx.Err() == nil {
+		klog.Errorf("otlp export failed: %s", err)
+	}
+}
+
+// request converts a batch of samples to an export request
+func (e *Exporter) request(batch []point) MetricsRequest {
+	energy := Metric{
+		Name:        energyName,
+		Description: "Energy consumed by the rapl domain since the exporter started.",
+		Unit:        "J",
+		Sum:         &Sum{DataPoints: []DataPoint{}, AggregationTemporality: TemporalityCumulative, IsMonotonic: true},
+	}
+
+	power := Metric{
+		Name:        powerName,
+		Description: "Average power drawn by the rapl domain during the last sampling interval.",
+		Unit:        "W",
+		Gauge:       &Gauge{DataPoints: []DataPoint{}},
+	}
+
+	e.mu.Lock()
+	start := unixNano(e.start.UnixNano())
+	e.mu.Unlock()
+
+	for _, p := range batch {
+		end := unixNano(p.time.UnixNano())
+
+		var pkgIds []int64
+		for pkgId := range p.totals {
+			pkgIds = append(pkgIds, pkgId)
+		}
+		sort.Slice(pkgIds, func(i, j int) bool { return pkgIds[i] < pkgIds[j] })
+
+		for _, pkgId := range pkgIds {
+			for _, domain := range readers.Domains {
+				attributes := []KeyValue{
+					Int("package", pkgId),
+					Int("die", e.dies[pkgId]),
+					String("domain", domain.String()),
+				}
+
+				energy.Sum.DataPoints = append(energy.Sum.DataPoints, DataPoint{
+					Attributes:        attributes,
+					StartTimeUnixNano: start,
+					TimeUnixNano:      end,
+					AsDouble:          p.totals[pkgId].Get(domain),
+				})
+
+				if watts, exists := p.power[pkgId]; exists {
+					power.Gauge.DataPoints = append(power.Gauge.DataPoints, DataPoint{
+						Attributes:   attributes,
+						TimeUnixNano: end,
+						AsDouble:     readers.Energy(watts).Get(domain),
+					})
+				}
+			}
+		}
+	}
+
+	return MetricsRequest{ResourceMetrics: []ResourceMetrics{{
+		Resource: e.resource,
+		ScopeMetrics: []ScopeMetrics{{
+			Scope:   Scope{Name: scopeName},
+			Metrics: []Metric{energy, power},
+		}},
+	}}}
+}
+
+// send posts the request, retrying retryable failures with exponential backoff and jitter for up to maxElapsed
+func (e *Exporter) send(ctx context.Context, request MetricsRequest, maxElapsed time.Duration) error {
+	var body []byte
+	var contentType string
+	switch e.config.Encoding {
+	case JSON:
+		var err error
+		body, err = json.Marshal(request)
+		if err != nil {
+			return &batch.PermanentError{Err: err}
+		}
+		contentType = jsonContent
+	default:
+		body = request.MarshalProto()
+		contentType = protobufContent
+	}
+
+	return batch.Retry(ctx, "otlp export", maxElapsed, func() error {
+		return e.post(ctx, body, contentType)
+	})
+}
+
+func (e *Exporter) post(ctx context.Context, body []byte, contentType string) error {
+	ctx, cancel := context.WithTimeout(ctx, e.config.Timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return &batch.PermanentError{Err: err}
+	}
+	request.Header.Set("Content-Type", contentType)
+	for key, value := range e.config.Headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := e.config.Client.Do(request)
+	if err != nil {
+		// the collector is unreachable, or did not answer in time
+		return &batch.RetryableError{Err: err}
+	}
+	defer response.Body.Close()
+
+	responseBody, err := io.ReadAll(io.LimitReader(response.Body, 64*1024))
+	if err != nil {
+		return &batch.RetryableError{Err: err}
+	}
+
+	switch {
+	case response.StatusCode >= 200 && response.StatusCode < 300:
+		e.partialSuccess(response.Header.Get("Content-Type"), responseBody)
+		return nil
+	case response.StatusCode == http.StatusTooManyRequests, response.StatusCode == http.StatusBadGateway,
+		response.StatusCode == http.StatusServiceUnavailable, response.StatusCode == http.StatusGatewayTimeout:
+		return &batch.RetryableError{
+			Err:        fmt.Errorf("otlp collector returned %s", response.Status),
+			RetryAfter: batch.RetryAfter(response.Header.Get("Retry-After")),
+		}
+	}
+
+	return &batch.PermanentError{Err: fmt.Errorf("otlp collector rejected the export with %s: %s", response.Status, strings.TrimSpace(string(responseBody)))}
+}
+
+// partialSuccess logs the data points an accepting collector rejected, which only the json responses are checked for
+func (e *Exporter) partialSuccess(contentType string, body []byte) {
+	if !strings.HasPrefix(contentType, jsonContent) || len(body) == 0 {
+		return
+	}
+
+	var response MetricsResponse
+	err := json.Unmarshal(body, &response)
+	if err != nil || response.PartialSuccess == nil {
+		return
+	}
+
+	if response.PartialSuccess.RejectedDataPoints != "" || response.PartialSuccess.ErrorMessage != "" {
+		klog.Warningf("otlp collector rejected %s data points: %s", response.PartialSuccess.RejectedDataPoints, response.PartialSuccess.ErrorMessage)
+	}
+}
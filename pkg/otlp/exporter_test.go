@@ -0,0 +1,238 @@
+package otlp_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/otlp"
+	"github.com/rekuberate-io/power/pkg/otlp/otlptest"
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+var start = time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+// sample is the n-th sample of a package drawing 1 W, the total is n joules
+func sample(n int) readers.Sample {
+	return readers.Sample{
+		Time:     start.Add(time.Duration(n) * time.Second),
+		Interval: time.Second,
+		Energy:   map[int64]readers.Energy{0: {Pkg: 1}},
+		Totals:   map[int64]readers.Energy{0: {Pkg: float64(n)}},
+	}
+}
+
+// packageTotals returns the package domain values of the energy data points the collector accepted
+func packageTotals(collector *otlptest.Collector) []float64 {
+	var totals []float64
+	for _, point := range collector.DataPoints("rapl.energy") {
+		for _, attribute := range point.Attributes {
+			if attribute.Key == "domain" && attribute.Value.StringValue != nil && *attribute.Value.StringValue == "package" {
+				totals = append(totals, point.AsDouble)
+			}
+		}
+	}
+
+	return totals
+}
+
+func assertTotals(t *testing.T, got []float64, want ...float64) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got totals %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got totals %v, want %v", got, want)
+		}
+	}
+}
+
+func newExporter(t *testing.T, config otlp.Config) *otlp.Exporter {
+	t.Helper()
+
+	exporter, err := otlp.New(config, "node", readers.Cpus)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return exporter
+}
+
+func TestExporterEncodings(t *testing.T) {
+	for encoding, contentType := range map[otlp.Encoding]string{otlp.Protobuf: "application/x-protobuf", otlp.JSON: "application/json"} {
+		t.Run(encoding.String(), func(t *testing.T) {
+			collector := otlptest.NewCollector()
+			defer collector.Close()
+
+			exporter := newExporter(t, otlp.Config{
+				Endpoint: collector.URL(),
+				Encoding: encoding,
+				Headers:  map[string]string{"Authorization": "Bearer token"},
+			})
+			exporter.Add(sample(1))
+			exporter.Add(sample(2))
+
+			if err := exporter.Flush(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			requests := collector.Requests()
+			if len(requests) != 1 || requests[0].ContentType != contentType || requests[0].Header.Get("Authorization") != "Bearer token" {
+				t.Fatalf("got requests %+v, want one %s request with the header", requests, contentType)
+			}
+			if requests[0].Metrics == nil {
+				t.Fatalf("the collector could not decode the %s request", encoding)
+			}
+
+			assertTotals(t, packageTotals(collector), 1, 2)
+			if points := collector.DataPoints("rapl.power"); len(points) != 2*len(readers.Domains) {
+				t.Errorf("got %d power data points, want one per sample and domain", len(points))
+			}
+			if exported, dropped := exporter.Stats(); exported != 2 || dropped != 0 {
+				t.Errorf("got %d exported and %d dropped, want 2 exported", exported, dropped)
+			}
+		})
+	}
+}
+
+func TestExporterRetriesWithRetryAfter(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			collector := otlptest.NewCollector()
+			defer collector.Close()
+			collector.Statuses[0] = status
+			collector.RetryAfter = "1"
+
+			exporter := newExporter(t, otlp.Config{Endpoint: collector.URL()})
+			exporter.Add(sample(1))
+
+			began := time.Now()
+			if err := exporter.Flush(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if elapsed := time.Since(began); elapsed < time.Second {
+				t.Errorf("retried after %s, want the Retry-After of 1s", elapsed)
+			}
+			if requests := collector.Requests(); len(requests) != 2 || requests[1].Status != http.StatusOK {
+				t.Errorf("got requests %+v, want a retry", requests)
+			}
+			assertTotals(t, packageTotals(collector), 1)
+		})
+	}
+}
+
+func TestExporterKeepsBatchPastMaxElapsed(t *testing.T) {
+	collector := otlptest.NewCollector()
+	defer collector.Close()
+	collector.Statuses[0] = http.StatusServiceUnavailable
+	collector.RetryAfter = "60"
+
+	exporter := newExporter(t, otlp.Config{Endpoint: collector.URL(), MaxElapsed: time.Second})
+	exporter.Add(sample(1))
+
+	if err := exporter.Flush(context.Background()); err == nil {
+		t.Fatal("the flush succeeded, want the retry to give up")
+	}
+
+	// the batch is kept for the next export
+	if err := exporter.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	assertTotals(t, packageTotals(collector), 1)
+}
+
+func TestExporterDropsRejectedBatch(t *testing.T) {
+	collector := otlptest.NewCollector()
+	defer collector.Close()
+	collector.Statuses[0] = http.StatusBadRequest
+
+	exporter := newExporter(t, otlp.Config{Endpoint: collector.URL(), BatchSize: 2})
+	for n := 1; n <= 3; n++ {
+		exporter.Add(sample(n))
+	}
+
+	if err := exporter.Flush(context.Background()); err == nil {
+		t.Fatal("the rejected batch did not fail the flush")
+	}
+	if err := exporter.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if requests := collector.Requests(); len(requests) != 2 {
+		t.Errorf("got %d requests, want the rejected batch not to be retried", len(requests))
+	}
+	assertTotals(t, packageTotals(collector), 3)
+	if exported, dropped := exporter.Stats(); exported != 1 || dropped != 2 {
+		t.Errorf("got %d exported and %d dropped, want 1 exported and 2 dropped", exported, dropped)
+	}
+}
+
+func TestExporterQueueOverflow(t *testing.T) {
+	collector := otlptest.NewCollector()
+	defer collector.Close()
+
+	exporter := newExporter(t, otlp.Config{Endpoint: collector.URL(), BatchSize: 5, MaxQueue: 5})
+	for n := 1; n <= 8; n++ {
+		exporter.Add(sample(n))
+	}
+
+	if err := exporter.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the oldest samples are dropped first
+	assertTotals(t, packageTotals(collector), 4, 5, 6, 7, 8)
+	if exported, dropped := exporter.Stats(); exported != 5 || dropped != 3 {
+		t.Errorf("got %d exported and %d dropped, want 5 exported and 3 dropped", exported, dropped)
+	}
+}
+
+// addingTransport adds samples to the exporter while the first request is in flight
+type addingTransport struct {
+	once     sync.Once
+	exporter *otlp.Exporter
+	samples  []readers.Sample
+}
+
+func (a *addingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	a.once.Do(func() {
+		for _, s := range a.samples {
+			a.exporter.Add(s)
+		}
+	})
+
+	return http.DefaultTransport.RoundTrip(request)
+}
+
+func TestExporterTrimsBatchPushedOutMeanwhile(t *testing.T) {
+	collector := otlptest.NewCollector()
+	defer collector.Close()
+
+	transport := &addingTransport{samples: []readers.Sample{sample(5), sample(6), sample(7)}}
+	exporter := newExporter(t, otlp.Config{
+		Endpoint:  collector.URL(),
+		BatchSize: 2,
+		MaxQueue:  4,
+		Client:    &http.Client{Transport: transport},
+	})
+	transport.exporter = exporter
+
+	for n := 1; n <= 4; n++ {
+		exporter.Add(sample(n))
+	}
+
+	// while 1 and 2 are sent, 5 to 7 push 1 to 3 out of the queue, only what is left of the batch is removed after it
+	if err := exporter.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	assertTotals(t, packageTotals(collector), 1, 2, 4, 5, 6, 7)
+	if exported, dropped := exporter.Stats(); exported != 4 || dropped != 3 {
+		t.Errorf("got %d exported and %d dropped, want 4 exported and 3 dropped", exported, dropped)
+	}
+}
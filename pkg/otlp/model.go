@@ -0,0 +1,116 @@
+// Package otlp exports the rapl energy and power as OpenTelemetry metrics, pushed over OTLP/HTTP with the protobuf or
+// the json encoding, without depending on the OpenTelemetry sdk
+package otlp
+
+import (
+	"strconv"
+)
+
+// AggregationTemporality of a Sum, only the cumulative one is exported
+const (
+	TemporalityDelta      = 1
+	TemporalityCumulative = 2
+)
+
+// The types below mirror the messages of opentelemetry/proto/collector/metrics/v1 and opentelemetry/proto/metrics/v1
+// the exporter needs. The json tags follow the OTLP/JSON mapping: lower camel case names, 64 bit integers as strings
+// and enums as numbers
+
+// MetricsRequest is an ExportMetricsServiceRequest
+type MetricsRequest struct {
+	ResourceMetrics []ResourceMetrics `json:"resourceMetrics"`
+}
+
+// MetricsResponse is an ExportMetricsServiceResponse
+type MetricsResponse struct {
+	PartialSuccess *PartialSuccess `json:"partialSuccess,omitempty"`
+}
+
+// PartialSuccess reports the data points a collector rejected from an otherwise accepted request
+type PartialSuccess struct {
+	RejectedDataPoints string `json:"rejectedDataPoints,omitempty"`
+	ErrorMessage       string `json:"errorMessage,omitempty"`
+}
+
+type ResourceMetrics struct {
+	Resource     Resource       `json:"resource"`
+	ScopeMetrics []ScopeMetrics `json:"scopeMetrics"`
+}
+
+type Resource struct {
+	Attributes []KeyValue `json:"attributes"`
+}
+
+type ScopeMetrics struct {
+	Scope   Scope    `json:"scope"`
+	Metrics []Metric `json:"metrics"`
+}
+
+type Scope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// Metric holds either a Gauge or a Sum
+type Metric struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Unit        string `json:"unit,omitempty"`
+	Gauge       *Gauge `json:"gauge,omitempty"`
+	Sum         *Sum   `json:"sum,omitempty"`
+}
+
+type Gauge struct {
+	DataPoints []DataPoint `json:"dataPoints"`
+}
+
+type Sum struct {
+	DataPoints             []DataPoint `json:"dataPoints"`
+	AggregationTemporality int         `json:"aggregationTemporality"`
+	IsMonotonic            bool        `json:"isMonotonic"`
+}
+
+// DataPoint is a NumberDataPoint with a double value
+type DataPoint struct {
+	Attributes        []KeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string     `json:"timeUnixNano"`
+	AsDouble          float64    `json:"asDouble"`
+}
+
+type KeyValue struct {
+	Key   string   `json:"key"`
+	Value AnyValue `json:"value"`
+}
+
+// AnyValue holds one of a string, a bool or an int value
+type AnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+// String creates a string attribute
+func String(key string, value string) KeyValue {
+	return KeyValue{Key: key, Value: AnyValue{StringValue: &value}}
+}
+
+// Bool creates a bool attribute
+func Bool(key string, value bool) KeyValue {
+	return KeyValue{Key: key, Value: AnyValue{BoolValue: &value}}
+}
+
+// Int creates an int attribute
+func Int(key string, value int64) KeyValue {
+	s := strconv.FormatInt(value, 10)
+	return KeyValue{Key: key, Value: AnyValue{IntValue: &s}}
+}
+
+// unixNano formats nanoseconds since the epoch as the json mapping does, zero is left out
+func unixNano(nanos int64) string {
+	if nanos == 0 {
+		return ""
+	}
+
+	return strconv.FormatInt(nanos, 10)
+}
@@ -0,0 +1,161 @@
+// Package otlptest provides a stub OTLP/HTTP collector, for testing the otlp.Exporter, or code exporting through it,
+// without a real collector
+package otlptest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/rekuberate-io/power/pkg/otlp"
+)
+
+// Request is an export request the collector received
+type Request struct {
+	ContentType string
+	Header      http.Header
+	Body        []byte
+	// Metrics is the decoded request, nil if it could not be decoded
+	Metrics *otlp.MetricsRequest
+	// Status is the status code the collector answered with
+	Status int
+}
+
+// Collector is a stub OTLP/HTTP collector accepting metrics in the protobuf and the json encoding on otlp.MetricsPath.
+// It answers the n-th (counting from 0) request with the status of Statuses, and 200 for every other one
+type Collector struct {
+	// Statuses holds the status code to answer the n-th request with
+	Statuses map[int]int
+	// RetryAfter is sent as the Retry-After header of the failed responses, if set
+	RetryAfter string
+
+	server   *httptest.Server
+	mu       sync.Mutex
+	requests []Request
+}
+
+// NewCollector starts a collector on a local port, stop it with Close
+func NewCollector() *Collector {
+	collector := &Collector{Statuses: make(map[int]int)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(otlp.MetricsPath, collector.export)
+	collector.server = httptest.NewServer(mux)
+
+	return collector
+}
+
+// URL returns the endpoint to configure the exporter with
+func (c *Collector) URL() string {
+	return c.server.URL
+}
+
+// Close stops the collector
+func (c *Collector) Close() {
+	c.server.Close()
+}
+
+// Requests returns every request received so far
+func (c *Collector) Requests() []Request {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	requests := make([]Request, len(c.requests))
+	copy(requests, c.requests)
+
+	return requests
+}
+
+// DataPoints returns the data points of the metric name across every accepted request, in the order received
+func (c *Collector) DataPoints(name string) []otlp.DataPoint {
+	var points []otlp.DataPoint
+	for _, request := range c.Requests() {
+		if request.Status != http.StatusOK || request.Metrics == nil {
+			continue
+		}
+
+		for _, resourceMetrics := range request.Metrics.ResourceMetrics {
+			for _, scopeMetrics := range resourceMetrics.ScopeMetrics {
+				for _, metric := range scopeMetrics.Metrics {
+					if metric.Name != name {
+						continue
+					}
+
+					switch {
+					case metric.Sum != nil:
+						points = append(points, metric.Sum.DataPoints...)
+					case metric.Gauge != nil:
+						points = append(points, metric.Gauge.DataPoints...)
+					}
+				}
+			}
+		}
+	}
+
+	return points
+}
+
+func (c *Collector) export(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	request := Request{ContentType: r.Header.Get("Content-Type"), Header: r.Header.Clone(), Body: body}
+
+	var decodeErr error
+	metrics := &otlp.MetricsRequest{}
+	switch {
+	case strings.HasPrefix(request.ContentType, "application/json"):
+		decodeErr = json.Unmarshal(body, metrics)
+	case strings.HasPrefix(request.ContentType, "application/x-protobuf"):
+		decodeErr = unmarshalRequest(body, metrics)
+	default:
+		decodeErr = fmt.Errorf("unsupported content type %q", request.ContentType)
+	}
+	if decodeErr == nil {
+		request.Metrics = metrics
+	}
+
+	c.mu.Lock()
+	status, scripted := c.Statuses[len(c.requests)]
+	switch {
+	case scripted:
+	case decodeErr != nil:
+		status = http.StatusBadRequest
+	default:
+		status = http.StatusOK
+	}
+	request.Status = status
+	c.requests = append(c.requests, request)
+	c.mu.Unlock()
+
+	if status != http.StatusOK {
+		if c.RetryAfter != "" {
+			w.Header().Set("Retry-After", c.RetryAfter)
+		}
+
+		message := http.StatusText(status)
+		if decodeErr != nil {
+			message = decodeErr.Error()
+		}
+		http.Error(w, message, status)
+		return
+	}
+
+	// an empty ExportMetricsServiceResponse is the full success in both encodings
+	w.Header().Set("Content-Type", request.ContentType)
+	if strings.HasPrefix(request.ContentType, "application/json") {
+		_, _ = w.Write([]byte("{}"))
+	}
+}
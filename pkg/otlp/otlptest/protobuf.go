@@ -0,0 +1,238 @@
+package otlptest
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strconv"
+
+	"github.com/rekuberate-io/power/pkg/otlp"
+)
+
+var errTruncated = errors.New("truncated protobuf message")
+
+// field is a field of a protobuf message, decoded by its wire type
+type field struct {
+	number int
+	varint uint64
+	fixed  uint64
+	bytes  []byte
+}
+
+// fields splits a protobuf message into its fields, the fields of the wire types OTLP metrics do not use are rejected
+func fields(b []byte) ([]field, error) {
+	var decoded []field
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errTruncated
+		}
+		b = b[n:]
+
+		f := field{number: int(key >> 3)}
+		switch key & 7 {
+		case 0:
+			f.varint, n = binary.Uvarint(b)
+			if n <= 0 {
+				return nil, errTruncated
+			}
+			b = b[n:]
+		case 1:
+			if len(b) < 8 {
+				return nil, errTruncated
+			}
+			f.fixed = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case 2:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < length {
+				return nil, errTruncated
+			}
+			f.bytes = b[n : n+int(length)]
+			b = b[n+int(length):]
+		case 5:
+			if len(b) < 4 {
+				return nil, errTruncated
+			}
+			b = b[4:]
+		default:
+			return nil, errors.New("unsupported protobuf wire type")
+		}
+
+		decoded = append(decoded, f)
+	}
+
+	return decoded, nil
+}
+
+// unmarshalRequest decodes the parts of an ExportMetricsServiceRequest the exporter writes, gauges and sums of double
+// data points, other fields are skipped
+func unmarshalRequest(b []byte, request *otlp.MetricsRequest) error {
+	return each(b, func(f field) error {
+		if f.number != 1 {
+			return nil
+		}
+
+		var resourceMetrics otlp.ResourceMetrics
+		err := each(f.bytes, func(f field) error {
+			switch f.number {
+			case 1:
+				return each(f.bytes, func(f field) error {
+					if f.number != 1 {
+						return nil
+					}
+
+					kv, err := unmarshalKeyValue(f.bytes)
+					resourceMetrics.Resource.Attributes = append(resourceMetrics.Resource.Attributes, kv)
+					return err
+				})
+			case 2:
+				scopeMetrics, err := unmarshalScopeMetrics(f.bytes)
+				resourceMetrics.ScopeMetrics = append(resourceMetrics.ScopeMetrics, scopeMetrics)
+				return err
+			}
+
+			return nil
+		})
+		request.ResourceMetrics = append(request.ResourceMetrics, resourceMetrics)
+
+		return err
+	})
+}
+
+func unmarshalScopeMetrics(b []byte) (otlp.ScopeMetrics, error) {
+	var scopeMetrics otlp.ScopeMetrics
+	err := each(b, func(f field) error {
+		switch f.number {
+		case 1:
+			return each(f.bytes, func(f field) error {
+				switch f.number {
+				case 1:
+					scopeMetrics.Scope.Name = string(f.bytes)
+				case 2:
+					scopeMetrics.Scope.Version = string(f.bytes)
+				}
+				return nil
+			})
+		case 2:
+			metric, err := unmarshalMetric(f.bytes)
+			scopeMetrics.Metrics = append(scopeMetrics.Metrics, metric)
+			return err
+		}
+
+		return nil
+	})
+
+	return scopeMetrics, err
+}
+
+func unmarshalMetric(b []byte) (otlp.Metric, error) {
+	var metric otlp.Metric
+	err := each(b, func(f field) error {
+		switch f.number {
+		case 1:
+			metric.Name = string(f.bytes)
+		case 2:
+			metric.Description = string(f.bytes)
+		case 3:
+			metric.Unit = string(f.bytes)
+		case 5:
+			metric.Gauge = &otlp.Gauge{}
+			return each(f.bytes, func(f field) error {
+				if f.number != 1 {
+					return nil
+				}
+
+				point, err := unmarshalDataPoint(f.bytes)
+				metric.Gauge.DataPoints = append(metric.Gauge.DataPoints, point)
+				return err
+			})
+		case 7:
+			metric.Sum = &otlp.Sum{}
+			return each(f.bytes, func(f field) error {
+				switch f.number {
+				case 1:
+					point, err := unmarshalDataPoint(f.bytes)
+					metric.Sum.DataPoints = append(metric.Sum.DataPoints, point)
+					return err
+				case 2:
+					metric.Sum.AggregationTemporality = int(f.varint)
+				case 3:
+					metric.Sum.IsMonotonic = f.varint != 0
+				}
+				return nil
+			})
+		}
+
+		return nil
+	})
+
+	return metric, err
+}
+
+func unmarshalDataPoint(b []byte) (otlp.DataPoint, error) {
+	var point otlp.DataPoint
+	err := each(b, func(f field) error {
+		switch f.number {
+		case 2:
+			point.StartTimeUnixNano = strconv.FormatUint(f.fixed, 10)
+		case 3:
+			point.TimeUnixNano = strconv.FormatUint(f.fixed, 10)
+		case 4:
+			point.AsDouble = math.Float64frombits(f.fixed)
+		case 6:
+			point.AsDouble = float64(int64(f.fixed))
+		case 7:
+			kv, err := unmarshalKeyValue(f.bytes)
+			point.Attributes = append(point.Attributes, kv)
+			return err
+		}
+
+		return nil
+	})
+
+	return point, err
+}
+
+func unmarshalKeyValue(b []byte) (otlp.KeyValue, error) {
+	var kv otlp.KeyValue
+	err := each(b, func(f field) error {
+		switch f.number {
+		case 1:
+			kv.Key = string(f.bytes)
+		case 2:
+			return each(f.bytes, func(f field) error {
+				switch f.number {
+				case 1:
+					kv.Value = otlp.String("", string(f.bytes)).Value
+				case 2:
+					kv.Value = otlp.Bool("", f.varint != 0).Value
+				case 3:
+					kv.Value = otlp.Int("", int64(f.varint)).Value
+				}
+				return nil
+			})
+		}
+
+		return nil
+	})
+
+	return kv, err
+}
+
+// each decodes a message and calls fn for every field
+func each(b []byte, fn func(field) error) error {
+	decoded, err := fields(b)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range decoded {
+		err = fn(f)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package otlp
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+)
+
+// protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+// protoBuffer encodes messages in the protobuf wire format, fields at their default value are left out like proto3 does
+type protoBuffer struct {
+	b []byte
+}
+
+func (p *protoBuffer) tag(field int, wireType int) {
+	p.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (p *protoBuffer) varint(v uint64) {
+	for v >= 0x80 {
+		p.b = append(p.b, byte(v)|0x80)
+		v >>= 7
+	}
+	p.b = append(p.b, byte(v))
+}
+
+func (p *protoBuffer) fixed64(v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	p.b = append(p.b, b[:]...)
+}
+
+func (p *protoBuffer) uint64Field(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+
+	p.tag(field, wireVarint)
+	p.varint(v)
+}
+
+func (p *protoBuffer) boolField(field int, v bool) {
+	if v {
+		p.uint64Field(field, 1)
+	}
+}
+
+func (p *protoBuffer) fixed64Field(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+
+	p.tag(field, wireFixed64)
+	p.fixed64(v)
+}
+
+func (p *protoBuffer) stringField(field int, s string) {
+	if s == "" {
+		return
+	}
+
+	p.tag(field, wireBytes)
+	p.varint(uint64(len(s)))
+	p.b = append(p.b, s...)
+}
+
+// message encodes a nested message, which is written even when empty
+func (p *protoBuffer) message(field int, encode func(*protoBuffer)) {
+	nested := &protoBuffer{}
+	encode(nested)
+
+	p.tag(field, wireBytes)
+	p.varint(uint64(len(nested.b)))
+	p.b = append(p.b, nested.b...)
+}
+
+// MarshalProto encodes the request as an opentelemetry.proto.collector.metrics.v1.ExportMetricsServiceRequest
+func (r MetricsRequest) MarshalProto() []byte {
+	p := &protoBuffer{}
+	for _, resourceMetrics := range r.ResourceMetrics {
+		p.message(1, resourceMetrics.encode)
+	}
+
+	return p.b
+}
+
+func (r ResourceMetrics) encode(p *protoBuffer) {
+	p.message(1, r.Resource.encode)
+	for _, scopeMetrics := range r.ScopeMetrics {
+		p.message(2, scopeMetrics.encode)
+	}
+}
+
+func (r Resource) encode(p *protoBuffer) {
+	for _, attribute := range r.Attributes {
+		p.message(1, attribute.encode)
+	}
+}
+
+func (s ScopeMetrics) encode(p *protoBuffer) {
+	p.message(1, s.Scope.encode)
+	for _, metric := range s.Metrics {
+		p.message(2, metric.encode)
+	}
+}
+
+func (s Scope) encode(p *protoBuffer) {
+	p.stringField(1, s.Name)
+	p.stringField(2, s.Version)
+}
+
+func (m Metric) encode(p *protoBuffer) {
+	p.stringField(1, m.Name)
+	p.stringField(2, m.Description)
+	p.stringField(3, m.Unit)
+
+	if m.Gauge != nil {
+		p.message(5, func(p *protoBuffer) {
+			for _, point := range m.Gauge.DataPoints {
+				p.message(1, point.encode)
+			}
+		})
+	}
+
+	if m.Sum != nil {
+		p.message(7, func(p *protoBuffer) {
+			for _, point := range m.Sum.DataPoints {
+				p.message(1, point.encode)
+			}
+			p.uint64Field(2, uint64(m.Sum.AggregationTemporality))
+			p.boolField(3, m.Sum.IsMonotonic)
+		})
+	}
+}
+
+func (d DataPoint) encode(p *protoBuffer) {
+	p.fixed64Field(2, parseUint(d.StartTimeUnixNano))
+	p.fixed64Field(3, parseUint(d.TimeUnixNano))
+
+	// as_double is part of a oneof, so it is written even when zero
+	p.tag(4, wireFixed64)
+	p.fixed64(math.Float64bits(d.AsDouble))
+
+	for _, attribute := range d.Attributes {
+		p.message(7, attribute.encode)
+	}
+}
+
+func (kv KeyValue) encode(p *protoBuffer) {
+	p.stringField(1, kv.Key)
+	p.message(2, kv.Value.encode)
+}
+
+func (v AnyValue) encode(p *protoBuffer) {
+	// the members of the value oneof are written even at their default value
+	switch {
+	case v.StringValue != nil:
+		p.tag(1, wireBytes)
+		p.varint(uint64(len(*v.StringValue)))
+		p.b = append(p.b, *v.StringValue...)
+	case v.BoolValue != nil:
+		p.tag(2, wireVarint)
+		if *v.BoolValue {
+			p.varint(1)
+		} else {
+			p.varint(0)
+		}
+	case v.IntValue != nil:
+		i, _ := strconv.ParseInt(*v.IntValue, 10, 64)
+		p.tag(3, wireVarint)
+		p.varint(uint64(i))
+	}
+}
+
+func parseUint(s string) uint64 {
+	v, _ := strconv.ParseUint(s, 10, 64)
+	return v
+}
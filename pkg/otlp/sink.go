@@ -0,0 +1,46 @@
+package otlp
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rekuberate-io/power/pkg/sink"
+)
+
+func init() {
+	sink.Register("otlp", newSink)
+}
+
+// newSink creates an exporter to the collector of the target. The encoding param is protobuf or json, the params
+// prefixed with "header." are sent as headers, e.g. header.Authorization=Bearer ...
+func newSink(config sink.Config) (sink.Sink, error) {
+	encoding, err := ParseEncoding(config.Param("encoding", Protobuf.String()))
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make(map[string]string)
+	for key, value := range config.Params {
+		if strings.HasPrefix(key, "header.") {
+			headers[strings.TrimPrefix(key, "header.")] = value
+		}
+	}
+
+	return New(Config{
+		Endpoint:   config.Target,
+		Encoding:   encoding,
+		Headers:    headers,
+		Attributes: []KeyValue{Bool("rapl.estimated", config.Topology.Estimated)},
+	}, config.Topology.Node, config.Topology.Cpus)
+}
+
+// Write queues the sample of a measurement, it is exported on the next Flush
+func (e *Exporter) Write(_ context.Context, measurement sink.Measurement) error {
+	e.Add(measurement.Sample)
+	return nil
+}
+
+// Close does nothing, Flush exports what is queued
+func (e *Exporter) Close() error {
+	return nil
+}
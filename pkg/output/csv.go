@@ -0,0 +1,98 @@
+package output
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// csvColumns are the columns of the csv format, one row per domain of every package of every sample. The topology is
+// flattened into the vendor and model columns of the package's socket
+var csvColumns = []string{
+	"schema_version", "hostname", "reader", "estimated", "start", "end", "interval_seconds", "socket", "vendor", "model",
+	"package", "die", "domain", "supported", "joules", "kwh", "watts", "total_joules", "emissions_grams",
+}
+
+type csvWriter struct {
+	w       *csv.Writer
+	header  Header
+	sockets map[int64]Cpu
+}
+
+func newCsvWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w), sockets: make(map[int64]Cpu)}
+}
+
+func (c *csvWriter) WriteHeader(header Header) error {
+	c.header = header
+	for _, cpu := range header.Topology {
+		for _, pkgId := range cpu.Packages {
+			c.sockets[pkgId] = cpu
+		}
+	}
+
+	err := c.w.Write(csvColumns)
+	c.w.Flush()
+	if err != nil {
+		return err
+	}
+
+	return c.w.Error()
+}
+
+func (c *csvWriter) WriteSample(sample Sample) error {
+	for _, pkg := range sample.Packages {
+		cpu, exists := c.sockets[pkg.Package]
+		socket := ""
+		if exists {
+			socket = strconv.Itoa(cpu.Socket)
+		}
+
+		for _, domain := range pkg.Domains {
+			emissions := ""
+			if domain.Emissions != nil {
+				emissions = formatFloat(*domain.Emissions)
+			}
+
+			err := c.w.Write([]string{
+				strconv.Itoa(SchemaVersion),
+				c.header.Hostname,
+				c.header.Reader,
+				strconv.FormatBool(c.header.Estimated),
+				sample.Start.Format(time.RFC3339Nano),
+				sample.End.Format(time.RFC3339Nano),
+				formatFloat(sample.Interval),
+				socket,
+				cpu.Vendor,
+				cpu.ModelName,
+				strconv.FormatInt(pkg.Package, 10),
+				strconv.FormatInt(pkg.Die, 10),
+				domain.Domain,
+				strconv.FormatBool(domain.Supported),
+				formatFloat(domain.Joules),
+				formatFloat(domain.KiloWattHours),
+				formatFloat(domain.Watts),
+				formatFloat(domain.TotalJoules),
+				emissions,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// flush every sample, so that a watch piped to another process is not held back by the buffer
+	c.w.Flush()
+
+	return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,198 @@
+package output
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+// SchemaVersion is the version of the machine readable output. Fields are only ever added within a version, a field
+// that is renamed, removed or changes its meaning bumps it
+const SchemaVersion = 1
+
+// Unit is a unit the energy is printed in by the table format, the machine readable formats always carry joules and
+// kilowatt-hours
+type Unit struct {
+	Name   string
+	Joules float64
+}
+
+var Units = []Unit{
+	{Name: "J", Joules: 1},
+	{Name: "Wh", Joules: 3600},
+	{Name: "kWh", Joules: 3600000},
+}
+
+// Convert converts joules to the unit
+func (u Unit) Convert(joules float64) float64 {
+	return joules / u.Joules
+}
+
+// ParseUnit returns the unit with the given name, case-insensitively
+func ParseUnit(s string) (Unit, error) {
+	var names []string
+	for _, unit := range Units {
+		if strings.EqualFold(unit.Name, s) {
+			return unit, nil
+		}
+
+		names = append(names, unit.Name)
+	}
+
+	return Unit{}, fmt.Errorf("unknown energy unit %q, expected one of: %s", s, strings.Join(names, ", "))
+}
+
+// Header describes the host and the reader the samples are taken with, it is written once before the samples
+type Header struct {
+	Schema    int    `json:"schema_version"`
+	Hostname  string `json:"hostname"`
+	Reader    string `json:"reader"`
+	Estimated bool   `json:"estimated"`
+	Topology  []Cpu  `json:"topology"`
+}
+
+// Cpu is a socket of the detected topology, see readers.Cpu
+type Cpu struct {
+	Socket       int     `json:"socket"`
+	Vendor       string  `json:"vendor"`
+	ModelId      int     `json:"model_id"`
+	ModelName    string  `json:"model_name"`
+	InternalName string  `json:"internal_model_name"`
+	Family       int     `json:"family"`
+	Packages     []int64 `json:"packages"`
+	Cores        []Core  `json:"cores"`
+}
+
+// Core is a logical cpu of a socket
+type Core struct {
+	Id      int   `json:"id"`
+	Package int64 `json:"package"`
+	Die     int64 `json:"die"`
+}
+
+// Sample is the energy consumed during one sampling interval
+type Sample struct {
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Interval  float64   `json:"interval_seconds"`
+	Intensity *float64  `json:"carbon_intensity_grams_per_kwh,omitempty"`
+	Packages  []Package `json:"packages"`
+}
+
+// Package is the energy of the domains of a package during a sample
+type Package struct {
+	Package int64    `json:"package"`
+	Die     int64    `json:"die"`
+	Domains []Domain `json:"domains"`
+}
+
+// Domain is the energy of a rapl domain during a sample. Supported is false when the hardware, or the reader, does
+// not implement the domain, its values are zero then
+type Domain struct {
+	Domain        string   `json:"domain"`
+	Supported     bool     `json:"supported"`
+	Joules        float64  `json:"joules"`
+	KiloWattHours float64  `json:"kwh"`
+	Watts         float64  `json:"watts"`
+	TotalJoules   float64  `json:"total_joules"`
+	Emissions     *float64 `json:"emissions_grams,omitempty"`
+}
+
+// NewHeader creates the header of the current host for reader
+func NewHeader(hostname string, reader readers.RaplReader, cpus map[int]*readers.Cpu) Header {
+	return Header{
+		Schema:    SchemaVersion,
+		Hostname:  hostname,
+		Reader:    readers.StrategyName(reader),
+		Estimated: readers.IsEstimated(reader),
+		Topology:  Topology(cpus),
+	}
+}
+
+// Topology converts the detected cpus, sorted by socket
+func Topology(cpus map[int]*readers.Cpu) []Cpu {
+	topology := []Cpu{}
+	for _, cpu := range cpus {
+		c := Cpu{
+			Socket:       cpu.PhysicalId,
+			Vendor:       cpu.Vendor.String(),
+			ModelId:      cpu.Model.Id,
+			ModelName:    strings.TrimSpace(cpu.Model.Name),
+			InternalName: cpu.Model.InternalName,
+			Family:       cpu.Family,
+			Packages:     []int64{},
+			Cores:        []Core{},
+		}
+
+		for pkgId := range cpu.Packages {
+			c.Packages = append(c.Packages, pkgId)
+		}
+		sort.Slice(c.Packages, func(i, j int) bool { return c.Packages[i] < c.Packages[j] })
+
+		for _, core := range cpu.Cores {
+			c.Cores = append(c.Cores, Core{Id: core.Id, Package: core.Package, Die: core.Die})
+		}
+		sort.Slice(c.Cores, func(i, j int) bool { return c.Cores[i].Id < c.Cores[j].Id })
+
+		topology = append(topology, c)
+	}
+	sort.Slice(topology, func(i, j int) bool { return topology[i].Socket < topology[j].Socket })
+
+	return topology
+}
+
+// FromSample converts a sample of a readers.Sampler, supported are the domains of every package reported by
+// readers.Sampler.Supported
+func FromSample(sample readers.Sample, supported map[int64][]readers.Domain, cpus map[int]*readers.Cpu) Sample {
+	s := Sample{
+		Start:    sample.Time.Add(-sample.Interval),
+		End:      sample.Time,
+		Interval: sample.Interval.Seconds(),
+		Packages: []Package{},
+	}
+
+	dies := make(map[int64]int64)
+	for _, cpu := range cpus {
+		for pkgId, die := range cpu.Dies() {
+			dies[pkgId] = die
+		}
+	}
+
+	power := sample.Power()
+	for _, pkgId := range sample.PackageIds() {
+		energy, exists := sample.Energy[pkgId]
+		if !exists {
+			continue
+		}
+
+		pkg := Package{Package: pkgId, Die: dies[pkgId]}
+		for _, domain := range readers.Domains {
+			pkg.Domains = append(pkg.Domains, Domain{
+				Domain:        domain.String(),
+				Supported:     HasDomain(supported[pkgId], domain),
+				Joules:        energy.Get(domain),
+				KiloWattHours: readers.Energy(energy.ToKiloWattHour()).Get(domain),
+				Watts:         readers.Energy(power[pkgId]).Get(domain),
+				TotalJoules:   sample.Totals[pkgId].Get(domain),
+			})
+		}
+
+		s.Packages = append(s.Packages, pkg)
+	}
+
+	return s
+}
+
+// HasDomain reports whether domain is one of domains, e.g. of the supported ones of a package
+func HasDomain(domains []readers.Domain, domain readers.Domain) bool {
+	for _, d := range domains {
+		if d == domain {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,94 @@
+package output
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/rekuberate-io/power/pkg/sink"
+)
+
+func init() {
+	sink.Register("stdout", newStdoutSink)
+	sink.Register("file", newFileSink)
+}
+
+// writerSink writes the measurements in one of the Formats, the header before the first one
+type writerSink struct {
+	writer Writer
+	file   *os.File
+	header bool
+}
+
+// newStdoutSink creates a sink writing to stdout, in the format param, ndjson by default
+func newStdoutSink(config sink.Config) (sink.Sink, error) {
+	return newWriterSink(config, os.Stdout, nil)
+}
+
+// newFileSink creates a sink appending to the file of the target, in the format param, ndjson by default
+func newFileSink(config sink.Config) (sink.Sink, error) {
+	file, err := os.OpenFile(config.Target, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := newWriterSink(config, file, file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func newWriterSink(config sink.Config, w io.Writer, file *os.File) (sink.Sink, error) {
+	unit, err := ParseUnit(config.Param("units", "J"))
+	if err != nil {
+		return nil, err
+	}
+
+	writer, err := NewWriter(config.Param("format", "ndjson"), w, unit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &writerSink{writer: writer, file: file}, nil
+}
+
+func (s *writerSink) Write(_ context.Context, measurement sink.Measurement) error {
+	if measurement.Err != nil {
+		return nil
+	}
+
+	topology := measurement.Topology
+	if !s.header {
+		err := s.writer.WriteHeader(Header{
+			Schema:    SchemaVersion,
+			Hostname:  topology.Node,
+			Reader:    topology.Reader,
+			Estimated: topology.Estimated,
+			Topology:  Topology(topology.Cpus),
+		})
+		if err != nil {
+			return err
+		}
+
+		s.header = true
+	}
+
+	return s.writer.WriteSample(FromSample(measurement.Sample, measurement.Supported(), topology.Cpus))
+}
+
+// Close closes the writer, the json format writes its document then, and the file
+func (s *writerSink) Close() error {
+	err := s.writer.Close()
+
+	if s.file != nil {
+		closeErr := s.file.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
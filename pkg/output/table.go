@@ -0,0 +1,66 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// tableWriter writes the samples for humans, it is not covered by the schema version
+type tableWriter struct {
+	w    io.Writer
+	unit Unit
+}
+
+func (t *tableWriter) WriteHeader(header Header) error {
+	_, err := fmt.Fprintf(t.w, "Host: %s, reader: %s", header.Hostname, header.Reader)
+	if err != nil {
+		return err
+	}
+
+	if header.Estimated {
+		fmt.Fprintf(t.w, " ESTIMATED")
+	}
+	fmt.Fprintln(t.w)
+
+	for _, cpu := range header.Topology {
+		fmt.Fprintf(t.w, "Socket %d: %s '%s/%s/Fam:%d' (packages: %v, cores: %d)\n", cpu.Socket, cpu.Vendor, cpu.ModelName, cpu.InternalName, cpu.Family, cpu.Packages, len(cpu.Cores))
+	}
+	_, err = fmt.Fprintln(t.w)
+
+	return err
+}
+
+func (t *tableWriter) WriteSample(sample Sample) error {
+	_, err := fmt.Fprintf(t.w, "%s (%.3fs)", sample.End.Format(time.RFC3339), sample.Interval)
+	if err != nil {
+		return err
+	}
+
+	if sample.Intensity != nil {
+		fmt.Fprintf(t.w, " carbon intensity: %.3f gCO2e/kWh", *sample.Intensity)
+	}
+	fmt.Fprintln(t.w)
+
+	for _, pkg := range sample.Packages {
+		fmt.Fprintf(t.w, "Package: %d\n", pkg.Package)
+		for _, domain := range pkg.Domains {
+			if !domain.Supported {
+				fmt.Fprintf(t.w, "\t%-8s: %18s\n", domain.Domain, "n/a")
+				continue
+			}
+
+			fmt.Fprintf(t.w, "\t%-8s: %18.6f %-3s %12.3f W", domain.Domain, t.unit.Convert(domain.Joules), t.unit.Name, domain.Watts)
+			if domain.Emissions != nil {
+				fmt.Fprintf(t.w, " %18.9f gCO2e", *domain.Emissions)
+			}
+			fmt.Fprintln(t.w)
+		}
+	}
+
+	return nil
+}
+
+func (t *tableWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,92 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Formats lists the output formats NewWriter supports
+var Formats = []string{"table", "json", "ndjson", "csv"}
+
+// Writer writes a header followed by any number of samples in one of the Formats. Close has to be called after the
+// last sample, the json format only writes its document then
+type Writer interface {
+	WriteHeader(header Header) error
+	WriteSample(sample Sample) error
+	Close() error
+}
+
+// NewWriter creates a writer of format to w, unit is the unit of the energy of the table format
+func NewWriter(format string, w io.Writer, unit Unit) (Writer, error) {
+	switch format {
+	case "table":
+		return &tableWriter{w: w, unit: unit}, nil
+	case "json":
+		return &jsonWriter{w: w}, nil
+	case "ndjson":
+		return &ndjsonWriter{encoder: json.NewEncoder(w)}, nil
+	case "csv":
+		return newCsvWriter(w), nil
+	}
+
+	return nil, fmt.Errorf("unknown output format %q, expected one of: %s", format, strings.Join(Formats, ", "))
+}
+
+// Document is the json format: the header and every sample in one object
+type Document struct {
+	Header
+	Samples []Sample `json:"samples"`
+}
+
+type jsonWriter struct {
+	w        io.Writer
+	document Document
+}
+
+func (j *jsonWriter) WriteHeader(header Header) error {
+	j.document.Header = header
+	return nil
+}
+
+func (j *jsonWriter) WriteSample(sample Sample) error {
+	j.document.Samples = append(j.document.Samples, sample)
+	return nil
+}
+
+func (j *jsonWriter) Close() error {
+	if j.document.Samples == nil {
+		j.document.Samples = []Sample{}
+	}
+
+	encoder := json.NewEncoder(j.w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(j.document)
+}
+
+// Record is a line of the ndjson format, Type is "header" or "sample" and tells which of the two is set
+type Record struct {
+	Schema int     `json:"schema_version"`
+	Type   string  `json:"type"`
+	Header *Header `json:"header,omitempty"`
+	Sample *Sample `json:"sample,omitempty"`
+}
+
+// ndjsonWriter writes every record as soon as it is known, which suits streaming the samples to another process
+type ndjsonWriter struct {
+	encoder *json.Encoder
+}
+
+func (n *ndjsonWriter) WriteHeader(header Header) error {
+	return n.encoder.Encode(Record{Schema: SchemaVersion, Type: "header", Header: &header})
+}
+
+func (n *ndjsonWriter) WriteSample(sample Sample) error {
+	return n.encoder.Encode(Record{Schema: SchemaVersion, Type: "sample", Sample: &sample})
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
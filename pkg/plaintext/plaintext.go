@@ -0,0 +1,405 @@
+// Package plaintext writes the rapl power and energy in the StatsD and the Graphite plaintext protocols, over udp or
+// tcp, for monitoring stacks that predate OpenMetrics
+package plaintext
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+
+	"k8s.io/klog/v2"
+)
+
+// DefaultTemplate names the metrics, e.g. power.node1.pkg0.package.watts
+const DefaultTemplate = "power.<host>.pkg<package>.<domain>.<metric>"
+
+// maxDatagram keeps udp datagrams below the usual mtu of 1500 bytes, lines are never split across datagrams
+const maxDatagram = 1432
+
+type Protocol int
+
+const (
+	// StatsD writes the power as gauges ("|g") and the energy consumed since the previous write as counters ("|c"),
+	// which the statsd daemon sums up per flush
+	StatsD Protocol = iota
+	// Graphite writes the power and the energy since the sampler started, which only grows, with the unix time of the
+	// write
+	Graphite
+)
+
+func (p Protocol) String() string {
+	var values []string = []string{"statsd", "graphite"}
+	if int(p) < 0 || int(p) >= len(values) {
+		return "unknown"
+	}
+
+	return values[p]
+}
+
+// defaultNetwork is the transport a protocol is usually spoken over
+func (p Protocol) defaultNetwork() string {
+	if p == Graphite {
+		return "tcp"
+	}
+
+	return "udp"
+}
+
+// Config configures a Sink
+type Config struct {
+	Protocol Protocol
+	// Address is the host:port of the daemon, optionally prefixed with the network, e.g. udp://localhost:8125 or
+	// tcp://graphite:2003. StatsD defaults to udp, Graphite to tcp
+	Address string
+	// Template names the metrics, DefaultTemplate if empty. <host>, <package> (or <id>), <die>, <domain> and <metric>,
+	// which is watts or joules, are replaced
+	Template string
+	// Host replaces <host>, its dots are replaced by underscores to keep it a single path segment
+	Host string
+	// Interval is the time between two writes, 10s by default
+	Interval time.Duration
+	// Timeout limits connecting and every write, 5s by default
+	Timeout time.Duration
+}
+
+// Sink writes the power and energy of every package and domain of a readers.Sampler every interval. The power is the
+// average over the interval, not the one of the last sample
+type Sink struct {
+	config  Config
+	network string
+	address string
+	dies    map[int64]int64
+
+	conn net.Conn
+	// start is the start of the first interval of the sampler, its totals count from there
+	start time.Time
+	// last holds the totals and the time of the last sample written, per package
+	last   map[int64]written
+	latest readers.Sample
+	// unwritten holds the packages of the latest sample not written yet
+	unwritten map[int64]bool
+}
+
+// written is what was written of a package
+type written struct {
+	totals readers.Energy
+	time   time.Time
+}
+
+// packageLines are the lines of a package
+type packageLines struct {
+	pkgId int64
+	lines [][]byte
+}
+
+// New creates a sink for the node with the given topology, it connects on the first write
+func New(config Config, cpus map[int]*readers.Cpu) (*Sink, error) {
+	if config.Template == "" {
+		config.Template = DefaultTemplate
+	}
+	if config.Interval <= 0 {
+		config.Interval = 10 * time.Second
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 5 * time.Second
+	}
+
+	network, address, err := parseAddress(config.Address, config.Protocol.defaultNetwork())
+	if err != nil {
+		return nil, err
+	}
+
+	dies := make(map[int64]int64)
+	for _, cpu := range cpus {
+		for pkgId, die := range cpu.Dies() {
+			dies[pkgId] = die
+		}
+	}
+
+	return &Sink{config: config, network: network, address: address, dies: dies}, nil
+}
+
+func parseAddress(address string, network string) (string, string, error) {
+	if strings.Contains(address, "://") {
+		u, err := url.Parse(address)
+		if err != nil {
+			return "", "", err
+		}
+
+		network, address = u.Scheme, u.Host
+	}
+
+	switch network {
+	case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6":
+	default:
+		return "", "", fmt.Errorf("unsupported network %q, expected udp or tcp", network)
+	}
+
+	_, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid address %q: %w", address, err)
+	}
+
+	return network, address, nil
+}
+
+// Add keeps a sample for the next write, failed samples are skipped
+func (s *Sink) Add(sample readers.Sample) {
+	if sample.Err != nil || sample.Time.IsZero() {
+		return
+	}
+
+	// the totals of the sampler count from the start of its first interval
+	if s.start.IsZero() {
+		s.last = make(map[int64]written)
+		s.start = sample.Time.Add(-sample.Interval)
+	}
+
+	s.latest = sample
+	s.unwritten = make(map[int64]bool)
+	for pkgId := range sample.Totals {
+		s.unwritten[pkgId] = true
+	}
+}
+
+// Flush writes the lines of the samples added since the previous flush, nothing if there are none. The packages whose
+// lines were all written before a failure are not written again, so that their StatsD counters are not counted twice
+// and their gauges do not drop to 0 W
+func (s *Sink) Flush(ctx context.Context) error {
+	if len(s.unwritten) == 0 {
+		return nil
+	}
+
+	packages := s.lines(s.latest, s.unwritten)
+
+	n, err := s.send(ctx, packages)
+	for _, p := range packages[:n] {
+		s.last[p.pkgId] = written{totals: s.latest.Totals[p.pkgId], time: s.latest.Time}
+		delete(s.unwritten, p.pkgId)
+	}
+
+	return err
+}
+
+// Close closes the connection to the daemon
+func (s *Sink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+
+	err := s.conn.Close()
+	s.conn = nil
+
+	return err
+}
+
+// Run adds every sample and writes every interval, until samples is closed or ctx is done. A failed write is
+// logged, the next one reconnects
+func (s *Sink) Run(ctx context.Context, samples <-chan readers.Sample) error {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	defer func() {
+		err := s.Close()
+		if err != nil {
+			klog.Errorln(err)
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case sample, ok := <-samples:
+			if !ok {
+				return nil
+			}
+
+			s.Add(sample)
+		case <-ticker.C:
+			err := s.Flush(ctx)
+			if err != nil {
+				klog.Errorf("writing to %s %s failed: %s", s.config.Protocol, s.address, err)
+			}
+		}
+	}
+}
+
+// lines renders the power over the interval since the previous write of every one of the packages and the energy, as
+// deltas for StatsD and as totals of the sampler for Graphite
+func (s *Sink) lines(sample readers.Sample, packageIds map[int64]bool) []packageLines {
+	timestamp := strconv.FormatInt(sample.Time.Unix(), 10)
+
+	var pkgIds []int64
+	for pkgId := range packageIds {
+		pkgIds = append(pkgIds, pkgId)
+	}
+	sort.Slice(pkgIds, func(i, j int) bool { return pkgIds[i] < pkgIds[j] })
+
+	var packages []packageLines
+	for _, pkgId := range pkgIds {
+		last, exists := s.last[pkgId]
+		if !exists {
+			last.time = s.start
+		}
+
+		delta := sample.Totals[pkgId].Sub(last.totals)
+		total := sample.Totals[pkgId]
+		watts := readers.Energy(delta.ToWatts(sample.Time.Sub(last.time)))
+
+		p := packageLines{pkgId: pkgId}
+		for _, domain := range readers.Domains {
+			power := s.name(pkgId, domain, "watts")
+			energy := s.name(pkgId, domain, "joules")
+
+			switch s.config.Protocol {
+			case StatsD:
+				p.lines = append(p.lines,
+					[]byte(power+":"+formatValue(watts.Get(domain))+"|g\n"),
+					[]byte(energy+":"+formatValue(delta.Get(domain))+"|c\n"),
+				)
+			case Graphite:
+				p.lines = append(p.lines,
+					[]byte(power+" "+formatValue(watts.Get(domain))+" "+timestamp+"\n"),
+					[]byte(energy+" "+formatValue(total.Get(domain))+" "+timestamp+"\n"),
+				)
+			}
+		}
+
+		packages = append(packages, p)
+	}
+
+	return packages
+}
+
+func (s *Sink) name(pkgId int64, domain readers.Domain, metric string) string {
+	replacer := strings.NewReplacer(
+		"<host>", sanitize(s.config.Host),
+		"<package>", strconv.FormatInt(pkgId, 10),
+		"<id>", strconv.FormatInt(pkgId, 10),
+		"<die>", strconv.FormatInt(s.dies[pkgId], 10),
+		"<domain>", domain.String(),
+		"<metric>", metric,
+	)
+
+	return replacer.Replace(s.config.Template)
+}
+
+// sanitize keeps a value a single path segment that is valid in both protocols
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', ' ', ':', '|', '@', '/', '\n':
+			return '_'
+		}
+
+		return r
+	}, s)
+}
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// send writes the lines of the packages, packed into datagrams below maxDatagram over udp, and returns how many of the
+// packages were written completely. The connection is dropped on a failure, so that the next send reconnects
+func (s *Sink) send(ctx context.Context, packages []packageLines) (int, error) {
+	if s.conn == nil {
+		dialer := net.Dialer{Timeout: s.config.Timeout}
+		conn, err := dialer.DialContext(ctx, s.network, s.address)
+		if err != nil {
+			return 0, err
+		}
+
+		s.conn = conn
+	}
+
+	n := 0
+	err := s.conn.SetWriteDeadline(time.Now().Add(s.config.Timeout))
+	if err == nil {
+		n, err = s.write(packages)
+	}
+
+	if err != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+
+	return n, err
+}
+
+// write writes the lines of the packages and returns how many of the packages were written completely. Over udp the
+// lines of a package are kept in one datagram, unless they do not fit into one on their own
+func (s *Sink) write(packages []packageLines) (int, error) {
+	if !strings.HasPrefix(s.network, "udp") {
+		var data []byte
+		for _, p := range packages {
+			data = append(data, bytes.Join(p.lines, nil)...)
+		}
+
+		n, err := s.conn.Write(data)
+
+		// the packages up to the bytes written went out completely
+		complete := 0
+		for complete < len(packages) {
+			size := len(bytes.Join(packages[complete].lines, nil))
+			if n < size {
+				break
+			}
+
+			n -= size
+			complete++
+		}
+
+		return complete, err
+	}
+
+	written, pending := 0, 0
+	var datagram []byte
+	send := func() error {
+		_, err := s.conn.Write(datagram)
+		if err != nil {
+			return err
+		}
+
+		written += pending
+		datagram, pending = nil, 0
+
+		return nil
+	}
+
+	for _, p := range packages {
+		if len(datagram) > 0 && len(datagram)+len(bytes.Join(p.lines, nil)) > maxDatagram {
+			if err := send(); err != nil {
+				return written, err
+			}
+		}
+
+		for _, line := range p.lines {
+			if len(datagram) > 0 && len(datagram)+len(line) > maxDatagram {
+				if err := send(); err != nil {
+					return written, err
+				}
+			}
+
+			datagram = append(datagram, line...)
+		}
+		pending++
+	}
+
+	if len(datagram) > 0 {
+		if err := send(); err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
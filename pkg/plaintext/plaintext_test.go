@@ -0,0 +1,122 @@
+package plaintext
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+// failingConn keeps the datagrams written to it and fails the write with the index failAt, if not negative
+type failingConn struct {
+	net.Conn
+	failAt    int
+	writes    int
+	datagrams [][]byte
+}
+
+func (c *failingConn) Write(b []byte) (int, error) {
+	defer func() { c.writes++ }()
+
+	if c.writes == c.failAt {
+		return 0, errors.New("network is unreachable")
+	}
+
+	c.datagrams = append(c.datagrams, append([]byte(nil), b...))
+
+	return len(b), nil
+}
+
+func (c *failingConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+func (c *failingConn) Close() error {
+	return nil
+}
+
+// counted sums the StatsD counters of the package domain of pkgId in the datagrams
+func counted(t *testing.T, pkgId int64, datagrams ...[]byte) float64 {
+	t.Helper()
+
+	prefix := ".pkg" + strconv.FormatInt(pkgId, 10) + ".package.joules:"
+
+	sum := 0.0
+	for _, line := range strings.Split(string(bytes.Join(datagrams, nil)), "\n") {
+		i := strings.Index(line, prefix)
+		if i < 0 {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(strings.TrimSuffix(line[i+len(prefix):], "|c"), 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum += value
+	}
+
+	return sum
+}
+
+func TestStatsDCountsPartialFlushOnce(t *testing.T) {
+	// the long host fills a datagram with the lines of a package
+	sink, err := New(Config{Protocol: StatsD, Address: "udp://127.0.0.1:8125", Host: strings.Repeat("h", 100)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+	sink.Add(readers.Sample{
+		Time:     at,
+		Interval: 10 * time.Second,
+		Totals:   map[int64]readers.Energy{0: {Pkg: 100}, 1: {Pkg: 200}},
+	})
+
+	// the second datagram fails, after the lines of package 0 were written
+	first := &failingConn{failAt: 1}
+	sink.conn = first
+	if err := sink.Flush(context.Background()); err == nil {
+		t.Fatal("the flush succeeded despite the failed datagram")
+	}
+	if len(first.datagrams) != 1 || counted(t, 0, first.datagrams...) != 100 {
+		t.Fatalf("the failure did not split the packages, got datagrams %q", first.datagrams)
+	}
+
+	second := &failingConn{failAt: -1}
+	sink.conn = second
+	if err := sink.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	datagrams := append(first.datagrams, second.datagrams...)
+	if joules := counted(t, 0, datagrams...); joules != 100 {
+		t.Errorf("got %v J counted for package 0, want 100 J", joules)
+	}
+	if joules := counted(t, 1, datagrams...); joules != 200 {
+		t.Errorf("got %v J counted for package 1, want 200 J", joules)
+	}
+
+	// package 0 is not resent, its gauge would drop to 0 W
+	if strings.Contains(string(bytes.Join(second.datagrams, nil)), ".pkg0.") {
+		t.Errorf("package 0 was written again, got datagrams %q", second.datagrams)
+	}
+	if !strings.Contains(string(bytes.Join(second.datagrams, nil)), ".pkg1.package.watts:20|g") {
+		t.Errorf("got datagrams %q, want package 1 drawing 20 W", second.datagrams)
+	}
+
+	// everything was written, until the next sample there is nothing to flush
+	third := &failingConn{failAt: -1}
+	sink.conn = third
+	if err := sink.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(third.datagrams) != 0 {
+		t.Errorf("got datagrams %q without a new sample", third.datagrams)
+	}
+}
@@ -0,0 +1,32 @@
+package plaintext
+
+import (
+	"context"
+
+	"github.com/rekuberate-io/power/pkg/sink"
+)
+
+func init() {
+	for _, protocol := range []Protocol{StatsD, Graphite} {
+		protocol := protocol
+		sink.Register(protocol.String(), func(config sink.Config) (sink.Sink, error) {
+			return newSink(protocol, config)
+		})
+	}
+}
+
+// newSink creates a sink writing to the address of the target, the template param names the metrics
+func newSink(protocol Protocol, config sink.Config) (sink.Sink, error) {
+	return New(Config{
+		Protocol: protocol,
+		Address:  config.Target,
+		Template: config.Param("template", DefaultTemplate),
+		Host:     config.Topology.Node,
+	}, config.Topology.Cpus)
+}
+
+// Write adds the sample of a measurement, it is written on the next Flush
+func (s *Sink) Write(_ context.Context, measurement sink.Measurement) error {
+	s.Add(measurement.Sample)
+	return nil
+}
@@ -0,0 +1,221 @@
+package readers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Difference is the disagreement of a strategy with the reference strategy, for one domain of one package
+type Difference struct {
+	Package   int64
+	Domain    Domain
+	Reference RaplReaderStrategy
+	Strategy  RaplReaderStrategy
+	// Expected is the energy in joules measured by the reference strategy
+	Expected float64
+	// Actual is the energy in joules measured by the compared strategy
+	Actual float64
+	// Absolute is Actual - Expected in joules
+	Absolute float64
+	// Relative is Absolute / Expected
+	Relative float64
+	// Missing is set when only one of the two strategies reported energy for this domain
+	Missing bool
+	// Discrepancy is set when the relative difference exceeds the tolerance of the comparison
+	Discrepancy bool
+}
+
+func (d Difference) String() string {
+	return fmt.Sprintf(
+		"package %d %s: %s %.6f J, %s %.6f J (%+.6f J, %+.2f%%)",
+		d.Package,
+		d.Domain,
+		d.Reference,
+		d.Expected,
+		d.Strategy,
+		d.Actual,
+		d.Absolute,
+		d.Relative*100,
+	)
+}
+
+// Comparison is the result of sampling several strategies over the same interval
+type Comparison struct {
+	Start     time.Time
+	Interval  time.Duration
+	Tolerance float64
+	// Reference is the strategy every other strategy is compared with, the first usable of DefaultRaplReaderStrategies
+	Reference RaplReaderStrategy
+	// Energy holds the energy measured by each strategy during the interval
+	Energy map[RaplReaderStrategy]map[int64]Energy
+	// Skipped holds the reason each unusable strategy was left out of the comparison
+	Skipped     map[RaplReaderStrategy]string
+	Differences []Difference
+}
+
+// Discrepancies returns the differences exceeding the tolerance
+func (c Comparison) Discrepancies() []Difference {
+	var discrepancies []Difference
+	for _, difference := range c.Differences {
+		if difference.Discrepancy {
+			discrepancies = append(discrepancies, difference)
+		}
+	}
+
+	return discrepancies
+}
+
+// Compare samples every usable strategy of DefaultRaplReaderStrategies over the same interval and reports the per
+// domain differences of each one against the first. Estimated strategies are skipped, they read no counters.
+// Differences whose relative value exceeds tolerance (e.g. 0.05 for 5%) are flagged as discrepancies. At least two
+// strategies have to be usable. A single wraparound of a counter during the interval is corrected, so the interval has
+// to stay well below the time the 32 bit msr counters take to wrap around (about a minute under full load)
+func Compare(interval time.Duration, tolerance float64) (Comparison, error) {
+	comparison := Comparison{
+		Interval:  interval,
+		Tolerance: tolerance,
+		Energy:    make(map[RaplReaderStrategy]map[int64]Energy),
+		Skipped:   make(map[RaplReaderStrategy]string),
+	}
+
+	var strategies []RaplReaderStrategy
+	raplReaders := make(map[RaplReaderStrategy]RaplReader)
+
+	for _, strategy := range DefaultRaplReaderStrategies {
+		raplReader, err := newRaplReaderOf(strategy)
+		if err != nil {
+			return comparison, err
+		}
+
+		diagnosis := raplReader.Diagnose()
+		if !diagnosis.Usable() {
+			klog.V(5).Infof("skipped rapl reader strategy %s %s", strategy, diagnosis)
+			comparison.Skipped[strategy] = diagnosis.Reason
+			continue
+		}
+
+		if IsEstimated(raplReader) {
+			comparison.Skipped[strategy] = "estimated by a model, not read from the rapl counters"
+			continue
+		}
+
+		strategies = append(strategies, strategy)
+		raplReaders[strategy] = raplReader
+	}
+
+	defer func() {
+		for _, raplReader := range raplReaders {
+			if perfEventReader, ok := raplReader.(*PerfEventReader); ok {
+				_ = perfEventReader.Close()
+			}
+		}
+	}()
+
+	if len(strategies) < 2 {
+		return comparison, errors.New("comparing needs at least two usable rapl reader strategies")
+	}
+
+	comparison.Reference = strategies[0]
+
+	// the first measurement primes the readers (e.g. opens the perf counters or reads the msr units) so that the
+	// measurements bracketing the interval are taken as close to each other as possible
+	for _, strategy := range strategies {
+		if _, err := raplReaders[strategy].Measure(); err != nil {
+			return comparison, fmt.Errorf("%s: %w", strategy, err)
+		}
+	}
+
+	// the msr counters wrap around within minutes under load, the ones of sysfs within hours
+	ranges := make(map[RaplReaderStrategy]map[int64]Energy)
+	for _, strategy := range strategies {
+		ranger, ok := raplReaders[strategy].(EnergyRanger)
+		if !ok {
+			continue
+		}
+
+		strategyRanges, err := ranger.EnergyRanges()
+		if err != nil {
+			return comparison, fmt.Errorf("%s: %w", strategy, err)
+		}
+
+		ranges[strategy] = strategyRanges
+	}
+
+	before := make(map[RaplReaderStrategy]Measurement)
+	comparison.Start = time.Now()
+	for _, strategy := range strategies {
+		measurement, err := raplReaders[strategy].Measure()
+		if err != nil {
+			return comparison, fmt.Errorf("%s: %w", strategy, err)
+		}
+
+		before[strategy] = measurement
+	}
+
+	time.Sleep(interval)
+
+	for _, strategy := range strategies {
+		after, err := raplReaders[strategy].Measure()
+		if err != nil {
+			return comparison, fmt.Errorf("%s: %w", strategy, err)
+		}
+
+		delta := make(map[int64]Energy)
+		previous := before[strategy].Packages()
+		for pkgId, energy := range after.Packages() {
+			var reset []Domain
+			delta[pkgId], reset = Unwrap(energy, previous[pkgId], ranges[strategy][pkgId])
+			if len(reset) > 0 {
+				return comparison, fmt.Errorf("%s: counters of package %d went backwards without a known range: %v", strategy, pkgId, reset)
+			}
+		}
+
+		comparison.Energy[strategy] = delta
+	}
+
+	reference := comparison.Energy[comparison.Reference]
+	var pkgIds []int64
+	for pkgId := range reference {
+		pkgIds = append(pkgIds, pkgId)
+	}
+	sort.Slice(pkgIds, func(i, j int) bool { return pkgIds[i] < pkgIds[j] })
+
+	for _, strategy := range strategies[1:] {
+		for _, pkgId := range pkgIds {
+			for _, domain := range Domains {
+				expected := reference[pkgId].Get(domain)
+				actual := comparison.Energy[strategy][pkgId].Get(domain)
+				if expected == 0 && actual == 0 {
+					continue
+				}
+
+				difference := Difference{
+					Package:   pkgId,
+					Domain:    domain,
+					Reference: comparison.Reference,
+					Strategy:  strategy,
+					Expected:  expected,
+					Actual:    actual,
+					Absolute:  actual - expected,
+					Missing:   expected == 0 || actual == 0,
+				}
+
+				if expected != 0 {
+					difference.Relative = difference.Absolute / expected
+				} else {
+					difference.Relative = math.Inf(1)
+				}
+
+				difference.Discrepancy = !difference.Missing && math.Abs(difference.Relative) > tolerance
+				comparison.Differences = append(comparison.Differences, difference)
+			}
+		}
+	}
+
+	return comparison, nil
+}
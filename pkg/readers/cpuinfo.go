@@ -13,6 +13,7 @@ import (
 const (
 	cpuInfoPath           = "/proc/cpuinfo"
 	physicalPackageIdPath = "/sys/devices/system/cpu/cpu%d/topology/physical_package_id"
+	dieIdPath             = "/sys/devices/system/cpu/cpu%d/topology/die_id"
 )
 
 const (
@@ -66,6 +67,7 @@ type Cpu struct {
 type Core struct {
 	Id      int
 	Package int64
+	Die     int64
 }
 
 type Model struct {
@@ -78,6 +80,30 @@ func (c *Cpu) String() string {
 	return fmt.Sprintf("{ Name: %s, Vendor: %s, Family: %d, Model: %s }", c.Model.Name, c.Vendor.String(), c.Family, c.Model.InternalName)
 }
 
+// Dies returns the lowest die id of every package of this cpu
+func (c *Cpu) Dies() map[int64]int64 {
+	dies := make(map[int64]int64)
+	for _, core := range c.Cores {
+		if die, exists := dies[core.Package]; !exists || core.Die < die {
+			dies[core.Package] = core.Die
+		}
+	}
+
+	return dies
+}
+
+// CorePackages maps the id of every core (logical cpu) to the id of its package
+func CorePackages(cpus map[int]*Cpu) map[int]int64 {
+	corePackages := make(map[int]int64)
+	for _, cpu := range cpus {
+		for _, core := range cpu.Cores {
+			corePackages[core.Id] = core.Package
+		}
+	}
+
+	return corePackages
+}
+
 func GetNumberOfSockets() (int, error) {
 	cpuSockets := make(map[int]bool)
 
@@ -225,6 +251,12 @@ func DetectPackages() (map[int]*Cpu, error) {
 
 				cpu.Cores[coreIdx].Package = packageId
 			}
+
+			// die_id exists since Linux 5.3, older kernels expose a single die per package
+			dieId, err := ReadIntFromFile(fmt.Sprintf(dieIdPath, core.Id))
+			if err == nil {
+				cpu.Cores[coreIdx].Die = dieId
+			}
 		}
 	}
 
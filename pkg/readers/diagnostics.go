@@ -0,0 +1,198 @@
+package readers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	procSelfStatusPath      = "/proc/self/status"
+	perfEventParanoidPath   = "/proc/sys/kernel/perf_event_paranoid"
+	kernelLockdownPath      = "/sys/kernel/security/lockdown"
+	msrModulePath           = "/sys/module/msr"
+	procModulesPath         = "/proc/modules"
+	perfEventMaxParanoidity = 0
+)
+
+// Linux capability bits, see include/uapi/linux/capability.h
+const (
+	CAP_DAC_READ_SEARCH = 2
+	CAP_SYS_RAWIO       = 17
+	CAP_SYS_ADMIN       = 21
+	CAP_PERFMON         = 38
+)
+
+// Diagnosis is the structured report of whether a RAPL reader strategy can be used on this machine, and if not, why
+type Diagnosis struct {
+	// Present reports whether the interface of the strategy exists at all (files, device nodes, pmu)
+	Present bool
+	// Readable reports whether the current process managed to open the interface for reading
+	Readable bool
+	// Implemented reports whether the strategy has a working implementation
+	Implemented bool
+	// MissingCapability is the name of the capability the process lacks to use this strategy, if any
+	MissingCapability string
+	// PerfEventParanoid is the value of kernel.perf_event_paranoid, nil if it could not be read
+	PerfEventParanoid *int
+	// Lockdown is the active kernel lockdown mode (none, integrity, confidentiality), empty if unknown
+	Lockdown string
+	// MsrModuleLoaded reports whether the msr kernel module is loaded (or built-in)
+	MsrModuleLoaded bool
+	// Reason is a human-readable explanation of why the strategy is unusable, empty if it is usable
+	Reason string
+}
+
+// Usable reports whether a reader of this strategy is expected to produce measurements
+func (d Diagnosis) Usable() bool {
+	return d.Present && d.Readable && d.Implemented
+}
+
+func (d Diagnosis) String() string {
+	paranoid := "n/a"
+	if d.PerfEventParanoid != nil {
+		paranoid = strconv.Itoa(*d.PerfEventParanoid)
+	}
+
+	lockdown := d.Lockdown
+	if lockdown == "" {
+		lockdown = "n/a"
+	}
+
+	s := fmt.Sprintf(
+		"{ present: %t, readable: %t, implemented: %t, paranoid: %s, lockdown: %s, msr module: %t }",
+		d.Present,
+		d.Readable,
+		d.Implemented,
+		paranoid,
+		lockdown,
+		d.MsrModuleLoaded,
+	)
+
+	if d.Reason != "" {
+		s = fmt.Sprintf("%s: %s", d.Reason, s)
+	}
+
+	return s
+}
+
+// newDiagnosis collects the host-wide facts that are common to every strategy
+func newDiagnosis() Diagnosis {
+	d := Diagnosis{
+		Lockdown:        KernelLockdown(),
+		MsrModuleLoaded: MsrModuleLoaded(),
+	}
+
+	if paranoid, err := PerfEventParanoid(); err == nil {
+		d.PerfEventParanoid = &paranoid
+	}
+
+	return d
+}
+
+// canRead tries to open path for reading and reports whether it succeeded, alongside a reason if it failed
+func canRead(path string) (bool, string) {
+	fd, err := syscall.Open(path, syscall.O_RDONLY, 0)
+	if err != nil {
+		switch {
+		case errors.Is(err, syscall.EACCES), errors.Is(err, syscall.EPERM):
+			return false, fmt.Sprintf("permission denied opening %s", path)
+		default:
+			return false, fmt.Sprintf("failed opening %s: %s", path, err)
+		}
+	}
+
+	_ = syscall.Close(fd)
+	return true, ""
+}
+
+// PerfEventParanoid reads kernel.perf_event_paranoid
+func PerfEventParanoid() (int, error) {
+	paranoid, err := ReadIntFromFile(perfEventParanoidPath)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(paranoid), nil
+}
+
+// KernelLockdown returns the active kernel lockdown mode, or an empty string if lockdown is not supported
+func KernelLockdown() string {
+	modes, err := ReadStringFromFile(kernelLockdownPath)
+	if err != nil {
+		return ""
+	}
+
+	// the active mode is enclosed in brackets e.g. "none [integrity] confidentiality"
+	for _, mode := range strings.Fields(modes) {
+		if strings.HasPrefix(mode, "[") && strings.HasSuffix(mode, "]") {
+			return strings.Trim(mode, "[]")
+		}
+	}
+
+	return ""
+}
+
+// MsrModuleLoaded reports whether the msr driver is available, either as a loaded module or built into the kernel
+func MsrModuleLoaded() bool {
+	if FileExists(msrModulePath) {
+		return true
+	}
+
+	file, err := os.Open(procModulesPath)
+	if err != nil {
+		return false
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			klog.Errorln(err)
+		}
+	}(file)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "msr ") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasCapability reports whether the current process has the given capability in its effective set
+func HasCapability(capability uint) bool {
+	file, err := os.Open(procSelfStatusPath)
+	if err != nil {
+		return false
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			klog.Errorln(err)
+		}
+	}(file)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if !strings.HasPrefix(text, "CapEff:") {
+			continue
+		}
+
+		capEff, err := strconv.ParseUint(strings.TrimSpace(text[len("CapEff:"):]), 16, 64)
+		if err != nil {
+			return false
+		}
+
+		return capEff&(1<<capability) != 0
+	}
+
+	return false
+}
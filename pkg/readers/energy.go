@@ -1,5 +1,7 @@
 package readers
 
+import "time"
+
 const joulesToKiloWattHour = 2.7777777777778e-7
 
 // Energy : the structure that holds the energy measurements
@@ -12,6 +14,63 @@ type Energy struct {
 	Pkg, PP0, PP1, DRAM, PSys float64
 }
 
+// Domain identifies one of the RAPL power domains of a package
+type Domain int
+
+const (
+	DomainPkg Domain = iota
+	DomainPP0
+	DomainPP1
+	DomainDRAM
+	DomainPSys
+)
+
+// Domains lists every RAPL domain in a stable order
+var Domains = []Domain{DomainPkg, DomainPP0, DomainPP1, DomainDRAM, DomainPSys}
+
+func (d Domain) String() string {
+	var values []string = []string{"package", "core", "uncore", "dram", "psys"}
+	if int(d) < 0 || int(d) >= len(values) {
+		return "unknown"
+	}
+
+	return values[d]
+}
+
+// Get returns the value of the given domain
+func (e Energy) Get(d Domain) float64 {
+	switch d {
+	case DomainPkg:
+		return e.Pkg
+	case DomainPP0:
+		return e.PP0
+	case DomainPP1:
+		return e.PP1
+	case DomainDRAM:
+		return e.DRAM
+	case DomainPSys:
+		return e.PSys
+	}
+
+	return 0
+}
+
+// Set sets the value of the given domain
+func (e *Energy) Set(d Domain, value float64) {
+	switch d {
+	case DomainPkg:
+		e.Pkg = value
+	case DomainPP0:
+		e.PP0 = value
+	case DomainPP1:
+		e.PP1 = value
+	case DomainDRAM:
+		e.DRAM = value
+	case DomainPSys:
+		e.PSys = value
+	}
+}
+
 func (e Energy) Add(e2 Energy) Energy {
 	return Energy{
 		Pkg:  e.Pkg + e2.Pkg,
@@ -32,6 +91,17 @@ func (e Energy) Sub(e2 Energy) Energy {
 	}
 }
 
+// Scale multiplies every domain by factor
+func (e Energy) Scale(factor float64) Energy {
+	return Energy{
+		Pkg:  e.Pkg * factor,
+		PP0:  e.PP0 * factor,
+		PP1:  e.PP1 * factor,
+		DRAM: e.DRAM * factor,
+		PSys: e.PSys * factor,
+	}
+}
+
 func (e Energy) ToKiloWattHour() Power {
 	power := Power{
 		Pkg:  e.Pkg * joulesToKiloWattHour,
@@ -44,6 +114,22 @@ func (e Energy) ToKiloWattHour() Power {
 	return power
 }
 
+// ToWatts converts the energy consumed during interval to the average power in watts
+func (e Energy) ToWatts(interval time.Duration) Power {
+	seconds := interval.Seconds()
+	if seconds <= 0 {
+		return Power{}
+	}
+
+	return Power{
+		Pkg:  e.Pkg / seconds,
+		PP0:  e.PP0 / seconds,
+		PP1:  e.PP1 / seconds,
+		DRAM: e.DRAM / seconds,
+		PSys: e.PSys / seconds,
+	}
+}
+
 type Measurement map[int64]map[int]Energy
 
 func (m Measurement) Delta(m2 Measurement) Measurement {
@@ -86,3 +172,40 @@ type Units struct {
 }
 
 type Power Energy
+
+// Packages collapses the measurement to one Energy per package. The RAPL counters are package scoped, so when a reader
+// reports them per core the values of the lowest core of the package are taken
+func (m Measurement) Packages() map[int64]Energy {
+	packages := make(map[int64]Energy)
+
+	for pkgId, cores := range m {
+		lowest := -1
+		for coreId := range cores {
+			if lowest == -1 || coreId < lowest {
+				lowest = coreId
+			}
+		}
+
+		if lowest != -1 {
+			packages[pkgId] = cores[lowest]
+		}
+	}
+
+	return packages
+}
+
+// SupportedDomains returns the domains of every package whose counter is non-zero, the readers leave the counters of
+// the domains the hardware does not implement at zero
+func SupportedDomains(counters map[int64]Energy) map[int64][]Domain {
+	supported := make(map[int64][]Domain)
+	for pkgId, energy := range counters {
+		supported[pkgId] = []Domain{}
+		for _, domain := range Domains {
+			if energy.Get(domain) != 0 {
+				supported[pkgId] = append(supported[pkgId], domain)
+			}
+		}
+	}
+
+	return supported
+}
@@ -0,0 +1,229 @@
+package readers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"time"
+)
+
+const (
+	constraintName       = "constraint_%d_name"
+	constraintPowerLimit = "constraint_%d_power_limit_uw"
+	constraintTimeWindow = "constraint_%d_time_window_us"
+	constraintMaxPower   = "constraint_%d_max_power_uw"
+	zoneEnabled          = "enabled"
+	subZone              = "class/powercap/intel-rapl/intel-rapl:%d/intel-rapl:%d:%d/"
+	microWattsToWatt     = 1000000.0
+)
+
+// msrPowerLimitDomains maps the rapl domains to their power limit registers
+var msrPowerLimitDomains = []struct {
+	domain Domain
+	offset int64
+}{
+	{DomainPkg, MSR_PKG_RAPL_POWER_LIMIT},
+	{DomainPP0, MSR_PP0_POWER_LIMIT},
+	{DomainPP1, MSR_PP1_POWER_LIMIT},
+	{DomainDRAM, MSR_DRAM_POWER_LIMIT},
+}
+
+// PowerLimit is one power capping constraint of a rapl domain, the average power the domain is held under over the
+// time window
+type PowerLimit struct {
+	Package int64
+	Domain  Domain
+	// Name is the constraint name, long_term and short_term for the two limits of a package
+	Name       string
+	Watts      float64
+	TimeWindow time.Duration
+	// MaxWatts is the highest limit that can be set, zero if not reported
+	MaxWatts float64
+	Enabled  bool
+	// Locked reports whether the limit is locked until the next reset, only the msr interface reports it
+	Locked bool
+	// Source is the interface the limit was read from, sysfs or msr
+	Source string
+}
+
+func (l PowerLimit) String() string {
+	return fmt.Sprintf(
+		"{ package: %d, domain: %s, name: %s, watts: %.3f, window: %s, max: %.3f, enabled: %t, locked: %t, source: %s }",
+		l.Package,
+		l.Domain,
+		l.Name,
+		l.Watts,
+		l.TimeWindow,
+		l.MaxWatts,
+		l.Enabled,
+		l.Locked,
+		l.Source,
+	)
+}
+
+// PowerLimiter is implemented by the readers that can read the power limits of the rapl domains
+type PowerLimiter interface {
+	PowerLimits() ([]PowerLimit, error)
+}
+
+// PowerLimits reads the constraints of every powercap zone and sub-zone
+func (r *Sysfs) PowerLimits() ([]PowerLimit, error) {
+	var limits []PowerLimit
+
+	for _, cpu := range Cpus {
+		for pkg := range cpu.Packages {
+			zoneLimits, err := r.zoneLimits(r.path(zone, pkg), pkg, DomainPkg)
+			if err != nil {
+				return nil, err
+			}
+			limits = append(limits, zoneLimits...)
+
+			for domain := range raplDomains {
+				name, err := ReadStringFromFile(r.path(subZoneName, pkg, pkg, domain))
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+				if err != nil {
+					return nil, err
+				}
+
+				subZoneDomain, exists := map[string]Domain{"core": DomainPP0, "uncore": DomainPP1, "dram": DomainDRAM}[name]
+				if !exists {
+					continue
+				}
+
+				zoneLimits, err := r.zoneLimits(r.path(subZone, pkg, pkg, domain), pkg, subZoneDomain)
+				if err != nil {
+					return nil, err
+				}
+				limits = append(limits, zoneLimits...)
+			}
+		}
+	}
+
+	return limits, nil
+}
+
+// zoneLimits reads the numbered constraints of the zone at path until the first one missing
+func (r *Sysfs) zoneLimits(path string, pkg int64, domain Domain) ([]PowerLimit, error) {
+	var limits []PowerLimit
+
+	enabled, err := ReadUintFromFile(path + zoneEnabled)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	for constraint := 0; ; constraint++ {
+		name, err := ReadStringFromFile(path + fmt.Sprintf(constraintName, constraint))
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		limit := PowerLimit{Package: pkg, Domain: domain, Name: name, Enabled: enabled == 1, Source: "sysfs"}
+
+		watts, err := ReadUintFromFile(path + fmt.Sprintf(constraintPowerLimit, constraint))
+		if err != nil {
+			return nil, err
+		}
+		limit.Watts = float64(watts) / microWattsToWatt
+
+		window, err := ReadUintFromFile(path + fmt.Sprintf(constraintTimeWindow, constraint))
+		if err == nil {
+			limit.TimeWindow = time.Duration(window) * time.Microsecond
+		}
+
+		maxWatts, err := ReadUintFromFile(path + fmt.Sprintf(constraintMaxPower, constraint))
+		if err == nil {
+			limit.MaxWatts = float64(maxWatts) / microWattsToWatt
+		}
+
+		limits = append(limits, limit)
+	}
+
+	return limits, nil
+}
+
+// PowerLimits decodes the power limit registers of every package. Only intel processors expose them
+func (r *MsrReader) PowerLimits() ([]PowerLimit, error) {
+	pkgUnits, err := r.energyUnits()
+	if err != nil {
+		return nil, err
+	}
+
+	var limits []PowerLimit
+
+	for _, cpu := range Cpus {
+		if cpu.Vendor != Intel {
+			continue
+		}
+
+		for pkg, core := range r.packageCores(cpu) {
+			fd, err := r.open(core)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, register := range msrPowerLimitDomains {
+				value, err := r.read(fd, register.offset, cpu.ByteOrder)
+				if err != nil {
+					// not every model implements the limits of every domain
+					continue
+				}
+
+				limits = append(limits, decodePowerLimits(pkg, register.domain, value, pkgUnits[pkg])...)
+			}
+
+			err = r.close(fd)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return limits, nil
+}
+
+// packageCores returns the lowest core of every package of the cpu
+func (r *MsrReader) packageCores(cpu *Cpu) map[int64]Core {
+	cores := make(map[int64]Core)
+	for _, core := range cpu.Cores {
+		if lowest, exists := cores[core.Package]; !exists || core.Id < lowest.Id {
+			cores[core.Package] = core
+		}
+	}
+
+	return cores
+}
+
+// decodePowerLimits decodes a power limit register: the long term limit in the lower 32 bits and, for the package,
+// the short term limit in the upper ones. Bit 63 locks the register until the next reset
+func decodePowerLimits(pkg int64, domain Domain, value uint64, units Units) []PowerLimit {
+	locked := value&(1<<63) != 0
+
+	decode := func(name string, bits uint64) PowerLimit {
+		windowExponent := (bits >> 17) & 0x1f
+		windowFraction := (bits >> 22) & 0x3
+
+		return PowerLimit{
+			Package:    pkg,
+			Domain:     domain,
+			Name:       name,
+			Watts:      float64(bits&0x7fff) * units.Power,
+			TimeWindow: time.Duration(math.Pow(2, float64(windowExponent)) * (1 + float64(windowFraction)/4) * units.Time * float64(time.Second)),
+			Enabled:    bits&(1<<15) != 0,
+			Locked:     locked,
+			Source:     "msr",
+		}
+	}
+
+	limits := []PowerLimit{decode("long_term", value&0xffffffff)}
+	if domain == DomainPkg {
+		limits = append(limits, decode("short_term", value>>32))
+	}
+
+	return limits
+}
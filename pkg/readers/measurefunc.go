@@ -0,0 +1,122 @@
+package readers
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// DefaultMeasureFuncInterval is how often MeasureFunc samples the counters in the background
+const DefaultMeasureFuncInterval = 1 * time.Second
+
+// FuncEnergy is the energy consumed by the packages while a function ran
+type FuncEnergy struct {
+	// Duration is the wall clock time the function ran for
+	Duration time.Duration
+	// Sampled is the time the counters were sampled over, the basis of Power. It falls short of Duration when reads
+	// failed in between, the energy of those intervals is lost
+	Sampled time.Duration
+	// Samples is the number of successful samples taken
+	Samples int
+	// Energy holds the joules consumed per package
+	Energy map[int64]Energy
+	// Peak is the highest power of all packages over a single sampling interval, per domain
+	Peak Power
+}
+
+// Total returns the joules consumed by all packages
+func (f FuncEnergy) Total() Energy {
+	total := Energy{}
+	for _, energy := range f.Energy {
+		total = total.Add(energy)
+	}
+
+	return total
+}
+
+// Power returns the average power of all packages in watts
+func (f FuncEnergy) Power() Power {
+	return f.Total().ToWatts(f.Sampled)
+}
+
+// MeasureFunc measures the energy the packages consume while fn runs, sampling the counters every
+// DefaultMeasureFuncInterval in the background so that long running functions survive counter wraps. The counters
+// are package wide, so everything else running on the host is measured too. The error of fn is returned along with
+// the energy, the background sampling stops early when ctx is done
+func MeasureFunc(ctx context.Context, reader RaplReader, fn func() error) (FuncEnergy, error) {
+	return MeasureFuncEvery(ctx, reader, DefaultMeasureFuncInterval, fn)
+}
+
+// MeasureFuncEvery is MeasureFunc sampling the counters every interval
+func MeasureFuncEvery(ctx context.Context, reader RaplReader, interval time.Duration, fn func() error) (FuncEnergy, error) {
+	measured := FuncEnergy{Energy: make(map[int64]Energy)}
+
+	sampler := NewSampler(reader, interval)
+	_, err := sampler.Sample()
+	if err != nil {
+		return measured, err
+	}
+
+	add := func(sample Sample) {
+		if sample.Time.IsZero() || sample.Err != nil {
+			return
+		}
+
+		measured.Samples++
+		measured.Sampled += sample.Interval
+
+		power := Energy{}
+		for _, watts := range sample.Power() {
+			power = power.Add(Energy(watts))
+		}
+
+		peak := Energy(measured.Peak)
+		for _, domain := range Domains {
+			peak.Set(domain, math.Max(peak.Get(domain), power.Get(domain)))
+		}
+		measured.Peak = Power(peak)
+	}
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				sample, err := sampler.Sample()
+				if err != nil {
+					klog.Errorln(err)
+				}
+				add(sample)
+			}
+		}
+	}()
+
+	start := time.Now()
+	fnErr := fn()
+	measured.Duration = time.Since(start)
+
+	close(stop)
+	<-stopped
+
+	sample, err := sampler.Sample()
+	if err != nil {
+		return measured, err
+	}
+	add(sample)
+
+	measured.Energy = sampler.Totals()
+
+	return measured, fnErr
+}
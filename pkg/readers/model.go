@@ -0,0 +1,294 @@
+package readers
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	procRoot          = "/proc"
+	procStatPath      = "stat"
+	cpuCurFreqPath    = "devices/system/cpu/cpu%d/cpufreq/scaling_cur_freq"
+	cpuMaxFreqPath    = "devices/system/cpu/cpu%d/cpufreq/cpuinfo_max_freq"
+	unknownCpuProfile = "CPU_UNKNOWN_MODEL"
+)
+
+// CpuProfile is the power envelope of one package of a processor model, in watts
+type CpuProfile struct {
+	// TdpWatts is the thermal design power, drawn when every core is busy at the maximum frequency
+	TdpWatts float64
+	// IdleWatts is the power drawn when every core is idle
+	IdleWatts float64
+}
+
+// CpuProfiles holds the power envelope of every entry of CpuModels, per package. The values are the nominal TDP of
+// the family and a typical idle floor, a rough guess for hosts that expose no energy counters at all
+var CpuProfiles = map[string]CpuProfile{
+	unknownCpuProfile:      {TdpWatts: 100, IdleWatts: 20},
+	"CPU_SANDYBRIDGE":      {TdpWatts: 95, IdleWatts: 10},
+	"CPU_SANDYBRIDGE_EP":   {TdpWatts: 130, IdleWatts: 25},
+	"CPU_IVYBRIDGE":        {TdpWatts: 77, IdleWatts: 8},
+	"CPU_IVYBRIDGE_EP":     {TdpWatts: 130, IdleWatts: 25},
+	"CPU_HASWELL":          {TdpWatts: 84, IdleWatts: 8},
+	"CPU_HASWELL_ULT":      {TdpWatts: 15, IdleWatts: 2},
+	"CPU_HASWELL_GT3E":     {TdpWatts: 47, IdleWatts: 6},
+	"CPU_HASWELL_EP":       {TdpWatts: 145, IdleWatts: 30},
+	"CPU_BROADWELL":        {TdpWatts: 65, IdleWatts: 6},
+	"CPU_BROADWELL_GT3E":   {TdpWatts: 65, IdleWatts: 6},
+	"CPU_BROADWELL_EP":     {TdpWatts: 145, IdleWatts: 30},
+	"CPU_SKYLAKE":          {TdpWatts: 15, IdleWatts: 2},
+	"CPU_SKYLAKE_HS":       {TdpWatts: 91, IdleWatts: 8},
+	"CPU_SKYLAKE_X":        {TdpWatts: 165, IdleWatts: 35},
+	"CPU_KNIGHTS_LANDING":  {TdpWatts: 215, IdleWatts: 60},
+	"CPU_KNIGHTS_MILL":     {TdpWatts: 320, IdleWatts: 80},
+	"CPU_KABYLAKE_MOBILE":  {TdpWatts: 15, IdleWatts: 2},
+	"CPU_KABYLAKE":         {TdpWatts: 91, IdleWatts: 8},
+	"CPU_ATOM_SILVERMONT":  {TdpWatts: 10, IdleWatts: 1},
+	"CPU_ATOM_AIRMONT":     {TdpWatts: 6, IdleWatts: 1},
+	"CPU_ATOM_MERRIFIELD":  {TdpWatts: 4, IdleWatts: 0.5},
+	"CPU_ATOM_MOOREFIELD":  {TdpWatts: 4, IdleWatts: 0.5},
+	"CPU_ATOM_GOLDMONT":    {TdpWatts: 10, IdleWatts: 1},
+	"CPU_ATOM_GEMINI_LAKE": {TdpWatts: 10, IdleWatts: 1},
+	"CPU_ATOM_DENVERTON":   {TdpWatts: 25, IdleWatts: 5},
+}
+
+// ProfileOf returns the power envelope of the given cpu, the one of CPU_UNKNOWN_MODEL for models without a profile.
+// CpuModels only lists intel models, so every other vendor gets the unknown profile too
+func ProfileOf(cpu *Cpu) CpuProfile {
+	if cpu != nil && cpu.Vendor == Intel {
+		if profile, exists := CpuProfiles[cpu.Model.InternalName]; exists {
+			return profile
+		}
+	}
+
+	return CpuProfiles[unknownCpuProfile]
+}
+
+// estimator is implemented by the readers whose measurements are modeled instead of read from energy counters
+type estimator interface {
+	Estimated() bool
+}
+
+// IsEstimated reports whether the measurements of the reader are estimated by a model instead of read from the
+// rapl counters
+func IsEstimated(reader RaplReader) bool {
+	e, ok := reader.(estimator)
+	return ok && e.Estimated()
+}
+
+// ModelReader estimates the package energy of hosts without any rapl interface, e.g. cloud vms, from the cpu
+// utilization in /proc/stat, the frequency in sysfs cpufreq and the CpuProfile of the detected model:
+//
+//	P(package) = idle + (tdp - idle) * avg(utilization(core) * frequency(core) / max frequency(core))
+//
+// The power is integrated into monotonic package counters, so the measurements have the same shape as the ones of
+// the other strategies. Only DomainPkg is estimated, and IsEstimated reports true for this reader
+type ModelReader struct {
+	// ProcRoot is the mount point of procfs, /proc if empty
+	ProcRoot string
+	// SysfsRoot is the mount point of sysfs, /sys if empty
+	SysfsRoot string
+	// Profiles overrides the profile of a package, e.g. with the share of the host a vm is sized for
+	Profiles map[int64]CpuProfile
+
+	mu       sync.Mutex
+	previous map[int]CpuTime
+	last     time.Time
+	counters map[int64]float64
+}
+
+// Available checks if this RAPL reading strategy is available on this machine
+func (r *ModelReader) Available() bool {
+	return r.Diagnose().Usable()
+}
+
+// Diagnose reports whether the cpu times can be read. The model needs no privileges, which is why it is the last resort
+func (r *ModelReader) Diagnose() Diagnosis {
+	d := newDiagnosis()
+	d.Implemented = true
+	d.Present = FileExists(r.procPath(procStatPath))
+	if !d.Present {
+		d.Reason = "procfs stat not found"
+		return d
+	}
+
+	d.Readable, d.Reason = canRead(r.procPath(procStatPath))
+
+	return d
+}
+
+// Estimated reports that the measurements of this reader are modeled, not read from the rapl counters
+func (r *ModelReader) Estimated() bool {
+	return true
+}
+
+// Read a measurement using this reader strategy
+func (r *ModelReader) Read() (Measurement, error) {
+	before, err := r.Measure()
+	if err != nil {
+		return nil, err
+	}
+
+	time.Sleep(1 * time.Second)
+
+	after, err := r.Measure()
+	if err != nil {
+		return nil, err
+	}
+
+	delta := after.DeltaSum(before)
+
+	return delta, nil
+}
+
+func (r *ModelReader) procPath(format string, a ...interface{}) string {
+	root := r.ProcRoot
+	if root == "" {
+		root = procRoot
+	}
+
+	return filepath.Join(root, fmt.Sprintf(format, a...))
+}
+
+func (r *ModelReader) sysfsPath(format string, a ...interface{}) string {
+	root := r.SysfsRoot
+	if root == "" {
+		root = sysfsRoot
+	}
+
+	return filepath.Join(root, fmt.Sprintf(format, a...))
+}
+
+// Measure integrates the modeled power of every package since the previous call into the package counters. The
+// first call only primes the cpu times and reports the packages at zero joules
+func (r *ModelReader) Measure() (Measurement, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, err := r.coreTimes()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+
+	corePackages := CorePackages(Cpus)
+	profiles := r.profiles()
+
+	if r.counters == nil {
+		r.counters = make(map[int64]float64)
+		for pkg := range profiles {
+			r.counters[pkg] = 0
+		}
+	}
+
+	if r.previous != nil {
+		elapsed := now.Sub(r.last).Seconds()
+
+		load := make(map[int64]float64)
+		cores := make(map[int64]int)
+		for id, times := range current {
+			previous, exists := r.previous[id]
+			if !exists {
+				continue
+			}
+
+			delta := times.Sub(previous)
+			if delta.Total() == 0 {
+				continue
+			}
+			utilization := delta.Utilization()
+
+			pkg, exists := corePackages[id]
+			if !exists || pkg < 0 {
+				pkg = 0
+			}
+
+			load[pkg] += clampUnit(utilization) * r.frequencyRatio(id)
+			cores[pkg]++
+		}
+
+		for pkg, profile := range profiles {
+			watts := profile.IdleWatts
+			if cores[pkg] > 0 {
+				watts += (profile.TdpWatts - profile.IdleWatts) * load[pkg] / float64(cores[pkg])
+			}
+
+			r.counters[pkg] += watts * elapsed
+		}
+	}
+
+	r.previous = current
+	r.last = now
+
+	measurement := Measurement{}
+	for pkg, joules := range r.counters {
+		measurement[pkg] = map[int]Energy{0: {Pkg: joules}}
+	}
+
+	return measurement, nil
+}
+
+// profiles returns the profile of every detected package, a single package 0 when the topology is unknown
+func (r *ModelReader) profiles() map[int64]CpuProfile {
+	profiles := make(map[int64]CpuProfile)
+	for _, cpu := range Cpus {
+		for pkg := range cpu.Packages {
+			profiles[pkg] = ProfileOf(cpu)
+		}
+	}
+
+	if len(profiles) == 0 {
+		profiles[0] = ProfileOf(Cpus[0])
+	}
+
+	for pkg, profile := range r.Profiles {
+		profiles[pkg] = profile
+	}
+
+	return profiles
+}
+
+// frequencyRatio returns the current over the maximum frequency of the cpu, 1 when cpufreq is not exposed as on
+// most vms
+func (r *ModelReader) frequencyRatio(id int) float64 {
+	current, err := ReadUintFromFile(r.sysfsPath(cpuCurFreqPath, id))
+	if err != nil {
+		return 1
+	}
+
+	maximum, err := ReadUintFromFile(r.sysfsPath(cpuMaxFreqPath, id))
+	if err != nil || maximum == 0 {
+		return 1
+	}
+
+	return clampUnit(float64(current) / float64(maximum))
+}
+
+// coreTimes reads the cpu times of every cpu
+func (r *ModelReader) coreTimes() (map[int]CpuTime, error) {
+	times, err := ReadCpuTimes(r.procPath(procStatPath))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(times) == 0 {
+		return nil, errors.New("no cpu times found in procfs stat")
+	}
+
+	return times, nil
+}
+
+func clampUnit(value float64) float64 {
+	if value < 0 {
+		return 0
+	}
+
+	if value > 1 {
+		return 1
+	}
+
+	return value
+}
@@ -0,0 +1,82 @@
+package readers
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeProcStat writes the user, idle and steal ticks of two cpus
+func writeProcStat(t *testing.T, root string, cpu0 [3]uint64, cpu1 [3]uint64) {
+	writeFile(t, filepath.Join(root, procStatPath), fmt.Sprintf("cpu  0 0 0 0 0 0 0 0 0 0\n"+
+		"cpu0 %d 0 0 %d 0 0 0 %d 0 0\ncpu1 %d 0 0 %d 0 0 0 %d 0 0\nintr 0\n",
+		cpu0[0], cpu0[1], cpu0[2], cpu1[0], cpu1[1], cpu1[2]))
+}
+
+func TestModelReaderInterpolatesIdleToTdp(t *testing.T) {
+	// a single package holds both cpus
+	defer func(cpus map[int]*Cpu) { Cpus = cpus }(Cpus)
+	Cpus = map[int]*Cpu{0: {Packages: map[int64]bool{0: true}, Cores: []Core{{Id: 0, Package: 0}, {Id: 1, Package: 0}}}}
+
+	procRoot, sysfsRoot := t.TempDir(), t.TempDir()
+	// cpu0 runs at half its maximum frequency, cpu1 exposes no cpufreq like most vms
+	writeFile(t, filepath.Join(sysfsRoot, fmt.Sprintf(cpuCurFreqPath, 0)), "1500000")
+	writeFile(t, filepath.Join(sysfsRoot, fmt.Sprintf(cpuMaxFreqPath, 0)), "3000000")
+
+	reader := &ModelReader{ProcRoot: procRoot, SysfsRoot: sysfsRoot, Profiles: map[int64]CpuProfile{0: {TdpWatts: 100, IdleWatts: 20}}}
+	if !IsEstimated(reader) {
+		t.Error("the model reader is not reported as estimated")
+	}
+
+	writeProcStat(t, procRoot, [3]uint64{0, 0, 0}, [3]uint64{0, 0, 0})
+	before, err := reader.Measure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	since := reader.last
+
+	// cpu0 is half busy, cpu1 busy for three quarters, the last quarter is stolen by the hypervisor
+	writeProcStat(t, procRoot, [3]uint64{50, 50, 0}, [3]uint64{75, 0, 25})
+	after, err := reader.Measure()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the load is avg(0.5 * 0.5, 0.75 * 1), so the package draws 20 + (100 - 20) * 0.5 W
+	joules := after.Packages()[0].Pkg - before.Packages()[0].Pkg
+	if watts := joules / reader.last.Sub(since).Seconds(); math.Abs(watts-60) > 1e-6 {
+		t.Errorf("got %v W, want 60 W", watts)
+	}
+}
+
+func TestReadCpuTimes(t *testing.T) {
+	root := t.TempDir()
+	// an old kernel without the steal column
+	writeFile(t, filepath.Join(root, procStatPath), "cpu  1 2 3 4 5\ncpu3 1 2 3 4 5\nintr 0\n")
+
+	cpus, err := ReadCpuTimes(filepath.Join(root, procStatPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := CpuTime{User: 1, Nice: 2, System: 3, Idle: 4, IOWait: 5}
+	if len(cpus) != 1 || cpus[3] != want {
+		t.Fatalf("got cpu times %+v, want cpu3 %+v", cpus, want)
+	}
+	if busy, total := cpus[3].Busy(), cpus[3].Total(); busy != 6 || total != 15 {
+		t.Errorf("got %d busy of %d ticks, want 6 of 15", busy, total)
+	}
+}
@@ -12,7 +12,8 @@ import (
 )
 
 const (
-	msrPath = "/dev/cpu/%d/msr"
+	msrPath          = "/dev/cpu/%d/msr"
+	energyStatusMask = 0xffffffff
 )
 
 var (
@@ -32,30 +33,49 @@ type MsrReader struct {
 
 //Available checks if this RAPL reading strategy is available on this machine
 func (r *MsrReader) Available() bool {
-	return FileExists(fmt.Sprintf(msrPath, 0))
+	return r.Diagnose().Usable()
 }
 
-//Read a measurement using this reader strategy
-func (r *MsrReader) Read() (Measurement, error) {
-	pkgUnits, err := r.initUnits()
-	if err != nil {
-		panic(err)
+//HardwareCounters reports that the energy status registers are the counters of the hardware
+func (r *MsrReader) HardwareCounters() bool {
+	return true
+}
+
+//Diagnose reports whether the msr device nodes exist and can be opened by this process, which requires CAP_SYS_RAWIO
+func (r *MsrReader) Diagnose() Diagnosis {
+	d := newDiagnosis()
+	d.Implemented = true
+	d.Present = FileExists(fmt.Sprintf(msrPath, 0))
+	if !d.Present {
+		if d.MsrModuleLoaded {
+			d.Reason = fmt.Sprintf("%s not found", fmt.Sprintf(msrPath, 0))
+		} else {
+			d.Reason = "msr module not loaded, try: modprobe msr"
+		}
+		return d
+	}
+
+	if !HasCapability(CAP_SYS_RAWIO) {
+		d.MissingCapability = "CAP_SYS_RAWIO"
 	}
 
-	units = pkgUnits
+	d.Readable, d.Reason = canRead(fmt.Sprintf(msrPath, 0))
 
-	klog.V(10).Infof("PkgUnits: %+v\n", units)
+	return d
+}
 
-	before, err := r.measure()
+//Read a measurement using this reader strategy
+func (r *MsrReader) Read() (Measurement, error) {
+	before, err := r.Measure()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	time.Sleep(1 * time.Second)
 
-	after, err := r.measure()
+	after, err := r.Measure()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	delta := after.DeltaSum(before)
@@ -63,20 +83,25 @@ func (r *MsrReader) Read() (Measurement, error) {
 	return delta, nil
 }
 
-func (r *MsrReader) measure() (Measurement, error) {
+//Measure reads the raw energy status registers of every core, in joules
+func (r *MsrReader) Measure() (Measurement, error) {
+	if units == nil {
+		pkgUnits, err := r.initUnits()
+		if err != nil {
+			return nil, err
+		}
+
+		units = pkgUnits
+
+		klog.V(10).Infof("PkgUnits: %+v\n", units)
+	}
+
 	measurement := Measurement{}
 
 	for _, cpu := range Cpus {
 		for _, core := range cpu.Cores {
 			byteOrder := cpu.ByteOrder
 			var energy = Energy{}
-			var fd int
-			defer func(int) {
-				err := r.close(fd)
-				if err != nil {
-					klog.Errorf("closing fd for core %d failed", core.Id)
-				}
-			}(fd)
 
 			fd, err := r.open(core)
 			if err != nil {
@@ -93,6 +118,11 @@ func (r *MsrReader) measure() (Measurement, error) {
 			energy.DRAM = r.readEnergy(fd, dramEnergyStatus, dramEnergyUnit, byteOrder)
 			energy.PSys = r.readEnergy(fd, psysEnergyStatus, cpuEnergyUnit, byteOrder)
 
+			err = r.close(fd)
+			if err != nil {
+				klog.Errorf("closing fd for core %d failed", core.Id)
+			}
+
 			if _, exists := measurement[core.Package]; !exists {
 				coreEnergy := make(map[int]Energy)
 				coreEnergy[core.Id] = energy
@@ -105,6 +135,51 @@ func (r *MsrReader) measure() (Measurement, error) {
 	return measurement, nil
 }
 
+// EnergyRanges computes the value at which the 32 bit energy status registers of every package wrap around
+func (r *MsrReader) EnergyRanges() (map[int64]Energy, error) {
+	if units == nil {
+		if _, err := r.Measure(); err != nil {
+			return nil, err
+		}
+	}
+
+	ranges := make(map[int64]Energy)
+	for pkgId, coreUnits := range units {
+		for _, unit := range coreUnits {
+			cpuRange := unit.CpuEnergy * (energyStatusMask + 1)
+			ranges[pkgId] = Energy{
+				Pkg:  cpuRange,
+				PP0:  cpuRange,
+				PP1:  cpuRange,
+				DRAM: unit.DramEnergy * (energyStatusMask + 1),
+				PSys: cpuRange,
+			}
+			break
+		}
+	}
+
+	return ranges, nil
+}
+
+// energyUnits reports the units of the energy status registers of every package
+func (r *MsrReader) energyUnits() (map[int64]Units, error) {
+	if units == nil {
+		if _, err := r.Measure(); err != nil {
+			return nil, err
+		}
+	}
+
+	pkgUnits := make(map[int64]Units)
+	for pkgId, coreUnits := range units {
+		for _, unit := range coreUnits {
+			pkgUnits[pkgId] = unit
+			break
+		}
+	}
+
+	return pkgUnits, nil
+}
+
 func (r *MsrReader) open(core Core) (int, error) {
 	path := fmt.Sprintf(msrPath, core.Id)
 
@@ -158,13 +233,19 @@ func (r *MsrReader) read(fd int, offset int64, order binary.ByteOrder) (uint64,
 }
 
 func (r *MsrReader) readEnergy(fd int, offset int64, unit float64, order binary.ByteOrder) float64 {
+	// the domain has no energy status register for this vendor
+	if offset == 0 {
+		return 0
+	}
+
 	result, err := r.read(fd, offset, order)
 	if err != nil {
 		klog.Errorf("reading offset: %d failed, %s", offset, err)
 		return 0
 	}
 
-	return unit * float64(result)
+	// only the lower 32 bits of the energy status registers hold the counter, the rest is reserved
+	return unit * float64(result&energyStatusMask)
 }
 
 func (r *MsrReader) initPerVendor(cpu Cpu) {
@@ -190,41 +271,35 @@ func (r *MsrReader) initUnits() (map[int64]map[int]Units, error) {
 		r.initPerVendor(*cpu)
 
 		for _, core := range cpu.Cores {
-			var fds []int
-			defer func([]int) {
-				for _, fd := range fds {
-					err := r.close(fd)
-					if err != nil {
-						klog.Errorln("closing fd failed")
-					}
-				}
-			}(fds)
-
 			fd, err := r.open(core)
-			if err == nil {
-				fds = append(fds, fd)
+			if err != nil {
+				return nil, err
 			}
 
-			for _, fd := range fds {
-				result, err := r.read(fd, raplUnits, cpu.ByteOrder)
-				if err != nil {
-					return nil, err
-				}
-
-				var units = Units{
-					Power:      math.Pow(0.5, float64(result&0xf)),
-					Time:       math.Pow(0.5, float64((result>>16)&0xf)),
-					CpuEnergy:  math.Pow(0.5, float64((result>>8)&0x1f)),
-					DramEnergy: math.Pow(0.5, float64((result>>8)&0x1f)),
-				}
-
-				if _, exists := pkgUnits[core.Package]; !exists {
-					coreUnits := make(map[int]Units)
-					coreUnits[core.Id] = units
-					pkgUnits[core.Package] = coreUnits
-				} else {
-					pkgUnits[core.Package][core.Id] = units
-				}
+			result, err := r.read(fd, raplUnits, cpu.ByteOrder)
+
+			closeErr := r.close(fd)
+			if closeErr != nil {
+				klog.Errorln("closing fd failed")
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			var units = Units{
+				Power:      math.Pow(0.5, float64(result&0xf)),
+				Time:       math.Pow(0.5, float64((result>>16)&0xf)),
+				CpuEnergy:  math.Pow(0.5, float64((result>>8)&0x1f)),
+				DramEnergy: math.Pow(0.5, float64((result>>8)&0x1f)),
+			}
+
+			if _, exists := pkgUnits[core.Package]; !exists {
+				coreUnits := make(map[int]Units)
+				coreUnits[core.Id] = units
+				pkgUnits[core.Package] = coreUnits
+			} else {
+				pkgUnits[core.Package][core.Id] = units
 			}
 		}
 	}
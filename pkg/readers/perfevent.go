@@ -1,29 +1,378 @@
 package readers
 
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"k8s.io/klog/v2"
+)
+
 const (
 	perfEventPowerPath            = "/sys/bus/event_source/devices/power/type"
+	perfEventPowerCpuMaskPath     = "/sys/bus/event_source/devices/power/cpumask"
 	perfEventPowerEventsPath      = "/sys/bus/event_source/devices/power/events/%s"
 	perfEventPowerEventsScalePath = "/sys/bus/event_source/devices/power/events/%s.scale"
 	perfEventPowerEventsUnitPath  = "/sys/bus/event_source/devices/power/events/%s.unit"
+
+	perfAttrSizeVer0  = 64
+	perfFlagFdCloexec = 8
 )
 
+var perfEventDomains = map[string]Domain{
+	"energy-cores": DomainPP0,
+	"energy-gpu":   DomainPP1,
+	"energy-pkg":   DomainPkg,
+	"energy-ram":   DomainDRAM,
+	"energy-psys":  DomainPSys,
+}
+
 type PerfEventAttr struct {
 	event string
 	scale float64
 	unit  string
 }
 
+// perfEventAttr mirrors the first version (PERF_ATTR_SIZE_VER0) of struct perf_event_attr, which is all that is
+// needed to count the system-wide power events
+type perfEventAttr struct {
+	Type         uint32
+	Size         uint32
+	Config       uint64
+	SamplePeriod uint64
+	SampleType   uint64
+	ReadFormat   uint64
+	Flags        uint64
+	WakeupEvents uint32
+	BpType       uint32
+	Config1      uint64
+}
+
+type perfEventCounter struct {
+	fd     int
+	domain Domain
+	scale  float64
+}
+
+// PerfEventReader is collecting RAPL results on Linux by counting the events of the power pmu with perf_event_open.
+// Counters are opened once, on one cpu of every package listed in the pmu cpumask, and are kept open until Close
 type PerfEventReader struct {
+	mu       sync.Mutex
+	counters map[int64][]perfEventCounter
 }
 
+//Available checks if this RAPL reading strategy is available on this machine
 func (r *PerfEventReader) Available() bool {
-	return FileExists(perfEventPowerPath)
+	return r.Diagnose().Usable()
 }
 
+// Diagnose reports whether the power pmu is exposed and whether system-wide events may be opened by this process,
+// which requires a perf_event_paranoid of 0 or less, or CAP_PERFMON (CAP_SYS_ADMIN before Linux 5.8)
+func (r *PerfEventReader) Diagnose() Diagnosis {
+	d := newDiagnosis()
+	d.Implemented = true
+	d.Present = FileExists(perfEventPowerPath)
+	if !d.Present {
+		d.Reason = "power pmu not found under /sys/bus/event_source/devices"
+		return d
+	}
+
+	privileged := HasCapability(CAP_PERFMON) || HasCapability(CAP_SYS_ADMIN)
+	switch {
+	case privileged:
+		d.Readable = true
+	case d.PerfEventParanoid == nil:
+		d.MissingCapability = "CAP_PERFMON"
+		d.Reason = "failed to read kernel.perf_event_paranoid"
+	case *d.PerfEventParanoid > perfEventMaxParanoidity:
+		d.MissingCapability = "CAP_PERFMON"
+		d.Reason = fmt.Sprintf("kernel.perf_event_paranoid is %d, system-wide events require %d or less", *d.PerfEventParanoid, perfEventMaxParanoidity)
+	default:
+		d.Readable = true
+	}
+
+	if d.Readable {
+		counters, err := r.openCounters()
+		if err != nil {
+			d.Readable = false
+			d.Reason = err.Error()
+		} else {
+			r.closeCounters(counters)
+		}
+	}
+
+	return d
+}
+
+//Read a measurement using this reader strategy
 func (r *PerfEventReader) Read() (Measurement, error) {
-	return nil, raplReaderStrategyNotImplemented
+	before, err := r.Measure()
+	if err != nil {
+		return nil, err
+	}
+
+	time.Sleep(1 * time.Second)
+
+	after, err := r.Measure()
+	if err != nil {
+		return nil, err
+	}
+
+	delta := after.DeltaSum(before)
+
+	return delta, nil
+}
+
+// Close releases the perf event file descriptors held by this reader
+func (r *PerfEventReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closeCounters(r.counters)
+	r.counters = nil
+
+	return nil
+}
+
+//Measure reads the power event counters of every package, in joules
+func (r *PerfEventReader) Measure() (Measurement, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.counters == nil {
+		counters, err := r.openCounters()
+		if err != nil {
+			return nil, err
+		}
+
+		r.counters = counters
+	}
+
+	measurement := Measurement{}
+
+	for pkg, counters := range r.counters {
+		energy := Energy{}
+
+		for _, counter := range counters {
+			value, err := r.read(counter.fd)
+			if err != nil {
+				return nil, err
+			}
+
+			energy.Set(counter.domain, float64(value)*counter.scale)
+		}
+
+		measurement[pkg] = map[int]Energy{0: energy}
+	}
+
+	return measurement, nil
+}
+
+// energyUnits reports the scale of the package and dram events of every package
+func (r *PerfEventReader) energyUnits() (map[int64]Units, error) {
+	if _, err := r.Measure(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pkgUnits := make(map[int64]Units)
+	for pkg, counters := range r.counters {
+		unit := Units{}
+		for _, counter := range counters {
+			switch counter.domain {
+			case DomainPkg:
+				unit.CpuEnergy = counter.scale
+			case DomainDRAM:
+				unit.DramEnergy = counter.scale
+			}
+		}
+
+		pkgUnits[pkg] = unit
+	}
+
+	return pkgUnits, nil
 }
 
-func (r *PerfEventReader) measure() (Measurement, error) {
-	return nil, raplReaderStrategyNotImplemented
+// openCounters opens every power event the pmu exposes, once per package
+func (r *PerfEventReader) openCounters() (map[int64][]perfEventCounter, error) {
+	pmuType, err := ReadUintFromFile(perfEventPowerPath)
+	if err != nil {
+		return nil, err
+	}
+
+	cpus, err := r.packageCpus()
+	if err != nil {
+		return nil, err
+	}
+
+	counters := make(map[int64][]perfEventCounter)
+
+	for pkg, cpu := range cpus {
+		for _, event := range raplDomains {
+			attr, err := r.parseEvent(event)
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+
+				r.closeCounters(counters)
+				return nil, err
+			}
+
+			config, err := r.parseConfig(attr.event)
+			if err != nil {
+				r.closeCounters(counters)
+				return nil, err
+			}
+
+			fd, err := r.open(uint32(pmuType), config, cpu)
+			if err != nil {
+				r.closeCounters(counters)
+				return nil, fmt.Errorf("perf_event_open %s on cpu %d failed: %w", event, cpu, err)
+			}
+
+			counters[pkg] = append(counters[pkg], perfEventCounter{fd: fd, domain: perfEventDomains[event], scale: attr.scale})
+		}
+	}
+
+	if len(counters) == 0 {
+		return nil, errors.New("no power events found")
+	}
+
+	return counters, nil
+}
+
+func (r *PerfEventReader) closeCounters(counters map[int64][]perfEventCounter) {
+	for _, pkgCounters := range counters {
+		for _, counter := range pkgCounters {
+			err := syscall.Close(counter.fd)
+			if err != nil {
+				klog.Errorf("closing perf event fd %d failed", counter.fd)
+			}
+		}
+	}
+}
+
+// packageCpus maps every package to the cpu the power pmu expects its events to be opened on
+func (r *PerfEventReader) packageCpus() (map[int64]int, error) {
+	mask, err := ReadStringFromFile(perfEventPowerCpuMaskPath)
+	if err != nil {
+		return nil, err
+	}
+
+	corePackages := CorePackages(Cpus)
+
+	cpus := make(map[int64]int)
+	for _, field := range strings.Split(mask, ",") {
+		// the cpumask is a list of single cpus or ranges, one cpu per package is enough
+		id, err := strconv.Atoi(strings.SplitN(field, "-", 2)[0])
+		if err != nil {
+			return nil, err
+		}
+
+		pkg, exists := corePackages[id]
+		if !exists || pkg < 0 {
+			pkg = 0
+		}
+
+		if _, exists := cpus[pkg]; !exists {
+			cpus[pkg] = id
+		}
+	}
+
+	return cpus, nil
+}
+
+func (r *PerfEventReader) parseEvent(event string) (PerfEventAttr, error) {
+	attr := PerfEventAttr{}
+
+	config, err := ReadStringFromFile(fmt.Sprintf(perfEventPowerEventsPath, event))
+	if err != nil {
+		return attr, err
+	}
+	attr.event = config
+
+	scale, err := ReadStringFromFile(fmt.Sprintf(perfEventPowerEventsScalePath, event))
+	if err != nil {
+		return attr, err
+	}
+
+	attr.scale, err = strconv.ParseFloat(scale, 64)
+	if err != nil {
+		return attr, err
+	}
+
+	attr.unit, err = ReadStringFromFile(fmt.Sprintf(perfEventPowerEventsUnitPath, event))
+	if err != nil {
+		return attr, err
+	}
+
+	return attr, nil
+}
+
+// parseConfig parses an event description like "event=0x02" into the config of perf_event_attr
+func (r *PerfEventReader) parseConfig(event string) (uint64, error) {
+	for _, term := range strings.Split(event, ",") {
+		key, value, found := strings.Cut(term, "=")
+		if found && key == "event" {
+			return strconv.ParseUint(value, 0, 64)
+		}
+	}
+
+	return 0, fmt.Errorf("failed to parse power event: %s", event)
+}
+
+func (r *PerfEventReader) open(pmuType uint32, config uint64, cpu int) (int, error) {
+	attr := perfEventAttr{
+		Type:   pmuType,
+		Size:   perfAttrSizeVer0,
+		Config: config,
+	}
+
+	pid := -1
+	groupFd := -1
+
+	fd, _, errno := syscall.Syscall6(
+		syscall.SYS_PERF_EVENT_OPEN,
+		uintptr(unsafe.Pointer(&attr)),
+		uintptr(pid),
+		uintptr(cpu),
+		uintptr(groupFd),
+		uintptr(perfFlagFdCloexec),
+		0,
+	)
+	if errno != 0 {
+		return -1, errno
+	}
+
+	return int(fd), nil
+}
+
+func (r *PerfEventReader) read(fd int) (uint64, error) {
+	var value uint64
+	buffer := make([]byte, unsafe.Sizeof(value))
+
+	bytes, err := syscall.Read(fd, buffer)
+	if err != nil {
+		return 0, err
+	}
+
+	if bytes != len(buffer) {
+		return 0, fmt.Errorf("failed to read the perf event counter correct: %d", bytes)
+	}
+
+	byteOrder, err := GetEndianness()
+	if err != nil {
+		return 0, err
+	}
+
+	return byteOrder.Uint64(buffer), nil
 }
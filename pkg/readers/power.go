@@ -8,15 +8,6 @@ import (
 	"k8s.io/klog/v2"
 )
 
-type RaplReaderStrategy int
-
-const (
-	firstAvailable RaplReaderStrategy = iota
-	sysfs                             // Reading the files under /sys/class/sysfs/intel-rapl/intel-rapl:0 using the sysfs interface. This requires no special permissions, and was introduced in Linux 3.13
-	perf_event                        // Using the perf_event interface with Linux 3.14 or newer. This requires root or a paranoid less than 1 (as do all system wide measurements with -a) sudo perf stat -a -e "power/energy-cores/" /bin/ls Available events can be found via perf list or under/sys/bus/event_source/devices/power/events/
-	msr                               // Using raw-access to the underlying MSRs under /dev/msr. This requires root.
-)
-
 var (
 	Cpus                             map[int]*Cpu
 	raplReaderStrategyNotImplemented error = errors.New("rapl reader strategy not implemented yet")
@@ -49,47 +40,93 @@ func init() {
 	}
 }
 
+// RaplReader reads the RAPL energy counters. Read measures the energy consumed over a second, Measure reads the raw,
+// monotonic counters once, in joules, which is what the Sampler builds on. Implementations outside this package, e.g.
+// the fake of readerstest, may additionally implement EnergyRanger and Timestamper
 type RaplReader interface {
 	Available() bool
+	Diagnose() Diagnosis
 	Read() (Measurement, error)
-	measure() (Measurement, error)
+	Measure() (Measurement, error)
 }
 
-func NewRaplReader(forceRaplReaderStrategyIfAvailable RaplReaderStrategy) (RaplReader, error) {
-	sysfsRaplReader := &Sysfs{}
-	perfEventReader := &PerfEventReader{}
-	msrReader := &MsrReader{}
+// TopologyReporter is implemented by the readers measuring another topology than the detected Cpus of this machine,
+// e.g. a ReplayReader reports the recorded one
+type TopologyReporter interface {
+	Cpus() map[int]*Cpu
+}
 
-	switch forceRaplReaderStrategyIfAvailable {
-	case sysfs:
-		if sysfsRaplReader.Available() {
-			return sysfsRaplReader, nil
-		}
-	case perf_event:
-		if perfEventReader.Available() {
-			return perfEventReader, nil
+// TopologyOf returns the topology the measurements of reader describe, the detected Cpus unless it is a TopologyReporter
+func TopologyOf(reader RaplReader) map[int]*Cpu {
+	if reporter, ok := reader.(TopologyReporter); ok {
+		return reporter.Cpus()
+	}
+
+	return Cpus
+}
+
+// counterKeeper is implemented by the readers whose counters are kept by the hardware, instead of by the process
+type counterKeeper interface {
+	HardwareCounters() bool
+}
+
+// HasHardwareCounters reports whether the counters of the reader outlive the process, so that the counters read by two
+// processes can be compared. The perf events and the model count from zero every time they are opened
+func HasHardwareCounters(reader RaplReader) bool {
+	k, ok := reader.(counterKeeper)
+	return ok && k.HardwareCounters()
+}
+
+// NewRaplReader returns a reader for the first usable strategy in the given order of preference. StrategyAuto, or no
+// strategy at all, expands to DefaultRaplReaderStrategies. When only forced strategies are given and none of them is
+// usable an error explaining why each one was skipped is returned, instead of falling through to another strategy
+func NewRaplReader(strategies ...RaplReaderStrategy) (RaplReader, error) {
+	if len(strategies) == 0 {
+		strategies = []RaplReaderStrategy{StrategyAuto}
+	}
+
+	var skipped []string
+	diagnosed := make(map[RaplReaderStrategy]bool)
+
+	for _, strategy := range expandRaplReaderStrategies(strategies) {
+		if diagnosed[strategy] {
+			continue
 		}
-	case msr:
-		if msrReader.Available() {
-			return msrReader, nil
+		diagnosed[strategy] = true
+
+		raplReader, err := newRaplReaderOf(strategy)
+		if err != nil {
+			return nil, err
 		}
-	case firstAvailable:
-		if sysfsRaplReader.Available() {
-			return sysfsRaplReader, nil
-		} else if perfEventReader.Available() {
-			return perfEventReader, nil
-		} else if msrReader.Available() {
-			return msrReader, nil
+
+		diagnosis := raplReader.Diagnose()
+		if diagnosis.Usable() {
+			klog.V(5).Infof("selected rapl reader strategy %s %s", strategy, diagnosis)
+			return raplReader, nil
 		}
+
+		klog.V(5).Infof("skipped rapl reader strategy %s %s", strategy, diagnosis)
+		skipped = append(skipped, fmt.Sprintf("%s: %s", strategy, diagnosis.Reason))
 	}
 
-	if sysfsRaplReader.Available() {
-		return sysfsRaplReader, nil
-	} else if perfEventReader.Available() {
-		return perfEventReader, nil
-	} else if msrReader.Available() {
-		return msrReader, nil
+	if !diagnosed[StrategyModel] {
+		return nil, fmt.Errorf("no available rapl reader strategy (%s), add the %s strategy, e.g. %s,%s, to estimate the energy instead", strings.Join(skipped, "; "), StrategyModel, StrategyAuto, StrategyModel)
 	}
 
-	return nil, fmt.Errorf("no available rapl reader strategy")
+	return nil, fmt.Errorf("no available rapl reader strategy (%s)", strings.Join(skipped, "; "))
+}
+
+func newRaplReaderOf(strategy RaplReaderStrategy) (RaplReader, error) {
+	switch strategy {
+	case StrategySysfs:
+		return &Sysfs{}, nil
+	case StrategyPerfEvent:
+		return &PerfEventReader{}, nil
+	case StrategyMsr:
+		return &MsrReader{}, nil
+	case StrategyModel:
+		return &ModelReader{}, nil
+	default:
+		return nil, fmt.Errorf("unknown rapl reader strategy: %d", strategy)
+	}
 }
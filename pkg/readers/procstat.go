@@ -0,0 +1,126 @@
+package readers
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// CpuTime holds the time a cpu spent in each state, in USER_HZ ticks as reported by /proc/stat
+type CpuTime struct {
+	User, Nice, System, Idle, IOWait, IRQ, SoftIRQ, Steal uint64
+}
+
+// Total returns the ticks spent in every state
+func (c CpuTime) Total() uint64 {
+	return c.User + c.Nice + c.System + c.Idle + c.IOWait + c.IRQ + c.SoftIRQ + c.Steal
+}
+
+// Busy returns the ticks the cpu spent running, neither idle, waiting for i/o nor stolen by the hypervisor, which
+// runs another guest meanwhile. Guest time is already part of user
+func (c CpuTime) Busy() uint64 {
+	return c.User + c.Nice + c.System + c.IRQ + c.SoftIRQ
+}
+
+// Utilization returns the busy ratio of the ticks, e.g. of the delta of two readings, zero without ticks
+func (c CpuTime) Utilization() float64 {
+	if c.Total() == 0 {
+		return 0
+	}
+
+	return float64(c.Busy()) / float64(c.Total())
+}
+
+// Sub returns the ticks spent between c2 and c, counters that went backwards count as zero
+func (c CpuTime) Sub(c2 CpuTime) CpuTime {
+	return CpuTime{
+		User:    subTicks(c.User, c2.User),
+		Nice:    subTicks(c.Nice, c2.Nice),
+		System:  subTicks(c.System, c2.System),
+		Idle:    subTicks(c.Idle, c2.Idle),
+		IOWait:  subTicks(c.IOWait, c2.IOWait),
+		IRQ:     subTicks(c.IRQ, c2.IRQ),
+		SoftIRQ: subTicks(c.SoftIRQ, c2.SoftIRQ),
+		Steal:   subTicks(c.Steal, c2.Steal),
+	}
+}
+
+// Add returns the ticks of c and c2 together, e.g. of the cpus of a package
+func (c CpuTime) Add(c2 CpuTime) CpuTime {
+	return CpuTime{
+		User:    c.User + c2.User,
+		Nice:    c.Nice + c2.Nice,
+		System:  c.System + c2.System,
+		Idle:    c.Idle + c2.Idle,
+		IOWait:  c.IOWait + c2.IOWait,
+		IRQ:     c.IRQ + c2.IRQ,
+		SoftIRQ: c.SoftIRQ + c2.SoftIRQ,
+		Steal:   c.Steal + c2.Steal,
+	}
+}
+
+// ReadCpuTimes parses the per cpu lines of a procfs stat file, the aggregated "cpu" line is skipped. The states older
+// kernels do not report count as zero
+func ReadCpuTimes(path string) (map[int]CpuTime, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			klog.Errorln(err)
+		}
+	}(file)
+
+	cpus := make(map[int]CpuTime)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "cpu") || fields[0] == "cpu" {
+			continue
+		}
+
+		id, err := strconv.Atoi(fields[0][3:])
+		if err != nil {
+			return nil, err
+		}
+
+		// user nice system idle iowait irq softirq steal, followed by guest and guest_nice
+		end := len(fields)
+		if end > 9 {
+			end = 9
+		}
+
+		values, err := ParseUint64s(fields[1:end])
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, make([]uint64, 8-len(values))...)
+
+		cpus[id] = CpuTime{
+			User:    values[0],
+			Nice:    values[1],
+			System:  values[2],
+			Idle:    values[3],
+			IOWait:  values[4],
+			IRQ:     values[5],
+			SoftIRQ: values[6],
+			Steal:   values[7],
+		}
+	}
+
+	return cpus, scanner.Err()
+}
+
+func subTicks(a, b uint64) uint64 {
+	if a < b {
+		return 0
+	}
+
+	return a - b
+}
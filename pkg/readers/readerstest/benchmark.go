@@ -0,0 +1,50 @@
+package readerstest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+// ReportEnergy runs fn, which loops b.N times like a benchmark body, measures it with readers.MeasureFunc and reports
+// the package joules per operation ("J/op"), the dram joules per operation when the reader measures dram
+// ("dram-J/op") and the average package power ("W") as custom benchmark metrics:
+//
+//	func BenchmarkEncode(b *testing.B) {
+//		reader, err := readers.NewRaplReader()
+//		if err != nil {
+//			b.Skip(err)
+//		}
+//
+//		readerstest.ReportEnergy(b, reader, func(b *testing.B) {
+//			for i := 0; i < b.N; i++ {
+//				encode()
+//			}
+//		})
+//	}
+func ReportEnergy(b *testing.B, reader readers.RaplReader, fn func(b *testing.B)) {
+	b.Helper()
+
+	b.ResetTimer()
+	measured, err := readers.MeasureFunc(context.Background(), reader, func() error {
+		fn(b)
+		return nil
+	})
+	b.StopTimer()
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	if b.N <= 0 {
+		return
+	}
+
+	total := measured.Total()
+	b.ReportMetric(total.Pkg/float64(b.N), "J/op")
+	if total.DRAM > 0 {
+		b.ReportMetric(total.DRAM/float64(b.N), "dram-J/op")
+	}
+	b.ReportMetric(measured.Power().Pkg, "W")
+}
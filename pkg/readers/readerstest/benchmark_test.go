@@ -0,0 +1,40 @@
+package readerstest
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+// BenchmarkReportEnergy is the example of ReportEnergy, measuring a loop with a fake drawing 50 W of package and 5 W
+// of dram power
+func BenchmarkReportEnergy(b *testing.B) {
+	reader := NewReader(map[int64]readers.Power{0: {Pkg: 50, DRAM: 5}})
+
+	ReportEnergy(b, reader, func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = strings.Repeat("rapl", 16)
+		}
+	})
+}
+
+// TestReportEnergy runs the example benchmark on every go test, not only with -bench
+func TestReportEnergy(t *testing.T) {
+	result := testing.Benchmark(BenchmarkReportEnergy)
+	if result.N == 0 {
+		t.Fatal("the benchmark did not run")
+	}
+
+	// every Measure of the fake advances its clock by a second, whatever the number of iterations
+	if watts := result.Extra["W"]; math.Abs(watts-50) > 1e-6 {
+		t.Errorf("got %v W, want 50 W", watts)
+	}
+	if joules := result.Extra["J/op"] * float64(result.N); joules < 50-1e-6 {
+		t.Errorf("got %v J over %d iterations, want at least one second of 50 W", joules, result.N)
+	}
+	if _, exists := result.Extra["dram-J/op"]; !exists {
+		t.Errorf("got metrics %v, want dram-J/op", result.Extra)
+	}
+}
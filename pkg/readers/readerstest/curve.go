@@ -0,0 +1,65 @@
+package readerstest
+
+import (
+	"math"
+	"time"
+)
+
+// Curve is a power curve, the power in watts drawn at the given offset from the start of the fake
+type Curve func(at time.Duration) float64
+
+// Constant draws the same power all the time
+func Constant(watts float64) Curve {
+	return func(time.Duration) float64 {
+		return watts
+	}
+}
+
+// Ramp draws from watts at the start, rising or falling linearly to watts to over the given duration, then stays
+func Ramp(from float64, to float64, over time.Duration) Curve {
+	return func(at time.Duration) float64 {
+		if over <= 0 || at >= over {
+			return to
+		}
+
+		return from + (to-from)*float64(at)/float64(over)
+	}
+}
+
+// Square alternates between low and high watts, spending half of every period on each, starting low
+func Square(low float64, high float64, period time.Duration) Curve {
+	return func(at time.Duration) float64 {
+		if period <= 0 || at%period < period/2 {
+			return low
+		}
+
+		return high
+	}
+}
+
+// Sine oscillates around mean watts by amplitude watts with the given period
+func Sine(mean float64, amplitude float64, period time.Duration) Curve {
+	return func(at time.Duration) float64 {
+		if period <= 0 {
+			return mean
+		}
+
+		return mean + amplitude*math.Sin(2*math.Pi*float64(at)/float64(period))
+	}
+}
+
+// Steps draws the watts of the last step that started at or before the offset, zero before the first step
+func Steps(steps map[time.Duration]float64) Curve {
+	return func(at time.Duration) float64 {
+		var start time.Duration = -1
+		watts := 0.0
+		for offset, w := range steps {
+			if offset <= at && offset > start {
+				start = offset
+				watts = w
+			}
+		}
+
+		return watts
+	}
+}
@@ -0,0 +1,354 @@
+// Package readerstest provides a scriptable fake readers.RaplReader, for testing code that consumes energy
+// measurements without rapl hardware
+package readerstest
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+// DefaultStep is how far the virtual clock of a Reader advances on every Measure, unless configured otherwise
+const DefaultStep = 1 * time.Second
+
+// integrationSteps is the number of points a curve is evaluated at per step of the virtual clock
+const integrationSteps = 10
+
+// DefaultStart is the virtual time of the first Measure of a Reader, unless configured otherwise
+var DefaultStart = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Reader is a fake readers.RaplReader driven by a virtual clock. Every call of Measure, but the first, advances the
+// clock by Step and integrates the power curves of every package and domain over it into the counters, which wrap
+// around at Ranges like the hardware ones do. The fake implements readers.EnergyRanger, readers.Timestamper and
+// readers.TopologyReporter, so a readers.Sampler over it produces the same samples on every run. A Reader must not be
+// copied after first use
+type Reader struct {
+	// Power holds the constant power of every package in watts per domain, domains without power draw nothing
+	Power map[int64]readers.Power
+	// Curves holds power curves overriding Power, per package and domain
+	Curves map[int64]map[readers.Domain]Curve
+	// Noise is the standard deviation of the gaussian noise added to the power of every domain, in watts
+	Noise float64
+	// Seed seeds the noise, runs with the same seed draw the same noise
+	Seed int64
+	// Ranges holds the value the counters of every package wrap around at, zero for counters that never wrap
+	Ranges map[int64]readers.Energy
+	// Initial holds the value of the counters at the start, e.g. close to the range to force an early wrap
+	Initial map[int64]readers.Energy
+	// Errors holds the error to fail the n-th (counting from 0) call of Measure with
+	Errors map[int]error
+	// Start is the virtual time of the first Measure, DefaultStart if zero
+	Start time.Time
+	// Step is how far the virtual clock advances on every Measure, DefaultStep if zero
+	Step time.Duration
+	// Topology is the reported cpu topology, a single package 0 of one core if nil, see NewTopology
+	Topology map[int]*readers.Cpu
+	// Diagnosis is reported by Diagnose, a usable diagnosis if zero
+	Diagnosis *readers.Diagnosis
+	// IsEstimated is reported by Estimated
+	IsEstimated bool
+
+	mu       sync.Mutex
+	rng      *rand.Rand
+	calls    int
+	started  bool
+	offset   time.Duration
+	pkgIds   []int64
+	totals   map[int64]readers.Energy
+	counters map[int64]readers.Energy
+}
+
+// NewReader creates a fake reader drawing constant power per package
+func NewReader(power map[int64]readers.Power) *Reader {
+	return &Reader{Power: power}
+}
+
+// NewTopology creates the topology of an intel machine with the given number of sockets, one package each, and
+// logical cores per socket, numbered consecutively
+func NewTopology(sockets int, coresPerSocket int) map[int]*readers.Cpu {
+	cpus := make(map[int]*readers.Cpu, sockets)
+	for socket := 0; socket < sockets; socket++ {
+		cpu := &readers.Cpu{
+			PhysicalId: socket,
+			Vendor:     readers.Intel,
+			Model:      readers.Model{Id: 85, Name: "Fake CPU", InternalName: readers.CpuModels[85]},
+			Family:     readers.IntelMinimumSupportedCpuFamily,
+			Packages:   map[int64]bool{int64(socket): true},
+			ByteOrder:  binary.LittleEndian,
+		}
+
+		for core := 0; core < coresPerSocket; core++ {
+			cpu.Cores = append(cpu.Cores, readers.Core{Id: socket*coresPerSocket + core, Package: int64(socket)})
+		}
+
+		cpus[socket] = cpu
+	}
+
+	return cpus
+}
+
+// Available reports whether Diagnose is usable
+func (r *Reader) Available() bool {
+	return r.Diagnose().Usable()
+}
+
+// Diagnose reports the configured diagnosis, a usable one by default
+func (r *Reader) Diagnose() readers.Diagnosis {
+	if r.Diagnosis != nil {
+		return *r.Diagnosis
+	}
+
+	return readers.Diagnosis{Present: true, Readable: true, Implemented: true}
+}
+
+// Estimated reports IsEstimated
+func (r *Reader) Estimated() bool {
+	return r.IsEstimated
+}
+
+// Read measures twice, advancing the virtual clock in between instead of sleeping
+func (r *Reader) Read() (readers.Measurement, error) {
+	before, err := r.Measure()
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := r.Measure()
+	if err != nil {
+		return nil, err
+	}
+
+	return after.DeltaSum(before), nil
+}
+
+// Measure advances the virtual clock by one step and reports the counters, or the injected error for this call. The
+// clock advances on failed calls too
+func (r *Reader) Measure() (readers.Measurement, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	call := r.calls
+	r.calls++
+
+	if !r.started {
+		r.start()
+	} else {
+		r.advance(r.step())
+	}
+
+	if err, exists := r.Errors[call]; exists && err != nil {
+		return nil, err
+	}
+
+	measurement := readers.Measurement{}
+	cores := r.packageCores()
+	for pkgId, counters := range r.counters {
+		measurement[pkgId] = map[int]readers.Energy{cores[pkgId]: counters}
+	}
+
+	return measurement, nil
+}
+
+// EnergyRanges reports the configured Ranges
+func (r *Reader) EnergyRanges() (map[int64]readers.Energy, error) {
+	ranges := make(map[int64]readers.Energy, len(r.Ranges))
+	for pkgId, energy := range r.Ranges {
+		ranges[pkgId] = energy
+	}
+
+	return ranges, nil
+}
+
+// MeasuredAt returns the virtual time of the last Measure
+func (r *Reader) MeasuredAt() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.now()
+}
+
+// Now returns the current virtual time
+func (r *Reader) Now() time.Time {
+	return r.MeasuredAt()
+}
+
+// Advance moves the virtual clock forward without reading, the energy drawn meanwhile shows on the next Measure
+func (r *Reader) Advance(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.started {
+		r.start()
+	}
+
+	r.advance(d)
+}
+
+// Calls returns how often Measure was called
+func (r *Reader) Calls() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.calls
+}
+
+// Totals returns the energy drawn since the start per package, without wraps, the ground truth to compare a
+// sampler with
+func (r *Reader) Totals() map[int64]readers.Energy {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	totals := make(map[int64]readers.Energy, len(r.totals))
+	for pkgId, energy := range r.totals {
+		totals[pkgId] = energy
+	}
+
+	return totals
+}
+
+// Strategy names the fake "fake" in output headers, recordings and ledgers, see readers.StrategyName
+func (r *Reader) Strategy() string {
+	return "fake"
+}
+
+// Cpus returns the topology the fake reports. The fake is a readers.TopologyReporter, so readers.TopologyOf, which the
+// commands and the agent pass on to the metrics, outputs and sinks, returns it instead of the detected readers.Cpus
+func (r *Reader) Cpus() map[int]*readers.Cpu {
+	if r.Topology == nil {
+		return NewTopology(1, 1)
+	}
+
+	return r.Topology
+}
+
+func (r *Reader) start() {
+	r.started = true
+	r.rng = rand.New(rand.NewSource(r.Seed))
+	r.totals = make(map[int64]readers.Energy)
+	r.counters = make(map[int64]readers.Energy)
+
+	r.pkgIds = r.packageIds()
+	for _, pkgId := range r.pkgIds {
+		r.totals[pkgId] = readers.Energy{}
+		r.counters[pkgId] = r.wrap(pkgId, r.Initial[pkgId])
+	}
+}
+
+// advance integrates the power of every domain over d with the midpoint rule
+func (r *Reader) advance(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	dt := d / integrationSteps
+	for i := 0; i < integrationSteps; i++ {
+		at := r.offset + dt*time.Duration(i) + dt/2
+		seconds := dt.Seconds()
+		if i == integrationSteps-1 {
+			// the rounding of dt is charged to the last point
+			seconds = (d - dt*(integrationSteps-1)).Seconds()
+		}
+
+		for _, pkgId := range r.pkgIds {
+			drawn := readers.Energy{}
+			for _, domain := range readers.Domains {
+				watts := r.watts(pkgId, domain, at)
+				// idle domains stay silent, so the noise does not invent domains the fake does not draw
+				if r.Noise > 0 && watts != 0 {
+					watts += r.rng.NormFloat64() * r.Noise
+				}
+
+				drawn.Set(domain, math.Max(watts, 0)*seconds)
+			}
+
+			r.totals[pkgId] = r.totals[pkgId].Add(drawn)
+			r.counters[pkgId] = r.wrap(pkgId, r.counters[pkgId].Add(drawn))
+		}
+	}
+
+	r.offset += d
+}
+
+func (r *Reader) watts(pkgId int64, domain readers.Domain, at time.Duration) float64 {
+	if curve, exists := r.Curves[pkgId][domain]; exists && curve != nil {
+		return curve(at)
+	}
+
+	return readers.Energy(r.Power[pkgId]).Get(domain)
+}
+
+func (r *Reader) wrap(pkgId int64, counters readers.Energy) readers.Energy {
+	limits := r.Ranges[pkgId]
+	for _, domain := range readers.Domains {
+		limit := limits.Get(domain)
+		if limit > 0 {
+			counters.Set(domain, math.Mod(counters.Get(domain), limit))
+		}
+	}
+
+	return counters
+}
+
+func (r *Reader) step() time.Duration {
+	if r.Step == 0 {
+		return DefaultStep
+	}
+
+	return r.Step
+}
+
+func (r *Reader) now() time.Time {
+	start := r.Start
+	if start.IsZero() {
+		start = DefaultStart
+	}
+
+	return start.Add(r.offset)
+}
+
+// packageIds returns every package of the topology, the power and the curves in ascending order, which keeps the
+// noise drawn for each of them stable
+func (r *Reader) packageIds() []int64 {
+	seen := make(map[int64]bool)
+	var pkgIds []int64
+	add := func(pkgId int64) {
+		if !seen[pkgId] {
+			seen[pkgId] = true
+			pkgIds = append(pkgIds, pkgId)
+		}
+	}
+
+	for _, cpu := range r.Cpus() {
+		for pkgId := range cpu.Packages {
+			add(pkgId)
+		}
+	}
+	for pkgId := range r.Power {
+		add(pkgId)
+	}
+	for pkgId := range r.Curves {
+		add(pkgId)
+	}
+	sort.Slice(pkgIds, func(i, j int) bool { return pkgIds[i] < pkgIds[j] })
+
+	return pkgIds
+}
+
+// packageCores returns the lowest core of every package, the one the measurements are reported on
+func (r *Reader) packageCores() map[int64]int {
+	cores := make(map[int64]int)
+	for _, cpu := range r.Cpus() {
+		for _, core := range cpu.Cores {
+			if lowest, exists := cores[core.Package]; !exists || core.Id < lowest {
+				cores[core.Package] = core.Id
+			}
+		}
+	}
+
+	return cores
+}
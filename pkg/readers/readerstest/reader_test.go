@@ -0,0 +1,57 @@
+package readerstest
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+func TestSamplerCorrectsFakeWraps(t *testing.T) {
+	reader := &Reader{
+		Power:    map[int64]readers.Power{0: {Pkg: 50, DRAM: 5}, 1: {Pkg: 30}},
+		Ranges:   map[int64]readers.Energy{0: {Pkg: 120, DRAM: 120}, 1: {Pkg: 120}},
+		Initial:  map[int64]readers.Energy{0: {Pkg: 100}},
+		Errors:   map[int]error{4: errors.New("injected")},
+		Topology: NewTopology(2, 4),
+	}
+
+	sampler := readers.NewSampler(reader, time.Second)
+	for i := 0; i < 10; i++ {
+		_, _ = sampler.Sample()
+	}
+
+	// the package 0 counter wrapped several times, the injected error lost the energy of two steps
+	totals := sampler.Totals()
+	want := reader.Totals()
+	if math.Abs(totals[0].Pkg-(want[0].Pkg-2*50)) > 1e-6 || math.Abs(totals[1].Pkg-(want[1].Pkg-2*30)) > 1e-6 {
+		t.Errorf("got sampler totals %+v, want the fake totals %+v less two steps", totals, want)
+	}
+
+	sample := sampler.Last()
+	if sample.Interval != time.Second || !sample.Time.Equal(DefaultStart.Add(9*time.Second)) {
+		t.Errorf("got sample at %s over %s, want the virtual clock", sample.Time, sample.Interval)
+	}
+	if math.Abs(sample.Energy[0].Pkg-50) > 1e-6 || math.Abs(sample.Energy[0].DRAM-5) > 1e-6 {
+		t.Errorf("got %+v, want 50 J package and 5 J dram", sample.Energy[0])
+	}
+}
+
+func TestTopologyOfFake(t *testing.T) {
+	reader := &Reader{Topology: NewTopology(2, 4)}
+
+	cpus := readers.TopologyOf(reader)
+	if len(cpus) != 2 || len(cpus[1].Cores) != 4 || cpus[1].Cores[0].Id != 4 {
+		t.Errorf("got topology %+v, want the one of the fake", cpus)
+	}
+
+	measurement, err := reader.Measure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := measurement[1][4]; !exists {
+		t.Errorf("got measurement %+v, want package 1 on core 4", measurement)
+	}
+}
@@ -0,0 +1,434 @@
+package readers
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// RecordingVersion is the version of the recording format written by a Recorder. Version 1 recordings, which hold the
+// joules instead of the raw counters, are still played back
+const RecordingVersion = 2
+
+// energyUniter is implemented by the readers that know the resolution of their counters
+type energyUniter interface {
+	energyUnits() (map[int64]Units, error)
+}
+
+// RecordingHeader describes the machine and the reader a recording was taken with
+type RecordingHeader struct {
+	Version   int
+	Created   time.Time
+	Hostname  string
+	Strategy  string
+	Estimated bool
+	// Cpus is the detected topology, without the byte order which is restored from the replaying machine
+	Cpus map[int]Cpu
+	// Units holds the resolution of the counters per package, when the reader reports it
+	Units map[int64]Units
+	// Ranges holds the value the counters wrap around at per package, when the reader reports it
+	Ranges map[int64]Energy
+}
+
+// Counters holds the raw values of the counters of every domain, in the units of the reader
+type Counters struct {
+	Pkg, PP0, PP1, DRAM, PSys uint64
+}
+
+// Get returns the counter of the given domain
+func (c Counters) Get(d Domain) uint64 {
+	switch d {
+	case DomainPkg:
+		return c.Pkg
+	case DomainPP0:
+		return c.PP0
+	case DomainPP1:
+		return c.PP1
+	case DomainDRAM:
+		return c.DRAM
+	case DomainPSys:
+		return c.PSys
+	}
+
+	return 0
+}
+
+// Set sets the counter of the given domain
+func (c *Counters) Set(d Domain, value uint64) {
+	switch d {
+	case DomainPkg:
+		c.Pkg = value
+	case DomainPP0:
+		c.PP0 = value
+	case DomainPP1:
+		c.PP1 = value
+	case DomainDRAM:
+		c.DRAM = value
+	case DomainPSys:
+		c.PSys = value
+	}
+}
+
+// unit returns the joules of one increment of the counter of the given domain
+func (u Units) unit(d Domain) float64 {
+	if d == DomainDRAM {
+		return u.DramEnergy
+	}
+
+	return u.CpuEnergy
+}
+
+// RecordedSnapshot is one raw read of the counters, or the error the read failed with
+type RecordedSnapshot struct {
+	Time time.Time
+	// Counters holds the raw counters per package and core, for the readers reporting the units of their counters
+	Counters map[int64]map[int]Counters
+	// Measurement holds the joules of the readers without counter units, e.g. the model, and of version 1 recordings
+	Measurement Measurement
+	Err         string
+}
+
+// Recorder is a RaplReader that passes every read of the wrapped reader through, writing the raw counters to a gzip
+// compressed gob stream: one RecordingHeader followed by one RecordedSnapshot per read. Wrapping the reader of a
+// Sampler records everything needed to replay the session with a ReplayReader
+type Recorder struct {
+	reader RaplReader
+	units  map[int64]Units
+
+	mu      sync.Mutex
+	file    io.Closer
+	gzip    *gzip.Writer
+	encoder *gob.Encoder
+}
+
+// CreateRecording creates the file at path and starts recording the reads of reader into it
+func CreateRecording(path string, reader RaplReader) (*Recorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	recorder, err := NewRecorder(file, reader)
+	if err != nil {
+		closeErr := file.Close()
+		if closeErr != nil {
+			klog.Errorln(closeErr)
+		}
+
+		return nil, err
+	}
+
+	recorder.file = file
+
+	return recorder, nil
+}
+
+// NewRecorder writes the header of the recording to w and returns a recorder of the reads of reader
+func NewRecorder(w io.Writer, reader RaplReader) (*Recorder, error) {
+	r := &Recorder{reader: reader}
+	r.gzip = gzip.NewWriter(w)
+	r.encoder = gob.NewEncoder(r.gzip)
+
+	header, err := r.header()
+	if err != nil {
+		return nil, err
+	}
+
+	r.units = header.Units
+
+	err = r.encoder.Encode(header)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, r.gzip.Flush()
+}
+
+func (r *Recorder) header() (RecordingHeader, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		klog.Errorln(err)
+	}
+
+	header := RecordingHeader{
+		Version:   RecordingVersion,
+		Created:   time.Now(),
+		Hostname:  hostname,
+		Strategy:  StrategyName(r.reader),
+		Estimated: IsEstimated(r.reader),
+		Cpus:      make(map[int]Cpu),
+	}
+
+	for socket, cpu := range TopologyOf(r.reader) {
+		recorded := *cpu
+		recorded.ByteOrder = nil
+		header.Cpus[socket] = recorded
+	}
+
+	if uniter, ok := r.reader.(energyUniter); ok {
+		header.Units, err = uniter.energyUnits()
+		if err != nil {
+			return header, err
+		}
+	}
+
+	if ranger, ok := r.reader.(EnergyRanger); ok {
+		header.Ranges, err = ranger.EnergyRanges()
+		if err != nil {
+			return header, err
+		}
+	}
+
+	return header, nil
+}
+
+// Available checks if the recorded reader is available on this machine
+func (r *Recorder) Available() bool {
+	return r.reader.Available()
+}
+
+// Diagnose reports the diagnosis of the recorded reader
+func (r *Recorder) Diagnose() Diagnosis {
+	return r.reader.Diagnose()
+}
+
+// Estimated reports whether the recorded reader is estimated
+func (r *Recorder) Estimated() bool {
+	return IsEstimated(r.reader)
+}
+
+// HardwareCounters reports whether the counters of the recorded reader are kept by the hardware
+func (r *Recorder) HardwareCounters() bool {
+	return HasHardwareCounters(r.reader)
+}
+
+// Read a measurement using the recorded reader, recording both underlying reads
+func (r *Recorder) Read() (Measurement, error) {
+	before, err := r.Measure()
+	if err != nil {
+		return nil, err
+	}
+
+	time.Sleep(1 * time.Second)
+
+	after, err := r.Measure()
+	if err != nil {
+		return nil, err
+	}
+
+	delta := after.DeltaSum(before)
+
+	return delta, nil
+}
+
+// Measure reads the wrapped reader and records the counters, or the error the read failed with
+func (r *Recorder) Measure() (Measurement, error) {
+	measurement, err := r.reader.Measure()
+
+	snapshot := RecordedSnapshot{Time: time.Now()}
+	if err != nil {
+		snapshot.Err = err.Error()
+	} else if counters, ok := toCounters(measurement, r.units); ok {
+		snapshot.Counters = counters
+	} else {
+		snapshot.Measurement = measurement
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.encoder != nil {
+		recordErr := r.encoder.Encode(snapshot)
+		if recordErr == nil {
+			recordErr = r.gzip.Flush()
+		}
+
+		if recordErr != nil {
+			klog.Errorf("failed to record the snapshot: %s", recordErr)
+		}
+	}
+
+	return measurement, err
+}
+
+// toCounters converts the joules of a measurement back to the raw counters they were read as, false if the units of a
+// package are unknown. The units are powers of two or, for sysfs, a micro joule, so the counters are restored exactly
+func toCounters(measurement Measurement, units map[int64]Units) (map[int64]map[int]Counters, bool) {
+	counters := make(map[int64]map[int]Counters, len(measurement))
+	for pkgId, cores := range measurement {
+		pkgUnits, exists := units[pkgId]
+		if !exists {
+			return nil, false
+		}
+
+		counters[pkgId] = make(map[int]Counters, len(cores))
+		for coreId, energy := range cores {
+			var raw Counters
+			for _, domain := range Domains {
+				unit := pkgUnits.unit(domain)
+				if unit <= 0 {
+					if energy.Get(domain) != 0 {
+						return nil, false
+					}
+
+					continue
+				}
+
+				raw.Set(domain, uint64(math.Round(energy.Get(domain)/unit)))
+			}
+
+			counters[pkgId][coreId] = raw
+		}
+	}
+
+	return counters, true
+}
+
+// fromCounters converts raw counters to joules with the units of their packages, like the readers do
+func fromCounters(counters map[int64]map[int]Counters, units map[int64]Units) Measurement {
+	measurement := make(Measurement, len(counters))
+	for pkgId, cores := range counters {
+		measurement[pkgId] = make(map[int]Energy, len(cores))
+		for coreId, raw := range cores {
+			var energy Energy
+			for _, domain := range Domains {
+				energy.Set(domain, float64(raw.Get(domain))*units[pkgId].unit(domain))
+			}
+
+			measurement[pkgId][coreId] = energy
+		}
+	}
+
+	return measurement
+}
+
+// Strategy reports the strategy of the wrapped reader
+func (r *Recorder) Strategy() string {
+	return StrategyName(r.reader)
+}
+
+// Cpus reports the topology of the wrapped reader
+func (r *Recorder) Cpus() map[int]*Cpu {
+	return TopologyOf(r.reader)
+}
+
+// EnergyRanges reports the wraparound values of the wrapped reader
+func (r *Recorder) EnergyRanges() (map[int64]Energy, error) {
+	ranger, ok := r.reader.(EnergyRanger)
+	if !ok {
+		return map[int64]Energy{}, nil
+	}
+
+	return ranger.EnergyRanges()
+}
+
+// Close ends the recording, the wrapped reader is left open
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.encoder == nil {
+		return nil
+	}
+	r.encoder = nil
+
+	err := r.gzip.Close()
+	if r.file != nil {
+		closeErr := r.file.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+// Recording is a recording loaded into memory
+type Recording struct {
+	Header    RecordingHeader
+	Snapshots []RecordedSnapshot
+}
+
+// LoadRecording reads the recording at path
+func LoadRecording(path string) (*Recording, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			klog.Errorln(err)
+		}
+	}(file)
+
+	return ParseRecording(file)
+}
+
+// ParseRecording reads a recording written by a Recorder. A truncated recording, e.g. of a process that was killed,
+// is returned up to its last complete snapshot
+func ParseRecording(r io.Reader) (*Recording, error) {
+	reader, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := gob.NewDecoder(reader)
+
+	recording := &Recording{}
+	err = decoder.Decode(&recording.Header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the recording header: %w", err)
+	}
+
+	if recording.Header.Version < 1 || recording.Header.Version > RecordingVersion {
+		return nil, fmt.Errorf("unsupported recording version %d, expected up to %d", recording.Header.Version, RecordingVersion)
+	}
+	recording.Header.Strategy = CanonicalStrategyName(recording.Header.Strategy)
+
+	for {
+		var snapshot RecordedSnapshot
+		err := decoder.Decode(&snapshot)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			klog.V(5).Infof("recording is truncated after %d snapshots", len(recording.Snapshots))
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		recording.Snapshots = append(recording.Snapshots, snapshot)
+	}
+
+	return recording, nil
+}
+
+// Cpus returns the recorded topology, with the byte order of this machine
+func (r *Recording) Cpus() map[int]*Cpu {
+	byteOrder, err := GetEndianness()
+	if err != nil {
+		klog.Errorln(err)
+	}
+
+	cpus := make(map[int]*Cpu, len(r.Header.Cpus))
+	for socket, cpu := range r.Header.Cpus {
+		replayed := cpu
+		replayed.ByteOrder = byteOrder
+		cpus[socket] = &replayed
+	}
+
+	return cpus
+}
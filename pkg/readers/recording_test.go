@@ -0,0 +1,92 @@
+package readers
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestRecordingReplaysRawCountersAndWraps(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, fixtureZone{pkg: 0, energy: 9_000_000, dram: 100, maxRange: 10_000_000})
+
+	var recorded bytes.Buffer
+	recorder, err := NewRecorder(&recorded, &Sysfs{Root: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, energy := range []uint64{9_000_000, 9_500_000, 500_000} {
+		writeFixture(t, root, fixtureZone{pkg: 0, energy: energy, dram: 100, maxRange: 10_000_000})
+		if _, err := recorder.Measure(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	recording, err := ParseRecording(&recorded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recording.Snapshots) != 3 {
+		t.Fatalf("got %d snapshots, want 3", len(recording.Snapshots))
+	}
+	if counters := recording.Snapshots[2].Counters[0][0]; counters.Pkg != 500_000 || counters.DRAM != 100 {
+		t.Errorf("got recorded counters %+v, want the raw micro joules", counters)
+	}
+	if units := recording.Header.Units[0]; units.CpuEnergy != 1e-6 {
+		t.Errorf("got recorded units %+v, want a micro joule", units)
+	}
+
+	replay := &ReplayReader{Recording: recording}
+	if strategy := StrategyName(replay); strategy != "sysfs" {
+		t.Errorf("got strategy %q of the replay, want the recorded sysfs", strategy)
+	}
+
+	sampler := NewSampler(replay, 0)
+	var total float64
+	for i := 0; i < 3; i++ {
+		sample, err := sampler.Sample()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		total += sample.Energy[0].Pkg
+	}
+
+	// 0.5 J, then 1 J across the wrap at 10 J
+	assertJoules(t, "replayed energy", total, 1.5)
+}
+
+func TestCanonicalStrategyName(t *testing.T) {
+	for name, want := range map[string]string{"*readers.Sysfs": "sysfs", "*readers.MsrReader": "msr", "perf": "perf", "fake": "fake"} {
+		if got := CanonicalStrategyName(name); got != want {
+			t.Errorf("CanonicalStrategyName(%q): got %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestSamplerSkipsReplayPolledFasterThanRecorded(t *testing.T) {
+	at := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+	reader := &ReplayReader{Speed: 1, Recording: &Recording{Snapshots: []RecordedSnapshot{
+		{Time: at, Measurement: Measurement{0: {0: {Pkg: 1}}}},
+		{Time: at.Add(time.Hour), Measurement: Measurement{0: {0: {Pkg: 2}}}},
+	}}}
+
+	sampler := NewSampler(reader, time.Second)
+	for i := 0; i < 3; i++ {
+		sample, err := sampler.Sample()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the first snapshot is only due again until an hour passed
+		if !sample.Time.IsZero() {
+			t.Fatalf("got sample %+v of the same snapshot, want none", sample)
+		}
+	}
+}
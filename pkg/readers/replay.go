@@ -0,0 +1,180 @@
+package readers
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// ReplayReader is a RaplReader playing back a Recording, for reproducing bug reports and for running the sampler and
+// the exporters on machines without RAPL. With a Speed of 1 the snapshots are played back at the pace they were
+// recorded at, with a Speed of 10 ten times faster, and so on: every read returns the latest snapshot that is due.
+// With a Speed of 0 every read steps to the next snapshot, which makes the playback deterministic. Once the
+// recording is exhausted reads fail with io.EOF
+type ReplayReader struct {
+	Recording *Recording
+	Speed     float64
+
+	mu         sync.Mutex
+	next       int
+	started    time.Time
+	measuredAt time.Time
+}
+
+// NewReplayReader loads the recording at path for a playback at the given speed
+func NewReplayReader(path string, speed float64) (*ReplayReader, error) {
+	recording, err := LoadRecording(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(recording.Snapshots) == 0 {
+		return nil, errors.New("recording holds no snapshots")
+	}
+
+	return &ReplayReader{Recording: recording, Speed: speed}, nil
+}
+
+// Available checks if there is a recording to play back
+func (r *ReplayReader) Available() bool {
+	return r.Diagnose().Usable()
+}
+
+// Diagnose reports whether the recording holds snapshots that were not played back yet
+func (r *ReplayReader) Diagnose() Diagnosis {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d := newDiagnosis()
+	d.Implemented = true
+	d.Present = r.Recording != nil
+	d.Readable = d.Present && r.next < len(r.Recording.Snapshots)
+
+	switch {
+	case !d.Present:
+		d.Reason = "no recording loaded"
+	case !d.Readable:
+		d.Reason = "recording played back completely"
+	}
+
+	return d
+}
+
+// Estimated reports whether the recording was taken with an estimated reader
+func (r *ReplayReader) Estimated() bool {
+	return r.Recording != nil && r.Recording.Header.Estimated
+}
+
+// Read the energy between the next two due snapshots
+func (r *ReplayReader) Read() (Measurement, error) {
+	before, err := r.Measure()
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Speed > 0 {
+		time.Sleep(time.Duration(float64(time.Second) / r.Speed))
+	}
+
+	after, err := r.Measure()
+	if err != nil {
+		return nil, err
+	}
+
+	delta := after.DeltaSum(before)
+
+	return delta, nil
+}
+
+// MeasuredAt returns the recorded time of the last snapshot played back
+func (r *ReplayReader) MeasuredAt() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.measuredAt
+}
+
+// Rewind restarts the playback from the first snapshot
+func (r *ReplayReader) Rewind() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.next = 0
+	r.started = time.Time{}
+	r.measuredAt = time.Time{}
+}
+
+// Measure plays back the next due snapshot, see ReplayReader for the pacing
+func (r *ReplayReader) Measure() (Measurement, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshots := r.Recording.Snapshots
+	if r.next >= len(snapshots) {
+		return nil, io.EOF
+	}
+
+	index := r.next
+	if r.Speed > 0 {
+		if r.started.IsZero() {
+			r.started = time.Now()
+		}
+
+		// jump to the latest snapshot that is due, the counters are monotonic so skipping loses nothing but wraps.
+		// Until the next snapshot is due the last one is returned again
+		elapsed := time.Duration(float64(time.Since(r.started)) * r.Speed)
+		due := 0
+		for due+1 < len(snapshots) && snapshots[due+1].Time.Sub(snapshots[0].Time) <= elapsed {
+			due++
+		}
+
+		index = due
+		if due < r.next {
+			index = r.next - 1
+		}
+	}
+
+	snapshot := snapshots[index]
+	if index >= r.next {
+		r.next = index + 1
+	}
+	r.measuredAt = snapshot.Time
+
+	if snapshot.Err != "" {
+		return nil, errors.New(snapshot.Err)
+	}
+
+	if snapshot.Counters != nil {
+		return fromCounters(snapshot.Counters, r.Recording.Header.Units), nil
+	}
+
+	return snapshot.Measurement, nil
+}
+
+// Strategy reports the strategy the recording was taken with
+func (r *ReplayReader) Strategy() string {
+	return r.Recording.Header.Strategy
+}
+
+// Cpus reports the recorded topology instead of the one of this machine
+func (r *ReplayReader) Cpus() map[int]*Cpu {
+	return r.Recording.Cpus()
+}
+
+// EnergyRanges reports the wraparound values recorded with the snapshots
+func (r *ReplayReader) EnergyRanges() (map[int64]Energy, error) {
+	if r.Recording.Header.Ranges == nil {
+		return map[int64]Energy{}, nil
+	}
+
+	return r.Recording.Header.Ranges, nil
+}
+
+func (r *ReplayReader) energyUnits() (map[int64]Units, error) {
+	if r.Recording.Header.Units == nil {
+		return map[int64]Units{}, nil
+	}
+
+	return r.Recording.Header.Units, nil
+}
@@ -0,0 +1,357 @@
+package readers
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// EnergyRanger is implemented by the readers whose counters wrap around, it reports the wraparound value per package
+type EnergyRanger interface {
+	EnergyRanges() (map[int64]Energy, error)
+}
+
+// Timestamper is implemented by the readers that know when their last measurement was taken, e.g. a ReplayReader.
+// The sampler uses it instead of the wall clock, which keeps the intervals of replays and fakes deterministic
+type Timestamper interface {
+	MeasuredAt() time.Time
+}
+
+// Sample is the energy consumed during one sampling interval of a Sampler
+type Sample struct {
+	// Time is the end of the interval
+	Time     time.Time
+	Interval time.Duration
+	// Energy holds the joules consumed during the interval, per package
+	Energy map[int64]Energy
+	// Totals holds the joules consumed since the sampler started, per package
+	Totals map[int64]Energy
+	// Counters holds the raw counters read at Time, in joules, per package. They are not wrap corrected
+	Counters map[int64]Energy
+	// Err is set when reading the counters failed, Energy is empty then and Totals carries the last known totals
+	Err error
+}
+
+// Power returns the average power in watts during the interval, per package
+func (s Sample) Power() map[int64]Power {
+	power := make(map[int64]Power)
+	for pkgId, energy := range s.Energy {
+		power[pkgId] = energy.ToWatts(s.Interval)
+	}
+
+	return power
+}
+
+// PackageIds returns the ids of the sampled packages in ascending order
+func (s Sample) PackageIds() []int64 {
+	var pkgIds []int64
+	for pkgId := range s.Totals {
+		pkgIds = append(pkgIds, pkgId)
+	}
+	sort.Slice(pkgIds, func(i, j int) bool { return pkgIds[i] < pkgIds[j] })
+
+	return pkgIds
+}
+
+// Sampler reads the counters of a RaplReader continuously, corrects counter wraparounds and keeps running totals
+type Sampler struct {
+	reader   RaplReader
+	interval time.Duration
+
+	// sampleMu serializes Sample, from the read of the counters to the update of the totals, mu guards the state
+	sampleMu     sync.Mutex
+	mu           sync.RWMutex
+	ranges       map[int64]Energy
+	previous     map[int64]Energy
+	previousTime time.Time
+	totals       map[int64]Energy
+	last         Sample
+	lastAttempt  time.Time
+	subscribers  []subscriber
+}
+
+type subscriber struct {
+	samples chan Sample
+	block   bool
+}
+
+// NewSampler creates a sampler taking a sample of reader every interval
+func NewSampler(reader RaplReader, interval time.Duration) *Sampler {
+	return &Sampler{
+		reader:   reader,
+		interval: interval,
+		totals:   make(map[int64]Energy),
+	}
+}
+
+// Interval returns the sampling interval
+func (s *Sampler) Interval() time.Duration {
+	return s.interval
+}
+
+// Reader returns the reader being sampled
+func (s *Sampler) Reader() RaplReader {
+	return s.reader
+}
+
+// Run samples until ctx is done, then closes every subscription. Read errors do not stop the sampler, they are
+// reported through the samples
+func (s *Sampler) Run(ctx context.Context) error {
+	defer s.closeSubscribers()
+
+	// prime the counters, the first delta is reported one interval later
+	if _, err := s.Sample(); err != nil {
+		klog.Errorln(err)
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			sample, err := s.Sample()
+			if err != nil {
+				klog.Errorln(err)
+			}
+
+			if !sample.Time.IsZero() && !s.publish(ctx, sample) {
+				// a blocking subscriber dropped the sample, the later ones would leave a gap
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// Sample reads the counters once and returns the energy consumed since the previous call. The first call, and the
+// first call after a failed one, only primes the counters and returns a Sample with a zero Time, like a call reading
+// the same counters again, e.g. of a replay polled faster than it was recorded
+func (s *Sampler) Sample() (Sample, error) {
+	s.sampleMu.Lock()
+	defer s.sampleMu.Unlock()
+
+	measurement, err := s.reader.Measure()
+	attempt := time.Now()
+
+	now := attempt
+	if timestamper, ok := s.reader.(Timestamper); ok {
+		now = timestamper.MeasuredAt()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastAttempt = attempt
+
+	if err != nil {
+		var interval time.Duration
+		if !s.previousTime.IsZero() {
+			interval = now.Sub(s.previousTime)
+		}
+
+		s.previous = nil
+		s.last = Sample{Time: now, Interval: interval, Totals: copyEnergies(s.totals), Err: err}
+		return s.last, err
+	}
+
+	current := measurement.Packages()
+	if s.previous == nil {
+		s.previous = current
+		s.previousTime = now
+		return Sample{}, nil
+	}
+
+	// the reader reports the same read as before, the interval of a sample would be empty
+	if !now.After(s.previousTime) {
+		return Sample{}, nil
+	}
+
+	if s.ranges == nil {
+		s.ranges = s.loadRanges()
+	}
+
+	energy := make(map[int64]Energy)
+	for pkgId, counters := range current {
+		previous, exists := s.previous[pkgId]
+		if !exists {
+			continue
+		}
+
+		delta, reset := Unwrap(counters, previous, s.ranges[pkgId])
+		for _, domain := range reset {
+			klog.V(5).Infof("counter of package %d %s went backwards without a known range, dropped delta", pkgId, domain)
+		}
+
+		energy[pkgId] = delta
+		s.totals[pkgId] = s.totals[pkgId].Add(delta)
+	}
+
+	s.last = Sample{
+		Time:     now,
+		Interval: now.Sub(s.previousTime),
+		Energy:   energy,
+		Totals:   copyEnergies(s.totals),
+		Counters: copyEnergies(current),
+	}
+
+	s.previous = current
+	s.previousTime = now
+
+	return s.last, nil
+}
+
+// Last returns the most recent sample, successful or not
+func (s *Sampler) Last() Sample {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.last
+}
+
+// LastAttempt returns when the counters were last read, successfully or not
+func (s *Sampler) LastAttempt() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.lastAttempt
+}
+
+// Supported returns the domains of every package whose counter was non-zero at the last read, see SupportedDomains
+func (s *Sampler) Supported() map[int64][]Domain {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return SupportedDomains(s.previous)
+}
+
+// Totals returns the joules consumed since the sampler started, per package
+func (s *Sampler) Totals() map[int64]Energy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return copyEnergies(s.totals)
+}
+
+// Subscribe returns a channel receiving every sample taken by Run. Samples are dropped when the channel buffer is
+// full, the channel is closed when Run returns
+func (s *Sampler) Subscribe(buffer int) <-chan Sample {
+	return s.subscribe(buffer, false)
+}
+
+// SubscribeBlocking returns a channel receiving every sample taken by Run, like Subscribe, but Run waits for room in
+// the channel buffer instead of dropping the sample, which holds up the sampling and every other subscription with it.
+// A sample is only dropped if Run is stopped meanwhile
+func (s *Sampler) SubscribeBlocking(buffer int) <-chan Sample {
+	return s.subscribe(buffer, true)
+}
+
+func (s *Sampler) subscribe(buffer int, block bool) <-chan Sample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subscriber := subscriber{samples: make(chan Sample, buffer), block: block}
+	s.subscribers = append(s.subscribers, subscriber)
+
+	return subscriber.samples
+}
+
+// publish sends the sample to every subscriber, false if ctx was done while a blocking one waited
+func (s *Sampler) publish(ctx context.Context, sample Sample) bool {
+	// a blocking subscriber may wait for long, the state is not locked meanwhile
+	s.mu.RLock()
+	subscribers := s.subscribers
+	s.mu.RUnlock()
+
+	published := true
+	for _, subscriber := range subscribers {
+		select {
+		case subscriber.samples <- sample:
+			continue
+		default:
+		}
+
+		if !subscriber.block {
+			klog.V(5).Infoln("subscriber is not keeping up, dropped sample")
+			continue
+		}
+
+		select {
+		case subscriber.samples <- sample:
+		case <-ctx.Done():
+			klog.V(5).Infoln("sampler stopped while a subscriber was blocking, dropped sample")
+			published = false
+		}
+	}
+
+	return published
+}
+
+func (s *Sampler) closeSubscribers() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, subscriber := range s.subscribers {
+		close(subscriber.samples)
+	}
+	s.subscribers = nil
+}
+
+func (s *Sampler) loadRanges() map[int64]Energy {
+	ranger, ok := s.reader.(EnergyRanger)
+	if !ok {
+		return map[int64]Energy{}
+	}
+
+	ranges, err := ranger.EnergyRanges()
+	if err != nil {
+		klog.Errorf("failed to read the energy ranges, counter wraparounds will be dropped: %s", err)
+		return map[int64]Energy{}
+	}
+
+	return ranges
+}
+
+// unwrap corrects the negative delta of a counter wrapping around at limit, ok is false when the counter went
+// backwards without a known limit, e.g. because it was reset
+func unwrap(delta float64, limit float64) (corrected float64, ok bool) {
+	if delta >= 0 {
+		return delta, true
+	}
+
+	if limit <= 0 {
+		return delta, false
+	}
+
+	return delta + limit, true
+}
+
+// Unwrap returns the energy consumed between two readings of the counters of a package, correcting the domains whose
+// counter wrapped around at the given ranges. Reset lists the domains whose counter went backwards without a known
+// range, their delta is zero
+func Unwrap(current Energy, previous Energy, ranges Energy) (delta Energy, reset []Domain) {
+	for _, domain := range Domains {
+		corrected, ok := unwrap(current.Get(domain)-previous.Get(domain), ranges.Get(domain))
+		if !ok {
+			reset = append(reset, domain)
+			corrected = 0
+		}
+
+		delta.Set(domain, corrected)
+	}
+
+	return delta, reset
+}
+
+func copyEnergies(energies map[int64]Energy) map[int64]Energy {
+	copied := make(map[int64]Energy, len(energies))
+	for pkgId, energy := range energies {
+		copied[pkgId] = energy
+	}
+
+	return copied
+}
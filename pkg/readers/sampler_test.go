@@ -0,0 +1,137 @@
+package readers
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fixtureZone is a package zone of a fixture sysfs tree, with a dram sub-zone
+type fixtureZone struct {
+	pkg      int64
+	energy   uint64
+	dram     uint64
+	maxRange uint64
+}
+
+func writeFixture(t *testing.T, root string, zones ...fixtureZone) {
+	t.Helper()
+
+	for _, z := range zones {
+		files := map[string]string{
+			fmt.Sprintf(zoneName, z.pkg):                   fmt.Sprintf("package-%d", z.pkg),
+			fmt.Sprintf(zoneEnergy, z.pkg):                 fmt.Sprint(z.energy),
+			fmt.Sprintf(zoneMaxEnergy, z.pkg):              fmt.Sprint(z.maxRange),
+			fmt.Sprintf(subZoneName, z.pkg, z.pkg, 0):      "dram",
+			fmt.Sprintf(subZoneEnergy, z.pkg, z.pkg, 0):    fmt.Sprint(z.dram),
+			fmt.Sprintf(subZoneMaxEnergy, z.pkg, z.pkg, 0): fmt.Sprint(z.maxRange),
+		}
+
+		for name, content := range files {
+			path := filepath.Join(root, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func assertJoules(t *testing.T, what string, got float64, want float64) {
+	t.Helper()
+
+	if math.Abs(got-want) > 1e-9 {
+		t.Errorf("%s: got %v J, want %v J", what, got, want)
+	}
+}
+
+func TestSysfsPackagesFromRoot(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, fixtureZone{pkg: 0, energy: 1}, fixtureZone{pkg: 3, energy: 2})
+
+	measurement, err := (&Sysfs{Root: root}).Measure()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packages := measurement.Packages()
+	if len(packages) != 2 {
+		t.Fatalf("got packages %v, want 0 and 3", packages)
+	}
+	assertJoules(t, "package 3", packages[3].Pkg, 2e-6)
+}
+
+func TestSamplerCorrectsWrap(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, fixtureZone{pkg: 0, energy: 9_000_000, dram: 500_000, maxRange: 10_000_000})
+
+	sampler := NewSampler(&Sysfs{Root: root}, 0)
+	if _, err := sampler.Sample(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the package counter wraps around, the dram one does not
+	writeFixture(t, root, fixtureZone{pkg: 0, energy: 1_000_000, dram: 700_000, maxRange: 10_000_000})
+
+	sample, err := sampler.Sample()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertJoules(t, "package", sample.Energy[0].Pkg, 2)
+	assertJoules(t, "dram", sample.Energy[0].DRAM, 0.2)
+	assertJoules(t, "package total", sample.Totals[0].Pkg, 2)
+	assertJoules(t, "package counter", sample.Counters[0].Pkg, 1)
+}
+
+func TestSamplerPrimesAfterError(t *testing.T) {
+	root := t.TempDir()
+
+	sampler := NewSampler(&Sysfs{Root: root}, 0)
+	sample, err := sampler.Sample()
+	if err == nil {
+		t.Fatal("sampling an empty tree succeeded")
+	}
+	if sample.Interval != 0 {
+		t.Errorf("a failed first sample has interval %s, want 0", sample.Interval)
+	}
+
+	writeFixture(t, root, fixtureZone{pkg: 0, energy: 1_000_000, maxRange: 10_000_000})
+	sample, err = sampler.Sample()
+	if err != nil || !sample.Time.IsZero() {
+		t.Fatalf("the first successful sample did not prime, got %+v, %v", sample, err)
+	}
+
+	writeFixture(t, root, fixtureZone{pkg: 0, energy: 2_000_000, maxRange: 10_000_000})
+	if _, err := sampler.Sample(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(filepath.Join(root, fmt.Sprintf(zoneEnergy, 0))); err != nil {
+		t.Fatal(err)
+	}
+	sample, err = sampler.Sample()
+	if err == nil || sample.Err == nil {
+		t.Fatal("sampling a broken tree succeeded")
+	}
+	assertJoules(t, "total after a failure", sample.Totals[0].Pkg, 1)
+
+	// the energy consumed while the counters could not be read is not known, the sampler primes again
+	writeFixture(t, root, fixtureZone{pkg: 0, energy: 5_000_000, maxRange: 10_000_000})
+	sample, err = sampler.Sample()
+	if err != nil || !sample.Time.IsZero() {
+		t.Fatalf("the sample after a failure did not prime, got %+v, %v", sample, err)
+	}
+
+	writeFixture(t, root, fixtureZone{pkg: 0, energy: 5_500_000, maxRange: 10_000_000})
+	sample, err = sampler.Sample()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJoules(t, "energy after priming", sample.Energy[0].Pkg, 0.5)
+	assertJoules(t, "total after priming", sample.Totals[0].Pkg, 1.5)
+}
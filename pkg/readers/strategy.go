@@ -0,0 +1,137 @@
+package readers
+
+import (
+	"fmt"
+	"strings"
+)
+
+type RaplReaderStrategy int
+
+const (
+	StrategyAuto      RaplReaderStrategy = iota // Picking the first usable strategy of DefaultRaplReaderStrategies
+	StrategySysfs                               // Reading the files under /sys/class/powercap/intel-rapl/intel-rapl:0 using the sysfs interface. This was introduced in Linux 3.13, and requires root since Linux 5.10
+	StrategyPerfEvent                           // Using the perf_event interface with Linux 3.14 or newer. This requires root or a paranoid less than 1 (as do all system wide measurements with -a) sudo perf stat -a -e "power/energy-cores/" /bin/ls Available events can be found via perf list or under/sys/bus/event_source/devices/power/events/
+	StrategyMsr                                 // Using raw-access to the underlying MSRs under /dev/msr. This requires root.
+	StrategyModel                               // Estimating the package energy from the cpu utilization and frequency, for hosts without any rapl interface. The measurements are flagged as estimated, the strategy is never picked by StrategyAuto
+)
+
+// DefaultRaplReaderStrategies is the order of preference StrategyAuto expands to. StrategyModel is left out, estimates
+// have to be opted in to, e.g. with "auto,model", instead of silently replacing unreadable counters
+var DefaultRaplReaderStrategies = []RaplReaderStrategy{StrategySysfs, StrategyPerfEvent, StrategyMsr}
+
+// RaplReaderStrategies lists every strategy but StrategyAuto
+var RaplReaderStrategies = []RaplReaderStrategy{StrategySysfs, StrategyPerfEvent, StrategyMsr, StrategyModel}
+
+var raplReaderStrategyNames = map[RaplReaderStrategy]string{
+	StrategyAuto:      "auto",
+	StrategySysfs:     "sysfs",
+	StrategyPerfEvent: "perf",
+	StrategyMsr:       "msr",
+	StrategyModel:     "model",
+}
+
+func (s RaplReaderStrategy) String() string {
+	if name, exists := raplReaderStrategyNames[s]; exists {
+		return name
+	}
+
+	return fmt.Sprintf("RaplReaderStrategy(%d)", int(s))
+}
+
+// legacyReaderNames maps the Go types, which identified the reader in recordings and ledgers before the strategy
+// names did, to their strategies
+var legacyReaderNames = map[string]RaplReaderStrategy{
+	"*readers.Sysfs":           StrategySysfs,
+	"*readers.PerfEventReader": StrategyPerfEvent,
+	"*readers.MsrReader":       StrategyMsr,
+	"*readers.ModelReader":     StrategyModel,
+}
+
+// strategyReporter is implemented by the readers that are not one of the strategies, e.g. a Recorder reports the
+// strategy of the reader it wraps and a ReplayReader the recorded one
+type strategyReporter interface {
+	Strategy() string
+}
+
+// StrategyName returns the name of the strategy reader measures with, e.g. "sysfs", which identifies the reader in
+// output headers, recordings and ledgers. Readers of other packages may report a name with a Strategy method, the
+// Go type of the reader is the last resort
+func StrategyName(reader RaplReader) string {
+	switch reader.(type) {
+	case *Sysfs:
+		return StrategySysfs.String()
+	case *PerfEventReader:
+		return StrategyPerfEvent.String()
+	case *MsrReader:
+		return StrategyMsr.String()
+	case *ModelReader:
+		return StrategyModel.String()
+	}
+
+	if reporter, ok := reader.(strategyReporter); ok {
+		return reporter.Strategy()
+	}
+
+	return fmt.Sprintf("%T", reader)
+}
+
+// CanonicalStrategyName returns the strategy name of a reader name written by an older version, which used the Go
+// type, e.g. "*readers.Sysfs" becomes "sysfs". Other names are returned as they are
+func CanonicalStrategyName(name string) string {
+	if strategy, exists := legacyReaderNames[name]; exists {
+		return strategy.String()
+	}
+
+	return name
+}
+
+// ParseRaplReaderStrategy parses one of "auto", "sysfs", "perf", "msr" or "model" into a RaplReaderStrategy
+func ParseRaplReaderStrategy(s string) (RaplReaderStrategy, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	for strategy, strategyName := range raplReaderStrategyNames {
+		if strategyName == name {
+			return strategy, nil
+		}
+	}
+
+	return StrategyAuto, fmt.Errorf("unknown rapl reader strategy %q, expected one of: auto, sysfs, perf, msr, model", s)
+}
+
+// ParseRaplReaderStrategies parses a comma separated, ordered fallback list of strategies e.g. "sysfs,msr"
+func ParseRaplReaderStrategies(s string) ([]RaplReaderStrategy, error) {
+	var strategies []RaplReaderStrategy
+	for _, name := range strings.Split(s, ",") {
+		strategy, err := ParseRaplReaderStrategy(name)
+		if err != nil {
+			return nil, err
+		}
+
+		strategies = append(strategies, strategy)
+	}
+
+	return strategies, nil
+}
+
+func expandRaplReaderStrategies(strategies []RaplReaderStrategy) []RaplReaderStrategy {
+	var expanded []RaplReaderStrategy
+	for _, strategy := range strategies {
+		if strategy == StrategyAuto {
+			expanded = append(expanded, DefaultRaplReaderStrategies...)
+			continue
+		}
+
+		expanded = append(expanded, strategy)
+	}
+
+	return expanded
+}
+
+// DiagnoseRaplReaderStrategy reports whether the given strategy is usable on this machine and, if not, why
+func DiagnoseRaplReaderStrategy(strategy RaplReaderStrategy) (Diagnosis, error) {
+	raplReader, err := newRaplReaderOf(strategy)
+	if err != nil {
+		return Diagnosis{}, err
+	}
+
+	return raplReader.Diagnose(), nil
+}
@@ -4,15 +4,24 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
 const (
-	zone          = "/sys/class/powercap/intel-rapl/intel-rapl:%d/"
-	zoneName      = "/sys/class/powercap/intel-rapl/intel-rapl:%d/name"
-	zoneEnergy    = "/sys/class/powercap/intel-rapl/intel-rapl:%d/energy_uj"
-	subZoneName   = "/sys/class/powercap/intel-rapl/intel-rapl:%d/intel-rapl:%d:%d/name"
-	subZoneEnergy = "/sys/class/powercap/intel-rapl/intel-rapl:%d/intel-rapl:%d:%d/energy_uj"
+	sysfsRoot          = "/sys"
+	zone               = "class/powercap/intel-rapl/intel-rapl:%d/"
+	zoneGlob           = "class/powercap/intel-rapl/intel-rapl:*"
+	zoneName           = "class/powercap/intel-rapl/intel-rapl:%d/name"
+	zoneEnergy         = "class/powercap/intel-rapl/intel-rapl:%d/energy_uj"
+	zoneMaxEnergy      = "class/powercap/intel-rapl/intel-rapl:%d/max_energy_range_uj"
+	subZoneName        = "class/powercap/intel-rapl/intel-rapl:%d/intel-rapl:%d:%d/name"
+	subZoneEnergy      = "class/powercap/intel-rapl/intel-rapl:%d/intel-rapl:%d:%d/energy_uj"
+	subZoneMaxEnergy   = "class/powercap/intel-rapl/intel-rapl:%d/intel-rapl:%d:%d/max_energy_range_uj"
+	microJoulesToJoule = 1000000.0
 )
 
 var (
@@ -21,25 +30,50 @@ var (
 
 // Sysfs is collecting RAPL results on Linux by reading the files under /sys/class/powercap/intel-rapl/intel-rapl:0 using the sysfs interface. This requires no special permissions, and was introduced in Linux 3.13
 type Sysfs struct {
+	// Root is the mount point of sysfs, /sys if empty. Pointing it to a fixture tree allows running without RAPL
+	Root string
 }
 
 //Available checks if this RAPL reading strategy is available on this machine
 func (r *Sysfs) Available() bool {
-	return FileExists(fmt.Sprintf(zone, 0))
+	return r.Diagnose().Usable()
+}
+
+//HardwareCounters reports that the energy_uj files expose the counters of the hardware
+func (r *Sysfs) HardwareCounters() bool {
+	return true
+}
+
+//Diagnose reports whether the powercap zones exist and can be read by this process. Since Linux 5.10 energy_uj is readable only by root
+func (r *Sysfs) Diagnose() Diagnosis {
+	d := newDiagnosis()
+	d.Implemented = true
+	d.Present = FileExists(r.path(zone, 0))
+	if !d.Present {
+		d.Reason = "powercap intel-rapl zones not found, is the intel_rapl_common module loaded?"
+		return d
+	}
+
+	d.Readable, d.Reason = canRead(r.path(zoneEnergy, 0))
+	if !d.Readable && !HasCapability(CAP_DAC_READ_SEARCH) {
+		d.MissingCapability = "CAP_DAC_READ_SEARCH"
+	}
+
+	return d
 }
 
 //Read a measurement using this reader strategy
 func (r *Sysfs) Read() (Measurement, error) {
-	before, err := r.measure()
+	before, err := r.Measure()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	time.Sleep(1 * time.Second)
 
-	after, err := r.measure()
+	after, err := r.Measure()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	delta := after.DeltaSum(before)
@@ -47,59 +81,140 @@ func (r *Sysfs) Read() (Measurement, error) {
 	return delta, nil
 }
 
-func (r *Sysfs) measure() (Measurement, error) {
+func (r *Sysfs) path(format string, a ...interface{}) string {
+	root := r.Root
+	if root == "" {
+		root = sysfsRoot
+	}
+
+	return filepath.Join(root, fmt.Sprintf(format, a...))
+}
+
+//Measure reads the energy_uj counters of every zone, in joules
+func (r *Sysfs) Measure() (Measurement, error) {
+	return r.walk(zoneEnergy, subZoneEnergy)
+}
+
+// EnergyRanges reads the value at which the energy_uj counter of every zone wraps around
+func (r *Sysfs) EnergyRanges() (map[int64]Energy, error) {
+	measurement, err := r.walk(zoneMaxEnergy, subZoneMaxEnergy)
+	if err != nil {
+		return nil, err
+	}
+
+	return measurement.Packages(), nil
+}
+
+// energyUnits reports the resolution of the energy_uj counters, one micro joule for every package
+func (r *Sysfs) energyUnits() (map[int64]Units, error) {
+	pkgs, err := r.packages()
+	if err != nil {
+		return nil, err
+	}
+
+	pkgUnits := make(map[int64]Units)
+	for _, pkg := range pkgs {
+		pkgUnits[pkg] = Units{CpuEnergy: 1 / microJoulesToJoule, DramEnergy: 1 / microJoulesToJoule}
+	}
+
+	return pkgUnits, nil
+}
+
+// packages returns the ids of the packages to read. The detected ones of Cpus on the host, the package zones of the
+// tree when Root is set, so that a fixture tree does not have to match the packages of the host
+func (r *Sysfs) packages() ([]int64, error) {
+	var pkgs []int64
+
+	if r.Root == "" {
+		for _, cpu := range Cpus {
+			for pkg := range cpu.Packages {
+				pkgs = append(pkgs, pkg)
+			}
+		}
+
+		return pkgs, nil
+	}
+
+	zones, err := filepath.Glob(r.path(zoneGlob))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, z := range zones {
+		// the sub-zones are named intel-rapl:<package>:<domain>
+		pkg, err := strconv.ParseInt(strings.TrimPrefix(filepath.Base(z), "intel-rapl:"), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		pkgs = append(pkgs, pkg)
+	}
+
+	if len(pkgs) == 0 {
+		return nil, fmt.Errorf("no powercap intel-rapl zones found under %s", r.Root)
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i] < pkgs[j] })
+
+	return pkgs, nil
+}
+
+// walk reads the given file of every package zone and its core, uncore and dram sub-zones, in joules
+func (r *Sysfs) walk(zoneFile string, subZoneFile string) (Measurement, error) {
 	measurement := Measurement{}
 
-	for _, cpu := range Cpus {
-		for pkg, _ := range cpu.Packages {
-			_, err := ReadStringFromFile(fmt.Sprintf(zoneName, pkg))
-			if err != nil {
+	pkgs, err := r.packages()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pkg := range pkgs {
+		_, err := ReadStringFromFile(r.path(zoneName, pkg))
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := ReadUintFromFile(r.path(zoneFile, pkg))
+		if err != nil {
+			return nil, err
+		}
+
+		result := float64(res) / microJoulesToJoule
+
+		energyPack := make(map[int]Energy)
+		energy := Energy{
+			Pkg: result,
+		}
+
+		measurement[pkg] = energyPack
+
+		for domain, _ := range raplDomains {
+			name, err := ReadStringFromFile(r.path(subZoneName, pkg, pkg, domain))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
 				return nil, err
+			} else if errors.Is(err, os.ErrNotExist) {
+				continue
 			}
 
-			res, err := ReadUintFromFile(fmt.Sprintf(zoneEnergy, pkg))
-			if err != nil {
+			res, err := ReadUintFromFile(r.path(subZoneFile, pkg, pkg, domain))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
 				return nil, err
+			} else if errors.Is(err, os.ErrNotExist) {
+				continue
 			}
 
-			result := float64(res) / 1000000.0
+			result := float64(res) / microJoulesToJoule
 
-			energyPack := make(map[int]Energy)
-			energy := Energy{
-				Pkg: result,
-			}
-
-			measurement[pkg] = energyPack
-
-			for domain, _ := range raplDomains {
-				name, err := ReadStringFromFile(fmt.Sprintf(subZoneName, pkg, pkg, domain))
-				if err != nil && !errors.Is(err, os.ErrNotExist) {
-					return nil, err
-				} else if errors.Is(err, os.ErrNotExist) {
-					continue
-				}
-
-				res, err := ReadUintFromFile(fmt.Sprintf(subZoneEnergy, pkg, pkg, domain))
-				if err != nil && !errors.Is(err, os.ErrNotExist) {
-					return nil, err
-				} else if errors.Is(err, os.ErrNotExist) {
-					continue
-				}
-
-				result := float64(res) / 1000000.0
-
-				switch name {
-				case "core":
-					energy.PP0 = result
-				case "uncore":
-					energy.PP1 = result
-				case "dram":
-					energy.DRAM = result
-				}
-
-				measurement[pkg][0] = energy
+			switch name {
+			case "core":
+				energy.PP0 = result
+			case "uncore":
+				energy.PP1 = result
+			case "dram":
+				energy.DRAM = result
 			}
 		}
+
+		measurement[pkg][0] = energy
 	}
 
 	return measurement, nil
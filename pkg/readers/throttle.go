@@ -0,0 +1,95 @@
+package readers
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// throttledTimeMask masks the 32 bit counter of MSR_PKG_PERF_STATUS, the rest of the register is reserved
+const throttledTimeMask = 0xffffffff
+
+// Throttling tracks the fraction of time every package was throttled by its power limits, read from the
+// MSR_PKG_PERF_STATUS register of intel processors. It needs the msr interface, whichever reader measures the energy
+type Throttling struct {
+	reader *MsrReader
+
+	mu           sync.Mutex
+	previous     map[int64]uint64
+	previousTime time.Time
+}
+
+// NewThrottling creates a throttling tracker reading the msrs through reader
+func NewThrottling(reader *MsrReader) *Throttling {
+	return &Throttling{reader: reader}
+}
+
+// Sample returns the fraction, between 0 and 1, of the time since the previous call every package was throttled. The
+// first call only primes the counters and returns an empty map
+func (t *Throttling) Sample() (map[int64]float64, error) {
+	pkgUnits, err := t.reader.energyUnits()
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[int64]uint64)
+	for _, cpu := range Cpus {
+		if cpu.Vendor != Intel {
+			continue
+		}
+
+		for pkg, core := range t.reader.packageCores(cpu) {
+			fd, err := t.reader.open(core)
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := t.reader.read(fd, MSR_PKG_PERF_STATUS, cpu.ByteOrder)
+
+			closeErr := t.reader.close(fd)
+			if closeErr != nil {
+				return nil, closeErr
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			current[pkg] = value & throttledTimeMask
+		}
+	}
+
+	if len(current) == 0 {
+		return nil, errors.New("no package exposes MSR_PKG_PERF_STATUS, only intel processors do")
+	}
+
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	throttled := make(map[int64]float64)
+	if t.previous != nil {
+		elapsed := now.Sub(t.previousTime).Seconds()
+		for pkg, counter := range current {
+			previous, exists := t.previous[pkg]
+			if !exists || elapsed <= 0 {
+				continue
+			}
+
+			// the subtraction wraps along with the 32 bit counter
+			delta := (counter - previous) & throttledTimeMask
+			fraction := float64(delta) * pkgUnits[pkg].Time / elapsed
+			if fraction > 1 {
+				fraction = 1
+			}
+
+			throttled[pkg] = fraction
+		}
+	}
+
+	t.previous = current
+	t.previousTime = now
+
+	return throttled, nil
+}
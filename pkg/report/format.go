@@ -0,0 +1,190 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+// Formats lists the formats Write supports
+var Formats = []string{"markdown", "csv", "json"}
+
+// Write renders the report in one of the Formats to w
+func Write(w io.Writer, report Report, format string) error {
+	switch format {
+	case "markdown", "md":
+		return writeMarkdown(w, report)
+	case "csv":
+		return writeCsv(w, report)
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	return fmt.Errorf("unknown report format %q, expected one of: %s", format, strings.Join(Formats, ", "))
+}
+
+func writeMarkdown(w io.Writer, report Report) error {
+	fmt.Fprintf(w, "# Energy report\n\n")
+	fmt.Fprintf(w, "- Source: `%s`\n", report.Source)
+	fmt.Fprintf(w, "- From: %s\n", report.From.Format(time.RFC3339))
+	fmt.Fprintf(w, "- To: %s\n", report.To.Format(time.RFC3339))
+	fmt.Fprintf(w, "- Time zone: %s\n", report.Timezone)
+	fmt.Fprintf(w, "- Coverage: %.1f%%\n\n", report.Total.Coverage*100)
+
+	fmt.Fprintf(w, "## Total\n\n")
+	fmt.Fprintf(w, "| | kWh |")
+	if report.Total.Cost != nil {
+		fmt.Fprintf(w, " cost (%s) |", report.Currency)
+	}
+	if report.Total.Emissions != nil {
+		fmt.Fprintf(w, " kgCO2e |")
+	}
+	fmt.Fprintf(w, "\n|---|---:|")
+	if report.Total.Cost != nil {
+		fmt.Fprintf(w, "---:|")
+	}
+	if report.Total.Emissions != nil {
+		fmt.Fprintf(w, "---:|")
+	}
+	fmt.Fprintln(w)
+	writeMarkdownRow(w, "total", report.Total)
+	for _, pkg := range report.Packages {
+		writeMarkdownRow(w, fmt.Sprintf("package %d", pkg.Package), pkg.Summary)
+	}
+
+	fmt.Fprintf(w, "\n## Energy per domain\n\n| domain | J | kWh |\n|---|---:|---:|\n")
+	for _, domain := range readers.Domains {
+		joules := report.Total.Energy[domain.String()]
+		fmt.Fprintf(w, "| %s | %.3f | %.6f |\n", domain, joules, readers.Energy{Pkg: joules}.ToKiloWattHour().Pkg)
+	}
+
+	if len(report.Periods) > 0 {
+		fmt.Fprintf(w, "\n## Tariff periods\n\n| period | price (%s/kWh) | kWh | cost (%s) |\n|---|---:|---:|---:|\n", report.Currency, report.Currency)
+		for _, period := range report.Periods {
+			fmt.Fprintf(w, "| %s | %.4f | %.6f | %.4f |\n", period.Period, period.Price, period.KiloWattHours, period.Cost)
+		}
+	}
+
+	fmt.Fprintf(w, "\n## Days\n\n| date | kWh |")
+	if report.Total.Cost != nil {
+		fmt.Fprintf(w, " cost (%s) |", report.Currency)
+	}
+	if report.Total.Emissions != nil {
+		fmt.Fprintf(w, " kgCO2e |")
+	}
+	fmt.Fprintf(w, " coverage |\n|---|---:|")
+	if report.Total.Cost != nil {
+		fmt.Fprintf(w, "---:|")
+	}
+	if report.Total.Emissions != nil {
+		fmt.Fprintf(w, "---:|")
+	}
+	fmt.Fprintf(w, "---:|\n")
+	for _, day := range report.Days {
+		fmt.Fprintf(w, "| %s | %.6f |", day.Date, day.KiloWattHours)
+		if day.Cost != nil {
+			fmt.Fprintf(w, " %.4f |", *day.Cost)
+		}
+		if day.Emissions != nil {
+			fmt.Fprintf(w, " %.6f |", *day.Emissions/1000)
+		}
+		fmt.Fprintf(w, " %.1f%% |\n", day.Coverage*100)
+	}
+
+	_, err := fmt.Fprintf(w, "\nkWh, cost and emissions cover the package and dram domains.\n")
+
+	return err
+}
+
+func writeMarkdownRow(w io.Writer, name string, summary Summary) {
+	fmt.Fprintf(w, "| %s | %.6f |", name, summary.KiloWattHours)
+	if summary.Cost != nil {
+		fmt.Fprintf(w, " %.4f |", *summary.Cost)
+	}
+	if summary.Emissions != nil {
+		fmt.Fprintf(w, " %.6f |", *summary.Emissions/1000)
+	}
+	fmt.Fprintln(w)
+}
+
+// writeCsv writes one row per summary: the total, every package, every day and every tariff period
+func writeCsv(w io.Writer, report Report) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{"scope", "key"}
+	for _, domain := range readers.Domains {
+		header = append(header, domain.String()+"_joules")
+	}
+	header = append(header, "kwh", "cost", "currency", "emissions_grams", "coverage")
+
+	err := writer.Write(header)
+	if err != nil {
+		return err
+	}
+
+	row := func(scope string, key string, summary Summary) error {
+		record := []string{scope, key}
+		for _, domain := range readers.Domains {
+			record = append(record, formatFloat(summary.Energy[domain.String()]))
+		}
+		record = append(record, formatFloat(summary.KiloWattHours), formatOptional(summary.Cost), report.Currency, formatOptional(summary.Emissions), formatFloat(summary.Coverage))
+
+		return writer.Write(record)
+	}
+
+	err = row("total", report.From.Format(time.RFC3339)+"/"+report.To.Format(time.RFC3339), report.Total)
+	if err != nil {
+		return err
+	}
+
+	for _, pkg := range report.Packages {
+		err = row("package", strconv.FormatInt(pkg.Package, 10), pkg.Summary)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, day := range report.Days {
+		err = row("day", day.Date, day.Summary)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, period := range report.Periods {
+		record := []string{"period", period.Period}
+		for range readers.Domains {
+			record = append(record, "")
+		}
+		record = append(record, formatFloat(period.KiloWattHours), formatFloat(period.Cost), report.Currency, "", "")
+
+		err = writer.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func formatOptional(f *float64) string {
+	if f == nil {
+		return ""
+	}
+
+	return formatFloat(*f)
+}
@@ -0,0 +1,194 @@
+package report
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func float(f float64) *float64 {
+	return &f
+}
+
+// summary is the summary of a stretch whose core domain drew half of the package energy
+func summary(pkg float64, dram float64, kWh float64, cost float64, emissions float64, coverage float64) Summary {
+	return Summary{
+		Energy:        map[string]float64{"package": pkg, "core": pkg / 2, "uncore": 0, "dram": dram, "psys": 0},
+		KiloWattHours: kWh,
+		Cost:          float(cost),
+		Emissions:     float(emissions),
+		Coverage:      coverage,
+	}
+}
+
+// goldenReport is two hours of two packages, priced by a tariff with a night period
+var goldenReport = Report{
+	Source:   "ledger.json",
+	From:     time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC),
+	To:       time.Date(2026, time.March, 1, 2, 0, 0, 0, time.UTC),
+	Timezone: "UTC",
+	Currency: "EUR",
+	Total:    summary(7.2e6, 7.2e5, 2.2, 0.44, 880, 0.75),
+	Packages: []PackageSummary{
+		{Package: 0, Summary: summary(3.6e6, 7.2e5, 1.2, 0.24, 480, 0.75)},
+		{Package: 1, Summary: summary(3.6e6, 0, 1, 0.2, 400, 0.75)},
+	},
+	Days: []DaySummary{{Date: "2026-03-01", Summary: summary(7.2e6, 7.2e5, 2.2, 0.44, 880, 0.75)}},
+	Periods: []PeriodSummary{
+		{Period: "night", Price: 0.1, KiloWattHours: 1.1, Cost: 0.11},
+		{Period: StandardPeriod, Price: 0.3, KiloWattHours: 1.1, Cost: 0.33},
+	},
+}
+
+func TestWrite(t *testing.T) {
+	for _, test := range []struct {
+		format string
+		golden string
+	}{
+		{format: "markdown", golden: `# Energy report
+
+- Source: ` + "`" + `ledger.json` + "`" + `
+- From: 2026-03-01T00:00:00Z
+- To: 2026-03-01T02:00:00Z
+- Time zone: UTC
+- Coverage: 75.0%
+
+## Total
+
+| | kWh | cost (EUR) | kgCO2e |
+|---|---:|---:|---:|
+| total | 2.200000 | 0.4400 | 0.880000 |
+| package 0 | 1.200000 | 0.2400 | 0.480000 |
+| package 1 | 1.000000 | 0.2000 | 0.400000 |
+
+## Energy per domain
+
+| domain | J | kWh |
+|---|---:|---:|
+| package | 7200000.000 | 2.000000 |
+| core | 3600000.000 | 1.000000 |
+| uncore | 0.000 | 0.000000 |
+| dram | 720000.000 | 0.200000 |
+| psys | 0.000 | 0.000000 |
+
+## Tariff periods
+
+| period | price (EUR/kWh) | kWh | cost (EUR) |
+|---|---:|---:|---:|
+| night | 0.1000 | 1.100000 | 0.1100 |
+| standard | 0.3000 | 1.100000 | 0.3300 |
+
+## Days
+
+| date | kWh | cost (EUR) | kgCO2e | coverage |
+|---|---:|---:|---:|---:|
+| 2026-03-01 | 2.200000 | 0.4400 | 0.880000 | 75.0% |
+
+kWh, cost and emissions cover the package and dram domains.
+`},
+		{format: "csv", golden: `scope,key,package_joules,core_joules,uncore_joules,dram_joules,psys_joules,kwh,cost,currency,emissions_grams,coverage
+total,2026-03-01T00:00:00Z/2026-03-01T02:00:00Z,7.2e+06,3.6e+06,0,720000,0,2.2,0.44,EUR,880,0.75
+package,0,3.6e+06,1.8e+06,0,720000,0,1.2,0.24,EUR,480,0.75
+package,1,3.6e+06,1.8e+06,0,0,0,1,0.2,EUR,400,0.75
+day,2026-03-01,7.2e+06,3.6e+06,0,720000,0,2.2,0.44,EUR,880,0.75
+period,night,,,,,,1.1,0.11,EUR,,
+period,standard,,,,,,1.1,0.33,EUR,,
+`},
+		{format: "json", golden: `{
+  "source": "ledger.json",
+  "from": "2026-03-01T00:00:00Z",
+  "to": "2026-03-01T02:00:00Z",
+  "timezone": "UTC",
+  "currency": "EUR",
+  "total": {
+    "energy_joules": {
+      "core": 3600000,
+      "dram": 720000,
+      "package": 7200000,
+      "psys": 0,
+      "uncore": 0
+    },
+    "kwh": 2.2,
+    "cost": 0.44,
+    "emissions_grams": 880,
+    "coverage": 0.75
+  },
+  "packages": [
+    {
+      "package": 0,
+      "energy_joules": {
+        "core": 1800000,
+        "dram": 720000,
+        "package": 3600000,
+        "psys": 0,
+        "uncore": 0
+      },
+      "kwh": 1.2,
+      "cost": 0.24,
+      "emissions_grams": 480,
+      "coverage": 0.75
+    },
+    {
+      "package": 1,
+      "energy_joules": {
+        "core": 1800000,
+        "dram": 0,
+        "package": 3600000,
+        "psys": 0,
+        "uncore": 0
+      },
+      "kwh": 1,
+      "cost": 0.2,
+      "emissions_grams": 400,
+      "coverage": 0.75
+    }
+  ],
+  "days": [
+    {
+      "date": "2026-03-01",
+      "energy_joules": {
+        "core": 3600000,
+        "dram": 720000,
+        "package": 7200000,
+        "psys": 0,
+        "uncore": 0
+      },
+      "kwh": 2.2,
+      "cost": 0.44,
+      "emissions_grams": 880,
+      "coverage": 0.75
+    }
+  ],
+  "periods": [
+    {
+      "period": "night",
+      "price": 0.1,
+      "kwh": 1.1,
+      "cost": 0.11
+    },
+    {
+      "period": "standard",
+      "price": 0.3,
+      "kwh": 1.1,
+      "cost": 0.33
+    }
+  ]
+}
+`},
+	} {
+		t.Run(test.format, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Write(&out, goldenReport, test.format); err != nil {
+				t.Fatal(err)
+			}
+
+			if out.String() != test.golden {
+				t.Errorf("got\n%s\nwant\n%s", out.String(), test.golden)
+			}
+		})
+	}
+
+	if err := Write(&bytes.Buffer{}, goldenReport, "pdf"); err == nil {
+		t.Error("wrote a report in an unknown format")
+	}
+}
@@ -0,0 +1,386 @@
+package report
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/aggregation"
+	"github.com/rekuberate-io/power/pkg/carbon"
+	"github.com/rekuberate-io/power/pkg/ledger"
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+// StandardPeriod names the time outside of every period of a time of use tariff
+const StandardPeriod = "standard"
+
+// Bucket is the energy consumed during a stretch of time, the unit the reports are built from
+type Bucket struct {
+	Start time.Time
+	End   time.Time
+	// Energy holds the joules, per package
+	Energy map[int64]readers.Energy
+	// Covered is the time of the bucket covered by samples
+	Covered time.Duration
+}
+
+// FromRollups converts the rollups of an aggregation.Aggregator to buckets, the node totals are left out
+func FromRollups(rollups []aggregation.Rollup) []Bucket {
+	buckets := make(map[time.Time]*Bucket)
+	for _, rollup := range rollups {
+		if rollup.Package == aggregation.NodeTotal {
+			continue
+		}
+
+		bucket, exists := buckets[rollup.Start]
+		if !exists {
+			bucket = &Bucket{Start: rollup.Start, End: rollup.End, Energy: make(map[int64]readers.Energy), Covered: rollup.Covered}
+			buckets[rollup.Start] = bucket
+		}
+
+		bucket.Energy[rollup.Package] = rollup.Energy
+	}
+
+	return sortBuckets(buckets)
+}
+
+// FromLedger converts the hourly totals of a ledger to buckets
+func FromLedger(state ledger.State) []Bucket {
+	var buckets []Bucket
+	for _, hour := range state.Hours {
+		buckets = append(buckets, Bucket{
+			Start:   hour.Start,
+			End:     hour.Start.Add(time.Hour),
+			Energy:  hour.Energy,
+			Covered: time.Duration(hour.Covered * float64(time.Second)),
+		})
+	}
+
+	return buckets
+}
+
+func sortBuckets(buckets map[time.Time]*Bucket) []Bucket {
+	var sorted []Bucket
+	for _, bucket := range buckets {
+		sorted = append(sorted, *bucket)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start.Before(sorted[j].Start) })
+
+	return sorted
+}
+
+// Options configure a report
+type Options struct {
+	// Source describes where the buckets come from, e.g. the path of the recording
+	Source string
+	// From and To limit the report to the buckets starting within them, the whole input if zero
+	From time.Time
+	To   time.Time
+	// Location is the time zone of the days and of the time of use periods, UTC if nil
+	Location *time.Location
+	// Tariff prices the energy, no cost is reported if nil
+	Tariff *Tariff
+	// Carbon estimates the emissions, none are reported if nil
+	Carbon *carbon.Estimator
+}
+
+// Summary sums the energy of a stretch of time. The kWh, cost and emissions cover the package and dram domains, the
+// core and uncore domains are part of the package one and psys, where present, overlaps both
+type Summary struct {
+	Energy        map[string]float64 `json:"energy_joules"`
+	KiloWattHours float64            `json:"kwh"`
+	Cost          *float64           `json:"cost,omitempty"`
+	Emissions     *float64           `json:"emissions_grams,omitempty"`
+	// Coverage is the fraction of the stretch covered by samples
+	Coverage float64 `json:"coverage"`
+
+	covered  time.Duration
+	duration time.Duration
+}
+
+// PackageSummary is the summary of a package over the whole report
+type PackageSummary struct {
+	Package int64 `json:"package"`
+	Summary
+}
+
+// DaySummary is the summary of a day of the report
+type DaySummary struct {
+	Date string `json:"date"`
+	Summary
+}
+
+// PeriodSummary is the energy and cost of a period of a time of use tariff over the whole report
+type PeriodSummary struct {
+	Period        string  `json:"period"`
+	Price         float64 `json:"price"`
+	KiloWattHours float64 `json:"kwh"`
+	Cost          float64 `json:"cost"`
+}
+
+// Report is the energy, cost and emissions of a time range, in total, per package and per day
+type Report struct {
+	Source   string           `json:"source"`
+	From     time.Time        `json:"from"`
+	To       time.Time        `json:"to"`
+	Timezone string           `json:"timezone"`
+	Currency string           `json:"currency,omitempty"`
+	Total    Summary          `json:"total"`
+	Packages []PackageSummary `json:"packages"`
+	Days     []DaySummary     `json:"days"`
+	Periods  []PeriodSummary  `json:"periods,omitempty"`
+}
+
+// Build sums the buckets within the range of the options into a report
+func Build(ctx context.Context, buckets []Bucket, options Options) (Report, error) {
+	location := options.Location
+	if location == nil {
+		location = time.UTC
+	}
+
+	var selected []Bucket
+	for _, bucket := range buckets {
+		if !options.From.IsZero() && bucket.Start.Before(options.From) {
+			continue
+		}
+		if !options.To.IsZero() && !bucket.Start.Before(options.To) {
+			continue
+		}
+
+		selected = append(selected, bucket)
+	}
+
+	if len(selected) == 0 {
+		return Report{}, errors.New("no energy was recorded within the time range")
+	}
+
+	report := Report{
+		Source:   options.Source,
+		From:     options.From,
+		To:       options.To,
+		Timezone: location.String(),
+		Packages: []PackageSummary{},
+		Days:     []DaySummary{},
+	}
+	if report.From.IsZero() {
+		report.From = selected[0].Start
+	}
+	if report.To.IsZero() {
+		report.To = selected[len(selected)-1].End
+	}
+	if options.Tariff != nil {
+		report.Currency = options.Tariff.Currency
+	}
+
+	total := newSummary(options)
+	total.duration = report.To.Sub(report.From)
+
+	packages := make(map[int64]*Summary)
+	days := make(map[string]*Summary)
+	var dates []string
+	periods := make(map[string]*PeriodSummary)
+	var periodNames []string
+
+	for _, bucket := range selected {
+		for _, piece := range split(bucket, location, options.Tariff) {
+			middle := piece.start.Add(piece.end.Sub(piece.start) / 2).In(location)
+
+			date := middle.Format("2006-01-02")
+			day, exists := days[date]
+			if !exists {
+				day = newSummary(options)
+				start := time.Date(middle.Year(), middle.Month(), middle.Day(), 0, 0, 0, 0, location)
+				day.duration = clip(start, start.AddDate(0, 0, 1), report.From, report.To)
+				days[date] = day
+				dates = append(dates, date)
+			}
+
+			var price float64
+			var period string
+			if options.Tariff != nil {
+				price, period = options.Tariff.PriceAt(middle)
+				if period == "" {
+					period = StandardPeriod
+				}
+			}
+
+			var pieceKWh float64
+			for pkgId, energy := range bucket.Energy {
+				energy = energy.Scale(piece.fraction)
+
+				pkg, exists := packages[pkgId]
+				if !exists {
+					pkg = newSummary(options)
+					pkg.duration = total.duration
+					packages[pkgId] = pkg
+				}
+
+				var emissions *carbon.Emissions
+				if options.Carbon != nil {
+					e, _, err := options.Carbon.Emissions(ctx, energy, middle)
+					if err != nil {
+						return Report{}, err
+					}
+					emissions = &e
+				}
+
+				for _, summary := range []*Summary{total, pkg, day} {
+					summary.add(energy, price, emissions)
+				}
+
+				pieceKWh += kiloWattHours(energy)
+			}
+
+			// a package missing from the bucket was not covered by it
+			covered := time.Duration(float64(bucket.Covered) * piece.fraction)
+			for _, summary := range []*Summary{total, day} {
+				summary.covered += covered
+			}
+			for pkgId := range bucket.Energy {
+				packages[pkgId].covered += covered
+			}
+
+			if options.Tariff != nil {
+				p, exists := periods[period]
+				if !exists {
+					p = &PeriodSummary{Period: period, Price: price}
+					periods[period] = p
+					periodNames = append(periodNames, period)
+				}
+
+				p.KiloWattHours += pieceKWh
+				p.Cost += pieceKWh * price
+			}
+		}
+	}
+
+	report.Total = total.finish()
+
+	var pkgIds []int64
+	for pkgId := range packages {
+		pkgIds = append(pkgIds, pkgId)
+	}
+	sort.Slice(pkgIds, func(i, j int) bool { return pkgIds[i] < pkgIds[j] })
+	for _, pkgId := range pkgIds {
+		report.Packages = append(report.Packages, PackageSummary{Package: pkgId, Summary: packages[pkgId].finish()})
+	}
+
+	sort.Strings(dates)
+	for _, date := range dates {
+		report.Days = append(report.Days, DaySummary{Date: date, Summary: days[date].finish()})
+	}
+
+	// a flat tariff has a single, standard period, which would only repeat the total
+	if len(periodNames) > 1 || (len(periodNames) == 1 && periodNames[0] != StandardPeriod) {
+		for _, name := range periodNames {
+			report.Periods = append(report.Periods, *periods[name])
+		}
+	}
+
+	return report, nil
+}
+
+// piece is the part of a bucket within a day and a period of the tariff, fraction is its share of the bucket
+type piece struct {
+	start, end time.Time
+	fraction   float64
+}
+
+// split cuts the bucket at the midnights of location and at the boundaries of the periods of the tariff, so that every
+// piece is accounted to its own day and priced at its own rate, e.g. an hourly ledger bucket crossing 06:30. The
+// energy of a bucket is taken to be spread evenly over it
+func split(bucket Bucket, location *time.Location, tariff *Tariff) []piece {
+	duration := bucket.End.Sub(bucket.Start)
+	if duration <= 0 {
+		return []piece{{start: bucket.Start, end: bucket.End, fraction: 1}}
+	}
+
+	var cuts []time.Time
+	start := bucket.Start.In(location)
+	for day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, location); day.Before(bucket.End); day = day.AddDate(0, 0, 1) {
+		cuts = append(cuts, day)
+		if tariff != nil {
+			cuts = append(cuts, tariff.boundaries(day)...)
+		}
+	}
+	sort.Slice(cuts, func(i, j int) bool { return cuts[i].Before(cuts[j]) })
+
+	var pieces []piece
+	from := bucket.Start
+	for _, cut := range append(cuts, bucket.End) {
+		if !cut.After(from) || cut.After(bucket.End) {
+			continue
+		}
+
+		pieces = append(pieces, piece{start: from, end: cut, fraction: cut.Sub(from).Seconds() / duration.Seconds()})
+		from = cut
+	}
+
+	return pieces
+}
+
+func newSummary(options Options) *Summary {
+	summary := &Summary{Energy: make(map[string]float64)}
+	for _, domain := range readers.Domains {
+		summary.Energy[domain.String()] = 0
+	}
+
+	if options.Tariff != nil {
+		summary.Cost = new(float64)
+	}
+	if options.Carbon != nil {
+		summary.Emissions = new(float64)
+	}
+
+	return summary
+}
+
+func (s *Summary) add(energy readers.Energy, price float64, emissions *carbon.Emissions) {
+	for _, domain := range readers.Domains {
+		s.Energy[domain.String()] += energy.Get(domain)
+	}
+
+	kWh := kiloWattHours(energy)
+	s.KiloWattHours += kWh
+
+	if s.Cost != nil {
+		*s.Cost += kWh * price
+	}
+
+	if s.Emissions != nil && emissions != nil {
+		*s.Emissions += emissions.Pkg + emissions.DRAM
+	}
+}
+
+func (s *Summary) finish() Summary {
+	if s.duration > 0 {
+		s.Coverage = s.covered.Seconds() / s.duration.Seconds()
+		if s.Coverage > 1 {
+			s.Coverage = 1
+		}
+	}
+
+	return *s
+}
+
+// kiloWattHours converts the package and dram energy to kWh
+func kiloWattHours(energy readers.Energy) float64 {
+	kWh := energy.ToKiloWattHour()
+	return kWh.Pkg + kWh.DRAM
+}
+
+// clip returns the duration of the overlap of two stretches of time
+func clip(start time.Time, end time.Time, from time.Time, to time.Time) time.Duration {
+	if from.After(start) {
+		start = from
+	}
+	if to.Before(end) {
+		end = to
+	}
+	if !end.After(start) {
+		return 0
+	}
+
+	return end.Sub(start)
+}
@@ -0,0 +1,149 @@
+package report
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+var midnight = time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+// kWh is a kilowatt hour in joules
+const kWh = 3.6e6
+
+// hours returns a fully covered bucket per hour after midnight, of the joules of every package
+func hours(from int, to int, energy map[int64]readers.Energy) []Bucket {
+	var buckets []Bucket
+	for hour := from; hour < to; hour++ {
+		start := midnight.Add(time.Duration(hour) * time.Hour)
+		buckets = append(buckets, Bucket{Start: start, End: start.Add(time.Hour), Energy: energy, Covered: time.Hour})
+	}
+
+	return buckets
+}
+
+func build(t *testing.T, buckets []Bucket, options Options) Report {
+	t.Helper()
+
+	report, err := Build(context.Background(), buckets, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return report
+}
+
+func assertFloat(t *testing.T, what string, got float64, want float64) {
+	t.Helper()
+
+	if math.Abs(got-want) > 1e-9 {
+		t.Errorf("%s: got %v, want %v", what, got, want)
+	}
+}
+
+func TestBuildFiltersRange(t *testing.T) {
+	buckets := hours(0, 5, map[int64]readers.Energy{0: {Pkg: kWh}})
+
+	for _, test := range []struct {
+		name     string
+		from, to time.Time
+		kWh      float64
+	}{
+		{name: "whole input", kWh: 5},
+		{name: "from", from: midnight.Add(2 * time.Hour), kWh: 3},
+		{name: "to", to: midnight.Add(2 * time.Hour), kWh: 2},
+		// a bucket counts if it starts within the range
+		{name: "within an hour", from: midnight.Add(30 * time.Minute), to: midnight.Add(150 * time.Minute), kWh: 2},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			report := build(t, buckets, Options{From: test.from, To: test.to})
+			assertFloat(t, "kWh", report.Total.KiloWattHours, test.kWh)
+		})
+	}
+
+	if _, err := Build(context.Background(), buckets, Options{From: midnight.Add(5 * time.Hour)}); err == nil {
+		t.Error("built a report without buckets in the range")
+	}
+}
+
+func TestBuildDaysInLocation(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 18:00 to 20:00 UTC, local midnight is at 18:30 UTC and splits the first hour
+	report := build(t, hours(18, 20, map[int64]readers.Energy{0: {Pkg: kWh}}), Options{Location: kolkata})
+
+	if report.Timezone != "Asia/Kolkata" || len(report.Days) != 2 {
+		t.Fatalf("got days %+v in %s, want 2 in Asia/Kolkata", report.Days, report.Timezone)
+	}
+	for i, want := range []struct {
+		date string
+		kWh  float64
+	}{
+		{date: "2026-03-01", kWh: 0.5},
+		{date: "2026-03-02", kWh: 1.5},
+	} {
+		day := report.Days[i]
+		if day.Date != want.date {
+			t.Errorf("got day %s, want %s", day.Date, want.date)
+		}
+		assertFloat(t, day.Date+" kWh", day.KiloWattHours, want.kWh)
+		// the days are clipped to the range of the report
+		assertFloat(t, day.Date+" coverage", day.Coverage, 1)
+	}
+	assertFloat(t, "total kWh", report.Total.KiloWattHours, 2)
+}
+
+func TestBuildCostPerPeriod(t *testing.T) {
+	tariff := tariff(t, 0.10, Period{Name: "peak", From: "06:30", To: "22:00", Price: 0.30})
+
+	// 1 kWh from 06:00 to 07:00, the peak starts half way through
+	report := build(t, hours(6, 8, map[int64]readers.Energy{0: {Pkg: kWh}}), Options{Tariff: tariff})
+
+	if report.Currency != "EUR" || report.Total.Cost == nil {
+		t.Fatalf("got no cost in %q", report.Currency)
+	}
+	assertFloat(t, "total cost", *report.Total.Cost, 0.5*0.10+1.5*0.30)
+
+	if len(report.Periods) != 2 {
+		t.Fatalf("got periods %+v, want standard and peak", report.Periods)
+	}
+	for i, want := range []PeriodSummary{
+		{Period: StandardPeriod, Price: 0.10, KiloWattHours: 0.5, Cost: 0.05},
+		{Period: "peak", Price: 0.30, KiloWattHours: 1.5, Cost: 0.45},
+	} {
+		period := report.Periods[i]
+		if period.Period != want.Period || period.Price != want.Price {
+			t.Errorf("got period %+v, want %+v", period, want)
+		}
+		assertFloat(t, want.Period+" kWh", period.KiloWattHours, want.KiloWattHours)
+		assertFloat(t, want.Period+" cost", period.Cost, want.Cost)
+	}
+
+	// a flat tariff repeats the total, it has no periods
+	flat := build(t, hours(6, 8, map[int64]readers.Energy{0: {Pkg: kWh}}), Options{Tariff: FlatTariff(0.2, "EUR")})
+	if len(flat.Periods) != 0 {
+		t.Errorf("got periods %+v of a flat tariff", flat.Periods)
+	}
+	assertFloat(t, "flat cost", *flat.Total.Cost, 0.4)
+}
+
+func TestBuildPackageCoverage(t *testing.T) {
+	// package 1 is only in the first of two hours
+	buckets := append(hours(0, 1, map[int64]readers.Energy{0: {Pkg: kWh}, 1: {Pkg: kWh, DRAM: kWh}}),
+		hours(1, 2, map[int64]readers.Energy{0: {Pkg: kWh}})...)
+	report := build(t, buckets, Options{})
+
+	if len(report.Packages) != 2 {
+		t.Fatalf("got packages %+v, want 0 and 1", report.Packages)
+	}
+	assertFloat(t, "coverage of package 0", report.Packages[0].Coverage, 1)
+	assertFloat(t, "coverage of package 1", report.Packages[1].Coverage, 0.5)
+	assertFloat(t, "kWh of package 1", report.Packages[1].KiloWattHours, 2)
+	assertFloat(t, "total coverage", report.Total.Coverage, 1)
+}
@@ -0,0 +1,183 @@
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Tariff is the price of the energy, flat or by time of use:
+//
+//	{
+//	  "currency": "EUR",
+//	  "price": 0.30,
+//	  "periods": [
+//	    {"name": "off-peak", "from": "22:00", "to": "06:00", "price": 0.18},
+//	    {"name": "weekend", "days": ["sat", "sun"], "price": 0.20}
+//	  ]
+//	}
+//
+// The first period matching a time applies, Price applies outside of every period
+type Tariff struct {
+	Currency string `json:"currency"`
+	// Price is the price of a kWh outside of every period
+	Price   float64  `json:"price"`
+	Periods []Period `json:"periods"`
+}
+
+// Period is a recurring time of use with its own price. A period whose To is before its From spans midnight, a period
+// without From and To spans the whole day
+type Period struct {
+	Name string `json:"name"`
+	// Days are the weekdays the period starts on, "mon" to "sun", every day if empty
+	Days  []string `json:"days"`
+	From  string   `json:"from"`
+	To    string   `json:"to"`
+	Price float64  `json:"price"`
+
+	days     map[time.Weekday]bool
+	from, to time.Duration
+}
+
+// FlatTariff creates a tariff with the same price at any time
+func FlatTariff(price float64, currency string) *Tariff {
+	return &Tariff{Currency: currency, Price: price}
+}
+
+// LoadTariff reads a tariff from a json file
+func LoadTariff(path string) (*Tariff, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tariff Tariff
+	err = json.Unmarshal(data, &tariff)
+	if err != nil {
+		return nil, fmt.Errorf("parsing the tariff %s failed: %w", path, err)
+	}
+
+	err = tariff.validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid tariff %s: %w", path, err)
+	}
+
+	return &tariff, nil
+}
+
+func (t *Tariff) validate() error {
+	if t.Price < 0 {
+		return errors.New("price can not be negative")
+	}
+
+	for i := range t.Periods {
+		period := &t.Periods[i]
+		if period.Name == "" {
+			period.Name = fmt.Sprintf("period %d", i+1)
+		}
+
+		if period.Price < 0 {
+			return fmt.Errorf("price of %s can not be negative", period.Name)
+		}
+
+		if len(period.Days) > 0 {
+			period.days = make(map[time.Weekday]bool)
+			for _, day := range period.Days {
+				weekday, exists := weekdays[strings.ToLower(day)]
+				if !exists {
+					return fmt.Errorf("unknown day %q in %s, expected one of: mon, tue, wed, thu, fri, sat, sun", day, period.Name)
+				}
+
+				period.days[weekday] = true
+			}
+		}
+
+		var err error
+		period.from, err = parseClock(period.From, 0)
+		if err != nil {
+			return fmt.Errorf("invalid from of %s: %w", period.Name, err)
+		}
+
+		period.to, err = parseClock(period.To, 24*time.Hour)
+		if err != nil {
+			return fmt.Errorf("invalid to of %s: %w", period.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// parseClock parses a "15:04" time of the day to the duration since midnight, fallback if empty
+func parseClock(s string, fallback time.Duration) (time.Duration, error) {
+	if s == "" {
+		return fallback, nil
+	}
+
+	clock, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute, nil
+}
+
+// PriceAt returns the price of a kWh at t, in the wall clock of the location of t, and the name of the period applied,
+// empty outside of every period
+func (t *Tariff) PriceAt(at time.Time) (float64, string) {
+	// the wall clock, not the time since midnight, which is off on the days daylight saving changes
+	clock := time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute + time.Duration(at.Second())*time.Second
+
+	for _, period := range t.Periods {
+		if period.matches(at.Weekday(), clock) {
+			return period.Price, period.Name
+		}
+	}
+
+	return t.Price, ""
+}
+
+// boundaries returns the times in the wall clock of the day of midnight the periods start and end at, whether the
+// period applies on that day or not
+func (t *Tariff) boundaries(midnight time.Time) []time.Time {
+	var boundaries []time.Time
+	for _, period := range t.Periods {
+		for _, clock := range []time.Duration{period.from, period.to} {
+			if clock > 0 && clock < 24*time.Hour {
+				boundaries = append(boundaries, time.Date(midnight.Year(), midnight.Month(), midnight.Day(),
+					int(clock/time.Hour), int(clock%time.Hour/time.Minute), 0, 0, midnight.Location()))
+			}
+		}
+	}
+
+	return boundaries
+}
+
+func (p Period) matches(weekday time.Weekday, clock time.Duration) bool {
+	if p.from <= p.to {
+		return p.onDay(weekday) && clock >= p.from && clock < p.to
+	}
+
+	// spanning midnight, the part after midnight belongs to the period started the day before
+	if clock >= p.from {
+		return p.onDay(weekday)
+	}
+
+	return clock < p.to && p.onDay((weekday+6)%7)
+}
+
+func (p Period) onDay(weekday time.Weekday) bool {
+	return p.days == nil || p.days[weekday]
+}
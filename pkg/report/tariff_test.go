@@ -0,0 +1,98 @@
+package report
+
+import (
+	"testing"
+	"time"
+)
+
+func tariff(t *testing.T, price float64, periods ...Period) *Tariff {
+	t.Helper()
+
+	tariff := &Tariff{Currency: "EUR", Price: price, Periods: periods}
+	if err := tariff.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	return tariff
+}
+
+func TestPeriodMatches(t *testing.T) {
+	// 2026-03-06 is a friday
+	friday := time.Date(2026, time.March, 6, 0, 0, 0, 0, time.UTC)
+	tariff := tariff(t, 0.30,
+		Period{Name: "friday night", Days: []string{"fri"}, From: "22:00", To: "06:00", Price: 0.10},
+		Period{Name: "night", From: "23:00", To: "05:00", Price: 0.15},
+		Period{Name: "day", From: "08:00", To: "18:00", Price: 0.40},
+	)
+
+	for _, test := range []struct {
+		at     time.Time
+		period string
+	}{
+		{at: friday.Add(21*time.Hour + 59*time.Minute), period: ""},
+		{at: friday.Add(22 * time.Hour), period: "friday night"},
+		// the part after midnight belongs to the day the period started on
+		{at: friday.Add(26 * time.Hour), period: "friday night"},
+		{at: friday.Add(29*time.Hour + 59*time.Minute), period: "friday night"},
+		{at: friday.Add(30 * time.Hour), period: ""},
+		// friday morning follows a thursday night
+		{at: friday.Add(2 * time.Hour), period: "night"},
+		// saturday night is not a friday night
+		{at: friday.Add(46 * time.Hour), period: ""},
+		{at: friday.Add(47 * time.Hour), period: "night"},
+		{at: friday.Add(8 * time.Hour), period: "day"},
+		{at: friday.Add(18 * time.Hour), period: ""},
+	} {
+		if _, period := tariff.PriceAt(test.at); period != test.period {
+			t.Errorf("got period %q at %s, want %q", period, test.at.Format("Mon 15:04"), test.period)
+		}
+	}
+}
+
+func TestPriceAtOnDaylightSavingDays(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tariff := tariff(t, 0.30,
+		Period{Name: "off-peak", From: "22:00", To: "06:00", Price: 0.18},
+		Period{Name: "peak", From: "17:00", To: "20:00", Price: 0.45},
+	)
+
+	for _, test := range []struct {
+		name  string
+		at    time.Time
+		price float64
+	}{
+		// the clocks skip from 02:00 to 03:00, 06:30 is 5.5 h after midnight
+		{name: "spring forward", at: time.Date(2026, time.March, 29, 6, 30, 0, 0, berlin), price: 0.30},
+		{name: "spring forward", at: time.Date(2026, time.March, 29, 17, 30, 0, 0, berlin), price: 0.45},
+		// the clocks go back from 03:00 to 02:00, 05:30 is 6.5 h after midnight
+		{name: "fall back", at: time.Date(2026, time.October, 25, 5, 30, 0, 0, berlin), price: 0.18},
+		{name: "fall back", at: time.Date(2026, time.October, 25, 19, 30, 0, 0, berlin), price: 0.45},
+		{name: "fall back", at: time.Date(2026, time.October, 25, 20, 30, 0, 0, berlin), price: 0.30},
+	} {
+		if price, _ := tariff.PriceAt(test.at); price != test.price {
+			t.Errorf("%s: got %v at %s, want %v", test.name, price, test.at.Format("15:04 MST"), test.price)
+		}
+	}
+}
+
+func TestTariffValidate(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		tariff  Tariff
+		invalid bool
+	}{
+		{name: "flat", tariff: Tariff{Price: 0.30}},
+		{name: "negative price", tariff: Tariff{Price: -1}, invalid: true},
+		{name: "unknown day", tariff: Tariff{Periods: []Period{{Days: []string{"someday"}}}}, invalid: true},
+		{name: "invalid from", tariff: Tariff{Periods: []Period{{From: "25:00"}}}, invalid: true},
+		{name: "negative period price", tariff: Tariff{Periods: []Period{{Price: -0.1}}}, invalid: true},
+	} {
+		if err := test.tariff.validate(); (err != nil) != test.invalid {
+			t.Errorf("%s: got error %v, want an error %v", test.name, err, test.invalid)
+		}
+	}
+}
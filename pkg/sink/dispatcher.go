@@ -0,0 +1,313 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+
+	"k8s.io/klog/v2"
+)
+
+type DropPolicy int
+
+const (
+	// DropOldest drops the oldest buffered measurement to make room for a new one, the energy totals are cumulative so
+	// the latest measurement is the most valuable
+	DropOldest DropPolicy = iota
+	// DropNewest drops the new measurement when the buffer is full
+	DropNewest
+	// Block waits for room in the buffer, which holds up the dispatcher, and every other sink with it
+	Block
+)
+
+func (p DropPolicy) String() string {
+	var values []string = []string{"drop-oldest", "drop-newest", "block"}
+	if int(p) < 0 || int(p) >= len(values) {
+		return "unknown"
+	}
+
+	return values[p]
+}
+
+// ParseDropPolicy parses one of "drop-oldest", "drop-newest" or "block"
+func ParseDropPolicy(s string) (DropPolicy, error) {
+	for _, policy := range []DropPolicy{DropOldest, DropNewest, Block} {
+		if strings.EqualFold(strings.TrimSpace(s), policy.String()) {
+			return policy, nil
+		}
+	}
+
+	return DropOldest, fmt.Errorf("unknown drop policy %q, expected one of: drop-oldest, drop-newest, block", s)
+}
+
+// Options configure how a Dispatcher feeds a sink, the zero values fall back to the defaults
+type Options struct {
+	// Buffer is the number of measurements buffered for the sink, 64 by default
+	Buffer int
+	// Policy decides what happens to a measurement when the buffer is full
+	Policy DropPolicy
+	// FlushInterval is the time between two flushes of a Flusher, 10s by default
+	FlushInterval time.Duration
+}
+
+// Stats are the deliveries to a sink so far
+type Stats struct {
+	Name string
+	// Written is the number of measurements written
+	Written int
+	// Dropped is the number of measurements dropped because the buffer was full
+	Dropped int
+	// Errors is the number of failed writes, flushes and closes
+	Errors        int
+	LastError     string
+	LastErrorTime time.Time
+}
+
+type entry struct {
+	name    string
+	sink    Sink
+	options Options
+	queue   chan Measurement
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+// Dispatcher fans measurements out to sinks, each fed by its own goroutine from its own buffer
+type Dispatcher struct {
+	// OnError is called with the name of the sink for every failed write, flush or close, the error is logged if nil
+	OnError func(name string, err error)
+	// ShutdownTimeout limits draining the buffers, flushing and closing the sinks once the dispatcher stops, 10s by
+	// default
+	ShutdownTimeout time.Duration
+
+	mu      sync.Mutex
+	entries []*entry
+	started bool
+}
+
+// NewDispatcher creates a dispatcher without sinks
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{ShutdownTimeout: 10 * time.Second}
+}
+
+// Add adds a sink under name, which has to be unique. Sinks can only be added before Run
+func (d *Dispatcher) Add(name string, sink Sink, options Options) error {
+	if options.Buffer <= 0 {
+		options.Buffer = 64
+	}
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = 10 * time.Second
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.started {
+		return errors.New("sinks can not be added to a running dispatcher")
+	}
+
+	for _, e := range d.entries {
+		if e.name == name {
+			return fmt.Errorf("sink %q is added already", name)
+		}
+	}
+
+	d.entries = append(d.entries, &entry{
+		name:    name,
+		sink:    sink,
+		options: options,
+		queue:   make(chan Measurement, options.Buffer),
+		stats:   Stats{Name: name},
+	})
+
+	return nil
+}
+
+// Len returns the number of sinks
+func (d *Dispatcher) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return len(d.entries)
+}
+
+// Stats returns the deliveries to every sink, in the order they were added
+func (d *Dispatcher) Stats() []Stats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stats := make([]Stats, 0, len(d.entries))
+	for _, e := range d.entries {
+		e.mu.Lock()
+		stats = append(stats, e.stats)
+		e.mu.Unlock()
+	}
+
+	return stats
+}
+
+// Dispatch buffers a measurement for every sink, applying their drop policies. A blocking sink waits until ctx is done
+func (d *Dispatcher) Dispatch(ctx context.Context, measurement Measurement) {
+	d.mu.Lock()
+	entries := d.entries
+	d.mu.Unlock()
+
+	for _, e := range entries {
+		e.enqueue(ctx, measurement)
+	}
+}
+
+func (e *entry) enqueue(ctx context.Context, measurement Measurement) {
+	switch e.options.Policy {
+	case Block:
+		select {
+		case e.queue <- measurement:
+		case <-ctx.Done():
+			e.dropped(1)
+		}
+	case DropNewest:
+		select {
+		case e.queue <- measurement:
+		default:
+			e.dropped(1)
+		}
+	default:
+		for {
+			select {
+			case e.queue <- measurement:
+				return
+			default:
+			}
+
+			// the sink may take the oldest one meanwhile, then there is room without dropping
+			select {
+			case <-e.queue:
+				e.dropped(1)
+			default:
+			}
+		}
+	}
+}
+
+func (e *entry) dropped(n int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.stats.Dropped += n
+	klog.V(5).Infof("sink %s is not keeping up, dropped a measurement", e.name)
+}
+
+// Run feeds every sample to the sinks until samples is closed or ctx is done, e.g. with a blocking subscription of a
+// readers.Sampler, so that the samples are dropped by the policies of the sinks rather than before them, and a Block
+// policy holds up the sampler. The sinks are drained, flushed and closed then, within ShutdownTimeout
+func (d *Dispatcher) Run(ctx context.Context, samples <-chan readers.Sample, topology Topology) error {
+	d.mu.Lock()
+	d.started = true
+	entries := d.entries
+	d.mu.Unlock()
+
+	// the sinks keep running until their buffers are drained, the shutdown context bounds that once ctx is done
+	sinkCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, e := range entries {
+		wg.Add(1)
+		go func(e *entry) {
+			defer wg.Done()
+			d.feed(sinkCtx, e)
+		}(e)
+	}
+
+	err := d.dispatch(ctx, samples, &topology)
+
+	for _, e := range entries {
+		close(e.queue)
+	}
+
+	shutdownTimeout := d.ShutdownTimeout
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = 10 * time.Second
+	}
+	timer := time.AfterFunc(shutdownTimeout, cancel)
+	defer timer.Stop()
+
+	wg.Wait()
+
+	return err
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, samples <-chan readers.Sample, topology *Topology) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case sample, ok := <-samples:
+			if !ok {
+				return nil
+			}
+
+			d.Dispatch(ctx, Measurement{Sample: sample, Topology: topology})
+		}
+	}
+}
+
+// feed writes the buffered measurements to the sink until the buffer is closed and drained, and flushes a Flusher
+// every FlushInterval and before closing it
+func (d *Dispatcher) feed(ctx context.Context, e *entry) {
+	flusher, flushes := e.sink.(Flusher)
+
+	var ticks <-chan time.Time
+	if flushes {
+		ticker := time.NewTicker(e.options.FlushInterval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	for {
+		select {
+		case measurement, ok := <-e.queue:
+			if !ok {
+				if flushes {
+					d.report(e, flusher.Flush(ctx), false)
+				}
+				d.report(e, e.sink.Close(), false)
+				return
+			}
+
+			d.report(e, e.sink.Write(ctx, measurement), true)
+		case <-ticks:
+			d.report(e, flusher.Flush(ctx), false)
+		}
+	}
+}
+
+func (d *Dispatcher) report(e *entry, err error, write bool) {
+	e.mu.Lock()
+	if err == nil && write {
+		e.stats.Written++
+	}
+	if err != nil {
+		e.stats.Errors++
+		e.stats.LastError = err.Error()
+		e.stats.LastErrorTime = time.Now()
+	}
+	e.mu.Unlock()
+
+	if err == nil {
+		return
+	}
+
+	if d.OnError != nil {
+		d.OnError(e.name, err)
+		return
+	}
+
+	klog.Errorf("sink %s failed: %s", e.name, err)
+}
@@ -0,0 +1,117 @@
+package sink_test
+
+import (
+	"context"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+	"github.com/rekuberate-io/power/pkg/readers/readerstest"
+	"github.com/rekuberate-io/power/pkg/sink"
+)
+
+// recordingSink keeps the measurements written to it, taking delay for every write
+type recordingSink struct {
+	delay time.Duration
+
+	mu           sync.Mutex
+	measurements []sink.Measurement
+}
+
+func (s *recordingSink) Write(_ context.Context, measurement sink.Measurement) error {
+	time.Sleep(s.delay)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.measurements = append(s.measurements, measurement)
+
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	return nil
+}
+
+func (s *recordingSink) written() []sink.Measurement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]sink.Measurement(nil), s.measurements...)
+}
+
+func measurement(n int) sink.Measurement {
+	return sink.Measurement{Sample: readers.Sample{Totals: map[int64]readers.Energy{0: {Pkg: float64(n)}}}}
+}
+
+func TestDispatcherBlockHoldsUpSampler(t *testing.T) {
+	sampler := readers.NewSampler(readerstest.NewReader(map[int64]readers.Power{0: {Pkg: 10}}), time.Millisecond)
+
+	slow := &recordingSink{delay: 5 * time.Millisecond}
+	dispatcher := sink.NewDispatcher()
+	if err := dispatcher.Add("slow", slow, sink.Options{Buffer: 1, Policy: sink.Block}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	// the dispatcher stops once the sampler closes the subscription, not on ctx, so that it drops nothing either
+	done := make(chan error, 1)
+	samples := sampler.SubscribeBlocking(1)
+	go func() {
+		done <- dispatcher.Run(context.Background(), samples, sink.Topology{})
+	}()
+
+	sampler.Run(ctx)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	written := slow.written()
+	if len(written) < 2 {
+		t.Fatalf("got %d measurements written, want the sink to keep up at its pace", len(written))
+	}
+	for i := 1; i < len(written); i++ {
+		gap := written[i].Totals[0].Pkg - written[i-1].Totals[0].Pkg - written[i].Energy[0].Pkg
+		if math.Abs(gap) > 1e-9 {
+			t.Fatalf("measurement %d is %v J short of the previous one, a sample was dropped", i, gap)
+		}
+	}
+	if stats := dispatcher.Stats()[0]; stats.Dropped != 0 || stats.Written != len(written) {
+		t.Errorf("got stats %+v, want %d written and none dropped", stats, len(written))
+	}
+}
+
+func TestDispatcherDropPolicies(t *testing.T) {
+	for policy, want := range map[sink.DropPolicy]float64{sink.DropOldest: 5, sink.DropNewest: 1} {
+		t.Run(policy.String(), func(t *testing.T) {
+			recording := &recordingSink{}
+			dispatcher := sink.NewDispatcher()
+			if err := dispatcher.Add("recording", recording, sink.Options{Buffer: 1, Policy: policy}); err != nil {
+				t.Fatal(err)
+			}
+
+			// nothing takes from the buffer before Run
+			for n := 1; n <= 5; n++ {
+				dispatcher.Dispatch(context.Background(), measurement(n))
+			}
+
+			samples := make(chan readers.Sample)
+			close(samples)
+			if err := dispatcher.Run(context.Background(), samples, sink.Topology{}); err != nil {
+				t.Fatal(err)
+			}
+
+			written := recording.written()
+			if len(written) != 1 || written[0].Totals[0].Pkg != want {
+				t.Fatalf("got measurements %+v, want only measurement %v", written, want)
+			}
+			if stats := dispatcher.Stats()[0]; stats.Dropped != 4 || stats.Written != 1 {
+				t.Errorf("got stats %+v, want 1 written and 4 dropped", stats)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package sink
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config configures a sink created by a Factory
+type Config struct {
+	// Target is where the sink writes to, e.g. an url, an address or a path, its meaning is up to the sink
+	Target string
+	// Params are the further settings of the sink
+	Params   map[string]string
+	Topology Topology
+}
+
+// Param returns the param key, fallback if it is not set
+func (c Config) Param(key string, fallback string) string {
+	if value, exists := c.Params[key]; exists {
+		return value
+	}
+
+	return fallback
+}
+
+// Factory creates a sink
+type Factory func(config Config) (Sink, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a sink available by name, it is meant to be called from the init function of the package
+// implementing the sink. It panics if the name is registered already or the factory is nil
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if factory == nil {
+		panic("sink: Register factory is nil")
+	}
+	if _, exists := registry[name]; exists {
+		panic("sink: Register called twice for " + name)
+	}
+
+	registry[name] = factory
+}
+
+// Registered returns the names of the registered sinks, sorted
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// New creates a sink by the name it was registered with
+func New(name string, config Config) (Sink, error) {
+	registryMu.RLock()
+	factory, exists := registry[name]
+	registryMu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("unknown sink %q, expected one of: %s", name, strings.Join(Registered(), ", "))
+	}
+
+	if config.Params == nil {
+		config.Params = map[string]string{}
+	}
+
+	return factory(config)
+}
+
+// Spec names a sink with its config and the options of the dispatcher, parsed by ParseSpec
+type Spec struct {
+	Name    string
+	Config  Config
+	Options Options
+}
+
+// ParseSpec parses "name[:target][,key=value...]", e.g. "influx:http://localhost:8086/write?db=power,policy=block".
+// The params buffer, policy and flush set the Options, every other one is passed to the sink
+func ParseSpec(s string) (Spec, error) {
+	spec := Spec{Config: Config{Params: map[string]string{}}}
+
+	parts := strings.Split(strings.TrimSpace(s), ",")
+	spec.Name, spec.Config.Target, _ = strings.Cut(parts[0], ":")
+	if spec.Name == "" {
+		return spec, fmt.Errorf("sink %q has no name", s)
+	}
+
+	for _, part := range parts[1:] {
+		key, value, found := strings.Cut(part, "=")
+		if !found {
+			return spec, fmt.Errorf("invalid param %q of sink %s, expected key=value", part, spec.Name)
+		}
+
+		var err error
+		switch key {
+		case "buffer":
+			spec.Options.Buffer, err = strconv.Atoi(value)
+		case "policy":
+			spec.Options.Policy, err = ParseDropPolicy(value)
+		case "flush":
+			spec.Options.FlushInterval, err = time.ParseDuration(value)
+		default:
+			spec.Config.Params[key] = value
+		}
+
+		if err != nil {
+			return spec, fmt.Errorf("invalid %s of sink %s: %w", key, spec.Name, err)
+		}
+	}
+
+	return spec, nil
+}
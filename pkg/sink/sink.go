@@ -0,0 +1,54 @@
+// Package sink fans the samples of a readers.Sampler out to any number of exporters. A Sink consumes timestamped
+// measurements with the topology of the host, a Dispatcher feeds every sink from its own buffer, so that a slow or
+// failing sink neither holds up the others nor the sampler. Sinks are registered by name, like database/sql drivers,
+// so that external modules can add their own
+package sink
+
+import (
+	"context"
+
+	"github.com/rekuberate-io/power/pkg/readers"
+)
+
+// Topology describes the host the measurements are taken on
+type Topology struct {
+	Node string
+	// Reader is the strategy of the readers.RaplReader taking the measurements, see readers.StrategyName
+	Reader string
+	// Estimated is set when the energy is modeled instead of read from the rapl counters, see readers.IsEstimated
+	Estimated bool
+	Cpus      map[int]*readers.Cpu
+}
+
+// NewTopology describes the host of reader
+func NewTopology(node string, reader readers.RaplReader, cpus map[int]*readers.Cpu) Topology {
+	return Topology{
+		Node:      node,
+		Reader:    readers.StrategyName(reader),
+		Estimated: readers.IsEstimated(reader),
+		Cpus:      cpus,
+	}
+}
+
+// Measurement is a sample of a readers.Sampler with the topology of the host it was taken on
+type Measurement struct {
+	readers.Sample
+	Topology *Topology
+}
+
+// Supported returns the domains of every package whose counter was non-zero, see readers.SupportedDomains
+func (m Measurement) Supported() map[int64][]readers.Domain {
+	return readers.SupportedDomains(m.Counters)
+}
+
+// Sink consumes measurements. A Dispatcher calls Write from a single goroutine per sink, in the order the measurements
+// were taken, failed samples included, and Close once after the last one
+type Sink interface {
+	Write(ctx context.Context, measurement Measurement) error
+	Close() error
+}
+
+// Flusher is implemented by the sinks batching their writes, a Dispatcher flushes them periodically and before Close
+type Flusher interface {
+	Flush(ctx context.Context) error
+}